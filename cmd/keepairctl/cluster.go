@@ -0,0 +1,490 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"keepair/pkg/common"
+	"keepair/pkg/gossip"
+	"keepair/pkg/primary/antientropy"
+	"keepair/pkg/primary/node"
+	"keepair/pkg/raft"
+)
+
+// nodeInfo is a node as listed by the primary. node.Node is not
+// used as its health check error cannot be decoded.
+type nodeInfo struct {
+	Index        int              `json:"index"`
+	ID           string           `json:"id"`
+	Address      string           `json:"address"`
+	Status       node.Status      `json:"status"`
+	Cordoned     bool             `json:"cordoned"`
+	Stats        common.NodeStats `json:"stats"`
+	LeaseExpiry  time.Time        `json:"leaseExpiry"`
+	GossipState  gossip.State     `json:"gossipState,omitempty"`
+	LeaderOf     []int            `json:"leaderOf"`
+	FollowerOf   []int            `json:"followerOf"`
+	ReadRepairs  int              `json:"readRepairs"`
+	PendingHints int              `json:"pendingHints"`
+}
+
+func nodesCommand(c *ctl, args []string) error {
+	fs := flag.NewFlagSet("nodes", flag.ContinueOnError)
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	var res struct {
+		Nodes []nodeInfo `json:"nodes"`
+	}
+	if err := c.primaryJSON(http.MethodGet, "/nodes", &res); err != nil {
+		return err
+	}
+	sortByIndex(res.Nodes, func(n nodeInfo) int { return n.Index })
+
+	return c.print(res.Nodes, func(w io.Writer) {
+		row(w, "INDEX", "ID", "ADDRESS", "STATUS", "GOSSIP", "OBJECTS", "LEADER OF", "FOLLOWER OF", "HINTS", "READ REPAIRS", "LEASE EXPIRY")
+		for _, n := range res.Nodes {
+			lease := "-"
+			if !n.LeaseExpiry.IsZero() {
+				lease = time.Until(n.LeaseExpiry).Round(time.Millisecond).String()
+			}
+			status := string(n.Status)
+			if n.Cordoned {
+				status += ",cordoned"
+			}
+			row(w, n.Index, n.ID, n.Address, status, orDash(string(n.GossipState)), n.Stats.ObjectCount,
+				ints(n.LeaderOf), ints(n.FollowerOf), n.PendingHints, n.ReadRepairs, lease)
+		}
+	})
+}
+
+func removeNodeCommand(c *ctl, args []string) error {
+	fs := flag.NewFlagSet("remove-node", flag.ContinueOnError)
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	n, err := c.findNode(args[0])
+	if err != nil {
+		return err
+	}
+	if _, err := c.primary(http.MethodDelete, "/nodes/"+url.PathEscape(n.ID), nil); err != nil {
+		return err
+	}
+	return c.print(map[string]string{"id": n.ID, "result": "removed"}, func(w io.Writer) {
+		fmt.Fprintf(w, "removed %s\n", n.ID)
+	})
+}
+
+// nodeActionCommand posts an action on a worker node to the primary
+func nodeActionCommand(name, result string) func(c *ctl, args []string) error {
+	return func(c *ctl, args []string) error {
+		fs := flag.NewFlagSet(name, flag.ContinueOnError)
+		args, err := parseArgs(fs, args, 1, 1)
+		if err != nil {
+			return err
+		}
+
+		n, err := c.findNode(args[0])
+		if err != nil {
+			return err
+		}
+		if _, err := c.primary(http.MethodPost, "/nodes/"+url.PathEscape(n.ID)+"/"+name, nil); err != nil {
+			return err
+		}
+		return c.print(map[string]string{"id": n.ID, "result": result}, func(w io.Writer) {
+			fmt.Fprintf(w, "%s %s\n", result, n.ID)
+		})
+	}
+}
+
+func topologyCommand(c *ctl, args []string) error {
+	fs := flag.NewFlagSet("topology", flag.ContinueOnError)
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	var topology node.Topology
+	if err := c.primaryJSON(http.MethodGet, "/topology", &topology); err != nil {
+		return err
+	}
+	return c.print(topology, func(w io.Writer) {
+		fmt.Fprintf(w, "version %d, epoch %d, replication factor %d, mode %s\n\n",
+			topology.Version, topology.Epoch, topology.ReplicationFactor, topology.Mode)
+		row(w, "INDEX", "ID", "ADDRESS", "STATUS", "LEADER OF", "FOLLOWER OF")
+		for _, n := range topology.Nodes {
+			row(w, n.Index, n.ID, n.Address, n.Status, ints(n.LeaderOf), ints(n.FollowerOf))
+		}
+	})
+}
+
+// placementCommand fails if problems were found and not repaired,
+// so it can be used in scripts
+func placementCommand(c *ctl, args []string) error {
+	fs := flag.NewFlagSet("placement", flag.ContinueOnError)
+	repair := fs.Bool("repair", false, "copy keys to owners missing them and remove them from other nodes")
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	var report node.PlacementReport
+	var err error
+	if *repair {
+		err = c.primaryJSON(http.MethodPost, "/placement/repair", &report)
+	} else {
+		err = c.primaryJSON(http.MethodGet, "/placement", &report)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = c.print(report, func(w io.Writer) {
+		row(w, "INDEX", "ID", "ADDRESS", "OBJECTS", "MISPLACED")
+		for _, n := range report.Nodes {
+			row(w, n.Index, n.ID, n.Address, n.ObjectCount, n.Misplaced)
+		}
+		problems := []struct {
+			name string
+			keys []node.KeyPlacement
+		}{
+			{"misplaced", report.Misplaced},
+			{"duplicate", report.Duplicates},
+			{"under-replicated", report.UnderReplicated},
+		}
+		if len(report.Misplaced)+len(report.Duplicates)+len(report.UnderReplicated) > 0 {
+			fmt.Fprintln(w)
+			row(w, "PROBLEM", "KEY", "HOLDERS", "OWNERS")
+			for _, p := range problems {
+				for _, k := range p.keys {
+					row(w, p.name, k.Key, strings.Join(k.Holders, ","), strings.Join(k.Owners, ","))
+				}
+			}
+		}
+		if report.Repair != nil {
+			fmt.Fprintf(w, "\nrepaired: %d copied, %d deleted\n", report.Repair.Copied, report.Repair.Deleted)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if problems := len(report.Misplaced) + len(report.Duplicates) + len(report.UnderReplicated); !*repair && problems > 0 {
+		return fmt.Errorf("found %d placement problems", problems)
+	}
+	return nil
+}
+
+func syncCommand(c *ctl, args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "only compare the nodes")
+	args, err := parseArgs(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	source, err := c.findNode(args[0])
+	if err != nil {
+		return err
+	}
+	target, err := c.findNode(args[1])
+	if err != nil {
+		return err
+	}
+	query := url.Values{"source": {source.ID}, "target": {target.ID}}
+	if *dryRun {
+		query.Set("dryRun", "true")
+	}
+	var report antientropy.Report
+	if err := c.primaryJSON(http.MethodPost, "/sync?"+query.Encode(), &report); err != nil {
+		return err
+	}
+
+	return c.print(report, func(w io.Writer) {
+		fmt.Fprintf(w, "in sync: %t, differing buckets: %d, applied: %t\n", report.InSync, report.DifferingBuckets, report.Applied)
+		if len(report.Differences) > 0 {
+			fmt.Fprintln(w)
+			row(w, "KEY", "ACTION")
+			for _, d := range report.Differences {
+				row(w, d.Key, d.Action)
+			}
+		}
+	})
+}
+
+// planCommand prints what adding and removing nodes would move
+// between each pair of nodes, without moving anything
+func planCommand(c *ctl, args []string) error {
+	change, err := parseChange(c, "plan", args)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	res, err := c.primary(http.MethodPost, "/rebalance/plan", body)
+	if err != nil {
+		return err
+	}
+	var preview node.RebalancePreview
+	if err := json.Unmarshal(res, &preview); err != nil {
+		return err
+	}
+	return c.print(preview, func(w io.Writer) {
+		fmt.Fprintf(w, "epoch %d to %d, %d nodes to %d, %d keys (%d bytes) copied\n\n",
+			preview.FromEpoch, preview.ToEpoch, len(preview.From), len(preview.To), preview.Keys, preview.Bytes)
+		row(w, "SOURCE", "TARGET", "KEYS", "BYTES")
+		for _, m := range preview.Moves {
+			target := m.Target
+			if target == "" {
+				target = "(drop)"
+			}
+			row(w, m.Source, target, m.Keys, m.Bytes)
+		}
+	})
+}
+
+// applyCommand adds and removes nodes with a single migration
+func applyCommand(c *ctl, args []string) error {
+	change, err := parseChange(c, "apply", args)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	if _, err := c.primary(http.MethodPost, "/rebalance/apply", body); err != nil {
+		return err
+	}
+	return c.print(change, func(w io.Writer) {
+		fmt.Fprintf(w, "added %d and removed %d nodes\n", len(change.Add), len(change.Remove))
+	})
+}
+
+// parseChange reads the nodes to add and remove from the flags
+func parseChange(c *ctl, name string, args []string) (node.MembershipChange, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	var add, remove listFlag
+	fs.Var(&add, "add", "node to add as id@address, can be repeated")
+	fs.Var(&remove, "remove", "node to remove, can be repeated")
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return node.MembershipChange{}, err
+	}
+
+	var change node.MembershipChange
+	for _, a := range add {
+		ID, address, ok := strings.Cut(a, "@")
+		if !ok {
+			return change, fmt.Errorf("%w: node to add is not id@address: %s", errUsage, a)
+		}
+		change.Add = append(change.Add, node.Node{ID: ID, Address: address})
+	}
+	for _, r := range remove {
+		n, err := c.findNode(r)
+		if err != nil {
+			return change, err
+		}
+		change.Remove = append(change.Remove, n.ID)
+	}
+	if len(change.Add)+len(change.Remove) == 0 {
+		return change, fmt.Errorf("%w: no node to add or remove", errUsage)
+	}
+	return change, nil
+}
+
+// migrationNodes names the node a migration adds or removes,
+// or all of them for a migration changing several
+func migrationNodes(nodeID string, added, removed []string) string {
+	if nodeID != "" {
+		return nodeID
+	}
+	names := make([]string, 0, len(added)+len(removed))
+	for _, ID := range added {
+		names = append(names, "+"+ID)
+	}
+	for _, ID := range removed {
+		names = append(names, "-"+ID)
+	}
+	return strings.Join(names, " ")
+}
+
+// rebalanceCommand prints the migration in progress,
+// or resumes or rolls it back
+func rebalanceCommand(c *ctl, args []string) error {
+	fs := flag.NewFlagSet("rebalance", flag.ContinueOnError)
+	args, err := parseArgs(fs, args, 0, 1)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 1 && args[0] == "status" {
+		return rebalanceStatus(c)
+	}
+	if len(args) == 1 {
+		if args[0] != "resume" && args[0] != "rollback" && args[0] != "cancel" {
+			return fmt.Errorf("%w: unknown action: %s", errUsage, args[0])
+		}
+		if _, err := c.primary(http.MethodPost, "/rebalance/"+args[0], nil); err != nil {
+			return err
+		}
+		return c.print(map[string]string{"action": args[0], "result": "ok"}, func(w io.Writer) {
+			fmt.Fprintln(w, "ok")
+		})
+	}
+
+	var plan node.MigrationPlan
+	if err := c.primaryJSON(http.MethodGet, "/rebalance/migration", &plan); err != nil {
+		var statusErr *statusError
+		if errors.As(err, &statusErr) && statusErr.statusCode == http.StatusNotFound {
+			return c.print(nil, func(w io.Writer) {
+				fmt.Fprintln(w, "no migration in progress")
+			})
+		}
+		return err
+	}
+	return c.print(plan, func(w io.Writer) {
+		fmt.Fprintf(w, "migration %s: %s %s, epoch %d to %d\n", plan.ID, plan.Operation, migrationNodes(plan.NodeID, plan.Added, plan.Removed), plan.FromEpoch, plan.ToEpoch)
+		if plan.Error != "" {
+			fmt.Fprintf(w, "error: %s\n", plan.Error)
+		}
+		fmt.Fprintln(w)
+		row(w, "STEP", "NODE", "DONE", "KEYS", "BYTES", "BYTES/S")
+		for _, step := range plan.Steps {
+			if len(step.Transfers) == 0 {
+				row(w, step.Kind, orDash(step.NodeID), step.Done, "-", "-", "-")
+			}
+			for _, tr := range step.Transfers {
+				target := tr.Target
+				if target == "" {
+					target = tr.Source
+				} else {
+					target = tr.Source + " > " + target
+				}
+				row(w, step.Kind, target, step.Done, tr.Keys, tr.Bytes, fmt.Sprintf("%.0f", tr.BytesPerSecond))
+			}
+		}
+	})
+}
+
+// rebalanceStatus prints what the migration in progress moved so
+// far and what remains to move
+func rebalanceStatus(c *ctl) error {
+	var status node.RebalanceStatus
+	if err := c.primaryJSON(http.MethodGet, "/rebalance/status", &status); err != nil {
+		var statusErr *statusError
+		if errors.As(err, &statusErr) && statusErr.statusCode == http.StatusNotFound {
+			return c.print(nil, func(w io.Writer) {
+				fmt.Fprintln(w, "no migration in progress")
+			})
+		}
+		return err
+	}
+	return c.print(status, func(w io.Writer) {
+		state := "stopped"
+		if status.Canceling {
+			state = "canceling"
+		} else if status.Running {
+			state = "running"
+		} else if status.Canceled {
+			state = "canceled"
+		}
+		fmt.Fprintf(w, "migration %s: %s %s, %s at %s step\n", status.ID, status.Operation, migrationNodes(status.NodeID, status.Added, status.Removed), state, status.Phase)
+		if status.Error != "" {
+			fmt.Fprintf(w, "error: %s\n", status.Error)
+		}
+		fmt.Fprintf(w, "%d keys (%d bytes) copied, %d keys (%d bytes) remaining, eta %s\n\n",
+			status.MovedKeys, status.MovedBytes, status.RemainingKeys, status.RemainingBytes, status.ETA.Round(time.Second))
+		row(w, "SOURCE", "TARGET", "MOVED", "REMAINING", "BYTES/S", "ETA")
+		for _, ts := range status.Transfers {
+			target := ts.Target
+			if target == "" {
+				target = "(drop)"
+			}
+			row(w, ts.Source, target, ts.MovedKeys, ts.RemainingKeys, fmt.Sprintf("%.0f", ts.BytesPerSecond), ts.ETA.Round(time.Second))
+		}
+	})
+}
+
+func raftCommand(c *ctl, args []string) error {
+	fs := flag.NewFlagSet("raft", flag.ContinueOnError)
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	var status raft.Status
+	if err := c.primaryJSON(http.MethodGet, "/raft/status", &status); err != nil {
+		var statusErr *statusError
+		if errors.As(err, &statusErr) && statusErr.statusCode == http.StatusNotFound {
+			return errors.New("raft is not enabled on the primary")
+		}
+		return err
+	}
+	return c.print(status, func(w io.Writer) {
+		row(w, "ID", "ROLE", "TERM", "LEADER", "COMMIT", "APPLIED", "LAST", "SNAPSHOT")
+		row(w, status.ID, status.Role, status.Term, orDash(status.LeaderID), status.CommitIndex,
+			status.LastApplied, status.LastIndex, status.SnapshotIndex)
+	})
+}
+
+// watchCommand prints change events until the stream ends. With
+// table output the cursor is printed so a watch can be resumed.
+func watchCommand(c *ctl, args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	prefix := fs.String("prefix", "", "only watch keys with this prefix")
+	since := fs.String("since", "", "cursor to resume watching from")
+	includeRebalance := fs.Bool("include-rebalance", false, "include changes made by rebalances")
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	query := url.Values{"prefix": {*prefix}, "since": {*since}}
+	if *includeRebalance {
+		query.Set("includeRebalance", "true")
+	}
+	res, err := http.Get(strings.TrimSuffix(c.primaryURLs[0], "/") + "/watch?" + query.Encode())
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		body, _ := io.ReadAll(res.Body)
+		return &statusError{statusCode: res.StatusCode, body: strings.TrimSpace(string(body))}
+	}
+
+	enc := json.NewEncoder(c.out)
+	cursor := ""
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "id:"):
+			cursor = strings.TrimSpace(strings.TrimPrefix(line, "id:"))
+		case strings.HasPrefix(line, "data:"):
+			var event common.ChangeEvent
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), &event); err != nil {
+				return fmt.Errorf("failed to decode event: %w", err)
+			}
+			if c.output == jsonOutput {
+				if err := enc.Encode(event); err != nil {
+					return err
+				}
+				continue
+			}
+			fmt.Fprintf(c.out, "%s\t%s\t%s\t%s\n", event.Time.Format(time.RFC3339), event.Action, event.Key, cursor)
+		}
+	}
+	return scanner.Err()
+}
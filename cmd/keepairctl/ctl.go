@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"keepair/pkg/primary/node"
+)
+
+const (
+	tableOutput = "table"
+	jsonOutput  = "json"
+)
+
+// ctl holds what every command needs to reach the cluster
+// and print its answers
+type ctl struct {
+	primaryURLs []string
+	output      string
+	out         io.Writer
+	client      *http.Client
+}
+
+func newCtl(primaryURLs []string, output string, out io.Writer) *ctl {
+	return &ctl{
+		primaryURLs: primaryURLs,
+		output:      output,
+		out:         out,
+		client:      &http.Client{Timeout: time.Minute * 5},
+	}
+}
+
+// primary sends a request to the first primary that answers
+func (c *ctl) primary(method, path string, body []byte) ([]byte, error) {
+	var err error
+	for _, primaryURL := range c.primaryURLs {
+		var resBody []byte
+		resBody, err = c.request(method, strings.TrimSuffix(primaryURL, "/")+path, body)
+		var statusErr *statusError
+		if err == nil || errors.As(err, &statusErr) {
+			return resBody, err
+		}
+	}
+	return nil, err
+}
+
+type statusError struct {
+	statusCode int
+	body       string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.statusCode, e.body)
+}
+
+func (c *ctl) request(method, URL string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, &statusError{statusCode: res.StatusCode, body: strings.TrimSpace(string(resBody))}
+	}
+	return resBody, nil
+}
+
+func (c *ctl) primaryJSON(method, path string, v any) error {
+	body, err := c.primary(method, path, nil)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+func (c *ctl) workerJSON(workerURL, path string, v any) error {
+	body, err := c.request(http.MethodGet, workerURL+path, nil)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+// workerURL resolves a worker given by URL, ID or index
+func (c *ctl) workerURL(worker string) (string, error) {
+	if strings.HasPrefix(worker, "http://") || strings.HasPrefix(worker, "https://") {
+		return strings.TrimSuffix(worker, "/"), nil
+	}
+	n, err := c.findNode(worker)
+	if err != nil {
+		return "", err
+	}
+	return n.URL(), nil
+}
+
+// findNode looks up a node of the topology by ID or index
+func (c *ctl) findNode(worker string) (node.TopologyNode, error) {
+	var topology node.Topology
+	if err := c.primaryJSON(http.MethodGet, "/topology", &topology); err != nil {
+		return node.TopologyNode{}, err
+	}
+	for _, n := range topology.Nodes {
+		if n.ID == worker || strconv.Itoa(n.Index) == worker {
+			return n, nil
+		}
+	}
+	return node.TopologyNode{}, fmt.Errorf("failed to find node: %s", worker)
+}
+
+// print writes v as JSON, or as a table written by table
+func (c *ctl) print(v any, table func(w io.Writer)) error {
+	if c.output == jsonOutput {
+		enc := json.NewEncoder(c.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	w := newTable(c.out)
+	table(w)
+	return w.Flush()
+}
+
+func newTable(out io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+}
+
+// row writes the tab separated columns of a table row
+func row(w io.Writer, columns ...any) {
+	for i, column := range columns {
+		if i > 0 {
+			fmt.Fprint(w, "\t")
+		}
+		fmt.Fprint(w, column)
+	}
+	fmt.Fprintln(w)
+}
+
+// errUsage is returned for a command given the wrong arguments
+var errUsage = errors.New("invalid arguments")
+
+// parseArgs parses flags wherever they are among the positional
+// arguments, which it returns, and checks their number
+func parseArgs(fs *flag.FlagSet, args []string, minArgs, maxArgs int) ([]string, error) {
+	fs.SetOutput(io.Discard)
+	positional := make([]string, 0)
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, fmt.Errorf("%w: %s", errUsage, err)
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(positional) < minArgs || len(positional) > maxArgs {
+		return nil, fmt.Errorf("%w: wrong number of arguments", errUsage)
+	}
+	return positional, nil
+}
+
+// listFlag collects the values of a flag given several times
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func keyPath(key string) string {
+	return "/keys/" + url.PathEscape(key)
+}
+
+func ints(values []int) string {
+	if len(values) == 0 {
+		return "-"
+	}
+	s := make([]string, 0, len(values))
+	for _, v := range values {
+		s = append(s, strconv.Itoa(v))
+	}
+	return strings.Join(s, ",")
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func sortByIndex[T any](items []T, index func(T) int) {
+	sort.Slice(items, func(i, j int) bool { return index(items[i]) < index(items[j]) })
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+func getCommand(c *ctl, args []string) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	value, err := c.primary(http.MethodGet, keyPath(args[0]), nil)
+	if err != nil {
+		return err
+	}
+	if c.output == jsonOutput {
+		return c.print(map[string]string{"key": args[0], "value": string(value)}, nil)
+	}
+	_, err = c.out.Write(append(value, '\n'))
+	return err
+}
+
+func setCommand(c *ctl, args []string) error {
+	return writeKey(c, "set", http.MethodPost, args)
+}
+
+func patchCommand(c *ctl, args []string) error {
+	return writeKey(c, "patch", http.MethodPatch, args)
+}
+
+// writeKey sends the value of a key taken from the arguments, from
+// the file given with -f, or from stdin if there is neither or the
+// value is "-"
+func writeKey(c *ctl, name, method string, args []string) error {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	file := fs.String("f", "", "file to read the value from")
+	args, err := parseArgs(fs, args, 1, 2)
+	if err != nil {
+		return err
+	}
+
+	var value []byte
+	switch {
+	case len(args) == 2 && *file != "":
+		return fmt.Errorf("%w: both a value and a file were given", errUsage)
+	case len(args) == 2 && args[1] != "-":
+		value = []byte(args[1])
+	case *file != "":
+		value, err = os.ReadFile(*file)
+	default:
+		value, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.primary(method, keyPath(args[0]), value); err != nil {
+		return err
+	}
+	return c.print(map[string]string{"key": args[0], "result": "ok"}, func(w io.Writer) {
+		fmt.Fprintln(w, "ok")
+	})
+}
+
+func deleteCommand(c *ctl, args []string) error {
+	fs := flag.NewFlagSet("delete", flag.ContinueOnError)
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.primary(http.MethodDelete, keyPath(args[0]), nil); err != nil {
+		return err
+	}
+	return c.print(map[string]string{"key": args[0], "result": "deleted"}, func(w io.Writer) {
+		fmt.Fprintln(w, "deleted")
+	})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"keepair/pkg/common"
+)
+
+type command struct {
+	usage       string
+	description string
+	run         func(ctl *ctl, args []string) error
+}
+
+var commands = map[string]command{
+	"get":         {"get <key>", "print the value of a key", getCommand},
+	"set":         {"set <key> [value] [-f file]", "set a key from an argument, a file or stdin", setCommand},
+	"patch":       {"patch <key> [patch] [-f file]", "apply a JSON merge patch to a key", patchCommand},
+	"delete":      {"delete <key>", "delete a key", deleteCommand},
+	"nodes":       {"nodes", "list the worker nodes with their stats", nodesCommand},
+	"remove-node": {"remove-node <node>", "remove a worker node and rebalance its keys", removeNodeCommand},
+	"cordon":      {"cordon <node>", "stop adding or removing other nodes while a node is cordoned", nodeActionCommand("cordon", "cordoned")},
+	"uncordon":    {"uncordon <node>", "let nodes be added and removed again", nodeActionCommand("uncordon", "uncordoned")},
+	"drain":       {"drain <node>", "move the keys of a worker node away and remove it", nodeActionCommand("drain", "drained")},
+	"topology":    {"topology", "print the partition topology", topologyCommand},
+	"placement":   {"placement [-repair]", "check that every key sits on the nodes the partitioner expects", placementCommand},
+	"sync":        {"sync <source> <target> [-dry-run]", "make the data of target match source", syncCommand},
+	"plan":        {"plan [-add id@addr] [-remove node]", "print what adding and removing nodes would move", planCommand},
+	"apply":       {"apply [-add id@addr] [-remove node]", "add and remove nodes with a single rebalance", applyCommand},
+	"rebalance":   {"rebalance [action]", "print the migration in progress, or status, resume, rollback or cancel it", rebalanceCommand},
+	"raft":        {"raft", "print the raft status of the primary", raftCommand},
+	"watch":       {"watch [-prefix p] [-since cursor]", "print changes to keys as they happen", watchCommand},
+	"dump":        {"dump <worker>", "print every entry held by a worker", dumpCommand},
+	"stats":       {"stats <worker>", "print the stats of a worker", statsCommand},
+	"entry":       {"entry <worker> <key>", "print the entry of a key held by a worker", entryCommand},
+	"assignment":  {"assignment <worker>", "print the partition assignment a worker holds", assignmentCommand},
+	"queues":      {"queues <worker> [queue] [-discard]", "print the queued operations of a worker, or discard a queue", queuesCommand},
+	"members":     {"members <worker>", "print the gossip members a worker sees", membersCommand},
+}
+
+// keepairctl operates a cluster through the endpoints of the primary
+// and the workers. Workers are given by ID, index or URL.
+func main() {
+
+	flags := flag.NewFlagSet("keepairctl", flag.ExitOnError)
+	primaryURL := flags.String("primary", common.GetEnvOrDefault("MASTER_NODE_URL", "http://0.0.0.0:9000"),
+		"URL of the primary, comma-separated for several (env MASTER_NODE_URL)")
+	output := flags.String("o", tableOutput, "output format: table or json")
+	flags.Usage = func() { usage(flags) }
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		os.Exit(2)
+	}
+
+	if *output != tableOutput && *output != jsonOutput {
+		fmt.Fprintf(os.Stderr, "unknown output format: %s\n", *output)
+		os.Exit(2)
+	}
+	if flags.NArg() == 0 {
+		usage(flags)
+		os.Exit(2)
+	}
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n", flags.Arg(0))
+		usage(flags)
+		os.Exit(2)
+	}
+
+	c := newCtl(strings.Split(*primaryURL, ","), *output, os.Stdout)
+	if err := cmd.run(c, flags.Args()[1:]); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(os.Stderr, "%s\nusage: keepairctl %s\n", err, cmd.usage)
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage(flags *flag.FlagSet) {
+	fmt.Fprintf(os.Stderr, "usage: keepairctl [flags] <command> [args]\n\ncommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-36s %s\n", commands[name].usage, commands[name].description)
+	}
+	fmt.Fprintf(os.Stderr, "\nflags:\n")
+	flags.PrintDefaults()
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"keepair/pkg/common"
+	"keepair/pkg/gossip"
+	"keepair/pkg/partition"
+	"keepair/pkg/primary/clients"
+)
+
+// dumpCommand prints the entries of a worker as they are streamed,
+// one JSON object per line with JSON output
+func dumpCommand(c *ctl, args []string) error {
+	fs := flag.NewFlagSet("dump", flag.ContinueOnError)
+	withValues := fs.Bool("values", false, "print values in the table")
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	workerURL, err := c.workerURL(args[0])
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(c.out)
+	w := newTable(c.out)
+	if c.output == tableOutput {
+		if *withValues {
+			row(w, "KEY", "TYPE", "TIMESTAMP", "SIZE", "VALUE")
+		} else {
+			row(w, "KEY", "TYPE", "TIMESTAMP", "SIZE")
+		}
+	}
+
+	entryChan, errChan := clients.NewWorkerClient(workerURL).StreamEntries()
+	for {
+		select {
+		case err := <-errChan:
+			if err != nil {
+				return err
+			}
+			if c.output == tableOutput {
+				return w.Flush()
+			}
+			return nil
+		case entry := <-entryChan:
+			if c.output == jsonOutput {
+				if err := enc.Encode(entry); err != nil {
+					return err
+				}
+				continue
+			}
+			ts := time.Unix(0, entry.Timestamp).Format(time.RFC3339Nano)
+			if *withValues {
+				row(w, entry.Key, orDash(string(entry.Type)), ts, len(entry.Value), strconv.Quote(string(entry.Value)))
+			} else {
+				row(w, entry.Key, orDash(string(entry.Type)), ts, len(entry.Value))
+			}
+		}
+	}
+}
+
+func statsCommand(c *ctl, args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	workerURL, err := c.workerURL(args[0])
+	if err != nil {
+		return err
+	}
+	var res struct {
+		Stats common.NodeStats `json:"stats"`
+	}
+	if err := c.workerJSON(workerURL, "/stats", &res); err != nil {
+		return err
+	}
+	return c.print(res.Stats, func(w io.Writer) {
+		row(w, "WORKER", "OBJECTS")
+		row(w, workerURL, res.Stats.ObjectCount)
+	})
+}
+
+func entryCommand(c *ctl, args []string) error {
+	fs := flag.NewFlagSet("entry", flag.ContinueOnError)
+	args, err := parseArgs(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	workerURL, err := c.workerURL(args[0])
+	if err != nil {
+		return err
+	}
+	var entry common.Entry
+	if err := c.workerJSON(workerURL, "/entries/"+url.PathEscape(args[1]), &entry); err != nil {
+		return err
+	}
+	return c.print(entry, func(w io.Writer) {
+		row(w, "KEY", "TYPE", "TIMESTAMP", "VALUE")
+		row(w, entry.Key, orDash(string(entry.Type)), time.Unix(0, entry.Timestamp).Format(time.RFC3339Nano), strconv.Quote(string(entry.Value)))
+	})
+}
+
+func assignmentCommand(c *ctl, args []string) error {
+	fs := flag.NewFlagSet("assignment", flag.ContinueOnError)
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	workerURL, err := c.workerURL(args[0])
+	if err != nil {
+		return err
+	}
+	var assignment partition.Assignment
+	if err := c.workerJSON(workerURL, "/assignment", &assignment); err != nil {
+		return err
+	}
+	return c.print(assignment, func(w io.Writer) {
+		row(w, "EPOCH", "REPLICATION FACTOR", "NODES")
+		for a := &assignment; a != nil; a = a.Next {
+			IDs := make([]string, 0, len(a.Nodes))
+			for _, n := range a.Nodes {
+				IDs = append(IDs, n.ID)
+			}
+			row(w, a.Epoch, a.ReplicationFactor, orDash(strings.Join(IDs, ",")))
+		}
+	})
+}
+
+func membersCommand(c *ctl, args []string) error {
+	fs := flag.NewFlagSet("members", flag.ContinueOnError)
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	workerURL, err := c.workerURL(args[0])
+	if err != nil {
+		return err
+	}
+	var res struct {
+		Members []gossip.Member `json:"members"`
+	}
+	if err := c.workerJSON(workerURL, "/gossip/members", &res); err != nil {
+		return err
+	}
+	sort.Slice(res.Members, func(i, j int) bool { return res.Members[i].ID < res.Members[j].ID })
+	return c.print(res.Members, func(w io.Writer) {
+		row(w, "ID", "ADDRESS", "STATE", "INCARNATION")
+		for _, m := range res.Members {
+			row(w, m.ID, m.Address, m.State, m.Incarnation)
+		}
+	})
+}
+
+func queuesCommand(c *ctl, args []string) error {
+	fs := flag.NewFlagSet("queues", flag.ContinueOnError)
+	discard := fs.Bool("discard", false, "drop the queue without applying it")
+	args, err := parseArgs(fs, args, 1, 2)
+	if err != nil {
+		return err
+	}
+	if *discard && len(args) < 2 {
+		return fmt.Errorf("-discard needs a queue")
+	}
+
+	workerURL, err := c.workerURL(args[0])
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		var queues []common.OperationQueue
+		if err := c.workerJSON(workerURL, "/operation-queues", &queues); err != nil {
+			return err
+		}
+		return c.print(queues, func(w io.Writer) {
+			row(w, "QUEUE", "PENDING", "BYTES", "BATCHES", "APPLIED", "UPDATED")
+			for _, q := range queues {
+				row(w, q.ID, q.Pending, q.Bytes, q.Batches, q.Applied, q.UpdatedAt.Format(time.RFC3339))
+			}
+		})
+	}
+
+	path := "/operation-queues/" + url.PathEscape(args[1])
+	if *discard {
+		if _, err := c.request(http.MethodDelete, workerURL+path, nil); err != nil {
+			return err
+		}
+		return c.print(map[string]string{"id": args[1], "result": "discarded"}, func(w io.Writer) {
+			fmt.Fprintf(w, "discarded %s\n", args[1])
+		})
+	}
+	var queue common.OperationQueue
+	if err := c.workerJSON(workerURL, path, &queue); err != nil {
+		return err
+	}
+	return c.print(queue, func(w io.Writer) {
+		row(w, "ACTION", "KEY", "TYPE", "BYTES")
+		for _, op := range queue.Operations {
+			row(w, op.Action, op.Entry.Key, orDash(string(op.Entry.Type)), len(op.Entry.Value))
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"keepair/pkg/common"
+)
+
+// checks that every key is held by the workers the partitioner maps
+// it to, and repairs misplaced keys if REPAIR is "true"
+func main() {
+
+	masterNodeURL := common.MustGetEnv("MASTER_NODE_URL")
+	repair := common.GetEnvOrDefault("REPAIR", "") == "true"
+
+	var res *http.Response
+	var err error
+	if repair {
+		res, err = http.Post(masterNodeURL+"/placement/repair", "", nil)
+	} else {
+		res, err = http.Get(masterNodeURL + "/placement")
+	}
+	if err != nil {
+		panic(err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		panic(err)
+	}
+	if res.StatusCode != 200 {
+		panic(fmt.Errorf("placement check failed: %s", body))
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, body, "", "  "); err != nil {
+		panic(err)
+	}
+	fmt.Println(out.String())
+
+	var report struct {
+		Misplaced       []any `json:"misplaced"`
+		Duplicates      []any `json:"duplicates"`
+		UnderReplicated []any `json:"underReplicated"`
+	}
+	if err := json.Unmarshal(body, &report); err != nil {
+		panic(err)
+	}
+	// exit non-zero if problems were found and not repaired
+	if !repair && len(report.Misplaced)+len(report.Duplicates)+len(report.UnderReplicated) > 0 {
+		os.Exit(1)
+	}
+}
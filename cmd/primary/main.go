@@ -2,16 +2,128 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"keepair/pkg/common"
 	"keepair/pkg/primary"
+	"keepair/pkg/primary/node"
 )
 
 func main() {
 
 	port := common.MustGetEnv("PORT")
 
-	service := primary.NewService()
+	config := primary.DefaultConfig()
+	if replicationFactor := common.GetEnvOrDefault("REPLICATION_FACTOR", ""); replicationFactor != "" {
+		n, err := strconv.Atoi(replicationFactor)
+		if err != nil {
+			panic(err)
+		}
+		config.Node.ReplicationFactor = n
+	}
+
+	if mode := common.GetEnvOrDefault("REPLICATION_MODE", ""); mode != "" {
+		config.Node.Mode = node.ReplicationMode(mode)
+		if config.Node.Mode != node.PrimaryBackupMode && config.Node.Mode != node.LeaderlessMode {
+			panic(fmt.Errorf("invalid replication mode: %s", mode))
+		}
+	}
+
+	if leaseDuration := common.GetEnvOrDefault("LEASE_DURATION", ""); leaseDuration != "" {
+		d, err := time.ParseDuration(leaseDuration)
+		if err != nil {
+			panic(err)
+		}
+		config.Node.LeaseDuration = d
+	}
+	if interval := common.GetEnvOrDefault("HEALTH_CHECK_INTERVAL", ""); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			panic(err)
+		}
+		config.Node.HealthCheckInterval = d
+	}
+	if suspectAfter := common.GetEnvOrDefault("SUSPECT_AFTER", ""); suspectAfter != "" {
+		n, err := strconv.Atoi(suspectAfter)
+		if err != nil {
+			panic(err)
+		}
+		config.Node.SuspectAfter = n
+	}
+	if deadAfter := common.GetEnvOrDefault("DEAD_AFTER", ""); deadAfter != "" {
+		n, err := strconv.Atoi(deadAfter)
+		if err != nil {
+			panic(err)
+		}
+		config.Node.DeadAfter = n
+	}
+
+	config.Node.Hints.Dir = common.GetEnvOrDefault("HINTS_DIR", config.Node.Hints.Dir)
+	if maxHints := common.GetEnvOrDefault("HINTS_MAX", ""); maxHints != "" {
+		n, err := strconv.Atoi(maxHints)
+		if err != nil {
+			panic(err)
+		}
+		config.Node.Hints.MaxHints = n
+	}
+	if maxAge := common.GetEnvOrDefault("HINTS_MAX_AGE", ""); maxAge != "" {
+		d, err := time.ParseDuration(maxAge)
+		if err != nil {
+			panic(err)
+		}
+		config.Node.Hints.MaxAge = d
+	}
+
+	if window := common.GetEnvOrDefault("REGISTRATION_WINDOW", ""); window != "" {
+		d, err := time.ParseDuration(window)
+		if err != nil {
+			panic(err)
+		}
+		config.Node.RegistrationWindow = d
+	}
+
+	config.Node.StateFile = common.GetEnvOrDefault("STATE_FILE", config.Node.StateFile)
+
+	if batchSize := common.GetEnvOrDefault("TRANSFER_BATCH_SIZE", ""); batchSize != "" {
+		n, err := strconv.Atoi(batchSize)
+		if err != nil {
+			panic(err)
+		}
+		config.Node.TransferBatchSize = n
+	}
+	if keysPerSecond := common.GetEnvOrDefault("MIGRATION_KEYS_PER_SECOND", ""); keysPerSecond != "" {
+		n, err := strconv.Atoi(keysPerSecond)
+		if err != nil {
+			panic(err)
+		}
+		config.Node.MigrationKeysPerSecond = n
+	}
+	if bytesPerSecond := common.GetEnvOrDefault("MIGRATION_BYTES_PER_SECOND", ""); bytesPerSecond != "" {
+		n, err := strconv.ParseInt(bytesPerSecond, 10, 64)
+		if err != nil {
+			panic(err)
+		}
+		config.Node.MigrationBytesPerSecond = n
+	}
+
+	// RAFT_PEERS lists every primary as id=url, including this one
+	if raftID := common.GetEnvOrDefault("RAFT_ID", ""); raftID != "" {
+		config.Raft.ID = raftID
+		config.Raft.Peers = make(map[string]string)
+		for _, peer := range strings.Split(common.MustGetEnv("RAFT_PEERS"), ",") {
+			peerID, peerURL, ok := strings.Cut(peer, "=")
+			if !ok {
+				panic(fmt.Errorf("invalid raft peer: %s", peer))
+			}
+			config.Raft.Peers[peerID] = peerURL
+		}
+		config.Raft.Dir = common.GetEnvOrDefault("RAFT_DIR", config.Raft.Dir)
+	}
+
+	service := primary.NewServiceWithConfig(config)
 
 	if err := service.Run(context.Background(), port); err != nil {
 		panic(err)
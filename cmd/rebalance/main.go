@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -63,13 +64,18 @@ func main() {
 	duration := time.Now().Sub(started).Milliseconds()
 	log.BigPrintf("done seeding in %dms", duration)
 
+	// preview what adding the second worker moves
+	worker1 := worker.NewService(masterNodeURL)
+	printPlan(masterNodeURL, node.MembershipChange{
+		Add: []node.Node{{ID: worker1.GetID(), Address: "127.0.0.1:9002"}},
+	})
+
 	log.BigPrintf("adding worker (1)...")
 
 	// start second worker node to trigger rebalance
 	go func() {
 		workerPort := "9002"
-		service := worker.NewService(masterNodeURL)
-		if err := service.Run(ctx, workerPort); err != nil {
+		if err := worker1.Run(ctx, workerPort); err != nil {
 			panic(err)
 		}
 	}()
@@ -78,6 +84,8 @@ func main() {
 
 	time.Sleep(time.Second * 2)
 
+	printPlan(masterNodeURL, node.MembershipChange{Remove: []string{worker0ID}})
+
 	log.BigPrintf("removing worker (0)...")
 	// remove first node
 	{
@@ -121,3 +129,37 @@ func main() {
 	block := make(chan struct{})
 	<-block
 }
+
+// printPlan prints the keys and bytes a membership change would move
+// between each pair of nodes, before anything moves
+func printPlan(masterNodeURL string, change node.MembershipChange) {
+	body, err := json.Marshal(change)
+	if err != nil {
+		panic(err)
+	}
+	res, err := http.Post(masterNodeURL+"/rebalance/plan", "application/json", bytes.NewReader(body))
+	if err != nil {
+		panic(err)
+	}
+	defer res.Body.Close()
+	body, err = io.ReadAll(res.Body)
+	if err != nil {
+		panic(err)
+	}
+	if res.StatusCode != 200 {
+		panic(fmt.Errorf("plan failed: %s", string(body)))
+	}
+	var preview node.RebalancePreview
+	if err := json.Unmarshal(body, &preview); err != nil {
+		panic(err)
+	}
+
+	log.BigPrintf("PLAN: epoch %d => %d, %d keys (%d bytes) to copy", preview.FromEpoch, preview.ToEpoch, preview.Keys, preview.Bytes)
+	for _, m := range preview.Moves {
+		if m.Target == "" {
+			log.Get().Printf("  %s drops %d keys (%d bytes)", m.Source, m.Keys, m.Bytes)
+			continue
+		}
+		log.Get().Printf("  %s => %s: %d keys (%d bytes)", m.Source, m.Target, m.Keys, m.Bytes)
+	}
+}
@@ -2,8 +2,14 @@ package main
 
 import (
 	"context"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"keepair/pkg/common"
+	"keepair/pkg/log"
 	"keepair/pkg/worker"
 )
 
@@ -12,9 +18,71 @@ func main() {
 	port := common.MustGetEnv("PORT")
 	masterNodeURL := common.MustGetEnv("MASTER_NODE_URL")
 
-	service := worker.NewService(masterNodeURL)
+	config := worker.DefaultConfig()
+	config.ChangeLog.Dir = common.GetEnvOrDefault("CHANGE_LOG_DIR", config.ChangeLog.Dir)
+	if maxEvents := common.GetEnvOrDefault("CHANGE_LOG_MAX_EVENTS", ""); maxEvents != "" {
+		n, err := strconv.Atoi(maxEvents)
+		if err != nil {
+			panic(err)
+		}
+		config.ChangeLog.MaxEvents = n
+	}
+	if maxAge := common.GetEnvOrDefault("CHANGE_LOG_MAX_AGE", ""); maxAge != "" {
+		d, err := time.ParseDuration(maxAge)
+		if err != nil {
+			panic(err)
+		}
+		config.ChangeLog.MaxAge = d
+	}
+	config.ChangeLog.SyncWrites = common.GetEnvOrDefault("CHANGE_LOG_SYNC", "") == "true"
+	if interval := common.GetEnvOrDefault("GOSSIP_PROBE_INTERVAL", ""); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			panic(err)
+		}
+		config.Gossip.ProbeInterval = d
+	}
+	if timeout := common.GetEnvOrDefault("GOSSIP_SUSPICION_TIMEOUT", ""); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			panic(err)
+		}
+		config.Gossip.SuspicionTimeout = d
+	}
+
+	if ttl := common.GetEnvOrDefault("TOMBSTONE_TTL", ""); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			panic(err)
+		}
+		config.TombstoneTTL = d
+	}
+
+	service, err := worker.NewServiceWithConfig(masterNodeURL, config)
+	if err != nil {
+		panic(err)
+	}
+
+	// on SIGTERM, the primary moves the keys of the worker to the
+	// others before it stops. A second signal stops it right away.
+	ctx, stop := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		<-signals
+		log.Get().Printf("draining worker %s before stopping", service.GetID())
+		drainCtx, cancelDrain := context.WithCancel(ctx)
+		go func() {
+			<-signals
+			cancelDrain()
+		}()
+		if err := service.Drain(drainCtx); err != nil {
+			log.Get().Printf("failed to drain worker %s: %s", service.GetID(), err)
+		}
+		stop()
+	}()
 
-	if err := service.Run(context.Background(), port); err != nil {
+	if err := service.Run(ctx, port); err != nil && ctx.Err() == nil {
 		panic(err)
 	}
 
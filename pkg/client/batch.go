@@ -0,0 +1,74 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+type OperationAction string
+
+var GetOperation = OperationAction("get")
+var SetOperation = OperationAction("set")
+var DeleteOperation = OperationAction("delete")
+
+type Operation struct {
+	Action OperationAction
+	Key    string
+	Value  []byte
+}
+
+// Result is the outcome of an operation of a batch. Value
+// is only set for get operations.
+type Result struct {
+	Value []byte
+	Err   error
+}
+
+// Batch runs operations concurrently across the workers that own
+// their keys. Operations sent to the same worker run in order. The
+// returned results match the operations by position.
+func (c *Client) Batch(ctx context.Context, operations []Operation) ([]Result, error) {
+	topology, err := c.getTopology(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// group operations by the leader of their key
+	groups := make(map[string][]int)
+	for i, op := range operations {
+		group := ""
+		if canRouteDirectly(topology) {
+			group = getReplicas(topology, op.Key)[0].ID
+		}
+		groups[group] = append(groups[group], i)
+	}
+
+	results := make([]Result, len(operations))
+	wg := sync.WaitGroup{}
+	for _, group := range groups {
+		wg.Add(1)
+		go func(group []int) {
+			defer wg.Done()
+			for _, i := range group {
+				results[i] = c.apply(ctx, operations[i])
+			}
+		}(group)
+	}
+	wg.Wait()
+	return results, nil
+}
+
+func (c *Client) apply(ctx context.Context, op Operation) Result {
+	switch op.Action {
+	case GetOperation:
+		value, err := c.Get(ctx, op.Key)
+		return Result{Value: value, Err: err}
+	case SetOperation:
+		return Result{Err: c.Set(ctx, op.Key, op.Value)}
+	case DeleteOperation:
+		return Result{Err: c.Delete(ctx, op.Key)}
+	default:
+		return Result{Err: fmt.Errorf("unknown operation: %s", op.Action)}
+	}
+}
@@ -0,0 +1,300 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"keepair/pkg/partition"
+	"keepair/pkg/primary/node"
+	"keepair/pkg/values"
+)
+
+// ErrNotFound is returned when a key does not exist
+var ErrNotFound = errors.New("key not found")
+
+// StatusError is returned when a node answers with an error
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("request failed with status code %d: %s", e.StatusCode, e.Body)
+}
+
+// RedirectError is returned by a worker that does not serve a key
+type RedirectError struct {
+	Kind    partition.RedirectKind
+	Epoch   uint64
+	NodeURL string
+}
+
+func (e *RedirectError) Error() string {
+	return fmt.Sprintf("redirected: %s %d %s", e.Kind, e.Epoch, e.NodeURL)
+}
+
+type IClient interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte) error
+	Delete(ctx context.Context, key string) error
+	Batch(ctx context.Context, operations []Operation) ([]Result, error)
+	Topology(ctx context.Context) (node.Topology, error)
+	Close()
+}
+
+// Client sends requests straight to the workers that own the keys,
+// using the topology published by the primary
+type Client struct {
+	PrimaryURLs []string
+	Config      Config
+
+	httpClient *http.Client
+	cancel     context.CancelFunc
+
+	mu          sync.RWMutex
+	topology    node.Topology
+	hasTopology bool
+	primaryIdx  int
+
+	// refreshMu lets a single request refresh a stale topology
+	refreshMu sync.Mutex
+}
+
+// New returns a client for the primary at primaryURL, or a
+// comma-separated list of URLs of several primaries
+func New(primaryURL string) IClient {
+	return NewWithConfig(primaryURL, DefaultConfig())
+}
+
+func NewWithConfig(primaryURL string, config Config) IClient {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Client{
+		PrimaryURLs: strings.Split(primaryURL, ","),
+		Config:      config,
+		httpClient:  &http.Client{},
+		cancel:      cancel,
+	}
+	if config.WatchTopology {
+		go c.watchTopology(ctx)
+	}
+	return c
+}
+
+// Close stops watching the topology
+func (c *Client) Close() {
+	c.cancel()
+}
+
+func (c *Client) Topology(ctx context.Context) (node.Topology, error) {
+	return c.getTopology(ctx)
+}
+
+func (c *Client) Get(ctx context.Context, key string) ([]byte, error) {
+	var value []byte
+	err := c.withRetries(ctx, func(topology node.Topology) error {
+		v, err := c.get(ctx, topology, key)
+		value = v
+		return err
+	})
+	return value, err
+}
+
+func (c *Client) Set(ctx context.Context, key string, value []byte) error {
+	return c.withRetries(ctx, func(topology node.Topology) error {
+		return c.write(ctx, topology, http.MethodPost, key, value)
+	})
+}
+
+func (c *Client) Delete(ctx context.Context, key string) error {
+	return c.withRetries(ctx, func(topology node.Topology) error {
+		return c.write(ctx, topology, http.MethodDelete, key, nil)
+	})
+}
+
+// withRetries calls attempt until it succeeds, fails for good or runs
+// out of retries, refreshing the topology before every retry since
+// failures usually mean a node joined, left or died
+func (c *Client) withRetries(ctx context.Context, attempt func(topology node.Topology) error) error {
+	topology, err := c.getTopology(ctx)
+	if err != nil {
+		return err
+	}
+	backoff := c.Config.RetryBackoff
+	for retry := 0; ; retry++ {
+		err = attempt(topology)
+		if err == nil || !isRetryable(err) || retry >= c.Config.Retries {
+			return err
+		}
+		// a key that moved is found again on the new topology
+		// right away, while failures need time to be detected
+		var redirect *RedirectError
+		if !errors.As(err, &redirect) {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("context err (%w) while retrying: %s", ctx.Err(), err.Error())
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		if refreshed, refreshErr := c.refresh(ctx, topology.Version); refreshErr == nil {
+			topology = refreshed
+		}
+	}
+}
+
+// isRetryable reports whether a request may succeed on another
+// attempt: the node could not be reached, failed internally or
+// does not serve the key anymore
+func isRetryable(err error) bool {
+	var redirect *RedirectError
+	if errors.As(err, &redirect) {
+		return true
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+	return !errors.Is(err, ErrNotFound)
+}
+
+// get reads a key from each live replica in turn, starting with the
+// leader, until one has it
+func (c *Client) get(ctx context.Context, topology node.Topology, key string) ([]byte, error) {
+	if !canRouteDirectly(topology) {
+		return c.primaryRequest(ctx, http.MethodGet, key, nil)
+	}
+	err := fmt.Errorf("no live replica for key %s", key)
+	notFound := false
+	for _, n := range getReplicas(topology, key) {
+		if n.Status == node.DeadStatus {
+			continue
+		}
+		value, readErr := c.sendFollowingAsk(ctx, http.MethodGet, n.URL(), key, nil, nil)
+		if readErr == nil {
+			return value, nil
+		}
+		notFound = notFound || errors.Is(readErr, ErrNotFound)
+		err = readErr
+	}
+	if notFound {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return nil, err
+}
+
+// write sends a write to the leader replica of a key, which forwards
+// it to the healthy followers. Writes for a leader that is not healthy
+// go through the primary, which keeps them as hints until it recovers.
+func (c *Client) write(ctx context.Context, topology node.Topology, method string, key string, value []byte) error {
+	replicas := getReplicas(topology, key)
+	if !canRouteDirectly(topology) || replicas[0].Status != node.HealthyStatus {
+		_, err := c.primaryRequest(ctx, method, key, value)
+		return err
+	}
+	followerURLs := make([]string, 0, len(replicas)-1)
+	for _, n := range replicas[1:] {
+		if n.Status == node.HealthyStatus {
+			followerURLs = append(followerURLs, n.URL())
+		}
+	}
+	header := http.Header{}
+	if len(followerURLs) > 0 {
+		header.Set(values.ReplicasHeader, strings.Join(followerURLs, ","))
+	}
+	_, err := c.sendFollowingAsk(ctx, method, replicas[0].URL(), key, value, header)
+	return err
+}
+
+// sendFollowingAsk makes a key request to a node. If the key is being
+// moved away from the node, the request is sent once more to the node
+// it is moving to, which forwards writes to the key's other replicas.
+func (c *Client) sendFollowingAsk(ctx context.Context, method string, nodeURL string, key string, value []byte, header http.Header) ([]byte, error) {
+	body, err := c.send(ctx, method, nodeURL, key, value, header)
+	var redirect *RedirectError
+	if errors.As(err, &redirect) && redirect.Kind == partition.AskRedirect {
+		header := http.Header{}
+		header.Set(values.AskingHeader, "true")
+		return c.send(ctx, method, redirect.NodeURL, key, value, header)
+	}
+	return body, err
+}
+
+// primaryRequest sends a key request through the primaries in turn
+func (c *Client) primaryRequest(ctx context.Context, method string, key string, value []byte) ([]byte, error) {
+	var err error
+	for i := 0; i < len(c.PrimaryURLs); i++ {
+		primaryURL := c.primaryURL()
+		var body []byte
+		if body, err = c.send(ctx, method, primaryURL, key, value, nil); err == nil || !isRetryable(err) {
+			return body, err
+		}
+		c.nextPrimary(primaryURL)
+	}
+	return nil, err
+}
+
+// send makes a key request to a node, bounded by the configured timeout
+func (c *Client) send(ctx context.Context, method string, nodeURL string, key string, value []byte, header http.Header) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.Config.Timeout)
+	defer cancel()
+
+	var body io.Reader
+	if value != nil {
+		body = bytes.NewReader(value)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s/keys/%s", nodeURL, key), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusMisdirectedRequest {
+		epoch, _ := strconv.ParseUint(res.Header.Get(values.EpochHeader), 10, 64)
+		return nil, &RedirectError{
+			Kind:    partition.RedirectKind(res.Header.Get(values.RedirectHeader)),
+			Epoch:   epoch,
+			NodeURL: res.Header.Get("Location"),
+		}
+	}
+	if res.StatusCode == 404 {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, &StatusError{StatusCode: res.StatusCode, Body: string(resBody)}
+	}
+	return resBody, nil
+}
+
+func (c *Client) primaryURL() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.PrimaryURLs[c.primaryIdx%len(c.PrimaryURLs)]
+}
+
+// nextPrimary moves on to the next primary, unless
+// another request already moved on from the failed one
+func (c *Client) nextPrimary(failedURL string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.PrimaryURLs[c.primaryIdx%len(c.PrimaryURLs)] == failedURL {
+		c.primaryIdx++
+	}
+}
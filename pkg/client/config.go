@@ -0,0 +1,29 @@
+package client
+
+import "time"
+
+type Config struct {
+	// Timeout bounds each request to a node
+	Timeout time.Duration
+	// Retries is the number of times a failed request is
+	// tried again, after refreshing the topology
+	Retries int
+	// RetryBackoff is the wait before the first retry,
+	// doubled for every following one
+	RetryBackoff time.Duration
+	// WatchTopology long-polls the primary in the background, so
+	// membership changes are picked up before requests fail
+	WatchTopology bool
+	// WatchTimeout is how long a single long-poll waits for a change
+	WatchTimeout time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Timeout:       time.Second * 5,
+		Retries:       3,
+		RetryBackoff:  time.Millisecond * 100,
+		WatchTopology: true,
+		WatchTimeout:  time.Second * 30,
+	}
+}
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"keepair/pkg/log"
+	"keepair/pkg/partition"
+	"keepair/pkg/primary/node"
+)
+
+// getTopology returns the last known topology,
+// fetching it from a primary the first time
+func (c *Client) getTopology(ctx context.Context) (node.Topology, error) {
+	c.mu.RLock()
+	topology, ok := c.topology, c.hasTopology
+	c.mu.RUnlock()
+	if ok {
+		return topology, nil
+	}
+	return c.refresh(ctx, topology.Version)
+}
+
+// refresh fetches the topology from a primary, unless it was
+// already replaced since the stale version was read
+func (c *Client) refresh(ctx context.Context, stale uint64) (node.Topology, error) {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	c.mu.RLock()
+	topology, ok := c.topology, c.hasTopology
+	c.mu.RUnlock()
+	if ok && topology.Version != stale {
+		return topology, nil
+	}
+
+	topology, err := c.fetchTopology(ctx, "")
+	if err != nil {
+		return topology, err
+	}
+	c.setTopology(topology)
+	return topology, nil
+}
+
+func (c *Client) setTopology(topology node.Topology) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.topology = topology
+	c.hasTopology = true
+}
+
+// fetchTopology gets the topology from the primaries in turn,
+// starting with the one that answered last
+func (c *Client) fetchTopology(ctx context.Context, rawQuery string) (node.Topology, error) {
+	var err error
+	for i := 0; i < len(c.PrimaryURLs); i++ {
+		var topology node.Topology
+		primaryURL := c.primaryURL()
+		if topology, err = c.getTopologyFrom(ctx, primaryURL, rawQuery); err == nil {
+			return topology, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		c.nextPrimary(primaryURL)
+	}
+	return node.Topology{}, fmt.Errorf("failed to get topology: %w", err)
+}
+
+func (c *Client) getTopologyFrom(ctx context.Context, primaryURL string, rawQuery string) (node.Topology, error) {
+	url := primaryURL + "/topology"
+	if rawQuery != "" {
+		url += "?" + rawQuery
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return node.Topology{}, err
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return node.Topology{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return node.Topology{}, fmt.Errorf("get topology request failed: status code %d", res.StatusCode)
+	}
+	var topology node.Topology
+	if err := json.NewDecoder(res.Body).Decode(&topology); err != nil {
+		return node.Topology{}, err
+	}
+	return topology, nil
+}
+
+// watchTopology long-polls the primaries for a topology newer than
+// the last known one until ctx is cancelled
+func (c *Client) watchTopology(ctx context.Context) {
+	for ctx.Err() == nil {
+		topology, err := c.getTopology(ctx)
+		if err == nil {
+			query := fmt.Sprintf("version=%d&timeout=%s", topology.Version, c.Config.WatchTimeout)
+			var changed node.Topology
+			if changed, err = c.fetchTopology(ctx, query); err == nil {
+				if changed.Version != topology.Version {
+					c.setTopology(changed)
+				}
+				continue
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		log.Get().Printf("client topology watch ERR: %s", err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(c.Config.RetryBackoff):
+		}
+	}
+}
+
+// canRouteDirectly reports whether requests can go straight to the
+// workers. Leaderless mode needs the primary to coordinate quorums.
+func canRouteDirectly(topology node.Topology) bool {
+	return topology.Mode != node.LeaderlessMode && len(topology.Nodes) > 0
+}
+
+// getReplicas returns the nodes that hold a key, leader first,
+// the same way the primary picks them
+func getReplicas(topology node.Topology, key string) []node.TopologyNode {
+	numNodes := len(topology.Nodes)
+	if numNodes == 0 {
+		return nil
+	}
+	indexes := partition.GetReplicaIndexes(key, numNodes, topology.ReplicationFactor)
+	replicas := make([]node.TopologyNode, 0, len(indexes))
+	for _, idx := range indexes {
+		// nodes are sorted by index
+		replicas = append(replicas, topology.Nodes[idx])
+	}
+	return replicas
+}
@@ -0,0 +1,29 @@
+package common
+
+import "time"
+
+// ChangeEvent describes a change to a key on a worker. Seq increases
+// monotonically per worker, so (WorkerID, Seq) identifies an event.
+// Value is the new value of the key for set events.
+type ChangeEvent struct {
+	Seq      uint64               `json:"seq"`
+	WorkerID string               `json:"workerId"`
+	Action   EntryOperationAction `json:"action"`
+	Key      string               `json:"key"`
+	Value    []byte               `json:"value,omitempty"`
+	Type     ValueType            `json:"type,omitempty"`
+	Origin   ChangeOrigin         `json:"origin"`
+	Time     time.Time            `json:"time"`
+}
+
+// CompactedChange is only sent in change streams. It means events
+// before Seq are no longer available, so the subscriber missed some.
+var CompactedChange = EntryOperationAction("compacted")
+
+// ChangeOrigin tells whether a change was made by a client or by
+// the cluster itself, e.g. when moving keys during a rebalance
+type ChangeOrigin string
+
+var ClientOrigin = ChangeOrigin("client")
+var RebalanceOrigin = ChangeOrigin("rebalance")
+var ReplicationOrigin = ChangeOrigin("replication")
@@ -0,0 +1,14 @@
+package common
+
+// Digest is a summary of a worker's data: the root of its Merkle
+// tree and the hash of each bucket of keys, hex encoded
+type Digest struct {
+	Root    string   `json:"root"`
+	Buckets []string `json:"buckets"`
+}
+
+// KeyDigest is the hash of a key's type and value
+type KeyDigest struct {
+	Key  string `json:"key"`
+	Hash string `json:"hash"`
+}
@@ -1,8 +1,12 @@
 package common
 
 type Entry struct {
-	Key   string `json:"key"`
-	Value []byte `json:"value"`
+	Key   string    `json:"key"`
+	Value []byte    `json:"value"`
+	Type  ValueType `json:"type,omitempty"`
+	// Timestamp is when the entry was last written,
+	// in nanoseconds since the Unix epoch
+	Timestamp int64 `json:"timestamp,omitempty"`
 }
 
 type EntryOperation struct {
@@ -14,3 +18,14 @@ type EntryOperationAction string
 
 var SetEntry = EntryOperationAction("set")
 var DeleteEntry = EntryOperationAction("delete")
+
+// ValueType is the type of value held by a key. Plain values
+// have an empty type, while data structures carry their
+// type so it survives streaming and rebalancing.
+type ValueType string
+
+var StringType = ValueType("")
+var ListType = ValueType("list")
+var SetType = ValueType("set")
+var HashType = ValueType("hash")
+var SortedSetType = ValueType("zset")
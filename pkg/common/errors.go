@@ -0,0 +1,27 @@
+package common
+
+import (
+	"errors"
+
+	"keepair/pkg/document"
+)
+
+var ErrNotFound = errors.New("not found")
+var ErrWrongType = errors.New("operation against a key holding the wrong kind of value")
+
+// ErrorStatus maps the errors of keys and their
+// documents to response status codes
+func ErrorStatus(err error) int {
+	switch {
+	case document.IsNotJSON(err):
+		return 422
+	case errors.Is(err, document.ErrInvalidPath):
+		return 400
+	case errors.Is(err, document.ErrPathNotFound), errors.Is(err, ErrNotFound):
+		return 404
+	case errors.Is(err, ErrWrongType):
+		return 409
+	default:
+		return 500
+	}
+}
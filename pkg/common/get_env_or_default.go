@@ -0,0 +1,11 @@
+package common
+
+import "os"
+
+func GetEnvOrDefault(key string, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
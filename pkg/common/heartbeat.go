@@ -0,0 +1,10 @@
+package common
+
+import "keepair/pkg/gossip"
+
+// Heartbeat is sent by a worker to renew its lease
+type Heartbeat struct {
+	Stats NodeStats `json:"stats"`
+	// Gossip is the worker's view of the other workers
+	Gossip []gossip.Member `json:"gossip"`
+}
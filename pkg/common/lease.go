@@ -0,0 +1,13 @@
+package common
+
+import "time"
+
+// Lease is how long a worker stays a member of the cluster
+// without sending another heartbeat
+type Lease struct {
+	Duration time.Duration `json:"duration"`
+	Expiry   time.Time     `json:"expiry"`
+	// TopologyVersion tells workers when to fetch the
+	// members to gossip with again
+	TopologyVersion uint64 `json:"topologyVersion"`
+}
@@ -0,0 +1,27 @@
+package common
+
+import "time"
+
+// DefaultQueue is the queue of the operations queued without a queue ID
+const DefaultQueue = "default"
+
+// OperationQueue is a queue of operations held by a worker until they
+// are applied. A migration queues its operations under its own ID, so
+// that migrations are applied separately, and each batch under a batch
+// ID, so that a batch sent again is only queued once.
+type OperationQueue struct {
+	ID string `json:"id"`
+	// Pending is the number of operations waiting to be applied
+	Pending int   `json:"pending"`
+	Bytes   int64 `json:"bytes"`
+	// Batches is the number of batches received, applied or not
+	Batches int `json:"batches"`
+	// Applied is the number of operations written to the store,
+	// leaving out the ones skipped for a newer version of their key
+	Applied   int       `json:"applied"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// Operations are the pending operations, only
+	// listed when a single queue is inspected
+	Operations []EntryOperation `json:"operations,omitempty"`
+}
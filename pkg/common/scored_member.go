@@ -0,0 +1,6 @@
+package common
+
+type ScoredMember struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
@@ -0,0 +1,11 @@
+package common
+
+// VersionedValue is a plain value with the timestamp it was written
+// at. A deleted key has no value but keeps the timestamp of its
+// delete, so replicas can tell which of them is newer.
+type VersionedValue struct {
+	Value     []byte `json:"value"`
+	Timestamp int64  `json:"timestamp"`
+	Found     bool   `json:"found"`
+	Deleted   bool   `json:"deleted"`
+}
@@ -0,0 +1,182 @@
+package document
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const notJSONMessage = "value is not valid JSON"
+
+// NotJSONError is returned when a document operation is
+// attempted on a value (or patch) that is not valid JSON
+type NotJSONError struct {
+	Err error
+}
+
+func (e *NotJSONError) Error() string {
+	return fmt.Sprintf("%s: %s", notJSONMessage, e.Err)
+}
+
+// ParseNotJSONError rebuilds a NotJSONError from its message,
+// e.g. when it has been received in a response body
+func ParseNotJSONError(message string) *NotJSONError {
+	message = strings.TrimPrefix(message, notJSONMessage+": ")
+	return &NotJSONError{Err: errors.New(message)}
+}
+
+func (e *NotJSONError) Unwrap() error {
+	return e.Err
+}
+
+var ErrPathNotFound = errors.New("path not found")
+var ErrInvalidPath = errors.New("invalid path")
+
+// IsNotJSON reports whether err is (or wraps) a NotJSONError
+func IsNotJSON(err error) bool {
+	var notJSONErr *NotJSONError
+	return errors.As(err, &notJSONErr)
+}
+
+func decode(value []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, &NotJSONError{Err: err}
+	}
+	if decoder.More() {
+		return nil, &NotJSONError{Err: errors.New("unexpected data after top-level value")}
+	}
+	return v, nil
+}
+
+// Validate checks that value is a single valid JSON document
+func Validate(value []byte) error {
+	_, err := decode(value)
+	return err
+}
+
+// MergePatch applies a JSON Merge Patch (RFC 7386) to doc and
+// returns the resulting document
+func MergePatch(doc []byte, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	patchValue, err := decode(patch)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(mergePatch(target, patchValue))
+}
+
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+	for k, v := range patchObject {
+		if v == nil {
+			delete(targetObject, k)
+			continue
+		}
+		targetObject[k] = mergePatch(targetObject[k], v)
+	}
+	return targetObject
+}
+
+// Extract returns the sub-document of doc at path. Paths use a
+// subset of JSONPath: "$" for the root, ".name" for object
+// members and "[n]" for array elements, e.g. "$.a.b[0].c"
+func Extract(doc []byte, path string) ([]byte, error) {
+	segments, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := Validate(doc); err != nil {
+		return nil, err
+	}
+	current := json.RawMessage(doc)
+	for _, segment := range segments {
+		if segment.isIndex {
+			var array []json.RawMessage
+			if err := json.Unmarshal(current, &array); err != nil {
+				return nil, fmt.Errorf("%w: %s is not an array", ErrPathNotFound, segment)
+			}
+			if segment.index < 0 || segment.index >= len(array) {
+				return nil, fmt.Errorf("%w: index %d out of range", ErrPathNotFound, segment.index)
+			}
+			current = array[segment.index]
+			continue
+		}
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(current, &object); err != nil {
+			return nil, fmt.Errorf("%w: parent of %s is not an object", ErrPathNotFound, segment)
+		}
+		next, ok := object[segment.name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrPathNotFound, segment)
+		}
+		current = next
+	}
+	return bytes.TrimSpace(current), nil
+}
+
+type pathSegment struct {
+	name    string
+	index   int
+	isIndex bool
+}
+
+func (s pathSegment) String() string {
+	if s.isIndex {
+		return fmt.Sprintf("[%d]", s.index)
+	}
+	return s.name
+}
+
+func parsePath(path string) ([]pathSegment, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("%w: must start with '$': %s", ErrInvalidPath, path)
+	}
+	segments := make([]pathSegment, 0)
+	rest := path[1:]
+	for len(rest) > 0 {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			if name == "" {
+				return nil, fmt.Errorf("%w: empty member name: %s", ErrInvalidPath, path)
+			}
+			segments = append(segments, pathSegment{name: name})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("%w: unterminated '[': %s", ErrInvalidPath, path)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid array index: %s", ErrInvalidPath, path)
+			}
+			segments = append(segments, pathSegment{index: index, isIndex: true})
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("%w: unexpected character '%c': %s", ErrInvalidPath, rest[0], path)
+		}
+	}
+	return segments, nil
+}
@@ -0,0 +1,83 @@
+package document
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMergePatch checks the examples from RFC 7386, Appendix A
+func TestMergePatch(t *testing.T) {
+
+	cases := []struct {
+		doc      string
+		patch    string
+		expected string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+		{`{"n":12345678901234567890}`, `{}`, `{"n":12345678901234567890}`},
+	}
+
+	for _, tc := range cases {
+		result, err := MergePatch([]byte(tc.doc), []byte(tc.patch))
+		assert.NoError(t, err)
+		assert.JSONEqf(t, tc.expected, string(result), "doc: %s, patch: %s", tc.doc, tc.patch)
+	}
+
+	_, err := MergePatch([]byte("not json"), []byte(`{"a":1}`))
+	assert.True(t, IsNotJSON(err))
+
+	_, err = MergePatch([]byte(`{"a":1}`), []byte(`{"a":`))
+	assert.True(t, IsNotJSON(err))
+}
+
+// TestExtract checks that sub-documents can be selected by path
+func TestExtract(t *testing.T) {
+
+	doc := []byte(`{"a":{"b":{"c":[10,{"d":"e"}]}},"x":null}`)
+
+	cases := []struct {
+		path     string
+		expected string
+	}{
+		{"$", string(doc)},
+		{"$.a.b", `{"c":[10,{"d":"e"}]}`},
+		{"$.a.b.c[0]", `10`},
+		{"$.a.b.c[1].d", `"e"`},
+		{"$.x", `null`},
+	}
+
+	for _, tc := range cases {
+		result, err := Extract(doc, tc.path)
+		assert.NoError(t, err)
+		assert.Equalf(t, tc.expected, string(result), "path: %s", tc.path)
+	}
+
+	for _, path := range []string{"$.missing", "$.a.b.c[2]", "$.a[0]", "$.x.y"} {
+		_, err := Extract(doc, path)
+		assert.Truef(t, errors.Is(err, ErrPathNotFound), "path: %s", path)
+	}
+
+	for _, path := range []string{"a.b", "$.", "$[x]", "$.a[0"} {
+		_, err := Extract(doc, path)
+		assert.Truef(t, errors.Is(err, ErrInvalidPath), "path: %s", path)
+	}
+
+	_, err := Extract([]byte("plain text"), "$.a")
+	assert.True(t, IsNotJSON(err))
+}
@@ -0,0 +1,380 @@
+package gossip
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"keepair/pkg/log"
+)
+
+// State is what a member believes about another. A member that
+// misses a probe is suspect until it refutes the suspicion or the
+// suspicion times out, after which it is dead.
+type State string
+
+var Alive = State("alive")
+var Suspect = State("suspect")
+var Dead = State("dead")
+
+// Member is a worker as seen by another. The incarnation is only
+// increased by the member itself, to refute suspicions about it.
+type Member struct {
+	ID          string `json:"id"`
+	Address     string `json:"address"`
+	State       State  `json:"state"`
+	Incarnation uint64 `json:"incarnation"`
+}
+
+// Message is sent with every probe and ack, carrying
+// recent membership updates
+type Message struct {
+	From    string   `json:"from"`
+	Updates []Member `json:"updates"`
+}
+
+// Transport sends probes to other members
+type Transport interface {
+	// Ping probes the member at address directly, returning its ack
+	Ping(ctx context.Context, address string, msg Message) (Message, error)
+	// PingReq asks the member at address to probe target,
+	// returning the ack if target answered
+	PingReq(ctx context.Context, address string, target Member, msg Message) (Message, error)
+}
+
+type Config struct {
+	// ProbeInterval is the length of a protocol period,
+	// in which one member is probed
+	ProbeInterval time.Duration
+	// ProbeTimeout is how long to wait for a direct ack
+	// before probing through other members
+	ProbeTimeout time.Duration
+	// IndirectProbes is the number of members asked to
+	// probe a member that did not ack
+	IndirectProbes int
+	// SuspicionTimeout is how long a member stays
+	// suspect before it is declared dead
+	SuspicionTimeout time.Duration
+	// RetransmitMult scales the number of messages each
+	// update is piggybacked on, which grows with the
+	// log of the number of members
+	RetransmitMult int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		ProbeInterval:    time.Second,
+		ProbeTimeout:     time.Millisecond * 300,
+		IndirectProbes:   3,
+		SuspicionTimeout: time.Second * 5,
+		RetransmitMult:   3,
+	}
+}
+
+type member struct {
+	Member
+	suspectedAt time.Time
+}
+
+type broadcast struct {
+	update    Member
+	transmits int
+}
+
+// Gossip detects failures of the other members with SWIM: each
+// protocol period it probes one member, directly and then through
+// others, and spreads what it learns on its probes and acks
+type Gossip struct {
+	config    Config
+	transport Transport
+
+	mu         sync.Mutex
+	self       Member
+	members    map[string]*member
+	probeOrder []string
+	broadcasts []*broadcast
+}
+
+func New(ID string, config Config, transport Transport) *Gossip {
+	return &Gossip{
+		config:    config,
+		transport: transport,
+		self:      Member{ID: ID, State: Alive},
+		members:   make(map[string]*member),
+	}
+}
+
+// Sync sets the members to gossip with, as listed by the primary.
+// New members start alive, and members that are no longer listed
+// are forgotten.
+func (g *Gossip) Sync(members []Member) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	listed := make(map[string]bool)
+	for _, mb := range members {
+		listed[mb.ID] = true
+		if mb.ID == g.self.ID {
+			g.self.Address = mb.Address
+			continue
+		}
+		if m, ok := g.members[mb.ID]; ok {
+			m.Address = mb.Address
+			continue
+		}
+		g.members[mb.ID] = &member{Member: Member{ID: mb.ID, Address: mb.Address, State: Alive}}
+	}
+	for ID := range g.members {
+		if !listed[ID] {
+			delete(g.members, ID)
+		}
+	}
+}
+
+// Members returns this member's view of every member, including itself
+func (g *Gossip) Members() []Member {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	members := []Member{g.self}
+	for _, m := range g.members {
+		members = append(members, m.Member)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+	return members
+}
+
+// Run probes a member every protocol period until ctx is done
+func (g *Gossip) Run(ctx context.Context) {
+	ticker := time.NewTicker(g.config.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			g.Probe(ctx)
+			g.ExpireSuspicions()
+		}
+	}
+}
+
+// Probe runs one protocol period: it pings the next member, asks
+// others to ping it if it does not ack, and suspects it if no
+// ack arrives at all
+func (g *Gossip) Probe(ctx context.Context) {
+	target, ok := g.nextTarget()
+	if !ok {
+		return
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, g.config.ProbeTimeout)
+	ack, err := g.transport.Ping(pingCtx, target.Address, g.outgoing())
+	cancel()
+	if err == nil {
+		g.receive(ack)
+		return
+	}
+
+	helpers := g.randomMembers(g.config.IndirectProbes, target.ID)
+	if len(helpers) > 0 {
+		indirectCtx, cancel := context.WithTimeout(ctx, g.config.ProbeInterval-g.config.ProbeTimeout)
+		defer cancel()
+		acks := make(chan Message, len(helpers))
+		for _, helper := range helpers {
+			go func(helper Member) {
+				ack, err := g.transport.PingReq(indirectCtx, helper.Address, target, g.outgoing())
+				if err == nil {
+					acks <- ack
+				}
+			}(helper)
+		}
+		select {
+		case ack := <-acks:
+			g.receive(ack)
+			return
+		case <-indirectCtx.Done():
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if m, ok := g.members[target.ID]; ok && m.State == Alive {
+		log.Get().Printf("gossip %s suspects %s", g.self.ID, target.ID)
+		g.apply(Member{ID: m.ID, Address: m.Address, State: Suspect, Incarnation: m.Incarnation})
+	}
+}
+
+// ExpireSuspicions declares members dead once they
+// have been suspect for too long
+func (g *Gossip) ExpireSuspicions() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, m := range g.members {
+		if m.State == Suspect && time.Since(m.suspectedAt) >= g.config.SuspicionTimeout {
+			log.Get().Printf("gossip %s declares %s dead", g.self.ID, m.ID)
+			g.apply(Member{ID: m.ID, Address: m.Address, State: Dead, Incarnation: m.Incarnation})
+		}
+	}
+}
+
+// HandlePing answers a direct probe
+func (g *Gossip) HandlePing(msg Message) Message {
+	g.receive(msg)
+	return g.outgoing()
+}
+
+// HandlePingReq probes target for another member,
+// failing if it does not ack
+func (g *Gossip) HandlePingReq(ctx context.Context, target Member, msg Message) (Message, error) {
+	g.receive(msg)
+	pingCtx, cancel := context.WithTimeout(ctx, g.config.ProbeTimeout)
+	defer cancel()
+	ack, err := g.transport.Ping(pingCtx, target.Address, g.outgoing())
+	if err != nil {
+		return Message{}, err
+	}
+	g.receive(ack)
+	return g.outgoing(), nil
+}
+
+func (g *Gossip) receive(msg Message) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, update := range msg.Updates {
+		g.apply(update)
+	}
+}
+
+// apply merges an update into the view, and spreads it further if
+// it was news. Suspicions about this member are refuted by a new
+// incarnation. Caller must hold mu.
+func (g *Gossip) apply(update Member) {
+	if update.ID == g.self.ID {
+		if update.State != Alive && update.Incarnation >= g.self.Incarnation {
+			g.self.Incarnation = update.Incarnation + 1
+			log.Get().Printf("gossip %s refutes %s with incarnation %d", g.self.ID, update.State, g.self.Incarnation)
+			g.queueBroadcast(g.self)
+		}
+		return
+	}
+
+	// only members listed by the primary are tracked
+	m, ok := g.members[update.ID]
+	if !ok || !overrides(update, m.Member) {
+		return
+	}
+	if update.State == Suspect && m.State != Suspect {
+		m.suspectedAt = time.Now()
+	}
+	m.State = update.State
+	m.Incarnation = update.Incarnation
+	g.queueBroadcast(m.Member)
+}
+
+// overrides reports whether an update is newer than what is known
+// about a member. A higher incarnation always wins, and at the same
+// incarnation dead beats suspect, which beats alive.
+func overrides(update, current Member) bool {
+	if update.Incarnation != current.Incarnation {
+		return update.Incarnation > current.Incarnation
+	}
+	return rank(update.State) > rank(current.State)
+}
+
+func rank(state State) int {
+	switch state {
+	case Suspect:
+		return 1
+	case Dead:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// queueBroadcast piggybacks an update on the next messages,
+// replacing older updates about the same member. Caller must
+// hold mu.
+func (g *Gossip) queueBroadcast(update Member) {
+	for i, b := range g.broadcasts {
+		if b.update.ID == update.ID {
+			g.broadcasts = append(g.broadcasts[:i], g.broadcasts[i+1:]...)
+			break
+		}
+	}
+	g.broadcasts = append(g.broadcasts, &broadcast{update: update})
+}
+
+// outgoing builds a message with the updates sent the fewest times,
+// dropping updates once they have been sent enough times
+func (g *Gossip) outgoing() Message {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	limit := g.config.RetransmitMult * int(math.Ceil(math.Log2(float64(len(g.members)+2))))
+	sort.SliceStable(g.broadcasts, func(i, j int) bool {
+		return g.broadcasts[i].transmits < g.broadcasts[j].transmits
+	})
+
+	msg := Message{From: g.self.ID, Updates: make([]Member, 0, len(g.broadcasts))}
+	kept := g.broadcasts[:0]
+	for _, b := range g.broadcasts {
+		msg.Updates = append(msg.Updates, b.update)
+		b.transmits++
+		if b.transmits < limit {
+			kept = append(kept, b)
+		}
+	}
+	g.broadcasts = kept
+	return msg
+}
+
+// nextTarget returns the next member to probe, going through the
+// members in a random order that is reshuffled after each round
+func (g *Gossip) nextTarget() (Member, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for attempts := 0; attempts <= len(g.members); attempts++ {
+		if len(g.probeOrder) == 0 {
+			for ID, m := range g.members {
+				if m.State != Dead {
+					g.probeOrder = append(g.probeOrder, ID)
+				}
+			}
+			rand.Shuffle(len(g.probeOrder), func(i, j int) {
+				g.probeOrder[i], g.probeOrder[j] = g.probeOrder[j], g.probeOrder[i]
+			})
+			if len(g.probeOrder) == 0 {
+				return Member{}, false
+			}
+		}
+		ID := g.probeOrder[0]
+		g.probeOrder = g.probeOrder[1:]
+		if m, ok := g.members[ID]; ok && m.State != Dead {
+			return m.Member, true
+		}
+	}
+	return Member{}, false
+}
+
+// randomMembers returns up to n alive members other than excludeID
+func (g *Gossip) randomMembers(n int, excludeID string) []Member {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	candidates := make([]Member, 0)
+	for ID, m := range g.members {
+		if ID != excludeID && m.State == Alive {
+			candidates = append(candidates, m.Member)
+		}
+	}
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	return candidates
+}
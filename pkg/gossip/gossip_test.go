@@ -0,0 +1,164 @@
+package gossip
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errUnreachable = errors.New("unreachable")
+
+// memTransport delivers probes between members in memory. Members
+// can be taken down, and links between two members cut.
+type memTransport struct {
+	mu      sync.Mutex
+	from    string
+	network *memNetwork
+}
+
+type memNetwork struct {
+	mu      sync.Mutex
+	members map[string]*Gossip
+	down    map[string]bool
+	cut     map[[2]string]bool
+}
+
+func (n *memNetwork) reachable(from, to string) (*Gossip, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.down[from] || n.down[to] || n.cut[[2]string{from, to}] || n.cut[[2]string{to, from}] {
+		return nil, false
+	}
+	g, ok := n.members[to]
+	return g, ok
+}
+
+func (t *memTransport) Ping(ctx context.Context, address string, msg Message) (Message, error) {
+	g, ok := t.network.reachable(t.from, address)
+	if !ok {
+		return Message{}, errUnreachable
+	}
+	return g.HandlePing(msg), nil
+}
+
+func (t *memTransport) PingReq(ctx context.Context, address string, target Member, msg Message) (Message, error) {
+	g, ok := t.network.reachable(t.from, address)
+	if !ok {
+		return Message{}, errUnreachable
+	}
+	return g.HandlePingReq(ctx, target, msg)
+}
+
+// newTestNetwork creates members that use their IDs as addresses
+func newTestNetwork(config Config, IDs ...string) *memNetwork {
+	n := &memNetwork{
+		members: make(map[string]*Gossip),
+		down:    make(map[string]bool),
+		cut:     make(map[[2]string]bool),
+	}
+	members := make([]Member, 0)
+	for _, ID := range IDs {
+		members = append(members, Member{ID: ID, Address: ID})
+	}
+	for _, ID := range IDs {
+		g := New(ID, config, &memTransport{from: ID, network: n})
+		g.Sync(members)
+		n.members[ID] = g
+	}
+	return n
+}
+
+// rounds runs protocol periods on every member that is up
+func (n *memNetwork) rounds(count int) {
+	for i := 0; i < count; i++ {
+		for ID, g := range n.members {
+			if !n.down[ID] {
+				g.Probe(context.Background())
+				g.ExpireSuspicions()
+			}
+		}
+	}
+}
+
+func stateOf(g *Gossip, ID string) Member {
+	for _, m := range g.Members() {
+		if m.ID == ID {
+			return m
+		}
+	}
+	return Member{}
+}
+
+func testConfig() Config {
+	config := DefaultConfig()
+	config.ProbeInterval = time.Millisecond * 20
+	config.ProbeTimeout = time.Millisecond * 5
+	config.SuspicionTimeout = time.Millisecond * 50
+	return config
+}
+
+// TestDetectFailure checks that a member that is down is suspected,
+// then declared dead by every other member
+func TestDetectFailure(t *testing.T) {
+	config := testConfig()
+	config.SuspicionTimeout = time.Millisecond * 500
+	n := newTestNetwork(config, "a", "b", "c", "d")
+	n.down["d"] = true
+
+	n.rounds(4)
+	for _, ID := range []string{"a", "b", "c"} {
+		assert.Equal(t, Suspect, stateOf(n.members[ID], "d").State, ID)
+	}
+
+	time.Sleep(config.SuspicionTimeout)
+	n.rounds(4)
+	for _, ID := range []string{"a", "b", "c"} {
+		assert.Equal(t, Dead, stateOf(n.members[ID], "d").State, ID)
+		assert.Equal(t, Alive, stateOf(n.members[ID], "a").State, ID)
+	}
+}
+
+// TestIndirectProbe checks that a member that cannot be reached
+// directly is not suspected if others can reach it
+func TestIndirectProbe(t *testing.T) {
+	n := newTestNetwork(testConfig(), "a", "b", "c")
+	n.cut[[2]string{"a", "b"}] = true
+
+	n.rounds(10)
+	assert.Equal(t, Alive, stateOf(n.members["a"], "b").State)
+	assert.Equal(t, Alive, stateOf(n.members["b"], "a").State)
+}
+
+// TestRefuteSuspicion checks that a member refutes a suspicion about
+// itself with a new incarnation, which overrides the suspicion
+func TestRefuteSuspicion(t *testing.T) {
+	n := newTestNetwork(testConfig(), "a", "b", "c")
+	n.members["a"].receive(Message{Updates: []Member{{ID: "b", Address: "b", State: Suspect}}})
+	assert.Equal(t, Suspect, stateOf(n.members["a"], "b").State)
+
+	n.rounds(6)
+	for _, ID := range []string{"a", "b", "c"} {
+		b := stateOf(n.members[ID], "b")
+		assert.Equal(t, Alive, b.State, ID)
+		assert.Equal(t, uint64(1), b.Incarnation, ID)
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	alive := Member{ID: "a", State: Alive, Incarnation: 1}
+	suspect := Member{ID: "a", State: Suspect, Incarnation: 1}
+	dead := Member{ID: "a", State: Dead, Incarnation: 1}
+	refuted := Member{ID: "a", State: Alive, Incarnation: 2}
+
+	assert.True(t, overrides(suspect, alive))
+	assert.False(t, overrides(alive, suspect))
+	assert.True(t, overrides(dead, suspect))
+	assert.False(t, overrides(suspect, dead))
+	assert.True(t, overrides(refuted, suspect))
+	assert.True(t, overrides(refuted, dead))
+	assert.False(t, overrides(suspect, refuted))
+}
@@ -0,0 +1,56 @@
+package gossip
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// PingReqBody is the body of an indirect probe
+type PingReqBody struct {
+	Target  Member  `json:"target"`
+	Message Message `json:"message"`
+}
+
+// HTTPTransport sends probes to the gossip
+// endpoints of the workers' servers
+type HTTPTransport struct {
+	client *http.Client
+}
+
+func NewHTTPTransport() Transport {
+	return &HTTPTransport{client: &http.Client{}}
+}
+
+func (t *HTTPTransport) Ping(ctx context.Context, address string, msg Message) (Message, error) {
+	return t.post(ctx, fmt.Sprintf("http://%s/gossip/ping", address), msg)
+}
+
+func (t *HTTPTransport) PingReq(ctx context.Context, address string, target Member, msg Message) (Message, error) {
+	return t.post(ctx, fmt.Sprintf("http://%s/gossip/ping-req", address), PingReqBody{Target: target, Message: msg})
+}
+
+func (t *HTTPTransport) post(ctx context.Context, url string, body interface{}) (Message, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return Message{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return Message{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := t.client.Do(req)
+	if err != nil {
+		return Message{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return Message{}, fmt.Errorf("gossip probe failed with status code: %d", res.StatusCode)
+	}
+	var ack Message
+	err = json.NewDecoder(res.Body).Decode(&ack)
+	return ack, err
+}
@@ -0,0 +1,130 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"keepair/pkg/primary"
+	"keepair/pkg/primary/clients"
+	"keepair/pkg/primary/node"
+	"keepair/pkg/seeder"
+	"keepair/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestBulkMembershipChange has workers starting together join with a
+// single migration, then adds and removes workers at once
+func TestBulkMembershipChange(t *testing.T) {
+
+	testMu.Lock()
+	defer testMu.Unlock()
+
+	masterNodeURL := "http://0.0.0.0:8000"
+
+	errChan := make(chan error, 4)
+	allContext, cancel := context.WithCancel(context.Background())
+
+	// run primary node in background
+	go func() {
+		config := primary.DefaultConfig()
+		config.Node.RegistrationWindow = time.Second
+		service := primary.NewServiceWithConfig(config)
+		if err := service.Run(allContext, "8000"); err != nil {
+			errChan <- err
+		}
+	}()
+	time.Sleep(time.Millisecond * 200)
+
+	getTopology := func() node.Topology {
+		res, err := http.Get(masterNodeURL + "/topology")
+		panicErr(err)
+		defer res.Body.Close()
+		var topology node.Topology
+		panicErr(json.NewDecoder(res.Body).Decode(&topology))
+		return topology
+	}
+	apply := func(change node.MembershipChange) int {
+		body, err := json.Marshal(change)
+		panicErr(err)
+		res, err := http.Post(masterNodeURL+"/rebalance/apply", "application/json", bytes.NewReader(body))
+		panicErr(err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+	runWorker := func(port string) worker.IService {
+		w := worker.NewService(masterNodeURL)
+		go func() {
+			if err := w.Run(allContext, port); err != nil {
+				errChan <- err
+			}
+		}()
+		return w
+	}
+	epoch := getTopology().Epoch
+
+	// workers registering within the window join together
+	runWorker("8001")
+	runWorker("8002")
+	assert.Eventually(t, func() bool {
+		return len(getTopology().Nodes) == 2
+	}, time.Second*5, time.Millisecond*50)
+	topology := getTopology()
+	assert.Equal(t, epoch+1, topology.Epoch)
+
+	kvs, err := seeder.NewSeeder(masterNodeURL, 50, 20).SeedKVs(300)
+	panicErr(err)
+	checkKeys := func() {
+		for key, value := range kvs {
+			res, err := http.Get(masterNodeURL + "/keys/" + key)
+			panicErr(err)
+			body, err := io.ReadAll(res.Body)
+			panicErr(err)
+			res.Body.Close()
+			assert.Equal(t, 200, res.StatusCode, key)
+			assert.Equal(t, value, body, key)
+		}
+	}
+
+	// changes that cannot be applied are refused
+	assert.Equal(t, 400, apply(node.MembershipChange{}))
+	assert.Equal(t, 404, apply(node.MembershipChange{Remove: []string{"unknown"}}))
+	assert.Equal(t, 400, apply(node.MembershipChange{Add: []node.Node{{ID: topology.Nodes[0].ID, Address: topology.Nodes[0].Address}}}))
+	assert.Equal(t, epoch+1, getTopology().Epoch)
+
+	// a worker joins while another leaves, with a single migration
+	removed, kept := topology.Nodes[0], topology.Nodes[1]
+	added := runWorker("8003")
+	time.Sleep(time.Millisecond * 200)
+	assert.Equal(t, 200, apply(node.MembershipChange{
+		Add:    []node.Node{{ID: added.GetID(), Address: "127.0.0.1:8003"}},
+		Remove: []string{removed.ID},
+	}))
+	topology = getTopology()
+	assert.Equal(t, epoch+2, topology.Epoch)
+	IDs := make([]string, 0)
+	for _, n := range topology.Nodes {
+		IDs = append(IDs, n.ID)
+	}
+	assert.ElementsMatch(t, []string{kept.ID, added.GetID()}, IDs)
+
+	stats, err := clients.NewWorkerClient(removed.URL()).GetStats()
+	panicErr(err)
+	assert.Equal(t, 0, stats.ObjectCount)
+	checkKeys()
+
+	// the registration of the added worker changes nothing
+	time.Sleep(time.Millisecond * 1500)
+	assert.Equal(t, epoch+2, getTopology().Epoch)
+	assert.Len(t, getTopology().Nodes, 2)
+
+	cancel() // close servers
+	for i := 0; i < cap(errChan); i++ {
+		assert.ErrorContains(t, <-errChan, "context canceled")
+	}
+}
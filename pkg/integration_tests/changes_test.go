@@ -0,0 +1,127 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"keepair/pkg/common"
+	"keepair/pkg/primary"
+	"keepair/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestWorkerChangeLog checks that a worker records client changes
+// and changes applied by a rebalance in its change log
+func TestWorkerChangeLog(t *testing.T) {
+
+	testMu.Lock()
+	defer testMu.Unlock()
+
+	masterNodeURL := "http://0.0.0.0:8000"
+
+	errChan := make(chan error, 3)
+	allContext, cancel := context.WithCancel(context.Background())
+
+	// run primary node in background
+	go func() {
+		service := primary.NewService()
+		if err := service.Run(allContext, "8000"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// run worker0 node in background
+	go func() {
+		worker0 := worker.NewService(masterNodeURL)
+		if err := worker0.Run(allContext, "8001"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// wait a bit for primary node and worker node to init
+	time.Sleep(time.Millisecond * 500)
+
+	// "a" and "b" are on different nodes once there are two
+	for _, key := range []string{"a", "b"} {
+		res, err := http.Post(masterNodeURL+"/keys/"+key, "", bytes.NewReader([]byte("value-"+key)))
+		panicErr(err)
+		assert.Equal(t, 200, res.StatusCode)
+	}
+	{
+		req, err := http.NewRequest(http.MethodDelete, masterNodeURL+"/keys/b", nil)
+		panicErr(err)
+		res, err := http.DefaultClient.Do(req)
+		panicErr(err)
+		assert.Equal(t, 200, res.StatusCode)
+	}
+
+	// run worker1 node in background, which moves "a" off worker0
+	go func() {
+		worker1 := worker.NewService(masterNodeURL)
+		if err := worker1.Run(allContext, "8002"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	time.Sleep(time.Second)
+
+	getChanges := func(since string, limit string) (int, []common.ChangeEvent, bool) {
+		res, err := http.Get("http://0.0.0.0:8001/changes?since=" + since + "&limit=" + limit)
+		panicErr(err)
+		body, err := io.ReadAll(res.Body)
+		panicErr(err)
+		var page struct {
+			Changes   []common.ChangeEvent `json:"changes"`
+			Compacted bool                 `json:"compacted"`
+		}
+		if res.StatusCode == 200 {
+			panicErr(json.Unmarshal(body, &page))
+		}
+		return res.StatusCode, page.Changes, page.Compacted
+	}
+
+	status, changes, compacted := getChanges("0", "100")
+	assert.Equal(t, 200, status)
+	assert.False(t, compacted)
+	if assert.Len(t, changes, 4) {
+		expected := []struct {
+			action common.EntryOperationAction
+			key    string
+			origin common.ChangeOrigin
+		}{
+			{common.SetEntry, "a", common.ClientOrigin},
+			{common.SetEntry, "b", common.ClientOrigin},
+			{common.DeleteEntry, "b", common.ClientOrigin},
+			{common.DeleteEntry, "a", common.RebalanceOrigin},
+		}
+		for i, e := range expected {
+			assert.Equal(t, uint64(i+1), changes[i].Seq)
+			assert.Equal(t, e.action, changes[i].Action)
+			assert.Equal(t, e.key, changes[i].Key)
+			assert.Equal(t, e.origin, changes[i].Origin)
+			assert.False(t, changes[i].Time.IsZero())
+		}
+		assert.Equal(t, []byte("value-a"), changes[0].Value)
+	}
+
+	// page through the log
+	status, changes, _ = getChanges("2", "1")
+	assert.Equal(t, 200, status)
+	if assert.Len(t, changes, 1) {
+		assert.Equal(t, uint64(3), changes[0].Seq)
+	}
+
+	status, _, _ = getChanges("x", "1")
+	assert.Equal(t, 400, status)
+
+	cancel() // close servers
+	for i := 0; i < cap(errChan); i++ {
+		assert.ErrorContains(t, <-errChan, "context canceled")
+	}
+}
@@ -0,0 +1,162 @@
+package integration_tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"keepair/pkg/client"
+	"keepair/pkg/primary"
+	"keepair/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestClient checks that the client sends requests straight to the
+// workers and follows the topology as workers join
+func TestClient(t *testing.T) {
+
+	testMu.Lock()
+	defer testMu.Unlock()
+
+	masterNodeURL := "http://0.0.0.0:8000"
+
+	errChan := make(chan error, 3)
+	allContext, cancel := context.WithCancel(context.Background())
+
+	// run primary node in background
+	go func() {
+		config := primary.DefaultConfig()
+		config.Node.ReplicationFactor = 2
+		config.Node.LeaseDuration = time.Millisecond * 300
+		service := primary.NewServiceWithConfig(config)
+		if err := service.Run(allContext, "8000"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// run worker0 node in background
+	go func() {
+		worker0 := worker.NewService(masterNodeURL)
+		if err := worker0.Run(allContext, "8001"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// wait a bit for primary node and worker node to init
+	time.Sleep(time.Millisecond * 500)
+
+	// the client talks to the primary through a proxy
+	// counting the key requests that reach it
+	var keyRequests atomic.Int64
+	target, err := url.Parse(masterNodeURL)
+	panicErr(err)
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	primaryProxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/keys/") {
+			keyRequests.Add(1)
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	defer primaryProxy.Close()
+
+	config := client.DefaultConfig()
+	config.WatchTimeout = time.Second
+	c := client.NewWithConfig(primaryProxy.URL, config)
+	defer c.Close()
+
+	ctx := context.Background()
+
+	// set, get and delete a key
+	{
+		assert.NoError(t, c.Set(ctx, "foo", []byte("bar")))
+		value, err := c.Get(ctx, "foo")
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("bar"), value)
+
+		assert.NoError(t, c.Delete(ctx, "foo"))
+		_, err = c.Get(ctx, "foo")
+		assert.ErrorIs(t, err, client.ErrNotFound)
+	}
+
+	// run worker1 node in background
+	go func() {
+		worker1 := worker.NewService(masterNodeURL)
+		if err := worker1.Run(allContext, "8002"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// the client picks up the new worker without failing a request
+	assert.Eventually(t, func() bool {
+		topology, err := c.Topology(ctx)
+		return err == nil && len(topology.Nodes) == 2
+	}, time.Second*3, time.Millisecond*50)
+
+	// batches are spread across both workers
+	numObjects := 50
+	{
+		operations := make([]client.Operation, 0, numObjects)
+		for i := 0; i < numObjects; i++ {
+			operations = append(operations, client.Operation{
+				Action: client.SetOperation,
+				Key:    fmt.Sprintf("key-%d", i),
+				Value:  []byte(fmt.Sprintf("value-%d", i)),
+			})
+		}
+		results, err := c.Batch(ctx, operations)
+		assert.NoError(t, err)
+		for _, result := range results {
+			assert.NoError(t, result.Err)
+		}
+	}
+	{
+		operations := make([]client.Operation, 0, numObjects)
+		for i := 0; i < numObjects; i++ {
+			action := client.GetOperation
+			if i%2 == 0 {
+				action = client.DeleteOperation
+			}
+			operations = append(operations, client.Operation{
+				Action: action,
+				Key:    fmt.Sprintf("key-%d", i),
+			})
+		}
+		results, err := c.Batch(ctx, operations)
+		assert.NoError(t, err)
+		for i, result := range results {
+			assert.NoError(t, result.Err)
+			if i%2 == 1 {
+				assert.Equal(t, []byte(fmt.Sprintf("value-%d", i)), result.Value)
+			}
+		}
+	}
+
+	// deleted keys are gone, and the rest can be read through the primary too
+	for i := 0; i < numObjects; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		_, err := c.Get(ctx, key)
+		res, getErr := http.Get(masterNodeURL + "/keys/" + key)
+		panicErr(getErr)
+		res.Body.Close()
+		if i%2 == 0 {
+			assert.ErrorIs(t, err, client.ErrNotFound)
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, 200, res.StatusCode)
+		}
+	}
+
+	// no key request went through the primary
+	assert.Equal(t, int64(0), keyRequests.Load())
+
+	cancel() // close servers
+	assert.ErrorContains(t, <-errChan, "context canceled")
+}
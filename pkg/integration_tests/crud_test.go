@@ -88,3 +88,104 @@ func TestSetGetKV(t *testing.T) {
 	cancel() // close servers
 	assert.ErrorContains(t, <-errChan, "context canceled")
 }
+
+// TestPatchJSONDocument checks that a JSON value can be partially read
+// by path and updated with a merge patch, and that non-JSON values are
+// rejected
+func TestPatchJSONDocument(t *testing.T) {
+
+	testMu.Lock()
+	defer testMu.Unlock()
+
+	errChan := make(chan error)
+	allContext, cancel := context.WithCancel(context.Background())
+
+	// run primary node in background
+	go func() {
+		service := primary.NewService()
+		if err := service.Run(allContext, "8000"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// run worker node in background
+	go func() {
+		service := worker.NewService("http://0.0.0.0:8000")
+		if err := service.Run(allContext, "8001"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// wait a bit for primary node and worker node to init
+	time.Sleep(time.Millisecond * 500)
+
+	patch := func(key string, body string) int {
+		req, err := http.NewRequest(http.MethodPatch, "http://0.0.0.0:8000/keys/"+key, bytes.NewReader([]byte(body)))
+		panicErr(err)
+		res, err := http.DefaultClient.Do(req)
+		panicErr(err)
+		return res.StatusCode
+	}
+
+	// set a JSON document and a plain text value
+	for key, value := range map[string]string{
+		"doc":  `{"a":{"b":1,"c":"x"},"d":[1,2]}`,
+		"text": "this is not json",
+	} {
+		res, err := http.Post("http://0.0.0.0:8000/keys/"+key, "", bytes.NewReader([]byte(value)))
+		panicErr(err)
+		assert.Equal(t, 200, res.StatusCode)
+	}
+
+	// patch the document
+	assert.Equal(t, 200, patch("doc", `{"a":{"b":2,"c":null},"e":true}`))
+
+	// get the whole document
+	{
+		res, err := http.Get("http://0.0.0.0:8000/keys/doc")
+		panicErr(err)
+		assert.Equal(t, 200, res.StatusCode)
+		body, err := io.ReadAll(res.Body)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"a":{"b":2},"d":[1,2],"e":true}`, string(body))
+	}
+
+	// get a sub-document
+	{
+		res, err := http.Get("http://0.0.0.0:8000/keys/doc?path=$.a.b")
+		panicErr(err)
+		assert.Equal(t, 200, res.StatusCode)
+		body, err := io.ReadAll(res.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "2", string(body))
+	}
+
+	// missing path
+	{
+		res, err := http.Get("http://0.0.0.0:8000/keys/doc?path=$.a.missing")
+		panicErr(err)
+		assert.Equal(t, 404, res.StatusCode)
+	}
+
+	// a key that does not exist is not found, with or without a path
+	{
+		res, err := http.Get("http://0.0.0.0:8000/keys/missing")
+		panicErr(err)
+		assert.Equal(t, 404, res.StatusCode)
+	}
+
+	// nor can it be patched
+	assert.Equal(t, 404, patch("missing", `{"a":1}`))
+
+	// non-JSON values and patches are rejected
+	assert.Equal(t, 422, patch("text", `{"a":1}`))
+	assert.Equal(t, 422, patch("doc", `{"a":`))
+	{
+		res, err := http.Get("http://0.0.0.0:8000/keys/text?path=$.a")
+		panicErr(err)
+		assert.Equal(t, 422, res.StatusCode)
+	}
+
+	cancel() // close servers
+	assert.ErrorContains(t, <-errChan, "context canceled")
+}
@@ -0,0 +1,150 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"keepair/pkg/common"
+	"keepair/pkg/primary"
+	"keepair/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestDataStructures checks that lists, sets, hashes and sorted sets
+// can be used through the primary node and keep their types when
+// they are moved to another node by a rebalance
+func TestDataStructures(t *testing.T) {
+
+	testMu.Lock()
+	defer testMu.Unlock()
+
+	masterNodeURL := "http://0.0.0.0:8000"
+
+	errChan := make(chan error, 3)
+	allContext, cancel := context.WithCancel(context.Background())
+
+	// run primary node in background
+	go func() {
+		service := primary.NewService()
+		if err := service.Run(allContext, "8000"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// run worker0 node in background
+	go func() {
+		worker0 := worker.NewService(masterNodeURL)
+		if err := worker0.Run(allContext, "8001"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// wait a bit for primary node and worker node to init
+	time.Sleep(time.Millisecond * 500)
+
+	request := func(method string, path string, body any) (int, []byte) {
+		value, err := json.Marshal(body)
+		panicErr(err)
+		req, err := http.NewRequest(method, masterNodeURL+path, bytes.NewReader(value))
+		panicErr(err)
+		res, err := http.DefaultClient.Do(req)
+		panicErr(err)
+		resBody, err := io.ReadAll(res.Body)
+		panicErr(err)
+		return res.StatusCode, resBody
+	}
+
+	// create a structure of each type for several keys so that
+	// some of them are moved by the rebalance
+	numKeys := 10
+	for i := 0; i < numKeys; i++ {
+		status, _ := request(http.MethodPost, fmt.Sprintf("/lists/list%d/push", i), map[string]any{
+			"values": []string{"b", "c"},
+		})
+		assert.Equal(t, 200, status)
+		status, body := request(http.MethodPost, fmt.Sprintf("/lists/list%d/push", i), map[string]any{
+			"values": []string{"a"},
+			"left":   true,
+		})
+		assert.Equal(t, 200, status)
+		assert.JSONEq(t, `{"length":3}`, string(body))
+
+		status, body = request(http.MethodPost, fmt.Sprintf("/sets/set%d/add", i), map[string]any{
+			"members": []string{"x", "y", "z", "x"},
+		})
+		assert.Equal(t, 200, status)
+		assert.JSONEq(t, `{"added":3}`, string(body))
+
+		status, _ = request(http.MethodPost, fmt.Sprintf("/hashes/hash%d", i), map[string]any{
+			"fields": map[string]string{"name": "keepair", "kind": "kv"},
+		})
+		assert.Equal(t, 200, status)
+
+		status, _ = request(http.MethodPost, fmt.Sprintf("/zsets/zset%d", i), map[string]any{
+			"members": []common.ScoredMember{{Member: "low", Score: 1}, {Member: "high", Score: 10}, {Member: "mid", Score: 5}},
+		})
+		assert.Equal(t, 200, status)
+	}
+
+	// a plain read of a data structure is rejected
+	{
+		status, _ := request(http.MethodGet, "/keys/list0", nil)
+		assert.NotEqual(t, 200, status)
+		status, _ = request(http.MethodPost, "/sets/list0/add", map[string]any{"members": []string{"a"}})
+		assert.Equal(t, 409, status)
+	}
+
+	// run worker1 node in background to trigger a rebalance
+	go func() {
+		worker1 := worker.NewService(masterNodeURL)
+		if err := worker1.Run(allContext, "8002"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	time.Sleep(time.Second)
+
+	for i := 0; i < numKeys; i++ {
+		status, body := request(http.MethodGet, fmt.Sprintf("/lists/list%d", i), nil)
+		assert.Equal(t, 200, status)
+		assert.JSONEq(t, `{"values":["a","b","c"]}`, string(body))
+
+		status, body = request(http.MethodPost, fmt.Sprintf("/lists/list%d/pop", i), nil)
+		assert.Equal(t, 200, status)
+		assert.JSONEq(t, `{"value":"c"}`, string(body))
+
+		status, body = request(http.MethodPost, fmt.Sprintf("/sets/set%d/remove", i), map[string]any{
+			"members": []string{"y"},
+		})
+		assert.Equal(t, 200, status)
+		assert.JSONEq(t, `{"removed":1}`, string(body))
+
+		status, body = request(http.MethodGet, fmt.Sprintf("/sets/set%d", i), nil)
+		assert.Equal(t, 200, status)
+		assert.JSONEq(t, `{"members":["x","z"]}`, string(body))
+
+		status, body = request(http.MethodGet, fmt.Sprintf("/hashes/hash%d/name", i), nil)
+		assert.Equal(t, 200, status)
+		assert.JSONEq(t, `{"value":"keepair"}`, string(body))
+
+		status, body = request(http.MethodGet, fmt.Sprintf("/hashes/hash%d", i), nil)
+		assert.Equal(t, 200, status)
+		assert.JSONEq(t, `{"fields":{"name":"keepair","kind":"kv"}}`, string(body))
+
+		status, body = request(http.MethodGet, fmt.Sprintf("/zsets/zset%d?min=2&max=10", i), nil)
+		assert.Equal(t, 200, status)
+		assert.JSONEq(t, `{"members":[{"member":"mid","score":5},{"member":"high","score":10}]}`, string(body))
+	}
+
+	cancel() // close servers
+	for i := 0; i < cap(errChan); i++ {
+		assert.ErrorContains(t, <-errChan, "context canceled")
+	}
+}
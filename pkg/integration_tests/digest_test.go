@@ -0,0 +1,119 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"keepair/pkg/common"
+	"keepair/pkg/primary"
+	"keepair/pkg/primary/antientropy"
+	"keepair/pkg/primary/node"
+	"keepair/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestDigestSync checks that replicas holding the same data have the
+// same digest, and that a sync only transfers the keys that differ
+func TestDigestSync(t *testing.T) {
+
+	testMu.Lock()
+	defer testMu.Unlock()
+
+	masterNodeURL := "http://0.0.0.0:8000"
+
+	errChan := make(chan error, 3)
+	allContext, cancel := context.WithCancel(context.Background())
+
+	// run primary node in background, with every key on both workers
+	go func() {
+		config := primary.DefaultConfig()
+		config.Node.ReplicationFactor = 2
+		service := primary.NewServiceWithConfig(config)
+		if err := service.Run(allContext, "8000"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// run worker nodes in background
+	for _, port := range []string{"8001", "8002"} {
+		go func(port string) {
+			w := worker.NewService(masterNodeURL)
+			if err := w.Run(allContext, port); err != nil {
+				errChan <- err
+			}
+		}(port)
+		time.Sleep(time.Millisecond * 500)
+	}
+
+	request := func(method string, url string, body string) []byte {
+		req, err := http.NewRequest(method, url, bytes.NewReader([]byte(body)))
+		panicErr(err)
+		res, err := http.DefaultClient.Do(req)
+		panicErr(err)
+		resBody, err := io.ReadAll(res.Body)
+		panicErr(err)
+		assert.Equalf(t, 200, res.StatusCode, "%s %s: %s", method, url, resBody)
+		return resBody
+	}
+	getDigest := func(url string) common.Digest {
+		var digest common.Digest
+		panicErr(json.Unmarshal(request(http.MethodGet, url+"/digest", ""), &digest))
+		return digest
+	}
+
+	for i := 0; i < 20; i++ {
+		request(http.MethodPost, fmt.Sprintf("%s/keys/key-%d", masterNodeURL, i), "value")
+	}
+	request(http.MethodPost, masterNodeURL+"/lists/list/push", `{"values":["a","b"]}`)
+
+	var placement node.PlacementReport
+	panicErr(json.Unmarshal(request(http.MethodGet, masterNodeURL+"/placement", ""), &placement))
+	nodeURL := map[string]string{}
+	for _, n := range placement.Nodes {
+		nodeURL[n.ID] = "http://" + n.Address
+	}
+	source, target := placement.Nodes[0].ID, placement.Nodes[1].ID
+
+	assert.Equal(t, getDigest(nodeURL[source]), getDigest(nodeURL[target]))
+
+	// make the target differ from the source
+	request(http.MethodPost, nodeURL[target]+"/keys/key-1", "changed")
+	request(http.MethodDelete, nodeURL[target]+"/keys/key-2", "")
+	request(http.MethodPost, nodeURL[target]+"/keys/extra", "value")
+	request(http.MethodPost, nodeURL[target]+"/lists/list/pop", "")
+	assert.NotEqual(t, getDigest(nodeURL[source]).Root, getDigest(nodeURL[target]).Root)
+
+	syncURL := fmt.Sprintf("%s/sync?source=%s&target=%s", masterNodeURL, source, target)
+
+	var report antientropy.Report
+	panicErr(json.Unmarshal(request(http.MethodPost, syncURL+"&dryRun=true", ""), &report))
+	assert.False(t, report.InSync)
+	assert.False(t, report.Applied)
+	assert.ElementsMatch(t, []antientropy.Difference{
+		{Key: "key-1", Action: common.SetEntry},
+		{Key: "key-2", Action: common.SetEntry},
+		{Key: "extra", Action: common.DeleteEntry},
+		{Key: "list", Action: common.SetEntry},
+	}, report.Differences)
+
+	panicErr(json.Unmarshal(request(http.MethodPost, syncURL, ""), &report))
+	assert.True(t, report.Applied)
+	assert.Equal(t, getDigest(nodeURL[source]), getDigest(nodeURL[target]))
+	assert.Equal(t, "value", string(request(http.MethodGet, nodeURL[target]+"/keys/key-1", "")))
+	assert.Contains(t, string(request(http.MethodGet, nodeURL[target]+"/lists/list", "")), `"b"`)
+
+	panicErr(json.Unmarshal(request(http.MethodPost, syncURL, ""), &report))
+	assert.True(t, report.InSync)
+
+	cancel() // close servers
+	for i := 0; i < cap(errChan); i++ {
+		assert.ErrorContains(t, <-errChan, "context canceled")
+	}
+}
@@ -0,0 +1,136 @@
+package integration_tests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"keepair/pkg/primary"
+	"keepair/pkg/primary/clients"
+	"keepair/pkg/primary/node"
+	"keepair/pkg/seeder"
+	"keepair/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestDrainNode cordons a worker, checks that membership changes are
+// refused while it is cordoned, then drains another worker and checks
+// that its keys moved to the workers that stay
+func TestDrainNode(t *testing.T) {
+
+	testMu.Lock()
+	defer testMu.Unlock()
+
+	masterNodeURL := "http://0.0.0.0:8000"
+
+	errChan := make(chan error, 4)
+	allContext, cancel := context.WithCancel(context.Background())
+
+	// run primary node in background
+	go func() {
+		service := primary.NewService()
+		if err := service.Run(allContext, "8000"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// run worker nodes in background, keeping the last one to drain it
+	var drained worker.IService
+	for _, port := range []string{"8001", "8002", "8003"} {
+		w := worker.NewService(masterNodeURL)
+		drained = w
+		go func(port string) {
+			if err := w.Run(allContext, port); err != nil {
+				errChan <- err
+			}
+		}(port)
+		time.Sleep(time.Millisecond * 500)
+	}
+
+	kvs, err := seeder.NewSeeder(masterNodeURL, 50, 20).SeedKVs(300)
+	panicErr(err)
+
+	getTopology := func() node.Topology {
+		res, err := http.Get(masterNodeURL + "/topology")
+		panicErr(err)
+		defer res.Body.Close()
+		var topology node.Topology
+		panicErr(json.NewDecoder(res.Body).Decode(&topology))
+		return topology
+	}
+	request := func(method, path string) int {
+		req, err := http.NewRequest(method, masterNodeURL+path, nil)
+		panicErr(err)
+		res, err := http.DefaultClient.Do(req)
+		panicErr(err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+	checkKeys := func() {
+		for key, value := range kvs {
+			res, err := http.Get(masterNodeURL + "/keys/" + key)
+			panicErr(err)
+			body, err := io.ReadAll(res.Body)
+			panicErr(err)
+			res.Body.Close()
+			assert.Equal(t, 200, res.StatusCode, key)
+			assert.Equal(t, value, body, key)
+		}
+	}
+
+	topology := getTopology()
+	assert.Len(t, topology.Nodes, 3)
+	var cordoned, drainedNode node.TopologyNode
+	for _, n := range topology.Nodes {
+		if n.ID == drained.GetID() {
+			drainedNode = n
+		} else if cordoned.ID == "" {
+			cordoned = n
+		}
+	}
+
+	assert.Equal(t, 404, request(http.MethodPost, "/nodes/unknown/cordon"))
+
+	// a cordoned node keeps its keys, and no other node can leave
+	assert.Equal(t, 200, request(http.MethodPost, "/nodes/"+cordoned.ID+"/cordon"))
+	for _, n := range getTopology().Nodes {
+		assert.Equal(t, n.ID == cordoned.ID, n.Cordoned, n.ID)
+	}
+	assert.Equal(t, 409, request(http.MethodDelete, "/nodes/"+drainedNode.ID))
+	assert.Equal(t, 409, request(http.MethodPost, "/nodes/"+drainedNode.ID+"/drain"))
+	assert.Len(t, getTopology().Nodes, 3)
+	checkKeys()
+
+	assert.Equal(t, 200, request(http.MethodPost, "/nodes/"+cordoned.ID+"/uncordon"))
+	assert.False(t, getTopology().Nodes[0].Cordoned)
+
+	// the drained worker hands its keys over and leaves
+	stats, err := clients.NewWorkerClient(drainedNode.URL()).GetStats()
+	panicErr(err)
+	assert.Greater(t, stats.ObjectCount, 0)
+
+	panicErr(drained.Drain(context.Background()))
+	topology = getTopology()
+	assert.Len(t, topology.Nodes, 2)
+	for _, n := range topology.Nodes {
+		assert.NotEqual(t, drainedNode.ID, n.ID)
+		assert.False(t, n.Cordoned)
+	}
+	stats, err = clients.NewWorkerClient(drainedNode.URL()).GetStats()
+	panicErr(err)
+	assert.Equal(t, 0, stats.ObjectCount)
+	checkKeys()
+
+	// draining it again has nothing to do
+	assert.NoError(t, drained.Drain(context.Background()))
+	assert.Len(t, getTopology().Nodes, 2)
+
+	cancel() // close servers
+	for i := 0; i < cap(errChan); i++ {
+		assert.ErrorContains(t, <-errChan, "context canceled")
+	}
+}
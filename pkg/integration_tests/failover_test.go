@@ -0,0 +1,233 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"keepair/pkg/primary"
+	"keepair/pkg/primary/node"
+	"keepair/pkg/seeder"
+	"keepair/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestFailover kills a worker while keys are being written, and
+// checks that it is removed from the topology and that every
+// acknowledged write can still be read
+func TestFailover(t *testing.T) {
+
+	testMu.Lock()
+	defer testMu.Unlock()
+
+	masterNodeURL := "http://0.0.0.0:8000"
+
+	errChan := make(chan error, 3)
+	allContext, cancel := context.WithCancel(context.Background())
+	worker1Context, killWorker1 := context.WithCancel(allContext)
+
+	// run primary node in background, with every key on both workers
+	go func() {
+		config := primary.DefaultConfig()
+		config.Node.ReplicationFactor = 2
+		config.Node.LeaseDuration = time.Millisecond * 300
+		config.Node.HealthCheckInterval = time.Millisecond * 100
+		config.Node.SuspectAfter = 1
+		config.Node.DeadAfter = 3
+		service := primary.NewServiceWithConfig(config)
+		if err := service.Run(allContext, "8000"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// run worker nodes in background
+	for port, ctx := range map[string]context.Context{"8001": allContext, "8002": worker1Context} {
+		go func(port string, ctx context.Context) {
+			w := worker.NewService(masterNodeURL)
+			if err := w.Run(ctx, port); err != nil {
+				errChan <- err
+			}
+		}(port, ctx)
+		time.Sleep(time.Millisecond * 500)
+	}
+
+	getTopology := func(query string) node.Topology {
+		res, err := http.Get(masterNodeURL + "/topology" + query)
+		panicErr(err)
+		body, err := io.ReadAll(res.Body)
+		panicErr(err)
+		assert.Equal(t, 200, res.StatusCode)
+		var topology node.Topology
+		panicErr(json.Unmarshal(body, &topology))
+		return topology
+	}
+
+	topology := getTopology("")
+	assert.Len(t, topology.Nodes, 2)
+
+	// write keys in the background, keeping track of the
+	// writes that were acknowledged
+	acked := make(map[string]string)
+	numErrors := 0
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			key, value := fmt.Sprintf("key-%d", i), fmt.Sprintf("value-%d", i)
+			res, err := http.Post(masterNodeURL+"/keys/"+key, "", bytes.NewReader([]byte(value)))
+			panicErr(err)
+			res.Body.Close()
+			if res.StatusCode == 200 || res.StatusCode == 202 {
+				acked[key] = value
+			} else {
+				numErrors++
+			}
+			time.Sleep(time.Millisecond * 5)
+		}
+	}()
+
+	time.Sleep(time.Millisecond * 200)
+	killWorker1()
+	assert.ErrorContains(t, <-errChan, "context canceled")
+
+	// wait for the topology to drop the dead worker
+	for len(topology.Nodes) != 1 {
+		topology = getTopology(fmt.Sprintf("?version=%d&timeout=5s", topology.Version))
+	}
+	assert.Equal(t, node.HealthyStatus, topology.Nodes[0].Status)
+	assert.Equal(t, 0, topology.Nodes[0].Index)
+
+	wg.Wait()
+	time.Sleep(time.Millisecond * 300)
+
+	// only writes made while the failure was being detected may fail
+	assert.Less(t, numErrors, 50)
+	assert.Greater(t, len(acked), 150)
+	for key, value := range acked {
+		res, err := http.Get(masterNodeURL + "/keys/" + key)
+		panicErr(err)
+		body, err := io.ReadAll(res.Body)
+		panicErr(err)
+		assert.Equal(t, 200, res.StatusCode, key)
+		assert.Equal(t, value, string(body))
+	}
+
+	cancel() // close servers
+	for i := 0; i < cap(errChan)-1; i++ {
+		assert.ErrorContains(t, <-errChan, "context canceled")
+	}
+}
+
+// TestNoFailoverWithoutReplicas kills the only replica of some keys,
+// and checks that the dead worker keeps its partitions until it is
+// removed by hand
+func TestNoFailoverWithoutReplicas(t *testing.T) {
+
+	testMu.Lock()
+	defer testMu.Unlock()
+
+	masterNodeURL := "http://0.0.0.0:8000"
+
+	errChan := make(chan error, 3)
+	allContext, cancel := context.WithCancel(context.Background())
+	worker1Context, killWorker1 := context.WithCancel(allContext)
+
+	// run primary node in background, with every key on a single worker
+	go func() {
+		config := primary.DefaultConfig()
+		config.Node.LeaseDuration = time.Millisecond * 300
+		config.Node.HealthCheckInterval = time.Millisecond * 100
+		config.Node.SuspectAfter = 1
+		config.Node.DeadAfter = 3
+		service := primary.NewServiceWithConfig(config)
+		if err := service.Run(allContext, "8000"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// run worker nodes in background, keeping the one to kill
+	worker1 := worker.NewService(masterNodeURL)
+	for port, w := range map[string]worker.IService{"8001": worker.NewService(masterNodeURL), "8002": worker1} {
+		ctx := allContext
+		if w == worker1 {
+			ctx = worker1Context
+		}
+		go func(port string, w worker.IService, ctx context.Context) {
+			if err := w.Run(ctx, port); err != nil {
+				errChan <- err
+			}
+		}(port, w, ctx)
+		time.Sleep(time.Millisecond * 500)
+	}
+
+	getTopology := func() node.Topology {
+		res, err := http.Get(masterNodeURL + "/topology")
+		panicErr(err)
+		defer res.Body.Close()
+		var topology node.Topology
+		panicErr(json.NewDecoder(res.Body).Decode(&topology))
+		return topology
+	}
+	countReadable := func(kvs map[string][]byte) int {
+		count := 0
+		for key, value := range kvs {
+			res, err := http.Get(masterNodeURL + "/keys/" + key)
+			panicErr(err)
+			body, err := io.ReadAll(res.Body)
+			panicErr(err)
+			res.Body.Close()
+			if res.StatusCode == 200 && string(value) == string(body) {
+				count++
+			}
+		}
+		return count
+	}
+
+	kvs, err := seeder.NewSeeder(masterNodeURL, 50, 20).SeedKVs(100)
+	panicErr(err)
+	assert.Equal(t, len(kvs), countReadable(kvs))
+
+	killWorker1()
+	assert.ErrorContains(t, <-errChan, "context canceled")
+
+	// the dead worker is kept, and so are the keys of the other one
+	assert.Eventually(t, func() bool {
+		for _, n := range getTopology().Nodes {
+			if n.ID == worker1.GetID() {
+				return n.Status == node.DeadStatus
+			}
+		}
+		return false
+	}, time.Second*3, time.Millisecond*50)
+	time.Sleep(time.Millisecond * 500)
+	assert.Len(t, getTopology().Nodes, 2)
+	readable := countReadable(kvs)
+	assert.Greater(t, readable, 0)
+	assert.Less(t, readable, len(kvs))
+
+	// removing it gives up its keys
+	req, err := http.NewRequest(http.MethodDelete, masterNodeURL+"/nodes/"+worker1.GetID(), nil)
+	panicErr(err)
+	res, err := http.DefaultClient.Do(req)
+	panicErr(err)
+	res.Body.Close()
+	assert.Equal(t, 200, res.StatusCode)
+	topology := getTopology()
+	if assert.Len(t, topology.Nodes, 1) {
+		assert.Equal(t, node.HealthyStatus, topology.Nodes[0].Status)
+	}
+	assert.Equal(t, readable, countReadable(kvs))
+
+	cancel() // close servers
+	for i := 0; i < cap(errChan)-1; i++ {
+		assert.ErrorContains(t, <-errChan, "context canceled")
+	}
+}
@@ -0,0 +1,117 @@
+package integration_tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"keepair/pkg/gossip"
+	"keepair/pkg/primary"
+	"keepair/pkg/primary/node"
+	"keepair/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestGossip checks that workers gossip about each other, and that
+// the primary fails over a worker that the others find dead without
+// waiting for its own failure count
+func TestGossip(t *testing.T) {
+
+	testMu.Lock()
+	defer testMu.Unlock()
+
+	masterNodeURL := "http://0.0.0.0:8000"
+
+	errChan := make(chan error, 3)
+	allContext, cancel := context.WithCancel(context.Background())
+	worker1Context, killWorker1 := context.WithCancel(allContext)
+
+	// run primary node in background, which on its own would
+	// keep a worker without a lease suspect for a long time, with
+	// replicas so that a dead worker can be failed over
+	go func() {
+		config := primary.DefaultConfig()
+		config.Node.ReplicationFactor = 2
+		config.Node.LeaseDuration = time.Millisecond * 300
+		config.Node.HealthCheckInterval = time.Millisecond * 100
+		config.Node.DeadAfter = 1000
+		service := primary.NewServiceWithConfig(config)
+		if err := service.Run(allContext, "8000"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// run worker nodes in background, gossiping often
+	for port, ctx := range map[string]context.Context{"8001": allContext, "8002": worker1Context} {
+		go func(port string, ctx context.Context) {
+			config := worker.DefaultConfig()
+			config.Gossip.ProbeInterval = time.Millisecond * 50
+			config.Gossip.ProbeTimeout = time.Millisecond * 20
+			config.Gossip.SuspicionTimeout = time.Millisecond * 300
+			w, err := worker.NewServiceWithConfig(masterNodeURL, config)
+			panicErr(err)
+			if err := w.Run(ctx, port); err != nil {
+				errChan <- err
+			}
+		}(port, ctx)
+		time.Sleep(time.Millisecond * 500)
+	}
+
+	type nodeGossip struct {
+		ID          string       `json:"id"`
+		Address     string       `json:"address"`
+		Status      node.Status  `json:"status"`
+		GossipState gossip.State `json:"gossipState"`
+	}
+	getNodes := func() []nodeGossip {
+		res, err := http.Get(masterNodeURL + "/nodes")
+		panicErr(err)
+		defer res.Body.Close()
+		var nodes struct {
+			Nodes []nodeGossip `json:"nodes"`
+		}
+		panicErr(json.NewDecoder(res.Body).Decode(&nodes))
+		return nodes.Nodes
+	}
+
+	// each worker reports the other as alive
+	assert.Eventually(t, func() bool {
+		nodes := getNodes()
+		for _, n := range nodes {
+			if n.GossipState != gossip.Alive {
+				return false
+			}
+		}
+		return len(nodes) == 2
+	}, time.Second*3, time.Millisecond*100)
+
+	{
+		res, err := http.Get("http://0.0.0.0:8001/gossip/members")
+		panicErr(err)
+		var members struct {
+			Members []gossip.Member `json:"members"`
+		}
+		panicErr(json.NewDecoder(res.Body).Decode(&members))
+		res.Body.Close()
+		assert.Len(t, members.Members, 2)
+		for _, m := range members.Members {
+			assert.Equal(t, gossip.Alive, m.State)
+		}
+	}
+
+	// worker0 finds worker1 dead, so it is failed over
+	killWorker1()
+	assert.ErrorContains(t, <-errChan, "context canceled")
+	assert.Eventually(t, func() bool {
+		nodes := getNodes()
+		return len(nodes) == 1 && nodes[0].Address[len(nodes[0].Address)-4:] == "8001"
+	}, time.Second*5, time.Millisecond*100)
+
+	cancel() // close servers
+	for i := 0; i < cap(errChan)-1; i++ {
+		assert.ErrorContains(t, <-errChan, "context canceled")
+	}
+}
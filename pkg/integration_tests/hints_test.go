@@ -0,0 +1,297 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"keepair/pkg/common"
+	"keepair/pkg/gossip"
+	"keepair/pkg/partition"
+	"keepair/pkg/primary"
+	"keepair/pkg/worker"
+	"keepair/pkg/worker/changelog"
+	"keepair/pkg/worker/ownership"
+	"keepair/pkg/worker/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestHintedHandoff checks that writes for a worker that is down are
+// accepted as hints and replayed once the worker is back up
+func TestHintedHandoff(t *testing.T) {
+
+	testMu.Lock()
+	defer testMu.Unlock()
+
+	masterNodeURL := "http://0.0.0.0:8000"
+	workerID := "hinted-worker"
+
+	errChan := make(chan error, 4)
+	allContext, cancel := context.WithCancel(context.Background())
+
+	// run primary node in background
+	go func() {
+		config := primary.DefaultConfig()
+		config.Node.LeaseDuration = time.Millisecond * 300
+		config.Node.HealthCheckInterval = time.Millisecond * 100
+		// keep the stopped worker in the cluster until it is back
+		config.Node.DeadAfter = 1000
+		service := primary.NewServiceWithConfig(config)
+		if err := service.Run(allContext, "8000"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// run worker0 node in background
+	go func() {
+		worker0 := worker.NewService(masterNodeURL)
+		if err := worker0.Run(allContext, "8001"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// run a worker server that can be stopped and started
+	// again under the same ID, renewing its lease while it runs
+	runWorker1 := func(ctx context.Context) {
+		go func() {
+			s := store.NewMemStore(workerID, changelog.NewMemoryLog(changelog.DefaultConfig()))
+			g := gossip.New(workerID, gossip.DefaultConfig(), gossip.NewHTTPTransport())
+			if err := worker.NewServerWithGossip(workerID, s, g, ownership.New(workerID)).Run(ctx, "8002"); err != nil {
+				errChan <- err
+			}
+		}()
+		go func() {
+			for ctx.Err() == nil {
+				res, err := http.Post(masterNodeURL+"/nodes/"+workerID+"/heartbeat", "application/json", bytes.NewReader([]byte("{}")))
+				if err == nil {
+					res.Body.Close()
+				}
+				time.Sleep(time.Millisecond * 100)
+			}
+		}()
+	}
+	worker1Context, stopWorker1 := context.WithCancel(allContext)
+	runWorker1(worker1Context)
+
+	// wait a bit for primary node and worker nodes to init
+	time.Sleep(time.Millisecond * 500)
+
+	{
+		body, err := json.Marshal(map[string]string{"id": workerID, "port": "8002"})
+		panicErr(err)
+		res, err := http.Post(masterNodeURL+"/nodes", "application/json", bytes.NewReader(body))
+		panicErr(err)
+		assert.Equal(t, 200, res.StatusCode)
+	}
+
+	// a failed health check error does not unmarshal into
+	// node.Node, so only decode the fields that are needed
+	type nodeHints struct {
+		ID           string `json:"id"`
+		Index        int    `json:"index"`
+		PendingHints int    `json:"pendingHints"`
+	}
+	getWorker1 := func() nodeHints {
+		res, err := http.Get(masterNodeURL + "/nodes")
+		panicErr(err)
+		body, err := io.ReadAll(res.Body)
+		panicErr(err)
+		var nodes struct {
+			Nodes []nodeHints `json:"nodes"`
+		}
+		panicErr(json.Unmarshal(body, &nodes))
+		for _, n := range nodes.Nodes {
+			if n.ID == workerID {
+				return n
+			}
+		}
+		panic("worker1 not found")
+	}
+
+	// pick a key owned by worker1
+	key := "a"
+	if partition.GenerateDeterministicPartitionKey(key, 2) != getWorker1().Index {
+		key = "b"
+	}
+
+	// stop worker1 and wait for its lease to expire
+	stopWorker1()
+	assert.ErrorContains(t, <-errChan, "context canceled")
+	time.Sleep(time.Millisecond * 600)
+
+	res, err := http.Post(masterNodeURL+"/keys/"+key, "", bytes.NewReader([]byte("hinted-value")))
+	panicErr(err)
+	body, err := io.ReadAll(res.Body)
+	panicErr(err)
+	assert.Equal(t, 202, res.StatusCode)
+	assert.Equal(t, "hinted", string(body))
+	assert.Equal(t, 1, getWorker1().PendingHints)
+
+	// restart worker1, which is sent the hint once its lease is renewed
+	runWorker1(allContext)
+	time.Sleep(time.Millisecond * 500)
+
+	assert.Equal(t, 0, getWorker1().PendingHints)
+	res, err = http.Get(masterNodeURL + "/keys/" + key)
+	panicErr(err)
+	body, err = io.ReadAll(res.Body)
+	panicErr(err)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "hinted-value", string(body))
+
+	cancel() // close servers
+	for i := 0; i < cap(errChan)-1; i++ {
+		assert.ErrorContains(t, <-errChan, "context canceled")
+	}
+}
+
+// TestHintedFollower checks that a write a follower misses is kept by
+// its leader, and sent to the follower as a hint once it is back up
+func TestHintedFollower(t *testing.T) {
+
+	testMu.Lock()
+	defer testMu.Unlock()
+
+	masterNodeURL := "http://0.0.0.0:8000"
+	workerID := "hinted-follower"
+
+	errChan := make(chan error, 4)
+	allContext, cancel := context.WithCancel(context.Background())
+
+	// run primary node in background, with every key on both workers
+	go func() {
+		config := primary.DefaultConfig()
+		config.Node.ReplicationFactor = 2
+		config.Node.LeaseDuration = time.Millisecond * 300
+		config.Node.HealthCheckInterval = time.Millisecond * 100
+		config.Node.DeadAfter = 1000
+		service := primary.NewServiceWithConfig(config)
+		if err := service.Run(allContext, "8000"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// run worker0 node in background
+	go func() {
+		worker0 := worker.NewService(masterNodeURL)
+		if err := worker0.Run(allContext, "8001"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// run a worker server that can be stopped and started
+	// again under the same ID, renewing its lease while it runs
+	runWorker1 := func(ctx context.Context) {
+		go func() {
+			s := store.NewMemStore(workerID, changelog.NewMemoryLog(changelog.DefaultConfig()))
+			g := gossip.New(workerID, gossip.DefaultConfig(), gossip.NewHTTPTransport())
+			if err := worker.NewServerWithGossip(workerID, s, g, ownership.New(workerID)).Run(ctx, "8002"); err != nil {
+				errChan <- err
+			}
+		}()
+		go func() {
+			for ctx.Err() == nil {
+				res, err := http.Post(masterNodeURL+"/nodes/"+workerID+"/heartbeat", "application/json", bytes.NewReader([]byte("{}")))
+				if err == nil {
+					res.Body.Close()
+				}
+				time.Sleep(time.Millisecond * 100)
+			}
+		}()
+	}
+	worker1Context, stopWorker1 := context.WithCancel(allContext)
+	runWorker1(worker1Context)
+
+	// wait a bit for primary node and worker nodes to init
+	time.Sleep(time.Millisecond * 500)
+
+	{
+		body, err := json.Marshal(map[string]string{"id": workerID, "port": "8002"})
+		panicErr(err)
+		res, err := http.Post(masterNodeURL+"/nodes", "application/json", bytes.NewReader(body))
+		panicErr(err)
+		assert.Equal(t, 200, res.StatusCode)
+	}
+
+	type nodeHints struct {
+		ID           string `json:"id"`
+		Index        int    `json:"index"`
+		PendingHints int    `json:"pendingHints"`
+	}
+	getWorker1 := func() nodeHints {
+		res, err := http.Get(masterNodeURL + "/nodes")
+		panicErr(err)
+		body, err := io.ReadAll(res.Body)
+		panicErr(err)
+		var nodes struct {
+			Nodes []nodeHints `json:"nodes"`
+		}
+		panicErr(json.Unmarshal(body, &nodes))
+		for _, n := range nodes.Nodes {
+			if n.ID == workerID {
+				return n
+			}
+		}
+		panic("worker1 not found")
+	}
+	getValue := func(url string) (int, string) {
+		res, err := http.Get(url)
+		panicErr(err)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		panicErr(err)
+		return res.StatusCode, string(body)
+	}
+
+	// pick a key that worker1 follows
+	key := "a"
+	if partition.GenerateDeterministicPartitionKey(key, 2) == getWorker1().Index {
+		key = "b"
+	}
+
+	// stop worker1, and write before its lease expires
+	stopWorker1()
+	assert.ErrorContains(t, <-errChan, "context canceled")
+
+	res, err := http.Post(masterNodeURL+"/keys/"+key, "", bytes.NewReader([]byte("follower-value")))
+	panicErr(err)
+	body, err := io.ReadAll(res.Body)
+	panicErr(err)
+	res.Body.Close()
+	assert.Equal(t, 202, res.StatusCode)
+	assert.Equal(t, "hinted", string(body))
+	assert.Equal(t, 1, getWorker1().PendingHints)
+
+	// the leader kept the write
+	status, value := getValue(masterNodeURL + "/keys/" + key)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "follower-value", value)
+
+	// restart worker1, which is sent the hint once its lease is renewed
+	runWorker1(allContext)
+	assert.Eventually(t, func() bool {
+		return getWorker1().PendingHints == 0
+	}, time.Second*2, time.Millisecond*50)
+
+	// with the version the leader applied it with
+	getVersion := func(workerURL string) common.VersionedValue {
+		status, body := getValue(workerURL + "/versions/" + key)
+		assert.Equal(t, 200, status)
+		var version common.VersionedValue
+		panicErr(json.Unmarshal([]byte(body), &version))
+		return version
+	}
+	leaderVersion, followerVersion := getVersion("http://0.0.0.0:8001"), getVersion("http://0.0.0.0:8002")
+	assert.Equal(t, "follower-value", string(followerVersion.Value))
+	assert.Equal(t, leaderVersion.Timestamp, followerVersion.Timestamp)
+
+	cancel() // close servers
+	for i := 0; i < cap(errChan)-1; i++ {
+		assert.ErrorContains(t, <-errChan, "context canceled")
+	}
+}
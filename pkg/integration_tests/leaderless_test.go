@@ -0,0 +1,146 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"keepair/pkg/common"
+	"keepair/pkg/primary"
+	"keepair/pkg/primary/node"
+	"keepair/pkg/values"
+	"keepair/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLeaderlessQuorum checks quorum reads and writes in leaderless
+// mode, and that a stale replica is repaired when it is read
+func TestLeaderlessQuorum(t *testing.T) {
+
+	testMu.Lock()
+	defer testMu.Unlock()
+
+	masterNodeURL := "http://0.0.0.0:8000"
+
+	errChan := make(chan error, 3)
+	allContext, cancel := context.WithCancel(context.Background())
+
+	// run primary node in background
+	go func() {
+		config := primary.DefaultConfig()
+		config.Node.ReplicationFactor = 2
+		config.Node.Mode = node.LeaderlessMode
+		service := primary.NewServiceWithConfig(config)
+		if err := service.Run(allContext, "8000"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// run worker nodes in background
+	for _, port := range []string{"8001", "8002"} {
+		go func(port string) {
+			w := worker.NewService(masterNodeURL)
+			if err := w.Run(allContext, port); err != nil {
+				errChan <- err
+			}
+		}(port)
+		time.Sleep(time.Millisecond * 500)
+	}
+
+	request := func(method string, url string, body string) (int, string) {
+		req, err := http.NewRequest(method, url, bytes.NewReader([]byte(body)))
+		panicErr(err)
+		res, err := http.DefaultClient.Do(req)
+		panicErr(err)
+		resBody, err := io.ReadAll(res.Body)
+		panicErr(err)
+		return res.StatusCode, string(resBody)
+	}
+	getVersion := func(workerURL string, key string) common.VersionedValue {
+		_, body := request(http.MethodGet, workerURL+"/versions/"+key, "")
+		var version common.VersionedValue
+		panicErr(json.Unmarshal([]byte(body), &version))
+		return version
+	}
+
+	// writes reach every replica with the same timestamp
+	status, _ := request(http.MethodPost, masterNodeURL+"/keys/doc?w=all", "v1")
+	assert.Equal(t, 200, status)
+	version0 := getVersion("http://0.0.0.0:8001", "doc")
+	version1 := getVersion("http://0.0.0.0:8002", "doc")
+	assert.Equal(t, []byte("v1"), version0.Value)
+	assert.Equal(t, version0, version1)
+
+	status, body := request(http.MethodGet, masterNodeURL+"/keys/doc?r=one", "")
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "v1", body)
+
+	status, _ = request(http.MethodGet, masterNodeURL+"/keys/doc?r=3", "")
+	assert.Equal(t, 400, status)
+
+	// write a newer value to worker0 only, leaving worker1 stale
+	{
+		req, err := http.NewRequest(http.MethodPost, "http://0.0.0.0:8001/keys/doc", bytes.NewReader([]byte("v2")))
+		panicErr(err)
+		req.Header.Set(values.TimestampHeader, strconv.FormatInt(version0.Timestamp+1, 10))
+		res, err := http.DefaultClient.Do(req)
+		panicErr(err)
+		assert.Equal(t, 200, res.StatusCode)
+	}
+
+	// an older write is ignored by the worker
+	{
+		req, err := http.NewRequest(http.MethodPost, "http://0.0.0.0:8001/keys/doc", bytes.NewReader([]byte("v0")))
+		panicErr(err)
+		req.Header.Set(values.TimestampHeader, strconv.FormatInt(version0.Timestamp-1, 10))
+		res, err := http.DefaultClient.Do(req)
+		panicErr(err)
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Equal(t, []byte("v2"), getVersion("http://0.0.0.0:8001", "doc").Value)
+	}
+
+	// the newest value wins and is written back to worker1
+	status, body = request(http.MethodGet, masterNodeURL+"/keys/doc?r=all", "")
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "v2", body)
+
+	time.Sleep(time.Millisecond * 200)
+	assert.Equal(t, []byte("v2"), getVersion("http://0.0.0.0:8002", "doc").Value)
+
+	{
+		res, err := http.Get(masterNodeURL + "/nodes")
+		panicErr(err)
+		body, err := io.ReadAll(res.Body)
+		panicErr(err)
+		var nodes struct {
+			Nodes []node.Node `json:"nodes"`
+		}
+		panicErr(json.Unmarshal(body, &nodes))
+		repairs := map[string]int{}
+		for _, n := range nodes.Nodes {
+			repairs[n.Address[strings.LastIndex(n.Address, ":")+1:]] = n.ReadRepairs
+		}
+		assert.Equal(t, 0, repairs["8001"], fmt.Sprint(repairs))
+		assert.Equal(t, 1, repairs["8002"], fmt.Sprint(repairs))
+	}
+
+	// deletes leave tombstones that win over older values
+	status, _ = request(http.MethodDelete, masterNodeURL+"/keys/doc?w=all", "")
+	assert.Equal(t, 200, status)
+	assert.True(t, getVersion("http://0.0.0.0:8002", "doc").Deleted)
+	status, _ = request(http.MethodGet, masterNodeURL+"/keys/doc", "")
+	assert.Equal(t, 404, status)
+
+	cancel() // close servers
+	for i := 0; i < cap(errChan); i++ {
+		assert.ErrorContains(t, <-errChan, "context canceled")
+	}
+}
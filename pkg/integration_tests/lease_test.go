@@ -0,0 +1,108 @@
+package integration_tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"keepair/pkg/common"
+	"keepair/pkg/primary"
+	"keepair/pkg/primary/node"
+	"keepair/pkg/seeder"
+	"keepair/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLeaseHeartbeats checks that worker heartbeats renew their lease,
+// and that a worker that stops sending them becomes suspect while its
+// stats from the latest heartbeat are kept
+func TestLeaseHeartbeats(t *testing.T) {
+
+	testMu.Lock()
+	defer testMu.Unlock()
+
+	masterNodeURL := "http://0.0.0.0:8000"
+
+	errChan := make(chan error, 2)
+	allContext, cancel := context.WithCancel(context.Background())
+	workerContext, stopWorker := context.WithCancel(allContext)
+
+	// run primary node in background, with short leases and
+	// a node that never goes dead during the test
+	go func() {
+		config := primary.DefaultConfig()
+		config.Node.LeaseDuration = time.Millisecond * 300
+		config.Node.HealthCheckInterval = time.Millisecond * 100
+		config.Node.SuspectAfter = 1
+		config.Node.DeadAfter = 1000
+		service := primary.NewServiceWithConfig(config)
+		if err := service.Run(allContext, "8000"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// run worker node in background
+	go func() {
+		w := worker.NewService(masterNodeURL)
+		if err := w.Run(workerContext, "8001"); err != nil {
+			errChan <- err
+		}
+	}()
+	time.Sleep(time.Millisecond * 500)
+
+	// the health check error of an expired lease does not decode
+	// into a node, so only the fields of the lease are read
+	type leaseNode struct {
+		Status              node.Status      `json:"status"`
+		Stats               common.NodeStats `json:"stats"`
+		LeaseExpiry         time.Time        `json:"leaseExpiry"`
+		LastHealthCheckTime time.Time        `json:"lastHealthCheckTime"`
+	}
+	getNode := func() leaseNode {
+		res, err := http.Get(masterNodeURL + "/nodes")
+		panicErr(err)
+		defer res.Body.Close()
+		assert.Equal(t, 200, res.StatusCode)
+		var nodes struct {
+			Nodes []leaseNode `json:"nodes"`
+		}
+		panicErr(json.NewDecoder(res.Body).Decode(&nodes))
+		if !assert.Len(t, nodes.Nodes, 1) {
+			return leaseNode{}
+		}
+		return nodes.Nodes[0]
+	}
+
+	numObjects := 50
+	_, err := seeder.NewSeeder(masterNodeURL, 10, 20).SeedKVs(numObjects)
+	panicErr(err)
+
+	// heartbeats keep renewing the lease
+	first := getNode()
+	assert.Equal(t, node.HealthyStatus, first.Status)
+	assert.True(t, first.LeaseExpiry.After(time.Now()))
+	time.Sleep(time.Millisecond * 300)
+	renewed := getNode()
+	assert.Equal(t, node.HealthyStatus, renewed.Status)
+	assert.True(t, renewed.LeaseExpiry.After(first.LeaseExpiry))
+	assert.True(t, renewed.LastHealthCheckTime.After(first.LastHealthCheckTime))
+
+	// a stopped worker lets its lease expire, and keeps
+	// the stats of its latest heartbeat
+	stopWorker()
+	assert.ErrorContains(t, <-errChan, "context canceled")
+	assert.Eventually(t, func() bool {
+		return getNode().Status == node.SuspectStatus
+	}, time.Second*2, time.Millisecond*50)
+	stopped := getNode()
+	assert.Equal(t, numObjects, stopped.Stats.ObjectCount)
+	assert.True(t, stopped.LeaseExpiry.Before(time.Now()))
+	time.Sleep(time.Millisecond * 300)
+	assert.Equal(t, stopped.LeaseExpiry, getNode().LeaseExpiry)
+
+	cancel() // close servers
+	assert.ErrorContains(t, <-errChan, "context canceled")
+}
@@ -0,0 +1,184 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"keepair/pkg/primary"
+	"keepair/pkg/primary/clients"
+	"keepair/pkg/primary/node"
+	"keepair/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMigrationRecovery removes a worker that is down, which fails the
+// migration and leaves it in the state file. The migration is rolled
+// back, then a second one is resumed by the primary after a restart.
+func TestMigrationRecovery(t *testing.T) {
+
+	testMu.Lock()
+	defer testMu.Unlock()
+
+	masterNodeURL := "http://0.0.0.0:8000"
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+
+	errChan := make(chan error, 5)
+	allContext, cancel := context.WithCancel(context.Background())
+
+	runPrimary := func() context.CancelFunc {
+		ctx, cancelPrimary := context.WithCancel(allContext)
+		go func() {
+			config := primary.DefaultConfig()
+			config.Node.StateFile = stateFile
+			// the stopped worker is not failed over during the test
+			config.Node.LeaseDuration = time.Minute
+			service := primary.NewServiceWithConfig(config)
+			if err := service.Run(ctx, "8000"); err != nil {
+				errChan <- err
+			}
+		}()
+		time.Sleep(time.Millisecond * 200)
+		return cancelPrimary
+	}
+	runWorker := func(ctx context.Context, primaryURL string, port string) {
+		go func() {
+			w := worker.NewService(primaryURL)
+			if err := w.Run(ctx, port); err != nil {
+				errChan <- err
+			}
+		}()
+		time.Sleep(time.Millisecond * 500)
+	}
+
+	stopPrimary := runPrimary()
+	runWorker(allContext, masterNodeURL, "8001")
+	workerContext, stopWorker := context.WithCancel(allContext)
+	runWorker(workerContext, masterNodeURL, "8002")
+
+	for i := 0; i < 50; i++ {
+		res, err := http.Post(masterNodeURL+fmt.Sprintf("/keys/key-%d", i), "", bytes.NewReader([]byte(fmt.Sprintf("value-%d", i))))
+		panicErr(err)
+		res.Body.Close()
+		assert.Equal(t, 200, res.StatusCode)
+	}
+
+	getTopology := func() node.Topology {
+		res, err := http.Get(masterNodeURL + "/topology")
+		panicErr(err)
+		defer res.Body.Close()
+		var topology node.Topology
+		panicErr(json.NewDecoder(res.Body).Decode(&topology))
+		return topology
+	}
+	topology := getTopology()
+	assert.Len(t, topology.Nodes, 2)
+	kept, removed := topology.Nodes[0], topology.Nodes[1]
+
+	// the keys of the worker that stays must remain readable
+	keys := make([]string, 0)
+	entryChan, streamErrChan := clients.NewWorkerClient(kept.URL()).StreamEntries()
+	for loop := true; loop; {
+		select {
+		case err := <-streamErrChan:
+			panicErr(err)
+			loop = false
+		case entry := <-entryChan:
+			keys = append(keys, entry.Key)
+		}
+	}
+	assert.NotEmpty(t, keys)
+	checkKeys := func() {
+		for _, key := range keys {
+			res, err := http.Get(masterNodeURL + "/keys/" + key)
+			panicErr(err)
+			body, err := io.ReadAll(res.Body)
+			panicErr(err)
+			res.Body.Close()
+			assert.Equal(t, 200, res.StatusCode, key)
+			assert.Equal(t, "value-"+key[len("key-"):], string(body), key)
+		}
+	}
+	savedMigration := func() *node.MigrationPlan {
+		b, err := os.ReadFile(stateFile)
+		panicErr(err)
+		var state struct {
+			Migration *node.MigrationPlan `json:"migration"`
+		}
+		panicErr(json.Unmarshal(b, &state))
+		return state.Migration
+	}
+	removeNode := func() int {
+		req, err := http.NewRequest(http.MethodDelete, masterNodeURL+"/nodes/"+removed.ID, nil)
+		panicErr(err)
+		res, err := http.DefaultClient.Do(req)
+		panicErr(err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+	post := func(path string) int {
+		res, err := http.Post(masterNodeURL+path, "", nil)
+		panicErr(err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	// the worker cannot be told about the migration, which stops it
+	// without changing membership
+	stopWorker()
+	assert.ErrorContains(t, <-errChan, "context canceled")
+	assert.Equal(t, 500, removeNode())
+	afterFailure := getTopology()
+	assert.Len(t, afterFailure.Nodes, 2)
+	assert.Equal(t, topology.Epoch, afterFailure.Epoch)
+	plan := savedMigration()
+	if assert.NotNil(t, plan) {
+		assert.Equal(t, node.DeleteNode, plan.Operation)
+		assert.Equal(t, removed.ID, plan.NodeID)
+		assert.NotEmpty(t, plan.Error)
+		assert.False(t, plan.Steps[len(plan.Steps)-1].Done)
+	}
+	checkKeys()
+
+	// it is rolled back without the worker, as no data was moved
+	assert.Equal(t, 200, post("/rebalance/rollback"))
+	rolledBack := getTopology()
+	assert.Len(t, rolledBack.Nodes, 2)
+	assert.Equal(t, topology.Epoch+2, rolledBack.Epoch)
+	assert.Nil(t, savedMigration())
+	assert.Equal(t, 404, post("/rebalance/resume"))
+	checkKeys()
+
+	// a second attempt fails the same way, and the primary is
+	// restarted once a worker serves the address again
+	assert.Equal(t, 500, removeNode())
+	assert.NotNil(t, savedMigration())
+	stopPrimary()
+	assert.ErrorContains(t, <-errChan, "context canceled")
+	// the new worker does not register, so only the migration
+	// can change membership
+	runWorker(allContext, "http://0.0.0.0:8009", "8002")
+	runPrimary()
+
+	assert.Eventually(t, func() bool {
+		return len(getTopology().Nodes) == 1
+	}, time.Second*5, time.Millisecond*100)
+	resumed := getTopology()
+	assert.Equal(t, kept.ID, resumed.Nodes[0].ID)
+	assert.Equal(t, rolledBack.Epoch+1, resumed.Epoch)
+	assert.Nil(t, savedMigration())
+	checkKeys()
+
+	cancel() // close servers
+	for i := 0; i < cap(errChan)-2; i++ {
+		assert.ErrorContains(t, <-errChan, "context canceled")
+	}
+}
@@ -0,0 +1,192 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"keepair/pkg/primary"
+	"keepair/pkg/primary/clients"
+	"keepair/pkg/primary/node"
+	"keepair/pkg/seeder"
+	"keepair/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestOnlineRebalance checks that keys can be read and written
+// while a rebalance moves them to a worker that joins
+func TestOnlineRebalance(t *testing.T) {
+
+	testMu.Lock()
+	defer testMu.Unlock()
+
+	masterNodeURL := "http://0.0.0.0:8000"
+
+	errChan := make(chan error, 4)
+	allContext, cancel := context.WithCancel(context.Background())
+
+	// run primary node in background, with a throttled migration
+	// so requests are sure to be served while keys move
+	go func() {
+		config := primary.DefaultConfig()
+		config.Node.TransferBatchSize = 50
+		config.Node.MigrationKeysPerSecond = 500
+		service := primary.NewServiceWithConfig(config)
+		if err := service.Run(allContext, "8000"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// run worker nodes in background
+	for _, port := range []string{"8001", "8002"} {
+		go func(port string) {
+			w := worker.NewService(masterNodeURL)
+			if err := w.Run(allContext, port); err != nil {
+				errChan <- err
+			}
+		}(port)
+		time.Sleep(time.Millisecond * 500)
+	}
+
+	// enough keys for the throttled rebalance to take seconds
+	items, err := seeder.NewSeeder(masterNodeURL, 100, 50).SeedKVs(3000)
+	panicErr(err)
+	keys := make([]string, 0, len(items))
+	for k := range items {
+		keys = append(keys, k)
+	}
+
+	getTopology := func() node.Topology {
+		res, err := http.Get(masterNodeURL + "/topology")
+		panicErr(err)
+		defer res.Body.Close()
+		var topology node.Topology
+		panicErr(json.NewDecoder(res.Body).Decode(&topology))
+		return topology
+	}
+	getStatus := func() (int, node.RebalanceStatus) {
+		res, err := http.Get(masterNodeURL + "/rebalance/status")
+		panicErr(err)
+		defer res.Body.Close()
+		var status node.RebalanceStatus
+		if res.StatusCode == 200 {
+			panicErr(json.NewDecoder(res.Body).Decode(&status))
+		}
+		return res.StatusCode, status
+	}
+
+	get := func(key string) (int, []byte) {
+		res, err := http.Get(masterNodeURL + "/keys/" + key)
+		panicErr(err)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		panicErr(err)
+		return res.StatusCode, body
+	}
+	set := func(key string, value []byte) int {
+		res, err := http.Post(masterNodeURL+"/keys/"+key, "", bytes.NewReader(value))
+		panicErr(err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+	del := func(key string) int {
+		req, err := http.NewRequest(http.MethodDelete, masterNodeURL+"/keys/"+key, nil)
+		panicErr(err)
+		res, err := http.DefaultClient.Do(req)
+		panicErr(err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	// a third worker joins, which moves a third of the keys
+	go func() {
+		w := worker.NewService(masterNodeURL)
+		if err := w.Run(allContext, "8003"); err != nil {
+			errChan <- err
+		}
+	}()
+	assert.Eventually(t, func() bool {
+		code, status := getStatus()
+		return code == 200 && status.Running && status.Phase == node.CopyStep
+	}, time.Second*5, time.Millisecond*10)
+
+	// keys are read and written while they move
+	deleted := make(map[string]bool)
+	for i := 0; i < 40; i++ {
+		key := keys[i%len(keys)]
+		switch i % 4 {
+		case 0:
+			// overwrite a key and read it back
+			value := []byte(fmt.Sprintf("overwritten-%d", i))
+			assert.Equal(t, 200, set(key, value))
+			items[key] = value
+			delete(deleted, key)
+		case 1:
+			// write a new key
+			key = fmt.Sprintf("new-%d", i)
+			value := []byte(fmt.Sprintf("new-%d", i))
+			assert.Equal(t, 200, set(key, value))
+			items[key] = value
+		case 2:
+			assert.Equal(t, 200, del(key))
+			delete(items, key)
+			deleted[key] = true
+		}
+		status, body := get(key)
+		if deleted[key] {
+			assert.Contains(t, string(body), "no value found", key)
+		} else {
+			assert.Equal(t, 200, status, key)
+			assert.Equal(t, string(items[key]), string(body), key)
+		}
+	}
+	code, status := getStatus()
+	assert.Equal(t, 200, code)
+	assert.True(t, status.Running, "requests are served during the migration")
+
+	assert.Eventually(t, func() bool {
+		return len(getTopology().Nodes) == 3
+	}, time.Second*20, time.Millisecond*50)
+
+	// every key has its latest value, and sits on its owners
+	for k, v := range items {
+		status, body := get(k)
+		assert.Equal(t, 200, status, k)
+		assert.Equal(t, string(v), string(body), k)
+	}
+	for k := range deleted {
+		_, body := get(k)
+		assert.Contains(t, string(body), "no value found", k)
+	}
+	{
+		res, err := http.Get(masterNodeURL + "/placement")
+		panicErr(err)
+		var report node.PlacementReport
+		panicErr(json.NewDecoder(res.Body).Decode(&report))
+		res.Body.Close()
+		assert.Empty(t, report.Misplaced)
+		assert.Empty(t, report.Duplicates)
+		assert.Len(t, report.Nodes, 3)
+	}
+
+	// the queues of the migration are discarded once it is committed
+	for _, n := range getTopology().Nodes {
+		client := clients.NewWorkerClient(n.URL())
+		assert.Eventually(t, func() bool {
+			queues, err := client.GetOperationQueues()
+			panicErr(err)
+			return len(queues) == 0
+		}, time.Second*2, time.Millisecond*50, n.ID)
+	}
+
+	cancel() // close servers
+	for i := 0; i < cap(errChan); i++ {
+		assert.ErrorContains(t, <-errChan, "context canceled")
+	}
+}
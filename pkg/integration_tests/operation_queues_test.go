@@ -0,0 +1,153 @@
+package integration_tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"keepair/pkg/common"
+	"keepair/pkg/primary"
+	"keepair/pkg/primary/clients"
+	"keepair/pkg/primary/node"
+	"keepair/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestOperationQueues queues operations of two migrations on a worker,
+// retries a batch, applies one queue and discards the other
+func TestOperationQueues(t *testing.T) {
+
+	testMu.Lock()
+	defer testMu.Unlock()
+
+	masterNodeURL := "http://0.0.0.0:8000"
+
+	errChan := make(chan error, 2)
+	allContext, cancel := context.WithCancel(context.Background())
+
+	// run primary node in background
+	go func() {
+		service := primary.NewService()
+		if err := service.Run(allContext, "8000"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// run worker node in background
+	go func() {
+		w := worker.NewService(masterNodeURL)
+		if err := w.Run(allContext, "8001"); err != nil {
+			errChan <- err
+		}
+	}()
+	time.Sleep(time.Millisecond * 500)
+
+	res, err := http.Get(masterNodeURL + "/topology")
+	panicErr(err)
+	var topology node.Topology
+	panicErr(json.NewDecoder(res.Body).Decode(&topology))
+	res.Body.Close()
+	assert.Len(t, topology.Nodes, 1)
+	client := clients.NewWorkerClient(topology.Nodes[0].URL())
+
+	objectCount := func() int {
+		stats, err := client.GetStats()
+		panicErr(err)
+		return stats.ObjectCount
+	}
+	set := func(keys ...string) []common.EntryOperation {
+		operations := make([]common.EntryOperation, 0, len(keys))
+		for _, key := range keys {
+			operations = append(operations, common.EntryOperation{
+				Action: common.SetEntry,
+				Entry:  common.Entry{Key: key, Value: []byte("value-" + key)},
+			})
+		}
+		return operations
+	}
+
+	queued, err := client.QueueOperations("migration-a", "batch-1", set("a1", "a2"))
+	panicErr(err)
+	assert.True(t, queued)
+	queued, err = client.QueueOperations("migration-b", "batch-1", set("b1"))
+	panicErr(err)
+	assert.True(t, queued)
+
+	// a retried batch is only queued once
+	queued, err = client.QueueOperations("migration-a", "batch-1", set("a1", "a2"))
+	panicErr(err)
+	assert.False(t, queued)
+	queued, err = client.QueueOperations("migration-a", "batch-2", set("a3"))
+	panicErr(err)
+	assert.True(t, queued)
+
+	queues, err := client.GetOperationQueues()
+	panicErr(err)
+	if assert.Len(t, queues, 2) {
+		assert.Equal(t, "migration-a", queues[0].ID)
+		assert.Equal(t, 3, queues[0].Pending)
+		assert.Equal(t, 2, queues[0].Batches)
+		assert.Empty(t, queues[0].Operations)
+		assert.Equal(t, "migration-b", queues[1].ID)
+		assert.Equal(t, 1, queues[1].Pending)
+	}
+
+	// applying a queue leaves the other one pending
+	assert.Equal(t, 0, objectCount())
+	panicErr(client.ApplyOperations("migration-a", false))
+	assert.Equal(t, 3, objectCount())
+	queue, ok, err := client.GetOperationQueue("migration-a")
+	panicErr(err)
+	assert.True(t, ok)
+	assert.Equal(t, 0, queue.Pending)
+	assert.Equal(t, 3, queue.Applied)
+
+	// and a batch retried after the queue was applied is not queued again
+	queued, err = client.QueueOperations("migration-a", "batch-2", set("a3"))
+	panicErr(err)
+	assert.False(t, queued)
+
+	queue, ok, err = client.GetOperationQueue("migration-b")
+	panicErr(err)
+	assert.True(t, ok)
+	if assert.Len(t, queue.Operations, 1) {
+		assert.Equal(t, "b1", queue.Operations[0].Entry.Key)
+	}
+
+	// a discarded queue is never applied
+	ok, err = client.DiscardOperationQueue("migration-b")
+	panicErr(err)
+	assert.True(t, ok)
+	ok, err = client.DiscardOperationQueue("migration-b")
+	panicErr(err)
+	assert.False(t, ok)
+	_, ok, err = client.GetOperationQueue("migration-b")
+	panicErr(err)
+	assert.False(t, ok)
+	panicErr(client.ApplyOperations("migration-b", false))
+	assert.Equal(t, 3, objectCount())
+
+	// a stale copy does not overwrite a newer write of its key
+	stale := set("a1")
+	stale[0].Entry.Value = []byte("stale")
+	stale[0].Entry.Timestamp = 1
+	queued, err = client.QueueOperations("repair", "batch-1", stale)
+	panicErr(err)
+	assert.True(t, queued)
+	panicErr(client.ApplyOperations("repair", true))
+	value, err := client.GetKey("a1")
+	panicErr(err)
+	assert.Equal(t, "value-a1", string(value))
+	queue, ok, err = client.GetOperationQueue("repair")
+	panicErr(err)
+	assert.True(t, ok)
+	assert.Equal(t, 0, queue.Applied)
+
+	cancel() // close servers
+	for i := 0; i < cap(errChan); i++ {
+		assert.ErrorContains(t, <-errChan, "context canceled")
+	}
+}
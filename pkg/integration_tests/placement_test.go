@@ -0,0 +1,128 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"keepair/pkg/common"
+	"keepair/pkg/primary"
+	"keepair/pkg/primary/node"
+	"keepair/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPlacementCheck checks that keys that end up on the wrong
+// worker are reported, and moved or deleted by a repair
+func TestPlacementCheck(t *testing.T) {
+
+	testMu.Lock()
+	defer testMu.Unlock()
+
+	masterNodeURL := "http://0.0.0.0:8000"
+
+	errChan := make(chan error, 3)
+	allContext, cancel := context.WithCancel(context.Background())
+
+	// run primary node in background
+	go func() {
+		service := primary.NewService()
+		if err := service.Run(allContext, "8000"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// run worker nodes in background
+	for _, port := range []string{"8001", "8002"} {
+		go func(port string) {
+			w := worker.NewService(masterNodeURL)
+			if err := w.Run(allContext, port); err != nil {
+				errChan <- err
+			}
+		}(port)
+		time.Sleep(time.Millisecond * 500)
+	}
+
+	setKey := func(url string, key string) {
+		res, err := http.Post(url+"/keys/"+key, "", bytes.NewReader([]byte("value-"+key)))
+		panicErr(err)
+		assert.Equal(t, 200, res.StatusCode)
+	}
+	// workers redirect writes of keys they do not own, so
+	// misplaced keys are planted as replicated writes
+	plantKey := func(url string, key string) {
+		body, err := json.Marshal([]common.EntryOperation{{
+			Action: common.SetEntry,
+			Entry:  common.Entry{Key: key, Value: []byte("value-" + key)},
+		}})
+		panicErr(err)
+		res, err := http.Post(url+"/replicate", "application/json", bytes.NewReader(body))
+		panicErr(err)
+		assert.Equal(t, 200, res.StatusCode)
+	}
+	checkPlacement := func(method string, path string) node.PlacementReport {
+		req, err := http.NewRequest(method, masterNodeURL+path, nil)
+		panicErr(err)
+		res, err := http.DefaultClient.Do(req)
+		panicErr(err)
+		body, err := io.ReadAll(res.Body)
+		panicErr(err)
+		assert.Equal(t, 200, res.StatusCode)
+		var report node.PlacementReport
+		panicErr(json.Unmarshal(body, &report))
+		return report
+	}
+
+	report := checkPlacement(http.MethodGet, "/placement")
+	assert.Len(t, report.Nodes, 2)
+	assert.Empty(t, report.Misplaced)
+
+	// "a" is owned by node 1 and "b" by node 0
+	owner := map[int]string{}
+	for _, n := range report.Nodes {
+		owner[n.Index] = "http://" + n.Address
+	}
+	setKey(masterNodeURL, "b")
+	plantKey(owner[1], "b") // stale duplicate
+	plantKey(owner[0], "a") // only copy is misplaced
+
+	report = checkPlacement(http.MethodGet, "/placement")
+	assert.Len(t, report.Misplaced, 2)
+	assert.Len(t, report.Duplicates, 1)
+	assert.Equal(t, "b", report.Duplicates[0].Key)
+	for _, n := range report.Nodes {
+		assert.Equal(t, 1, n.Misplaced)
+	}
+
+	// "a" is not visible through the primary until repaired
+	res, err := http.Get(masterNodeURL + "/keys/a")
+	panicErr(err)
+	assert.NotEqual(t, 200, res.StatusCode)
+
+	report = checkPlacement(http.MethodPost, "/placement/repair")
+	assert.Equal(t, &node.RepairSummary{Copied: 1, Deleted: 2}, report.Repair)
+
+	report = checkPlacement(http.MethodGet, "/placement")
+	assert.Empty(t, report.Misplaced)
+	assert.Empty(t, report.Duplicates)
+	for _, n := range report.Nodes {
+		assert.Equal(t, 1, n.ObjectCount)
+	}
+
+	res, err = http.Get(masterNodeURL + "/keys/a")
+	panicErr(err)
+	body, err := io.ReadAll(res.Body)
+	panicErr(err)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "value-a", string(body))
+
+	cancel() // close servers
+	for i := 0; i < cap(errChan); i++ {
+		assert.ErrorContains(t, <-errChan, "context canceled")
+	}
+}
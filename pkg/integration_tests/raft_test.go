@@ -0,0 +1,170 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"keepair/pkg/primary"
+	"keepair/pkg/primary/node"
+	"keepair/pkg/raft"
+	"keepair/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRaftPrimaries runs three primaries that replicate membership
+// with raft, and checks that workers can register with any of them,
+// that membership survives the leader stopping, and that a restarted
+// primary catches up from a snapshot
+func TestRaftPrimaries(t *testing.T) {
+
+	testMu.Lock()
+	defer testMu.Unlock()
+
+	primaryPorts := map[string]string{"p0": "8000", "p1": "8003", "p2": "8004"}
+	primaryURLs := make(map[string]string)
+	for ID, port := range primaryPorts {
+		primaryURLs[ID] = fmt.Sprintf("http://127.0.0.1:%s", port)
+	}
+
+	errChan := make(chan error, 6)
+	allContext, cancel := context.WithCancel(context.Background())
+	primaryCancels := make(map[string]context.CancelFunc)
+
+	runPrimary := func(ID string) {
+		ctx, cancelPrimary := context.WithCancel(allContext)
+		primaryCancels[ID] = cancelPrimary
+		go func() {
+			config := primary.DefaultConfig()
+			config.Raft.ID = ID
+			config.Raft.Peers = primaryURLs
+			config.Raft.SnapshotThreshold = 2
+			service := primary.NewServiceWithConfig(config)
+			if err := service.Run(ctx, primaryPorts[ID]); err != nil {
+				errChan <- err
+			}
+		}()
+	}
+	for ID := range primaryPorts {
+		runPrimary(ID)
+	}
+
+	getRaftStatus := func(ID string) (raft.Status, bool) {
+		res, err := http.Get(primaryURLs[ID] + "/raft/status")
+		if err != nil {
+			return raft.Status{}, false
+		}
+		defer res.Body.Close()
+		var status raft.Status
+		panicErr(json.NewDecoder(res.Body).Decode(&status))
+		return status, true
+	}
+	waitForLeader := func(IDs ...string) string {
+		deadline := time.Now().Add(time.Second * 10)
+		for time.Now().Before(deadline) {
+			for _, ID := range IDs {
+				if status, ok := getRaftStatus(ID); ok && status.Role == raft.Leader {
+					return ID
+				}
+			}
+			time.Sleep(time.Millisecond * 50)
+		}
+		t.Fatal("no leader elected")
+		return ""
+	}
+	getTopology := func(ID string) node.Topology {
+		res, err := http.Get(primaryURLs[ID] + "/topology")
+		panicErr(err)
+		defer res.Body.Close()
+		var topology node.Topology
+		panicErr(json.NewDecoder(res.Body).Decode(&topology))
+		return topology
+	}
+	waitForNodes := func(ID string, numNodes int) {
+		assert.Eventually(t, func() bool {
+			return len(getTopology(ID).Nodes) == numNodes
+		}, time.Second*10, time.Millisecond*50, "primary %s should have %d nodes", ID, numNodes)
+	}
+	setKey := func(ID, key, value string) {
+		res, err := http.Post(primaryURLs[ID]+"/keys/"+key, "", bytes.NewReader([]byte(value)))
+		panicErr(err)
+		res.Body.Close()
+		assert.Equal(t, 200, res.StatusCode)
+	}
+	getKey := func(ID, key string) string {
+		res, err := http.Get(primaryURLs[ID] + "/keys/" + key)
+		panicErr(err)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		panicErr(err)
+		assert.Equal(t, 200, res.StatusCode)
+		return string(body)
+	}
+
+	leaderID := waitForLeader("p0", "p1", "p2")
+	followerIDs := make([]string, 0)
+	for ID := range primaryPorts {
+		if ID != leaderID {
+			followerIDs = append(followerIDs, ID)
+		}
+	}
+
+	// a follower forwards the registration to the leader
+	go func() {
+		w := worker.NewService(primaryURLs[followerIDs[0]])
+		if err := w.Run(allContext, "8001"); err != nil {
+			errChan <- err
+		}
+	}()
+	for ID := range primaryPorts {
+		waitForNodes(ID, 1)
+	}
+
+	// every primary routes keys with the replicated membership
+	setKey(followerIDs[0], "a", "apple")
+	setKey(followerIDs[1], "b", "banana")
+	assert.Equal(t, "apple", getKey(leaderID, "a"))
+	assert.Equal(t, "banana", getKey(followerIDs[0], "b"))
+
+	// stop the leader, and wait for another to take over
+	primaryCancels[leaderID]()
+	assert.ErrorContains(t, <-errChan, "context canceled")
+	newLeaderID := waitForLeader(followerIDs...)
+
+	// the worker tries each primary until one accepts it
+	go func() {
+		urls := []string{primaryURLs[leaderID], primaryURLs[followerIDs[0]], primaryURLs[followerIDs[1]]}
+		w := worker.NewService(strings.Join(urls, ","))
+		if err := w.Run(allContext, "8002"); err != nil {
+			errChan <- err
+		}
+	}()
+	for _, ID := range followerIDs {
+		waitForNodes(ID, 2)
+	}
+	assert.Equal(t, "apple", getKey(followerIDs[0], "a"))
+	assert.Equal(t, "banana", getKey(followerIDs[1], "b"))
+
+	// the old leader restarts with no state, and
+	// catches up from the new leader's snapshot
+	runPrimary(leaderID)
+	waitForNodes(leaderID, 2)
+	status, _ := getRaftStatus(leaderID)
+	assert.Equal(t, raft.Follower, status.Role)
+	assert.Greater(t, status.SnapshotIndex, uint64(0))
+	leaderStatus, _ := getRaftStatus(newLeaderID)
+	assert.Equal(t, leaderStatus.Term, status.Term)
+	assert.Equal(t, "apple", getKey(leaderID, "a"))
+
+	cancel() // close servers
+	for i := 0; i < cap(errChan)-1; i++ {
+		assert.ErrorContains(t, <-errChan, "context canceled")
+	}
+}
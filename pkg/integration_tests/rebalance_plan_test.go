@@ -0,0 +1,149 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"keepair/pkg/primary"
+	"keepair/pkg/primary/clients"
+	"keepair/pkg/primary/node"
+	"keepair/pkg/seeder"
+	"keepair/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRebalancePlan previews adding and removing workers, and checks
+// that nothing moves until a worker actually joins, which moves as
+// many keys as the preview said
+func TestRebalancePlan(t *testing.T) {
+
+	testMu.Lock()
+	defer testMu.Unlock()
+
+	masterNodeURL := "http://0.0.0.0:8000"
+
+	errChan := make(chan error, 4)
+	allContext, cancel := context.WithCancel(context.Background())
+
+	// run primary node in background
+	go func() {
+		service := primary.NewService()
+		if err := service.Run(allContext, "8000"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// run worker nodes in background
+	for _, port := range []string{"8001", "8002"} {
+		go func(port string) {
+			w := worker.NewService(masterNodeURL)
+			if err := w.Run(allContext, port); err != nil {
+				errChan <- err
+			}
+		}(port)
+		time.Sleep(time.Millisecond * 500)
+	}
+
+	numObjects := 300
+	_, err := seeder.NewSeeder(masterNodeURL, 50, 20).SeedKVs(numObjects)
+	panicErr(err)
+
+	getTopology := func() node.Topology {
+		res, err := http.Get(masterNodeURL + "/topology")
+		panicErr(err)
+		defer res.Body.Close()
+		var topology node.Topology
+		panicErr(json.NewDecoder(res.Body).Decode(&topology))
+		return topology
+	}
+	plan := func(change node.MembershipChange) (int, node.RebalancePreview) {
+		body, err := json.Marshal(change)
+		panicErr(err)
+		res, err := http.Post(masterNodeURL+"/rebalance/plan", "application/json", bytes.NewReader(body))
+		panicErr(err)
+		defer res.Body.Close()
+		var preview node.RebalancePreview
+		if res.StatusCode == 200 {
+			panicErr(json.NewDecoder(res.Body).Decode(&preview))
+		}
+		return res.StatusCode, preview
+	}
+	objectCount := func(n node.TopologyNode) int {
+		stats, err := clients.NewWorkerClient(n.URL()).GetStats()
+		panicErr(err)
+		return stats.ObjectCount
+	}
+
+	topology := getTopology()
+	assert.Len(t, topology.Nodes, 2)
+	counts := []int{objectCount(topology.Nodes[0]), objectCount(topology.Nodes[1])}
+
+	// removing a worker moves all its keys to the other one
+	status, preview := plan(node.MembershipChange{Remove: []string{topology.Nodes[1].ID}})
+	assert.Equal(t, 200, status)
+	assert.Len(t, preview.To, 1)
+	assert.Equal(t, counts[1], preview.Keys)
+	assert.Equal(t, int64(counts[1]*20), preview.Bytes)
+	for _, m := range preview.Moves {
+		assert.Equal(t, topology.Nodes[1].ID, m.Source)
+		assert.Equal(t, counts[1], m.Keys)
+	}
+	assert.Len(t, preview.Moves, 2)
+
+	// adding a worker moves keys to it, and between the others as
+	// partitions shift, and every copied key is dropped from its source
+	status, preview = plan(node.MembershipChange{Add: []node.Node{{ID: "new", Address: "127.0.0.1:8003"}}})
+	assert.Equal(t, 200, status)
+	assert.Len(t, preview.To, 3)
+	assert.Equal(t, topology.Epoch+1, preview.ToEpoch)
+	assert.Greater(t, preview.Keys, 0)
+	copied, dropped, toNew := 0, 0, 0
+	for _, m := range preview.Moves {
+		switch m.Target {
+		case "":
+			dropped += m.Keys
+		case "new":
+			toNew += m.Keys
+		}
+		if m.Target != "" {
+			copied += m.Keys
+		}
+	}
+	assert.Equal(t, preview.Keys, copied)
+	assert.Equal(t, preview.Keys, dropped)
+	assert.Greater(t, toNew, 0)
+
+	// invalid changes are refused
+	status, _ = plan(node.MembershipChange{Remove: []string{"unknown"}})
+	assert.Equal(t, 400, status)
+	status, _ = plan(node.MembershipChange{Add: []node.Node{{ID: topology.Nodes[0].ID, Address: "127.0.0.1:8003"}}})
+	assert.Equal(t, 400, status)
+	status, _ = plan(node.MembershipChange{})
+	assert.Equal(t, 400, status)
+
+	// nothing moved
+	assert.Equal(t, topology.Epoch, getTopology().Epoch)
+	assert.Equal(t, counts, []int{objectCount(topology.Nodes[0]), objectCount(topology.Nodes[1])})
+
+	// the worker that joins gets the keys the preview counted
+	go func() {
+		w := worker.NewService(masterNodeURL)
+		if err := w.Run(allContext, "8003"); err != nil {
+			errChan <- err
+		}
+	}()
+	assert.Eventually(t, func() bool {
+		return len(getTopology().Nodes) == 3
+	}, time.Second*5, time.Millisecond*50)
+	assert.Equal(t, toNew, objectCount(getTopology().Nodes[2]))
+
+	cancel() // close servers
+	for i := 0; i < cap(errChan); i++ {
+		assert.ErrorContains(t, <-errChan, "context canceled")
+	}
+}
@@ -0,0 +1,82 @@
+package integration_tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"keepair/pkg/partition"
+	"keepair/pkg/primary"
+	"keepair/pkg/primary/node"
+	"keepair/pkg/seeder"
+	"keepair/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRebalanceKeySplit checks that after a worker joins, each worker
+// holds exactly the keys that partition to its index
+func TestRebalanceKeySplit(t *testing.T) {
+
+	testMu.Lock()
+	defer testMu.Unlock()
+
+	masterNodeURL := "http://0.0.0.0:8000"
+
+	errChan := make(chan error, 3)
+	allContext, cancel := context.WithCancel(context.Background())
+
+	// run primary node in background
+	go func() {
+		service := primary.NewService()
+		if err := service.Run(allContext, "8000"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	runWorker := func(port string) {
+		go func() {
+			w := worker.NewService(masterNodeURL)
+			if err := w.Run(allContext, port); err != nil {
+				errChan <- err
+			}
+		}()
+	}
+	getNodes := func() []node.Node {
+		res, err := http.Get(masterNodeURL + "/nodes")
+		panicErr(err)
+		defer res.Body.Close()
+		var nodes struct {
+			Nodes []node.Node `json:"nodes"`
+		}
+		panicErr(json.NewDecoder(res.Body).Decode(&nodes))
+		return nodes.Nodes
+	}
+
+	runWorker("8001")
+	time.Sleep(time.Millisecond * 500)
+
+	items, err := seeder.NewSeeder(masterNodeURL, 100, 50).SeedKVs(300)
+	panicErr(err)
+	expected := make(map[int]int)
+	for k := range items {
+		expected[partition.GenerateDeterministicPartitionKey(k, 2)]++
+	}
+
+	// a second worker joins, which moves the keys of index 1 to it
+	runWorker("8002")
+	assert.Eventually(t, func() bool {
+		return len(getNodes()) == 2
+	}, time.Second*5, time.Millisecond*50)
+
+	for _, n := range getNodes() {
+		assert.Equalf(t, expected[n.Index], n.Stats.ObjectCount, "object count of node %d", n.Index)
+	}
+
+	cancel() // close servers
+	for i := 0; i < cap(errChan); i++ {
+		assert.ErrorContains(t, <-errChan, "context canceled")
+	}
+}
@@ -0,0 +1,154 @@
+package integration_tests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"keepair/pkg/primary"
+	"keepair/pkg/primary/node"
+	"keepair/pkg/seeder"
+	"keepair/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRebalanceStatus throttles the migration adding a worker,
+// follows its progress, cancels it and resumes it
+func TestRebalanceStatus(t *testing.T) {
+
+	testMu.Lock()
+	defer testMu.Unlock()
+
+	masterNodeURL := "http://0.0.0.0:8000"
+
+	errChan := make(chan error, 4)
+	allContext, cancel := context.WithCancel(context.Background())
+
+	// run primary node in background
+	go func() {
+		config := primary.DefaultConfig()
+		config.Node.TransferBatchSize = 10
+		config.Node.MigrationKeysPerSecond = 100
+		service := primary.NewServiceWithConfig(config)
+		if err := service.Run(allContext, "8000"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// run worker nodes in background
+	for _, port := range []string{"8001", "8002"} {
+		go func(port string) {
+			w := worker.NewService(masterNodeURL)
+			if err := w.Run(allContext, port); err != nil {
+				errChan <- err
+			}
+		}(port)
+		time.Sleep(time.Millisecond * 500)
+	}
+
+	kvs, err := seeder.NewSeeder(masterNodeURL, 50, 20).SeedKVs(300)
+	panicErr(err)
+
+	getTopology := func() node.Topology {
+		res, err := http.Get(masterNodeURL + "/topology")
+		panicErr(err)
+		defer res.Body.Close()
+		var topology node.Topology
+		panicErr(json.NewDecoder(res.Body).Decode(&topology))
+		return topology
+	}
+	getStatus := func() (int, node.RebalanceStatus) {
+		res, err := http.Get(masterNodeURL + "/rebalance/status")
+		panicErr(err)
+		defer res.Body.Close()
+		var status node.RebalanceStatus
+		if res.StatusCode == 200 {
+			panicErr(json.NewDecoder(res.Body).Decode(&status))
+		}
+		return res.StatusCode, status
+	}
+	post := func(path string) int {
+		res, err := http.Post(masterNodeURL+path, "", nil)
+		panicErr(err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+	checkKeys := func() {
+		for key, value := range kvs {
+			res, err := http.Get(masterNodeURL + "/keys/" + key)
+			panicErr(err)
+			body, err := io.ReadAll(res.Body)
+			panicErr(err)
+			res.Body.Close()
+			assert.Equal(t, 200, res.StatusCode, key)
+			assert.Equal(t, value, body, key)
+		}
+	}
+
+	topology := getTopology()
+	code, _ := getStatus()
+	assert.Equal(t, 404, code)
+	assert.Equal(t, 404, post("/rebalance/cancel"))
+
+	// a third worker joins, and its keys are copied slowly
+	go func() {
+		w := worker.NewService(masterNodeURL)
+		if err := w.Run(allContext, "8003"); err != nil {
+			errChan <- err
+		}
+	}()
+	var status node.RebalanceStatus
+	assert.Eventually(t, func() bool {
+		code, status = getStatus()
+		return code == 200 && status.Running && status.Phase == node.CopyStep && status.MovedKeys > 0
+	}, time.Second*5, time.Millisecond*50)
+	assert.Equal(t, node.AddNode, status.Operation)
+	assert.Greater(t, status.RemainingKeys, 0)
+	assert.Greater(t, status.ETA, time.Duration(0))
+	copying := 0
+	for _, ts := range status.Transfers {
+		assert.Equal(t, ts.Keys, ts.MovedKeys+ts.RemainingKeys)
+		if ts.MovedKeys > 0 && ts.Target != "" {
+			copying++
+			// 100 keys of 20 bytes per second, sent in batches
+			assert.Less(t, ts.BytesPerSecond, float64(100*20*2))
+		}
+	}
+	assert.Greater(t, copying, 0)
+
+	// the copy in progress stops at its next batch, keeping the membership
+	start := time.Now()
+	assert.Equal(t, 200, post("/rebalance/cancel"))
+	assert.Less(t, time.Since(start), time.Millisecond*500)
+	code, status = getStatus()
+	assert.Equal(t, 200, code)
+	assert.False(t, status.Running)
+	assert.True(t, status.Canceled)
+	assert.NotEmpty(t, status.Error)
+	assert.Equal(t, node.CopyStep, status.Phase)
+	assert.Greater(t, status.RemainingKeys, 0)
+	assert.Equal(t, 409, post("/rebalance/cancel"))
+	checkKeys()
+
+	// the worker keeps registering, which does not resume it
+	time.Sleep(time.Millisecond * 500)
+	assert.Len(t, getTopology().Nodes, 2)
+	assert.Equal(t, topology.Epoch, getTopology().Epoch)
+
+	// until it is resumed
+	assert.Equal(t, 200, post("/rebalance/resume"))
+	assert.Len(t, getTopology().Nodes, 3)
+	assert.Equal(t, topology.Epoch+1, getTopology().Epoch)
+	code, _ = getStatus()
+	assert.Equal(t, 404, code)
+	checkKeys()
+
+	cancel() // close servers
+	for i := 0; i < cap(errChan); i++ {
+		assert.ErrorContains(t, <-errChan, "context canceled")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"math/rand"
 	"net/http"
 	"testing"
 	"time"
@@ -49,7 +50,9 @@ func TestRebalanceOnAddWorkerNode(t *testing.T) {
 	// wait a bit for primary node and worker node to init
 	time.Sleep(time.Millisecond * 500)
 
-	// set keys
+	// set keys, the same ones on every run whichever
+	// tests drew random numbers before
+	rand.Seed(1)
 	numObjects := 100
 	objectSize := 50
 	var items map[string][]byte
@@ -0,0 +1,106 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"keepair/pkg/partition"
+	"keepair/pkg/primary"
+	"keepair/pkg/primary/node"
+	"keepair/pkg/values"
+	"keepair/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRedirects checks that workers redirect requests for keys
+// they do not own, and refuse assignments of older epochs
+func TestRedirects(t *testing.T) {
+
+	testMu.Lock()
+	defer testMu.Unlock()
+
+	masterNodeURL := "http://0.0.0.0:8000"
+
+	errChan := make(chan error, 3)
+	allContext, cancel := context.WithCancel(context.Background())
+
+	// run primary node in background
+	go func() {
+		service := primary.NewService()
+		if err := service.Run(allContext, "8000"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// run worker nodes in background
+	for _, port := range []string{"8001", "8002"} {
+		go func(port string) {
+			w := worker.NewService(masterNodeURL)
+			if err := w.Run(allContext, port); err != nil {
+				errChan <- err
+			}
+		}(port)
+		time.Sleep(time.Millisecond * 500)
+	}
+
+	// every worker joining changed the assignment
+	var topology node.Topology
+	{
+		res, err := http.Get(masterNodeURL + "/topology")
+		panicErr(err)
+		panicErr(json.NewDecoder(res.Body).Decode(&topology))
+		res.Body.Close()
+	}
+	assert.Len(t, topology.Nodes, 2)
+	assert.Equal(t, uint64(2), topology.Epoch)
+
+	// the workers were pushed the assignment
+	for _, n := range topology.Nodes {
+		res, err := http.Get(n.URL() + "/assignment")
+		panicErr(err)
+		var assignment partition.Assignment
+		panicErr(json.NewDecoder(res.Body).Decode(&assignment))
+		res.Body.Close()
+		assert.Equal(t, topology.Epoch, assignment.Epoch)
+		assert.Nil(t, assignment.Next)
+		assert.Len(t, assignment.Nodes, 2)
+	}
+
+	// "b" is owned by node 0, so node 1 redirects it there
+	{
+		res, err := http.Post(topology.Nodes[1].URL()+"/keys/b", "", bytes.NewReader([]byte("value")))
+		panicErr(err)
+		res.Body.Close()
+		assert.Equal(t, http.StatusMisdirectedRequest, res.StatusCode)
+		assert.Equal(t, string(partition.MovedRedirect), res.Header.Get(values.RedirectHeader))
+		assert.Equal(t, strconv.FormatUint(topology.Epoch, 10), res.Header.Get(values.EpochHeader))
+		assert.Equal(t, topology.Nodes[0].URL(), res.Header.Get("Location"))
+
+		res, err = http.Post(topology.Nodes[0].URL()+"/keys/b", "", bytes.NewReader([]byte("value")))
+		panicErr(err)
+		res.Body.Close()
+		assert.Equal(t, 200, res.StatusCode)
+	}
+
+	// an assignment from a primary that missed the last change is refused
+	{
+		body, err := json.Marshal(partition.Assignment{Epoch: topology.Epoch - 1, ReplicationFactor: 1})
+		panicErr(err)
+		res, err := http.Post(topology.Nodes[0].URL()+"/assignment", "application/json", bytes.NewReader(body))
+		panicErr(err)
+		res.Body.Close()
+		assert.Equal(t, 409, res.StatusCode)
+		assert.Equal(t, strconv.FormatUint(topology.Epoch, 10), res.Header.Get(values.EpochHeader))
+	}
+
+	cancel() // close servers
+	for i := 0; i < cap(errChan); i++ {
+		assert.ErrorContains(t, <-errChan, "context canceled")
+	}
+}
@@ -0,0 +1,125 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"keepair/pkg/primary"
+	"keepair/pkg/primary/node"
+	"keepair/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestReplication checks that with a replication factor of 2 every
+// key is held by two workers, and stays readable when one goes away
+func TestReplication(t *testing.T) {
+
+	testMu.Lock()
+	defer testMu.Unlock()
+
+	masterNodeURL := "http://0.0.0.0:8000"
+
+	errChan := make(chan error, 3)
+	allContext, cancel := context.WithCancel(context.Background())
+	worker1Context, cancelWorker1 := context.WithCancel(allContext)
+
+	// run primary node in background
+	go func() {
+		config := primary.DefaultConfig()
+		config.Node.ReplicationFactor = 2
+		// workers send heartbeats with fresh stats every 100ms
+		config.Node.LeaseDuration = time.Millisecond * 300
+		service := primary.NewServiceWithConfig(config)
+		if err := service.Run(allContext, "8000"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// run worker0 node in background
+	go func() {
+		worker0 := worker.NewService(masterNodeURL)
+		if err := worker0.Run(allContext, "8001"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// wait a bit for primary node and worker node to init
+	time.Sleep(time.Millisecond * 500)
+
+	setKey := func(key string) {
+		res, err := http.Post(masterNodeURL+"/keys/"+key, "", bytes.NewReader([]byte("value-"+key)))
+		panicErr(err)
+		assert.Equal(t, 200, res.StatusCode)
+	}
+	getNodes := func() []node.Node {
+		res, err := http.Get(masterNodeURL + "/nodes")
+		panicErr(err)
+		assert.Equal(t, 200, res.StatusCode)
+		body, err := io.ReadAll(res.Body)
+		panicErr(err)
+		var nodes struct {
+			Nodes []node.Node `json:"nodes"`
+		}
+		panicErr(json.Unmarshal(body, &nodes))
+		return nodes.Nodes
+	}
+
+	// with a single worker there is only one copy of each key
+	numKeys := 10
+	for i := 0; i < numKeys; i++ {
+		setKey(fmt.Sprintf("before-%d", i))
+	}
+
+	// run worker1 node in background, which copies every key to it
+	go func() {
+		worker1 := worker.NewService(masterNodeURL)
+		if err := worker1.Run(worker1Context, "8002"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	time.Sleep(time.Second)
+
+	// keys written now are forwarded from leader to follower
+	for i := 0; i < numKeys; i++ {
+		setKey(fmt.Sprintf("after-%d", i))
+	}
+
+	time.Sleep(time.Millisecond * 1500)
+
+	nodes := getNodes()
+	assert.Len(t, nodes, 2)
+	for _, n := range nodes {
+		assert.Equal(t, numKeys*2, n.Stats.ObjectCount)
+		assert.Equal(t, []int{n.Index}, n.LeaderOf)
+		assert.Equal(t, []int{1 - n.Index}, n.FollowerOf)
+	}
+
+	// stop worker1, reads fall back to the remaining replica
+	cancelWorker1()
+	assert.ErrorContains(t, <-errChan, "context canceled")
+
+	for _, prefix := range []string{"before", "after"} {
+		for i := 0; i < numKeys; i++ {
+			key := fmt.Sprintf("%s-%d", prefix, i)
+			res, err := http.Get(masterNodeURL + "/keys/" + key)
+			panicErr(err)
+			body, err := io.ReadAll(res.Body)
+			panicErr(err)
+			assert.Equal(t, 200, res.StatusCode)
+			assert.Equal(t, "value-"+key, string(body))
+		}
+	}
+
+	cancel() // close servers
+	for i := 0; i < cap(errChan)-1; i++ {
+		assert.ErrorContains(t, <-errChan, "context canceled")
+	}
+}
@@ -0,0 +1,125 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"keepair/pkg/primary"
+	"keepair/pkg/primary/node"
+	"keepair/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPrimaryRestart restarts the primary, first with its state
+// file so it remembers the workers, then without it so the workers
+// have to register again, and checks that keys stay readable
+func TestPrimaryRestart(t *testing.T) {
+
+	testMu.Lock()
+	defer testMu.Unlock()
+
+	masterNodeURL := "http://0.0.0.0:8000"
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+
+	errChan := make(chan error, 5)
+	allContext, cancel := context.WithCancel(context.Background())
+
+	runPrimary := func(stateFile string) context.CancelFunc {
+		ctx, cancelPrimary := context.WithCancel(allContext)
+		go func() {
+			config := primary.DefaultConfig()
+			config.Node.StateFile = stateFile
+			// workers send heartbeats every 100ms
+			config.Node.LeaseDuration = time.Millisecond * 300
+			service := primary.NewServiceWithConfig(config)
+			if err := service.Run(ctx, "8000"); err != nil {
+				errChan <- err
+			}
+		}()
+		time.Sleep(time.Millisecond * 200)
+		return cancelPrimary
+	}
+	stopPrimary := runPrimary(stateFile)
+
+	// run worker nodes in background
+	for _, port := range []string{"8001", "8002"} {
+		go func(port string) {
+			w := worker.NewService(masterNodeURL)
+			if err := w.Run(allContext, port); err != nil {
+				errChan <- err
+			}
+		}(port)
+		time.Sleep(time.Millisecond * 500)
+	}
+
+	getTopology := func() node.Topology {
+		res, err := http.Get(masterNodeURL + "/topology")
+		panicErr(err)
+		defer res.Body.Close()
+		var topology node.Topology
+		panicErr(json.NewDecoder(res.Body).Decode(&topology))
+		return topology
+	}
+	checkKeys := func() {
+		for i := 0; i < 20; i++ {
+			res, err := http.Get(masterNodeURL + fmt.Sprintf("/keys/key-%d", i))
+			panicErr(err)
+			body, err := io.ReadAll(res.Body)
+			panicErr(err)
+			res.Body.Close()
+			assert.Equal(t, 200, res.StatusCode)
+			assert.Equal(t, fmt.Sprintf("value-%d", i), string(body))
+		}
+	}
+
+	for i := 0; i < 20; i++ {
+		res, err := http.Post(masterNodeURL+fmt.Sprintf("/keys/key-%d", i), "", bytes.NewReader([]byte(fmt.Sprintf("value-%d", i))))
+		panicErr(err)
+		res.Body.Close()
+		assert.Equal(t, 200, res.StatusCode)
+	}
+	topology := getTopology()
+	assert.Len(t, topology.Nodes, 2)
+
+	// the restarted primary reloads the workers
+	stopPrimary()
+	assert.ErrorContains(t, <-errChan, "context canceled")
+	stopPrimary = runPrimary(stateFile)
+	restored := getTopology()
+	assert.Len(t, restored.Nodes, 2)
+	for i, n := range restored.Nodes {
+		assert.Equal(t, topology.Nodes[i].ID, n.ID)
+		assert.Equal(t, topology.Nodes[i].Index, n.Index)
+	}
+	assert.Equal(t, topology.Epoch, restored.Epoch)
+	checkKeys()
+
+	// workers keep sending heartbeats without changing membership
+	time.Sleep(time.Millisecond * 500)
+	assert.Equal(t, restored.Version, getTopology().Version)
+
+	// a primary without state makes the workers register again
+	stopPrimary()
+	assert.ErrorContains(t, <-errChan, "context canceled")
+	runPrimary("")
+	assert.Eventually(t, func() bool {
+		return len(getTopology().Nodes) == 2
+	}, time.Second*5, time.Millisecond*100)
+	checkKeys()
+
+	// it continues from the epoch the workers had seen
+	assert.Greater(t, getTopology().Epoch, restored.Epoch)
+
+	cancel() // close servers
+	for i := 0; i < cap(errChan)-2; i++ {
+		assert.ErrorContains(t, <-errChan, "context canceled")
+	}
+}
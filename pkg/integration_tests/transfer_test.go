@@ -0,0 +1,115 @@
+package integration_tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"keepair/pkg/partition"
+	"keepair/pkg/primary"
+	"keepair/pkg/primary/clients"
+	"keepair/pkg/primary/node"
+	"keepair/pkg/seeder"
+	"keepair/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestWorkerTransfer has a worker send all its keys straight to
+// another in small batches, then drop them, and checks the
+// transfers it reports
+func TestWorkerTransfer(t *testing.T) {
+
+	testMu.Lock()
+	defer testMu.Unlock()
+
+	masterNodeURL := "http://0.0.0.0:8000"
+
+	errChan := make(chan error, 3)
+	allContext, cancel := context.WithCancel(context.Background())
+
+	// run primary node in background
+	go func() {
+		service := primary.NewService()
+		if err := service.Run(allContext, "8000"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// run worker nodes in background
+	for _, port := range []string{"8001", "8002"} {
+		go func(port string) {
+			w := worker.NewService(masterNodeURL)
+			if err := w.Run(allContext, port); err != nil {
+				errChan <- err
+			}
+		}(port)
+		time.Sleep(time.Millisecond * 500)
+	}
+
+	numObjects := 200
+	_, err := seeder.NewSeeder(masterNodeURL, 50, 20).SeedKVs(numObjects)
+	panicErr(err)
+
+	res, err := http.Get(masterNodeURL + "/topology")
+	panicErr(err)
+	var topology node.Topology
+	panicErr(json.NewDecoder(res.Body).Decode(&topology))
+	res.Body.Close()
+	assert.Len(t, topology.Nodes, 2)
+	kept, source := topology.Nodes[0], topology.Nodes[1]
+
+	keptClient, sourceClient := clients.NewWorkerClient(kept.URL()), clients.NewWorkerClient(source.URL())
+	objectCount := func(client clients.IWorkerClient) int {
+		stats, err := client.GetStats()
+		panicErr(err)
+		return stats.ObjectCount
+	}
+	moved := objectCount(sourceClient)
+	assert.Greater(t, moved, 0)
+	assert.Equal(t, numObjects, moved+objectCount(keptClient))
+
+	// every key of the source goes to the worker that stays
+	keptNode := partition.Node{ID: kept.ID, Address: kept.Address}
+	next := partition.Assignment{Epoch: topology.Epoch + 1, ReplicationFactor: 1, Nodes: []partition.Node{keptNode}}
+	current := partition.Assignment{
+		Epoch:             topology.Epoch,
+		ReplicationFactor: 1,
+		Nodes:             []partition.Node{keptNode, {ID: source.ID, Address: source.Address}},
+		Next:              &next,
+	}
+	req := partition.TransferRequest{ID: "transfer-test", Assignment: current, BatchSize: 7}
+
+	transfers, err := sourceClient.TransferKeys(req)
+	panicErr(err)
+	if assert.Len(t, transfers, 1) {
+		assert.Equal(t, source.ID, transfers[0].Source)
+		assert.Equal(t, kept.ID, transfers[0].Target)
+		assert.Equal(t, moved, transfers[0].Keys)
+		assert.Equal(t, int64(moved*20), transfers[0].Bytes)
+		assert.Greater(t, transfers[0].BytesPerSecond, float64(0))
+	}
+
+	// the copies are queued until applied
+	assert.Equal(t, numObjects-moved, objectCount(keptClient))
+	panicErr(keptClient.ApplyOperations(req.ID, false))
+	assert.Equal(t, numObjects, objectCount(keptClient))
+
+	dropped, err := sourceClient.DropKeys(req)
+	panicErr(err)
+	assert.Equal(t, source.ID, dropped.Source)
+	assert.Empty(t, dropped.Target)
+	assert.Equal(t, moved, dropped.Keys)
+	assert.Equal(t, 0, objectCount(sourceClient))
+
+	// a request without a next assignment is refused
+	_, err = sourceClient.TransferKeys(partition.TransferRequest{Assignment: next})
+	assert.ErrorContains(t, err, "no next assignment")
+
+	cancel() // close servers
+	for i := 0; i < cap(errChan); i++ {
+		assert.ErrorContains(t, <-errChan, "context canceled")
+	}
+}
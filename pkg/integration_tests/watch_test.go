@@ -0,0 +1,183 @@
+package integration_tests
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"keepair/pkg/common"
+	"keepair/pkg/primary"
+	"keepair/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type watchEvent struct {
+	ID     string
+	Event  string
+	Change common.ChangeEvent
+}
+
+// openWatch connects to the watch endpoint and parses
+// the Server-Sent Events into a channel
+func openWatch(ctx context.Context, url string, lastEventID string) <-chan watchEvent {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	panicErr(err)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	res, err := http.DefaultClient.Do(req)
+	panicErr(err)
+	if res.StatusCode != 200 {
+		panic(fmt.Errorf("watch request failed: %d", res.StatusCode))
+	}
+
+	ch := make(chan watchEvent, 100)
+	go func() {
+		defer res.Body.Close()
+		scanner := bufio.NewScanner(res.Body)
+		current := watchEvent{}
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id:"):
+				current.ID = line[len("id:"):]
+			case strings.HasPrefix(line, "event:"):
+				current.Event = line[len("event:"):]
+			case strings.HasPrefix(line, "data:"):
+				panicErr(json.Unmarshal([]byte(line[len("data:"):]), &current.Change))
+			case line == "" && current.Event != "":
+				ch <- current
+				current = watchEvent{}
+			}
+		}
+	}()
+	return ch
+}
+
+func nextWatchEvent(t *testing.T, ch <-chan watchEvent) watchEvent {
+	select {
+	case event := <-ch:
+		return event
+	case <-time.After(time.Second * 3):
+		t.Fatal("timed out waiting for watch event")
+		return watchEvent{}
+	}
+}
+
+// TestWatchKeys checks that set and delete events are streamed for a
+// prefix, keep flowing after a node joins, and can be resumed
+func TestWatchKeys(t *testing.T) {
+
+	testMu.Lock()
+	defer testMu.Unlock()
+
+	masterNodeURL := "http://0.0.0.0:8000"
+
+	errChan := make(chan error, 3)
+	allContext, cancel := context.WithCancel(context.Background())
+
+	// run primary node in background
+	go func() {
+		service := primary.NewService()
+		if err := service.Run(allContext, "8000"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// run worker0 node in background
+	go func() {
+		worker0 := worker.NewService(masterNodeURL)
+		if err := worker0.Run(allContext, "8001"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// wait a bit for primary node and worker node to init
+	time.Sleep(time.Millisecond * 500)
+
+	setKey := func(key string) {
+		res, err := http.Post(masterNodeURL+"/keys/"+key, "", bytes.NewReader([]byte("value")))
+		panicErr(err)
+		assert.Equal(t, 200, res.StatusCode)
+	}
+	deleteKey := func(key string) {
+		req, err := http.NewRequest(http.MethodDelete, masterNodeURL+"/keys/"+key, nil)
+		panicErr(err)
+		res, err := http.DefaultClient.Do(req)
+		panicErr(err)
+		assert.Equal(t, 200, res.StatusCode)
+	}
+
+	watchContext, cancelWatch := context.WithCancel(allContext)
+	events := openWatch(watchContext, masterNodeURL+"/watch?prefix=user:", "")
+
+	// wait a bit for the watch to subscribe to the worker
+	time.Sleep(time.Millisecond * 200)
+
+	setKey("user:a")
+	setKey("other:a")
+	deleteKey("user:a")
+
+	first := nextWatchEvent(t, events)
+	assert.Equal(t, "set", first.Event)
+	assert.Equal(t, "user:a", first.Change.Key)
+	second := nextWatchEvent(t, events)
+	assert.Equal(t, "delete", second.Event)
+	assert.Equal(t, "user:a", second.Change.Key)
+	assert.Greater(t, second.Change.Seq, first.Change.Seq)
+
+	// run worker1 node in background, which triggers a rebalance
+	go func() {
+		worker1 := worker.NewService(masterNodeURL)
+		if err := worker1.Run(allContext, "8002"); err != nil {
+			errChan <- err
+		}
+	}()
+
+	// wait for the rebalance and for the watch to pick up the new node
+	time.Sleep(time.Millisecond * 1500)
+
+	// keys are spread over both workers, so all of them
+	// are only seen if both workers are watched
+	keys := map[string]bool{}
+	for i := 0; i < 6; i++ {
+		key := fmt.Sprintf("user:%d", i)
+		keys[key] = true
+		setKey(key)
+	}
+	workerIDs := map[string]bool{}
+	for range keys {
+		event := nextWatchEvent(t, events)
+		assert.Equal(t, "set", event.Event)
+		assert.True(t, keys[event.Change.Key])
+		workerIDs[event.Change.WorkerID] = true
+	}
+	assert.Len(t, workerIDs, 2)
+
+	// resume from the first event, which should replay the delete
+	// next for that worker. The cursor has no position for the new
+	// worker, so its events are replayed too and may come first.
+	cancelWatch()
+	resumed := openWatch(allContext, masterNodeURL+"/watch?prefix=user:", first.ID)
+	for {
+		event := nextWatchEvent(t, resumed)
+		if event.Change.WorkerID != first.Change.WorkerID {
+			continue
+		}
+		assert.Equal(t, "delete", event.Event)
+		assert.Equal(t, "user:a", event.Change.Key)
+		break
+	}
+
+	cancel() // close servers
+	for i := 0; i < cap(errChan); i++ {
+		assert.ErrorContains(t, <-errChan, "context canceled")
+	}
+}
@@ -0,0 +1,63 @@
+package partition
+
+import "fmt"
+
+// Assignment is the placement of keys on nodes that the primary pushes
+// to workers, so they can tell when they receive a key they do not own.
+// Epoch increases every time the placement changes.
+type Assignment struct {
+	Epoch             uint64 `json:"epoch"`
+	ReplicationFactor int    `json:"replicationFactor"`
+	// Nodes are ordered by index
+	Nodes []Node `json:"nodes"`
+	// Next is the placement a rebalance is moving keys to
+	Next *Assignment `json:"next,omitempty"`
+}
+
+type Node struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+}
+
+func (n Node) URL() string {
+	return fmt.Sprintf("http://%s", n.Address)
+}
+
+// Owners returns the replicas of a key, leader first
+func (a Assignment) Owners(key string) []Node {
+	if len(a.Nodes) == 0 {
+		return nil
+	}
+	indexes := GetReplicaIndexes(key, len(a.Nodes), a.ReplicationFactor)
+	owners := make([]Node, 0, len(indexes))
+	for _, idx := range indexes {
+		owners = append(owners, a.Nodes[idx])
+	}
+	return owners
+}
+
+// Owns reports whether a node holds a replica of a key
+func (a Assignment) Owns(ID string, key string) bool {
+	for _, n := range a.Owners(key) {
+		if n.ID == ID {
+			return true
+		}
+	}
+	return false
+}
+
+// RedirectKind tells a client how to follow a redirect from a worker.
+// A MOVED key belongs to another node for good, so the client should
+// refresh its topology. An ASK is only for the request that got it,
+// while a rebalance moves the key.
+type RedirectKind string
+
+var MovedRedirect = RedirectKind("MOVED")
+var AskRedirect = RedirectKind("ASK")
+
+// Redirect names the node that serves a key, as of an epoch
+type Redirect struct {
+	Kind  RedirectKind
+	Epoch uint64
+	Node  Node
+}
@@ -0,0 +1,155 @@
+package partition
+
+import (
+	"sort"
+	"time"
+)
+
+// Move is the number of keys and bytes a rebalance copies from one
+// node to another. A move without a target is the keys dropped from
+// the source.
+type Move struct {
+	Source string `json:"source"`
+	Target string `json:"target,omitempty"`
+	Keys   int    `json:"keys"`
+	Bytes  int64  `json:"bytes"`
+}
+
+// Transfer is a move made by a worker, with how long it took
+type Transfer struct {
+	Move
+	Duration       time.Duration `json:"duration"`
+	BytesPerSecond float64       `json:"bytesPerSecond"`
+}
+
+func NewTransfer(move Move, duration time.Duration) Transfer {
+	t := Transfer{Move: move, Duration: duration}
+	if duration > 0 {
+		t.BytesPerSecond = float64(move.Bytes) / duration.Seconds()
+	}
+	return t
+}
+
+// TransferRequest asks a worker to copy its keys to their owners in
+// the next placement of an assignment, or to drop the keys it does
+// not own in it
+type TransferRequest struct {
+	// ID names the transfer, so its progress can be followed
+	ID         string     `json:"id,omitempty"`
+	Assignment Assignment `json:"assignment"`
+	// Skip are current owners that cannot copy keys, such as a
+	// failed node, so the next owner copies them instead
+	Skip []string `json:"skip,omitempty"`
+	// BatchSize is the number of entries sent to a target at once
+	BatchSize int `json:"batchSize"`
+	// MaxKeysPerSecond and MaxBytesPerSecond limit how fast
+	// keys are sent, with no limit if zero
+	MaxKeysPerSecond  int   `json:"maxKeysPerSecond,omitempty"`
+	MaxBytesPerSecond int64 `json:"maxBytesPerSecond,omitempty"`
+}
+
+// CopyTargets returns the nodes a node copies a key to when keys move
+// to the next placement: its new owners that do not own it yet. Only
+// the first current owner not skipped copies a key, and a node that
+// does not own a key, such as one that registers again, copies it to
+// all its new owners as if it were the only holder.
+func (a Assignment) CopyTargets(nodeID string, key string, skip []string) []Node {
+	if a.Next == nil {
+		return nil
+	}
+	owner := a.Owns(nodeID, key)
+	if owner {
+		for _, n := range a.Owners(key) {
+			if !containsString(skip, n.ID) {
+				if n.ID != nodeID {
+					return nil
+				}
+				break
+			}
+		}
+	}
+	targets := make([]Node, 0)
+	for _, n := range a.Next.Owners(key) {
+		if n.ID != nodeID && !(owner && a.Owns(n.ID, key)) {
+			targets = append(targets, n)
+		}
+	}
+	return targets
+}
+
+// Drops reports whether a node drops a key when keys
+// move to the next placement
+func (a Assignment) Drops(nodeID string, key string) bool {
+	return a.Next != nil && !a.Next.Owns(nodeID, key)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// MoveCounter counts what a node would move if keys went from the
+// placement of an assignment to the placement of its next one
+type MoveCounter struct {
+	nodeID     string
+	assignment Assignment
+	skip       []string
+	moves      map[Move]*Move
+}
+
+// NewMoveCounter counts the moves of a node, with the
+// current owners in skip not copying keys
+func NewMoveCounter(nodeID string, assignment Assignment, skip []string) *MoveCounter {
+	return &MoveCounter{
+		nodeID:     nodeID,
+		assignment: assignment,
+		skip:       skip,
+		moves:      make(map[Move]*Move),
+	}
+}
+
+// Add counts a key held by the node, copied and dropped
+// the way a rebalance does
+func (c *MoveCounter) Add(key string, size int) {
+	for _, n := range c.assignment.CopyTargets(c.nodeID, key, c.skip) {
+		c.count(n.ID, size)
+	}
+	if c.assignment.Drops(c.nodeID, key) {
+		c.count("", size)
+	}
+}
+
+func (c *MoveCounter) count(target string, size int) {
+	k := Move{Source: c.nodeID, Target: target}
+	m, ok := c.moves[k]
+	if !ok {
+		m = &Move{Source: c.nodeID, Target: target}
+		c.moves[k] = m
+	}
+	m.Keys++
+	m.Bytes += int64(size)
+}
+
+// Moves returns the counted moves ordered by target, drops first
+func (c *MoveCounter) Moves() []Move {
+	moves := make([]Move, 0, len(c.moves))
+	for _, m := range c.moves {
+		moves = append(moves, *m)
+	}
+	SortMoves(moves)
+	return moves
+}
+
+// SortMoves orders moves by source, then by target with drops first
+func SortMoves(moves []Move) {
+	sort.Slice(moves, func(i, j int) bool {
+		if moves[i].Source != moves[j].Source {
+			return moves[i].Source < moves[j].Source
+		}
+		return moves[i].Target < moves[j].Target
+	})
+}
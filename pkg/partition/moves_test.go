@@ -0,0 +1,72 @@
+package partition
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMoveCounter checks that with replicas, a key copied to a new
+// node is counted once across the nodes holding it, and dropped
+// from the nodes that no longer own it
+func TestMoveCounter(t *testing.T) {
+	a, b, c := Node{ID: "a"}, Node{ID: "b"}, Node{ID: "c"}
+	next := Assignment{Epoch: 2, ReplicationFactor: 2, Nodes: []Node{a, b, c}}
+	current := Assignment{Epoch: 1, ReplicationFactor: 2, Nodes: []Node{a, b}, Next: &next}
+
+	counters := map[string]*MoveCounter{
+		"a": NewMoveCounter("a", current, nil),
+		"b": NewMoveCounter("b", current, nil),
+	}
+	copies, drops := 0, 0
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		for _, n := range current.Owners(key) {
+			counters[n.ID].Add(key, 10)
+			if !next.Owns(n.ID, key) {
+				drops++
+			}
+		}
+		if next.Owns("c", key) {
+			copies++
+		}
+	}
+
+	counted := map[Move]int{}
+	for _, counter := range counters {
+		for _, m := range counter.Moves() {
+			assert.Equal(t, int64(m.Keys*10), m.Bytes)
+			counted[Move{Target: m.Target}] += m.Keys
+		}
+	}
+	assert.Greater(t, copies, 0)
+	assert.Equal(t, copies, counted[Move{Target: "c"}])
+	assert.Equal(t, drops, counted[Move{}])
+	assert.Len(t, counted, 2)
+
+	// nothing moves without a next assignment
+	counter := NewMoveCounter("a", Assignment{Epoch: 1, ReplicationFactor: 1, Nodes: []Node{a}}, nil)
+	counter.Add("key", 10)
+	assert.Empty(t, counter.Moves())
+}
+
+// TestCopyTargets checks that the first current owner that is not
+// skipped copies a key, and a node not owning it copies it to
+// all its new owners
+func TestCopyTargets(t *testing.T) {
+	a, b, c := Node{ID: "a"}, Node{ID: "b"}, Node{ID: "c"}
+	next := Assignment{Epoch: 2, ReplicationFactor: 2, Nodes: []Node{b, c}}
+	current := Assignment{Epoch: 1, ReplicationFactor: 2, Nodes: []Node{a, b}, Next: &next}
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		// a and b own every key, and c is the only new owner
+		assert.Equal(t, []Node{c}, current.CopyTargets(current.Owners(key)[0].ID, key, nil), key)
+		assert.Nil(t, current.CopyTargets(current.Owners(key)[1].ID, key, nil), key)
+		assert.Equal(t, []Node{c}, current.CopyTargets(current.Owners(key)[1].ID, key, []string{current.Owners(key)[0].ID}), key)
+		assert.Equal(t, []Node{b}, current.CopyTargets("c", key, nil), key)
+		assert.True(t, current.Drops("a", key))
+		assert.False(t, current.Drops("b", key))
+	}
+}
@@ -7,3 +7,22 @@ func GenerateDeterministicPartitionKey(key string, numPartitions int) int {
 	}
 	return n % numPartitions
 }
+
+// GetReplicaIndexes returns the indexes of the nodes that hold a key
+// when it is stored replicationFactor times: the node chosen by
+// GenerateDeterministicPartitionKey first, followed by the next nodes
+// in index order. Fewer indexes are returned if there are fewer nodes.
+func GetReplicaIndexes(key string, numNodes int, replicationFactor int) []int {
+	if replicationFactor > numNodes {
+		replicationFactor = numNodes
+	}
+	if replicationFactor < 1 {
+		replicationFactor = 1
+	}
+	first := GenerateDeterministicPartitionKey(key, numNodes)
+	indexes := make([]int, 0, replicationFactor)
+	for i := 0; i < replicationFactor; i++ {
+		indexes = append(indexes, (first+i)%numNodes)
+	}
+	return indexes
+}
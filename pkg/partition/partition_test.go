@@ -59,3 +59,24 @@ func TestGenerateDeterministicPartitionKey(t *testing.T) {
 	}
 
 }
+
+// TestGetReplicaIndexes checks that replicas are placed on
+// distinct successive nodes, starting with the partition node
+func TestGetReplicaIndexes(t *testing.T) {
+
+	for i := 0; i < 100; i++ {
+		key := common.GenerateRandomString(10)
+		for numNodes := 1; numNodes <= 5; numNodes++ {
+			indexes := GetReplicaIndexes(key, numNodes, 3)
+			expectedLen := int(math.Min(3, float64(numNodes)))
+			assert.Len(t, indexes, expectedLen)
+			assert.Equal(t, GenerateDeterministicPartitionKey(key, numNodes), indexes[0])
+			seen := map[int]bool{}
+			for j, index := range indexes {
+				assert.Equal(t, (indexes[0]+j)%numNodes, index)
+				assert.False(t, seen[index])
+				seen[index] = true
+			}
+		}
+	}
+}
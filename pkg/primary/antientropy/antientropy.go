@@ -0,0 +1,144 @@
+package antientropy
+
+import (
+	"fmt"
+
+	"keepair/pkg/common"
+	"keepair/pkg/log"
+	"keepair/pkg/primary/clients"
+
+	"github.com/google/uuid"
+)
+
+// Difference is a key whose value on the target does not match the
+// source, and the operation that makes the target match
+type Difference struct {
+	Key    string                      `json:"key"`
+	Action common.EntryOperationAction `json:"action"`
+}
+
+type Report struct {
+	InSync           bool         `json:"inSync"`
+	DifferingBuckets int          `json:"differingBuckets"`
+	Differences      []Difference `json:"differences"`
+	// Applied is whether the differences were transferred to the target
+	Applied bool `json:"applied"`
+}
+
+// Compare finds the keys that differ between two workers by comparing
+// their Merkle trees, only listing the keys of buckets that differ.
+// Keys that are not shared by both workers are left out, and the
+// workers are in sync when no shared key differs.
+func Compare(source, target clients.IWorkerClient, shared func(key string) bool) (Report, error) {
+	report := Report{Differences: make([]Difference, 0)}
+
+	sourceDigest, err := source.GetDigest()
+	if err != nil {
+		return report, fmt.Errorf("failed to get source digest: %w", err)
+	}
+	targetDigest, err := target.GetDigest()
+	if err != nil {
+		return report, fmt.Errorf("failed to get target digest: %w", err)
+	}
+	if sourceDigest.Root == targetDigest.Root {
+		report.InSync = true
+		return report, nil
+	}
+	if len(sourceDigest.Buckets) != len(targetDigest.Buckets) {
+		return report, fmt.Errorf("digests have different bucket counts: %d and %d", len(sourceDigest.Buckets), len(targetDigest.Buckets))
+	}
+
+	for bucket := range sourceDigest.Buckets {
+		if sourceDigest.Buckets[bucket] == targetDigest.Buckets[bucket] {
+			continue
+		}
+		report.DifferingBuckets++
+
+		sourceKeys, err := source.GetBucketDigest(bucket)
+		if err != nil {
+			return report, err
+		}
+		targetKeys, err := target.GetBucketDigest(bucket)
+		if err != nil {
+			return report, err
+		}
+		report.Differences = append(report.Differences, diffKeys(sourceKeys, targetKeys, shared)...)
+	}
+	report.InSync = len(report.Differences) == 0
+
+	return report, nil
+}
+
+// diffKeys returns the operations that make the shared target
+// keys of a bucket match the source keys
+func diffKeys(sourceKeys, targetKeys []common.KeyDigest, shared func(key string) bool) []Difference {
+	targetHashes := make(map[string]string, len(targetKeys))
+	for _, k := range targetKeys {
+		targetHashes[k.Key] = k.Hash
+	}
+
+	differences := make([]Difference, 0)
+	for _, k := range sourceKeys {
+		if !shared(k.Key) {
+			delete(targetHashes, k.Key)
+			continue
+		}
+		if hash, ok := targetHashes[k.Key]; !ok || hash != k.Hash {
+			differences = append(differences, Difference{Key: k.Key, Action: common.SetEntry})
+		}
+		delete(targetHashes, k.Key)
+	}
+	for _, k := range targetKeys {
+		if _, ok := targetHashes[k.Key]; ok && shared(k.Key) {
+			differences = append(differences, Difference{Key: k.Key, Action: common.DeleteEntry})
+		}
+	}
+	return differences
+}
+
+// Sync makes the keys the target shares with the source match the
+// source, only transferring the keys that differ
+func Sync(source, target clients.IWorkerClient, shared func(key string) bool) (Report, error) {
+	report, err := Compare(source, target, shared)
+	if err != nil || report.InSync {
+		return report, err
+	}
+
+	operations := make([]common.EntryOperation, 0, len(report.Differences))
+	for _, difference := range report.Differences {
+		if difference.Action == common.DeleteEntry {
+			operations = append(operations, common.EntryOperation{
+				Action: common.DeleteEntry,
+				Entry:  common.Entry{Key: difference.Key},
+			})
+			continue
+		}
+		entry, ok, err := source.GetEntry(difference.Key)
+		if err != nil {
+			return report, err
+		}
+		// deleted from the source since it was compared
+		if !ok {
+			entry = common.Entry{Key: difference.Key}
+			operations = append(operations, common.EntryOperation{Action: common.DeleteEntry, Entry: entry})
+			continue
+		}
+		operations = append(operations, common.EntryOperation{Action: common.SetEntry, Entry: entry})
+	}
+
+	// the sync is queued apart from any migration
+	queueID := "sync-" + uuid.NewString()
+	if _, err := target.QueueOperations(queueID, queueID, operations); err != nil {
+		return report, err
+	}
+	if err := target.ApplyOperations(queueID, false); err != nil {
+		return report, err
+	}
+	report.Applied = true
+	if _, err := target.DiscardOperationQueue(queueID); err != nil {
+		log.Get().Printf("failed to discard queue of anti-entropy sync: %s", err)
+	}
+
+	log.Get().Printf("anti-entropy sync transferred %d keys", len(operations))
+	return report, nil
+}
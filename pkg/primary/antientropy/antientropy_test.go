@@ -0,0 +1,36 @@
+package antientropy
+
+import (
+	"testing"
+
+	"keepair/pkg/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffKeys(t *testing.T) {
+	source := []common.KeyDigest{
+		{Key: "same", Hash: "1"},
+		{Key: "changed", Hash: "2"},
+		{Key: "missing", Hash: "3"},
+	}
+	target := []common.KeyDigest{
+		{Key: "same", Hash: "1"},
+		{Key: "changed", Hash: "old"},
+		{Key: "extra", Hash: "4"},
+	}
+	all := func(key string) bool { return true }
+
+	assert.Equal(t, []Difference{
+		{Key: "changed", Action: common.SetEntry},
+		{Key: "missing", Action: common.SetEntry},
+		{Key: "extra", Action: common.DeleteEntry},
+	}, diffKeys(source, target, all))
+
+	assert.Empty(t, diffKeys(source, source, all))
+
+	// keys only one of the nodes should hold are left alone
+	assert.Equal(t, []Difference{
+		{Key: "changed", Action: common.SetEntry},
+	}, diffKeys(source, target, func(key string) bool { return key == "changed" || key == "same" }))
+}
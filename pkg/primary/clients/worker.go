@@ -3,12 +3,19 @@ package clients
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"keepair/pkg/common"
+	"keepair/pkg/document"
+	"keepair/pkg/partition"
 	"keepair/pkg/streamer"
 	"keepair/pkg/values"
 )
@@ -17,14 +24,36 @@ type IWorkerClient interface {
 	SetKey(key string, value []byte) error
 	DeleteKey(key string) error
 	GetKey(key string) ([]byte, error)
+	SetKeyVersioned(key string, value []byte, timestamp int64) error
+	DeleteKeyVersioned(key string, timestamp int64) error
+	GetKeyVersion(key string) (common.VersionedValue, error)
+	GetKeyPath(key string, path string) ([]byte, error)
+	PatchKey(key string, patch []byte) error
 	GetStats() (common.NodeStats, error)
+	GetDigest() (common.Digest, error)
+	GetBucketDigest(bucket int) ([]common.KeyDigest, error)
+	GetEntry(key string) (common.Entry, bool, error)
+	Forward(method string, path string, rawQuery string, body []byte) (int, []byte, error)
 	StreamEntries() (<-chan common.Entry, <-chan error)
-	QueueOperations(operations []common.EntryOperation) error
-	ApplyOperations() error
+	StreamEvents(ctx context.Context, since uint64) (<-chan common.ChangeEvent, <-chan error)
+	QueueOperations(queueID string, batchID string, operations []common.EntryOperation) (bool, error)
+	ApplyOperations(queueID string, keepNewer bool) error
+	GetOperationQueues() ([]common.OperationQueue, error)
+	GetOperationQueue(queueID string) (common.OperationQueue, bool, error)
+	DiscardOperationQueue(queueID string) (bool, error)
+	SetAssignment(assignment partition.Assignment) error
+	CountMoves(req partition.TransferRequest) ([]partition.Move, error)
+	TransferKeys(req partition.TransferRequest) ([]partition.Transfer, error)
+	DropKeys(req partition.TransferRequest) (partition.Transfer, error)
+	GetTransferProgress(ID string) ([]partition.Transfer, bool, error)
+	CancelTransfer(ID string) (bool, error)
 }
 
 type WorkerClient struct {
 	WorkerNodeURL string
+	// FollowerURLs are the workers that the worker must
+	// replicate writes to before acknowledging them
+	FollowerURLs []string
 }
 
 func NewWorkerClient(workerNodeURL string) IWorkerClient {
@@ -33,17 +62,114 @@ func NewWorkerClient(workerNodeURL string) IWorkerClient {
 	}
 }
 
+// NewReplicatedWorkerClient returns a client for the leader replica
+// of a key, whose writes are forwarded to the followers
+func NewReplicatedWorkerClient(leaderURL string, followerURLs []string) IWorkerClient {
+	return WorkerClient{
+		WorkerNodeURL: leaderURL,
+		FollowerURLs:  followerURLs,
+	}
+}
+
+// doWrite sends a write request, telling the worker
+// which followers to replicate it to
+func (w WorkerClient) doWrite(req *http.Request) (*http.Response, error) {
+	if len(w.FollowerURLs) > 0 {
+		req.Header.Set(values.ReplicasHeader, strings.Join(w.FollowerURLs, ","))
+	}
+	return do(req)
+}
+
+// ReplicationError is returned by a write that the leader replica of
+// a key applied, but that some of its followers failed to apply
+type ReplicationError struct {
+	// FollowerURLs are the followers that missed the write
+	FollowerURLs []string
+	// Timestamp is the version of the write
+	Timestamp int64
+	Message   string
+}
+
+func (e *ReplicationError) Error() string {
+	return fmt.Sprintf("write not replicated to %s: %s", strings.Join(e.FollowerURLs, ", "), e.Message)
+}
+
+// writeError returns the error of a write response, if any
+func writeError(res *http.Response, request string) error {
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode == http.StatusAccepted && res.Header.Get(values.FailedReplicasHeader) != "" {
+		timestamp, _ := strconv.ParseInt(res.Header.Get(values.TimestampHeader), 10, 64)
+		return &ReplicationError{
+			FollowerURLs: strings.Split(res.Header.Get(values.FailedReplicasHeader), ","),
+			Timestamp:    timestamp,
+			Message:      string(body),
+		}
+	}
+	if res.StatusCode != 200 {
+		return fmt.Errorf("%s request failed: %s", request, body)
+	}
+	return nil
+}
+
+// maxRedirects is how many redirects a key request follows
+const maxRedirects = 3
+
+// do sends a key request, following the redirects of workers that
+// do not serve the key while a rebalance moves it. Following an ASK
+// drops the followers named by the request, as the new owner of the
+// key replicates it to its own followers.
+func do(req *http.Request) (*http.Response, error) {
+	for i := 0; ; i++ {
+		res, err := http.DefaultClient.Do(req)
+		if err != nil || res.StatusCode != http.StatusMisdirectedRequest || i == maxRedirects {
+			return res, err
+		}
+		location, err := url.Parse(res.Header.Get("Location"))
+		kind := partition.RedirectKind(res.Header.Get(values.RedirectHeader))
+		res.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid redirect location: %w", err)
+		}
+
+		next := req.Clone(req.Context())
+		next.URL.Scheme = location.Scheme
+		next.URL.Host = location.Host
+		next.Host = ""
+		if req.GetBody != nil {
+			if next.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		next.Header.Del(values.AskingHeader)
+		if kind == partition.AskRedirect {
+			next.Header.Set(values.AskingHeader, "true")
+			next.Header.Del(values.ReplicasHeader)
+		}
+		req = next
+	}
+}
+
+// get sends a key read request
+func get(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return do(req)
+}
+
 func (w WorkerClient) SetKey(key string, value []byte) error {
 	url := fmt.Sprintf("%s/keys/%s", w.WorkerNodeURL, key)
-	res, err := http.Post(url, "", bytes.NewReader(value))
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(value))
 	if err != nil {
 		return err
 	}
-	if res.StatusCode != 200 {
-		body, _ := io.ReadAll(res.Body)
-		return fmt.Errorf("set key request failed: %s", body)
+	res, err := w.doWrite(req)
+	if err != nil {
+		return err
 	}
-	return nil
+	defer res.Body.Close()
+	return writeError(res, "set key")
 }
 
 func (w WorkerClient) DeleteKey(key string) error {
@@ -52,23 +178,80 @@ func (w WorkerClient) DeleteKey(key string) error {
 	if err != nil {
 		return err
 	}
-	res, err := http.DefaultClient.Do(req)
+	res, err := w.doWrite(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return writeError(res, "delete key")
+}
+
+// SetKeyVersioned sets a key written at timestamp. The worker
+// ignores it if it already has a newer version.
+func (w WorkerClient) SetKeyVersioned(key string, value []byte, timestamp int64) error {
+	url := fmt.Sprintf("%s/keys/%s", w.WorkerNodeURL, key)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(value))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(values.TimestampHeader, strconv.FormatInt(timestamp, 10))
+	res, err := w.doWrite(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return writeError(res, "set key")
+}
+
+// DeleteKeyVersioned deletes a key at timestamp. The worker
+// ignores it if it already has a newer version.
+func (w WorkerClient) DeleteKeyVersioned(key string, timestamp int64) error {
+	url := fmt.Sprintf("%s/keys/%s", w.WorkerNodeURL, key)
+	req, err := http.NewRequest(http.MethodDelete, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(values.TimestampHeader, strconv.FormatInt(timestamp, 10))
+	res, err := w.doWrite(req)
 	if err != nil {
 		return err
 	}
+	defer res.Body.Close()
+	return writeError(res, "delete key")
+}
+
+// GetKeyVersion returns the value of a key with its timestamp
+func (w WorkerClient) GetKeyVersion(key string) (common.VersionedValue, error) {
+	url := fmt.Sprintf("%s/versions/%s", w.WorkerNodeURL, key)
+	res, err := http.Get(url)
+	if err != nil {
+		return common.VersionedValue{}, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return common.VersionedValue{}, err
+	}
 	if res.StatusCode != 200 {
-		body, _ := io.ReadAll(res.Body)
-		return fmt.Errorf("delete key request failed: %s", body)
+		return common.VersionedValue{}, fmt.Errorf("get version request failed: %s", body)
 	}
-	return nil
+	var version common.VersionedValue
+	if err := json.Unmarshal(body, &version); err != nil {
+		return common.VersionedValue{}, err
+	}
+	return version, nil
 }
 
 func (w WorkerClient) GetKey(key string) ([]byte, error) {
 	url := fmt.Sprintf("%s/keys/%s", w.WorkerNodeURL, key)
-	res, err := http.Get(url)
+	res, err := get(url)
 	if err != nil {
 		return nil, err
 	}
+	if res.StatusCode == 404 {
+		body, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("%w: %s", common.ErrNotFound, strings.TrimPrefix(string(body), common.ErrNotFound.Error()+": "))
+	}
 	if res.StatusCode != 200 {
 		body, _ := io.ReadAll(res.Body)
 		return nil, fmt.Errorf("get key request failed: %s", body)
@@ -80,6 +263,66 @@ func (w WorkerClient) GetKey(key string) ([]byte, error) {
 	return body, nil
 }
 
+func (w WorkerClient) GetKeyPath(key string, path string) ([]byte, error) {
+	url := fmt.Sprintf("%s/keys/%s?path=%s", w.WorkerNodeURL, key, url.QueryEscape(path))
+	res, err := get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != 200 {
+		return nil, documentError(res.StatusCode, body, "get key path")
+	}
+	return body, nil
+}
+
+func (w WorkerClient) PatchKey(key string, patch []byte) error {
+	url := fmt.Sprintf("%s/keys/%s", w.WorkerNodeURL, key)
+	req, err := http.NewRequest(http.MethodPatch, url, bytes.NewReader(patch))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	res, err := w.doWrite(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusAccepted {
+		return writeError(res, "patch key")
+	}
+	if res.StatusCode != 200 {
+		body, _ := io.ReadAll(res.Body)
+		return documentError(res.StatusCode, body, "patch key")
+	}
+	return nil
+}
+
+// documentError converts a failed document request back
+// into the typed error returned by the worker's store
+func documentError(statusCode int, body []byte, action string) error {
+	switch statusCode {
+	case 422:
+		return document.ParseNotJSONError(string(body))
+	case 404:
+		// a key the worker does not hold, or a path its value lacks
+		if message := strings.TrimPrefix(string(body), common.ErrNotFound.Error()+": "); message != string(body) {
+			return fmt.Errorf("%w: %s", common.ErrNotFound, message)
+		}
+		return fmt.Errorf("%w: %s", document.ErrPathNotFound, body)
+	case 409:
+		return fmt.Errorf("%w: %s", common.ErrWrongType, strings.TrimPrefix(string(body), common.ErrWrongType.Error()+": "))
+	case 400:
+		return fmt.Errorf("%w: %s", document.ErrInvalidPath, body)
+	default:
+		return fmt.Errorf("%s request failed: %s", action, body)
+	}
+}
+
 func (w WorkerClient) GetStats() (common.NodeStats, error) {
 	url := fmt.Sprintf("%s/stats", w.WorkerNodeURL)
 	res, err := http.Get(url)
@@ -103,6 +346,82 @@ func (w WorkerClient) GetStats() (common.NodeStats, error) {
 	return stats.Stats, nil
 }
 
+// Forward sends a request to the worker as-is and returns
+// the status code and body of the response
+// getJSON gets a worker URL and decodes its JSON response
+func getJSON(url string, out any) (int, error) {
+	res, err := http.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return 0, err
+	}
+	if res.StatusCode != 200 {
+		return res.StatusCode, fmt.Errorf("request to %s failed: %s", url, body)
+	}
+	return res.StatusCode, json.Unmarshal(body, out)
+}
+
+// GetDigest returns the root and bucket hashes of the worker's Merkle tree
+func (w WorkerClient) GetDigest() (common.Digest, error) {
+	var digest common.Digest
+	_, err := getJSON(fmt.Sprintf("%s/digest", w.WorkerNodeURL), &digest)
+	return digest, err
+}
+
+// GetBucketDigest returns the hash of each key in a bucket
+func (w WorkerClient) GetBucketDigest(bucket int) ([]common.KeyDigest, error) {
+	var result struct {
+		Keys []common.KeyDigest `json:"keys"`
+	}
+	_, err := getJSON(fmt.Sprintf("%s/digest/%d", w.WorkerNodeURL, bucket), &result)
+	return result.Keys, err
+}
+
+// GetEntry returns the typed entry of a key, and false if
+// the worker does not hold it
+func (w WorkerClient) GetEntry(key string) (common.Entry, bool, error) {
+	var entry common.Entry
+	status, err := getJSON(fmt.Sprintf("%s/entries/%s", w.WorkerNodeURL, key), &entry)
+	if status == 404 {
+		return common.Entry{}, false, nil
+	}
+	if err != nil {
+		return common.Entry{}, false, err
+	}
+	return entry, true, nil
+}
+
+func (w WorkerClient) Forward(method string, path string, rawQuery string, body []byte) (int, []byte, error) {
+	url := fmt.Sprintf("%s%s", w.WorkerNodeURL, path)
+	if rawQuery != "" {
+		url = fmt.Sprintf("%s?%s", url, rawQuery)
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	var res *http.Response
+	if method == http.MethodGet {
+		res, err = do(req)
+	} else {
+		res, err = w.doWrite(req)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+	return res.StatusCode, resBody, nil
+}
+
 func (w WorkerClient) StreamEntries() (<-chan common.Entry, <-chan error) {
 	entryChan := make(chan common.Entry)
 	errChan := make(chan error)
@@ -136,32 +455,277 @@ func (w WorkerClient) StreamEntries() (<-chan common.Entry, <-chan error) {
 	return entryChan, errChan
 }
 
-func (w WorkerClient) QueueOperations(operations []common.EntryOperation) error {
-	url := fmt.Sprintf("%s/queue-operations", w.WorkerNodeURL)
+// StreamEvents streams the worker's changes made after since until
+// the context is cancelled or the stream ends
+func (w WorkerClient) StreamEvents(ctx context.Context, since uint64) (<-chan common.ChangeEvent, <-chan error) {
+	eventChan := make(chan common.ChangeEvent)
+	errChan := make(chan error, 1)
+
+	go func() {
+		url := fmt.Sprintf("%s/events?since=%d", w.WorkerNodeURL, since)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			errChan <- err
+			return
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			errChan <- fmt.Errorf("stream events err: %w", err)
+			return
+		}
+		defer res.Body.Close()
+		if res.StatusCode != 200 {
+			body, _ := io.ReadAll(res.Body)
+			errChan <- fmt.Errorf("stream events request failed: %s", body)
+			return
+		}
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			var event common.ChangeEvent
+			if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+				errChan <- fmt.Errorf("decode event err: %w", err)
+				return
+			}
+			select {
+			case eventChan <- event:
+			case <-ctx.Done():
+				errChan <- ctx.Err()
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			errChan <- fmt.Errorf("scanner err: %w", err)
+			return
+		}
+		errChan <- nil
+	}()
+
+	return eventChan, errChan
+}
+
+// QueueOperations queues a batch of operations on the worker under a
+// queue ID, to be applied with ApplyOperations. A batch with an ID the
+// queue already received is not queued again, and false is returned.
+func (w WorkerClient) QueueOperations(queueID string, batchID string, operations []common.EntryOperation) (bool, error) {
+	url := fmt.Sprintf("%s/queue-operations?%s", w.WorkerNodeURL, url.Values{"queue": {queueID}, "batch": {batchID}}.Encode())
 	value, err := json.Marshal(operations)
 	if err != nil {
-		return err
+		return false, err
 	}
 	res, err := http.Post(url, "", bytes.NewReader(value))
 	if err != nil {
-		return err
+		return false, err
 	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
 	if res.StatusCode != 200 {
-		body, _ := io.ReadAll(res.Body)
-		return fmt.Errorf("queue operations request failed: %s", body)
+		return false, fmt.Errorf("queue operations request failed: %s", body)
 	}
-	return nil
+	return string(body) == "ok", nil
 }
 
-func (w WorkerClient) ApplyOperations() error {
-	url := fmt.Sprintf("%s/apply-operations", w.WorkerNodeURL)
+// ApplyOperations applies the operations queued on the worker under
+// a queue ID, leaving the other queues pending. With keepNewer, keys
+// written after their queued copies were made are kept.
+func (w WorkerClient) ApplyOperations(queueID string, keepNewer bool) error {
+	query := url.Values{"queue": {queueID}}
+	if keepNewer {
+		query.Set("keepNewer", "true")
+	}
+	url := fmt.Sprintf("%s/apply-operations?%s", w.WorkerNodeURL, query.Encode())
 	res, err := http.Post(url, "", nil)
 	if err != nil {
 		return err
 	}
+	defer res.Body.Close()
 	if res.StatusCode != 200 {
 		body, _ := io.ReadAll(res.Body)
 		return fmt.Errorf("apply operations request failed: %s", body)
 	}
 	return nil
 }
+
+// GetOperationQueues returns the queues of operations of the worker
+func (w WorkerClient) GetOperationQueues() ([]common.OperationQueue, error) {
+	res, err := http.Get(fmt.Sprintf("%s/operation-queues", w.WorkerNodeURL))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("operation queues request failed: %s", body)
+	}
+	var queues []common.OperationQueue
+	return queues, json.Unmarshal(body, &queues)
+}
+
+// GetOperationQueue returns a queue of the worker with its pending
+// operations, and whether the queue exists
+func (w WorkerClient) GetOperationQueue(queueID string) (common.OperationQueue, bool, error) {
+	res, err := http.Get(fmt.Sprintf("%s/operation-queues/%s", w.WorkerNodeURL, url.PathEscape(queueID)))
+	if err != nil {
+		return common.OperationQueue{}, false, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return common.OperationQueue{}, false, err
+	}
+	if res.StatusCode == 404 {
+		return common.OperationQueue{}, false, nil
+	}
+	if res.StatusCode != 200 {
+		return common.OperationQueue{}, false, fmt.Errorf("operation queue request failed: %s", body)
+	}
+	var queue common.OperationQueue
+	return queue, true, json.Unmarshal(body, &queue)
+}
+
+// DiscardOperationQueue drops a queue of the worker without applying
+// it, and returns whether the queue existed
+func (w WorkerClient) DiscardOperationQueue(queueID string) (bool, error) {
+	req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/operation-queues/%s", w.WorkerNodeURL, url.PathEscape(queueID)), nil)
+	if err != nil {
+		return false, err
+	}
+	res, err := do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == 404 {
+		return false, nil
+	}
+	if res.StatusCode != 200 {
+		body, _ := io.ReadAll(res.Body)
+		return false, fmt.Errorf("discard operation queue request failed: %s", body)
+	}
+	return true, nil
+}
+
+// ErrFenced is returned when a worker refuses an assignment because it
+// has seen a newer epoch, meaning another primary has taken over
+var ErrFenced = errors.New("primary is fenced by a newer epoch")
+
+// SetAssignment pushes the partition assignment to the worker
+func (w WorkerClient) SetAssignment(assignment partition.Assignment) error {
+	url := fmt.Sprintf("%s/assignment", w.WorkerNodeURL)
+	value, err := json.Marshal(assignment)
+	if err != nil {
+		return err
+	}
+	res, err := http.Post(url, "application/json", bytes.NewReader(value))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode == 409 {
+		return fmt.Errorf("%w: %s", ErrFenced, body)
+	}
+	if res.StatusCode != 200 {
+		return fmt.Errorf("set assignment request failed: %s", body)
+	}
+	return nil
+}
+
+// CountMoves returns what the worker would copy and drop if keys
+// moved from the placement of an assignment to its next one
+func (w WorkerClient) CountMoves(req partition.TransferRequest) ([]partition.Move, error) {
+	var result struct {
+		Moves []partition.Move `json:"moves"`
+	}
+	if err := w.postTransfer("moves", req, &result); err != nil {
+		return nil, err
+	}
+	return result.Moves, nil
+}
+
+// TransferKeys tells the worker to send its keys straight to the
+// workers that own them in the next placement of an assignment
+func (w WorkerClient) TransferKeys(req partition.TransferRequest) ([]partition.Transfer, error) {
+	var result struct {
+		Transfers []partition.Transfer `json:"transfers"`
+	}
+	if err := w.postTransfer("transfer", req, &result); err != nil {
+		return nil, err
+	}
+	return result.Transfers, nil
+}
+
+// DropKeys tells the worker to delete the keys it does
+// not own in the next placement of an assignment
+func (w WorkerClient) DropKeys(req partition.TransferRequest) (partition.Transfer, error) {
+	var result struct {
+		Transfer partition.Transfer `json:"transfer"`
+	}
+	err := w.postTransfer("drop", req, &result)
+	return result.Transfer, err
+}
+
+// GetTransferProgress returns what a copy in progress on the worker
+// has sent so far, and whether the copy is in progress
+func (w WorkerClient) GetTransferProgress(ID string) ([]partition.Transfer, bool, error) {
+	res, err := http.Get(fmt.Sprintf("%s/transfer/%s", w.WorkerNodeURL, url.PathEscape(ID)))
+	if err != nil {
+		return nil, false, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, false, err
+	}
+	if res.StatusCode == 404 {
+		return nil, false, nil
+	}
+	if res.StatusCode != 200 {
+		return nil, false, fmt.Errorf("transfer progress request failed: %s", body)
+	}
+	var result struct {
+		Transfers []partition.Transfer `json:"transfers"`
+	}
+	return result.Transfers, true, json.Unmarshal(body, &result)
+}
+
+// CancelTransfer stops a copy in progress on the worker before its
+// next batch, and returns whether the copy was in progress
+func (w WorkerClient) CancelTransfer(ID string) (bool, error) {
+	res, err := http.Post(fmt.Sprintf("%s/transfer/%s/cancel", w.WorkerNodeURL, url.PathEscape(ID)), "", nil)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == 404 {
+		return false, nil
+	}
+	if res.StatusCode != 200 {
+		body, _ := io.ReadAll(res.Body)
+		return false, fmt.Errorf("cancel transfer request failed: %s", body)
+	}
+	return true, nil
+}
+
+func (w WorkerClient) postTransfer(path string, req partition.TransferRequest, result interface{}) error {
+	url := fmt.Sprintf("%s/%s", w.WorkerNodeURL, path)
+	value, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	res, err := http.Post(url, "application/json", bytes.NewReader(value))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != 200 {
+		return fmt.Errorf("%s request failed: %s", path, body)
+	}
+	return json.Unmarshal(body, result)
+}
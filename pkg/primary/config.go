@@ -0,0 +1,20 @@
+package primary
+
+import (
+	"keepair/pkg/primary/node"
+	"keepair/pkg/raft"
+)
+
+type Config struct {
+	Node node.Config
+	// Raft replicates membership across several primaries.
+	// A primary runs on its own if Raft.ID is empty.
+	Raft raft.Config
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Node: node.DefaultConfig(),
+		Raft: raft.DefaultConfig(),
+	}
+}
@@ -0,0 +1,37 @@
+package endpoints
+
+import (
+	"errors"
+
+	"keepair/pkg/primary/node"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ApplyRebalanceHandler adds and removes the nodes of a membership
+// change with a single migration, returning once it is done
+var ApplyRebalanceHandler = func(nodeService node.IService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var change node.MembershipChange
+		if err := c.ShouldBindJSON(&change); err != nil {
+			c.Data(400, "", []byte(err.Error()))
+			return
+		}
+		if len(change.Add) == 0 && len(change.Remove) == 0 {
+			c.Data(400, "", []byte("empty membership change"))
+			return
+		}
+
+		if err := nodeService.ChangeMembership(change); err != nil {
+			status := nodeErrorStatus(err)
+			if errors.Is(err, node.ErrInvalidChange) {
+				status = 400
+			}
+			c.Data(status, "", []byte(err.Error()))
+			return
+		}
+
+		c.Data(200, "", []byte("ok"))
+	}
+}
@@ -0,0 +1,27 @@
+package endpoints
+
+import (
+	"keepair/pkg/primary/node"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CheckPlacementHandler reports keys that are not held by the nodes
+// the partitioner maps them to, and repairs them if repair is true
+var CheckPlacementHandler = func(nodeService node.IService, repair bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if nodeService.GetNumNodes() == 0 {
+			c.Data(500, "", []byte("no nodes available"))
+			return
+		}
+
+		report, err := nodeService.CheckPlacement(repair)
+		if err != nil {
+			c.Data(500, "", []byte(err.Error()))
+			return
+		}
+
+		c.JSON(200, report)
+	}
+}
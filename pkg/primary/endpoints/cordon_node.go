@@ -0,0 +1,59 @@
+package endpoints
+
+import (
+	"errors"
+
+	"keepair/pkg/primary/node"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CordonNodeHandler stops a node from being given new data
+var CordonNodeHandler = func(nodeService node.IService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if err := nodeService.CordonNode(c.Param("nodeID")); err != nil {
+			c.Data(nodeErrorStatus(err), "", []byte(err.Error()))
+			return
+		}
+
+		c.Data(200, "", []byte("ok"))
+	}
+}
+
+// UncordonNodeHandler lets a cordoned node be given new data again
+var UncordonNodeHandler = func(nodeService node.IService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if err := nodeService.UncordonNode(c.Param("nodeID")); err != nil {
+			c.Data(nodeErrorStatus(err), "", []byte(err.Error()))
+			return
+		}
+
+		c.Data(200, "", []byte("ok"))
+	}
+}
+
+// DrainNodeHandler moves all the keys of a node to the other
+// nodes and unregisters it, returning once it is done
+var DrainNodeHandler = func(nodeService node.IService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if err := nodeService.DrainNode(c.Param("nodeID")); err != nil {
+			c.Data(nodeErrorStatus(err), "", []byte(err.Error()))
+			return
+		}
+
+		c.Data(200, "", []byte("ok"))
+	}
+}
+
+func nodeErrorStatus(err error) int {
+	if errors.Is(err, node.ErrNodeNotFound) {
+		return 404
+	}
+	if errors.Is(err, node.ErrNodeCordoned) {
+		return 409
+	}
+	return 500
+}
@@ -1,10 +1,7 @@
 package endpoints
 
 import (
-	"fmt"
-
-	"keepair/pkg/partition"
-	"keepair/pkg/primary/clients"
+	"keepair/pkg/common"
 	"keepair/pkg/primary/node"
 
 	"github.com/gin-gonic/gin"
@@ -19,23 +16,23 @@ var DeleteKeyHandler = func(nodeService node.IService) gin.HandlerFunc {
 			return
 		}
 
-		numNodes := nodeService.GetNumNodes()
-		if numNodes == 0 {
-			c.Data(500, "", []byte("no nodes available"))
+		if nodeService.GetConfig().Mode == node.LeaderlessMode {
+			err := writeQuorum(nodeService, key, c.Query("w"), common.DeleteEntry, nil)
+			if err != nil {
+				c.Data(errorStatus(err), "", []byte(err.Error()))
+				return
+			}
+			c.Data(200, "", []byte("ok"))
 			return
 		}
 
-		partitionKey := partition.GenerateDeterministicPartitionKey(key, numNodes)
-		n, err := nodeService.GetNodeByIndex(partitionKey)
+		hinted, err := writeOrHint(nodeService, key, common.DeleteEntry, nil)
 		if err != nil {
-			c.Data(500, "", []byte(err.Error()))
+			c.Data(errorStatus(err), "", []byte(err.Error()))
 			return
 		}
-
-		workerNodeURL := fmt.Sprintf("http://%s", n.Address)
-		workerClient := clients.NewWorkerClient(workerNodeURL)
-		if err := workerClient.DeleteKey(key); err != nil {
-			c.Data(500, "", []byte(err.Error()))
+		if hinted {
+			c.Data(202, "", []byte("hinted"))
 			return
 		}
 
@@ -0,0 +1,27 @@
+package endpoints
+
+import (
+	"errors"
+
+	"keepair/pkg/common"
+	"keepair/pkg/primary/clients"
+	"keepair/pkg/primary/hints"
+	"keepair/pkg/primary/quorum"
+)
+
+// errorStatus maps worker client errors to response status codes,
+// the errors of keys and their documents as the workers do
+func errorStatus(err error) int {
+	var replicationErr *clients.ReplicationError
+	switch {
+	// the write was applied, and its followers are repaired later
+	case errors.As(err, &replicationErr):
+		return 202
+	case errors.Is(err, quorum.ErrInvalidLevel):
+		return 400
+	case errors.Is(err, hints.ErrFull):
+		return 503
+	default:
+		return common.ErrorStatus(err)
+	}
+}
@@ -0,0 +1,47 @@
+package endpoints
+
+import (
+	"io"
+
+	"keepair/pkg/primary/node"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ForwardByKeyHandler forwards the request unchanged to the leader
+// replica of the key and relays the worker's response
+var ForwardByKeyHandler = func(nodeService node.IService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		key := c.Param("key")
+		if key == "" {
+			c.Data(400, "", []byte("empty key"))
+			return
+		}
+
+		workerClient, err := getWriteClient(nodeService, key)
+		if err != nil {
+			c.Data(500, "", []byte(err.Error()))
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.Data(500, "", []byte(err.Error()))
+			return
+		}
+		defer c.Request.Body.Close()
+
+		statusCode, resBody, err := workerClient.Forward(c.Request.Method, c.Request.URL.Path, c.Request.URL.RawQuery, body)
+		if err != nil {
+			c.Data(500, "", []byte(err.Error()))
+			return
+		}
+
+		contentType := "application/json"
+		if statusCode != 200 {
+			contentType = ""
+		}
+		c.Data(statusCode, contentType, resBody)
+	}
+}
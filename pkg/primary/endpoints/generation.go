@@ -0,0 +1,17 @@
+package endpoints
+
+import (
+	"keepair/pkg/primary/node"
+	"keepair/pkg/values"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GenerationHeader tells workers which run of the primary answered,
+// so they can re-register after it restarts
+var GenerationHeader = func(nodeService node.IService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header(values.GenerationHeader, nodeService.GetGeneration())
+		c.Next()
+	}
+}
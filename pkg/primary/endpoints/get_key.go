@@ -1,9 +1,6 @@
 package endpoints
 
 import (
-	"fmt"
-
-	"keepair/pkg/partition"
 	"keepair/pkg/primary/clients"
 	"keepair/pkg/primary/node"
 
@@ -19,24 +16,40 @@ var GetKeyHandler = func(nodeService node.IService) gin.HandlerFunc {
 			return
 		}
 
-		numNodes := nodeService.GetNumNodes()
-		if numNodes == 0 {
-			c.Data(500, "", []byte("no nodes available"))
+		// return a sub-document of a JSON value
+		if path := c.Query("path"); path != "" {
+			var value []byte
+			err := readFromReplicas(nodeService, key, func(workerClient clients.IWorkerClient) error {
+				v, err := workerClient.GetKeyPath(key, path)
+				value = v
+				return err
+			})
+			if err != nil {
+				c.Data(errorStatus(err), "", []byte(err.Error()))
+				return
+			}
+			c.Data(200, "application/json", value)
 			return
 		}
 
-		partitionKey := partition.GenerateDeterministicPartitionKey(key, numNodes)
-		n, err := nodeService.GetNodeByIndex(partitionKey)
-		if err != nil {
-			c.Data(500, "", []byte(err.Error()))
+		if nodeService.GetConfig().Mode == node.LeaderlessMode {
+			value, err := readQuorum(nodeService, key, c.Query("r"))
+			if err != nil {
+				c.Data(errorStatus(err), "", []byte(err.Error()))
+				return
+			}
+			c.Data(200, "", value)
 			return
 		}
 
-		workerNodeURL := fmt.Sprintf("http://%s", n.Address)
-		workerClient := clients.NewWorkerClient(workerNodeURL)
-		value, err := workerClient.GetKey(key)
+		var value []byte
+		err := readFromReplicas(nodeService, key, func(workerClient clients.IWorkerClient) error {
+			v, err := workerClient.GetKey(key)
+			value = v
+			return err
+		})
 		if err != nil {
-			c.Data(500, "", []byte(err.Error()))
+			c.Data(errorStatus(err), "", []byte(err.Error()))
 			return
 		}
 
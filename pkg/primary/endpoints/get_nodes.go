@@ -9,10 +9,11 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// GetNodesHandler returns the nodes with their current stats, or the
+// stats sent in their latest heartbeats when they cannot be reached
 var GetNodesHandler = func(nodeService node2.IService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		mu := sync.Mutex{}
 		nodes := nodeService.GetNodes()
 		if len(nodes) == 0 {
 			c.Data(500, "", []byte("no nodes available"))
@@ -20,19 +21,15 @@ var GetNodesHandler = func(nodeService node2.IService) gin.HandlerFunc {
 		}
 
 		wg := sync.WaitGroup{}
-		for i, n := range nodes {
+		for i := range nodes {
 			wg.Add(1)
-			go func(i int, n node2.Node) {
+			go func(n *node2.Node) {
 				defer wg.Done()
 
 				if err := n.LoadStats(); err != nil {
 					log.Get().Printf("LoadStats ERR: %s", err)
 				}
-
-				mu.Lock()
-				nodes[i] = n
-				mu.Unlock()
-			}(i, n)
+			}(&nodes[i])
 		}
 		wg.Wait()
 
@@ -0,0 +1,50 @@
+package endpoints
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"keepair/pkg/primary/node"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxTopologyWait = time.Minute
+
+// GetTopologyHandler returns the nodes of the cluster with their
+// status and partitions. With ?version, the request waits until the
+// topology differs from that version or ?timeout (default 30s) passes,
+// so clients can long-poll for changes such as a failover.
+var GetTopologyHandler = func(nodeService node.IService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		versionParam := c.Query("version")
+		if versionParam == "" {
+			c.JSON(200, nodeService.GetTopology())
+			return
+		}
+
+		version, err := strconv.ParseUint(versionParam, 10, 64)
+		if err != nil {
+			c.Data(400, "", []byte("invalid version"))
+			return
+		}
+		timeout := time.Second * 30
+		if timeoutParam := c.Query("timeout"); timeoutParam != "" {
+			timeout, err = time.ParseDuration(timeoutParam)
+			if err != nil || timeout < 0 {
+				c.Data(400, "", []byte("invalid timeout"))
+				return
+			}
+		}
+		if timeout > maxTopologyWait {
+			timeout = maxTopologyWait
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		c.JSON(200, nodeService.WaitForTopologyChange(ctx, version))
+	}
+}
@@ -0,0 +1,40 @@
+package endpoints
+
+import (
+	"errors"
+	"fmt"
+
+	"keepair/pkg/common"
+	"keepair/pkg/primary/node"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HeartbeatHandler renews the membership lease of a worker. A worker
+// that is not a member is told to register again with a 404, unless
+// it was unregistered, which is answered with a 410.
+var HeartbeatHandler = func(nodeService node.IService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var heartbeat common.Heartbeat
+		if err := c.ShouldBindJSON(&heartbeat); err != nil {
+			c.Data(400, "", []byte(fmt.Sprintf("error: %s", err.Error())))
+			return
+		}
+
+		lease, err := nodeService.Heartbeat(c.Param("nodeID"), heartbeat)
+		if errors.Is(err, node.ErrNodeRemoved) {
+			c.Data(410, "", []byte(err.Error()))
+			return
+		}
+		if errors.Is(err, node.ErrNodeNotFound) {
+			c.Data(404, "", []byte(err.Error()))
+			return
+		}
+		if err != nil {
+			c.Data(500, "", []byte(err.Error()))
+			return
+		}
+
+		c.JSON(200, lease)
+	}
+}
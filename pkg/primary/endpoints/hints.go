@@ -0,0 +1,92 @@
+package endpoints
+
+import (
+	"errors"
+	"net/url"
+	"time"
+
+	"keepair/pkg/common"
+	"keepair/pkg/primary/clients"
+	"keepair/pkg/primary/hints"
+	"keepair/pkg/primary/node"
+)
+
+// isUnavailable returns whether a worker request failed because
+// the worker could not be reached, rather than being rejected
+func isUnavailable(err error) bool {
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// writeOrHint writes a key through its leader replica. If the leader
+// is not healthy or cannot be reached, the write is stored as a hint
+// and replayed once the leader is healthy again.
+// It returns whether the write was hinted.
+func writeOrHint(nodeService node.IService, key string, action common.EntryOperationAction, value []byte) (bool, error) {
+	replicas, err := nodeService.GetReplicasForKey(key)
+	if err != nil {
+		return false, err
+	}
+	leader := replicas[0]
+	timestamp := time.Now().UnixNano()
+
+	if leader.Status == node.HealthyStatus {
+		workerClient, err := getWriteClient(nodeService, key)
+		if err != nil {
+			return false, err
+		}
+		if action == common.DeleteEntry {
+			err = workerClient.DeleteKey(key)
+		} else {
+			err = workerClient.SetKey(key, value)
+		}
+		// the leader kept the write, and the followers
+		// that missed it are sent it later
+		var replicationErr *clients.ReplicationError
+		if errors.As(err, &replicationErr) {
+			return true, hintFollowers(nodeService, replicas[1:], replicationErr, action, key, value)
+		}
+		if !isUnavailable(err) {
+			return false, err
+		}
+	}
+
+	return true, addHint(nodeService, leader, action, key, value, timestamp)
+}
+
+// hintFollowers stores a write for the followers that missed it,
+// at the version the leader applied it with
+func hintFollowers(nodeService node.IService, followers []node.Node, replicationErr *clients.ReplicationError, action common.EntryOperationAction, key string, value []byte) error {
+	missed := make(map[string]bool, len(replicationErr.FollowerURLs))
+	for _, followerURL := range replicationErr.FollowerURLs {
+		missed[followerURL] = true
+	}
+	for _, n := range followers {
+		if !missed[n.URL()] {
+			continue
+		}
+		if err := addHint(nodeService, n, action, key, value, replicationErr.Timestamp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addHint(nodeService node.IService, nd node.Node, action common.EntryOperationAction, key string, value []byte, timestamp int64) error {
+	return nodeService.AddHint(hints.Hint{
+		NodeID:    nd.ID,
+		Action:    action,
+		Key:       key,
+		Value:     value,
+		Timestamp: timestamp,
+		CreatedAt: time.Now(),
+	})
+}
+
+// writeVersioned applies a write to a worker at timestamp
+func writeVersioned(workerClient clients.IWorkerClient, action common.EntryOperationAction, key string, value []byte, timestamp int64) error {
+	if action == common.DeleteEntry {
+		return workerClient.DeleteKeyVersioned(key, timestamp)
+	}
+	return workerClient.SetKeyVersioned(key, value, timestamp)
+}
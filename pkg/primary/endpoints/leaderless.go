@@ -0,0 +1,164 @@
+package endpoints
+
+import (
+	"fmt"
+	"time"
+
+	"keepair/pkg/common"
+	"keepair/pkg/log"
+	"keepair/pkg/primary/clients"
+	"keepair/pkg/primary/node"
+	"keepair/pkg/primary/quorum"
+)
+
+var errKeyNotFound = fmt.Errorf("%w: no value found for key", common.ErrNotFound)
+
+// getQuorumReplicas returns the replicas of a key and how many
+// of them must respond for a consistency level
+func getQuorumReplicas(nodeService node.IService, key string, level string) ([]node.Node, int, error) {
+	replicas, err := nodeService.GetReplicasForKey(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	required, err := quorum.ParseLevel(level, len(replicas))
+	if err != nil {
+		return nil, 0, err
+	}
+	return replicas, required, nil
+}
+
+// writeQuorum sends a write with the same timestamp to every replica
+// of a key and returns once the required number acknowledged it. The
+// remaining writes carry on in the background. Unavailable replicas
+// are sent the write as a hint later, which does not count as an ack.
+func writeQuorum(nodeService node.IService, key string, level string, action common.EntryOperationAction, value []byte) error {
+	replicas, required, err := getQuorumReplicas(nodeService, key, level)
+	if err != nil {
+		return err
+	}
+
+	timestamp := time.Now().UnixNano()
+	errChan := make(chan error, len(replicas))
+	for _, n := range replicas {
+		go func(n node.Node) {
+			unhealthy := n.Status != node.HealthyStatus
+			var err error
+			if unhealthy {
+				err = fmt.Errorf("node %s is %s", n.ID, n.Status)
+			} else {
+				err = writeVersioned(clients.NewWorkerClient(n.URL()), action, key, value, timestamp)
+			}
+			if unhealthy || isUnavailable(err) {
+				if hintErr := addHint(nodeService, n, action, key, value, timestamp); hintErr != nil {
+					log.Get().Printf("failed to store hint for node %s: %s", n.ID, hintErr)
+				}
+			}
+			errChan <- err
+		}(n)
+	}
+
+	acks := 0
+	var lastErr error
+	for i := range replicas {
+		if err := <-errChan; err != nil {
+			lastErr = err
+		} else {
+			acks++
+		}
+		if acks == required {
+			return nil
+		}
+		// too many failures for the rest to reach the quorum
+		if i+1-acks > len(replicas)-required {
+			break
+		}
+	}
+	return fmt.Errorf("write quorum not reached, %d of %d acks: %w", acks, required, lastErr)
+}
+
+type replicaVersion struct {
+	node    node.Node
+	version common.VersionedValue
+	err     error
+}
+
+// readQuorum reads a key from every replica and returns the newest
+// value once the required number responded. Replicas with an older
+// version are then repaired in the background.
+func readQuorum(nodeService node.IService, key string, level string) ([]byte, error) {
+	replicas, required, err := getQuorumReplicas(nodeService, key, level)
+	if err != nil {
+		return nil, err
+	}
+
+	responseChan := make(chan replicaVersion, len(replicas))
+	for _, n := range replicas {
+		go func(n node.Node) {
+			version, err := clients.NewWorkerClient(n.URL()).GetKeyVersion(key)
+			responseChan <- replicaVersion{node: n, version: version, err: err}
+		}(n)
+	}
+
+	responses := make([]replicaVersion, 0, len(replicas))
+	received := 0
+	var lastErr error
+	for len(responses) < required && received < len(replicas) {
+		response := <-responseChan
+		received++
+		if response.err != nil {
+			lastErr = response.err
+			continue
+		}
+		responses = append(responses, response)
+	}
+	if len(responses) < required {
+		return nil, fmt.Errorf("read quorum not reached, %d of %d responses: %w", len(responses), required, lastErr)
+	}
+
+	newest := quorum.Newest(versionsOf(responses))
+
+	go func() {
+		for ; received < len(replicas); received++ {
+			if response := <-responseChan; response.err == nil {
+				responses = append(responses, response)
+			}
+		}
+		readRepair(nodeService, key, responses)
+	}()
+
+	if !newest.Found {
+		return nil, fmt.Errorf("%w: %s", errKeyNotFound, key)
+	}
+	return newest.Value, nil
+}
+
+// readRepair writes the newest version of a key back to
+// the replicas that responded with an older one
+func readRepair(nodeService node.IService, key string, responses []replicaVersion) {
+	newest := quorum.Newest(versionsOf(responses))
+	for _, response := range responses {
+		if !quorum.IsStale(response.version, newest) {
+			continue
+		}
+		client := clients.NewWorkerClient(response.node.URL())
+		var err error
+		if newest.Deleted {
+			err = client.DeleteKeyVersioned(key, newest.Timestamp)
+		} else {
+			err = client.SetKeyVersioned(key, newest.Value, newest.Timestamp)
+		}
+		if err != nil {
+			log.Get().Printf("read repair of %s on node %s failed: %s", key, response.node.ID, err)
+			continue
+		}
+		nodeService.RecordReadRepair(response.node.ID)
+	}
+}
+
+func versionsOf(responses []replicaVersion) []common.VersionedValue {
+	versions := make([]common.VersionedValue, 0, len(responses))
+	for _, response := range responses {
+		versions = append(versions, response.version)
+	}
+	return versions
+}
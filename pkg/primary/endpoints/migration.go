@@ -0,0 +1,90 @@
+package endpoints
+
+import (
+	"errors"
+
+	"keepair/pkg/primary/node"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMigrationHandler returns the migration in progress
+// with the progress of its steps
+var GetMigrationHandler = func(nodeService node.IService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		plan := nodeService.GetMigration()
+		if plan == nil {
+			c.Data(404, "", []byte(node.ErrNoMigration.Error()))
+			return
+		}
+
+		c.JSON(200, plan)
+	}
+}
+
+// ResumeMigrationHandler runs the rest of a migration that failed
+var ResumeMigrationHandler = func(nodeService node.IService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if err := nodeService.ResumeMigration(); err != nil {
+			c.Data(migrationErrorStatus(err), "", []byte(err.Error()))
+			return
+		}
+
+		c.Data(200, "", []byte("ok"))
+	}
+}
+
+// RollbackMigrationHandler moves the data of a migration that
+// failed back to the membership it started from
+var RollbackMigrationHandler = func(nodeService node.IService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if err := nodeService.RollbackMigration(); err != nil {
+			c.Data(migrationErrorStatus(err), "", []byte(err.Error()))
+			return
+		}
+
+		c.Data(200, "", []byte("ok"))
+	}
+}
+
+// CancelMigrationHandler stops the running migration before its next
+// step, so it can be resumed or rolled back later
+var CancelMigrationHandler = func(nodeService node.IService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if err := nodeService.CancelMigration(); err != nil {
+			c.Data(migrationErrorStatus(err), "", []byte(err.Error()))
+			return
+		}
+
+		c.Data(200, "", []byte("ok"))
+	}
+}
+
+// GetRebalanceStatusHandler returns the phase of the migration in
+// progress, with what it moved so far and what remains to move
+var GetRebalanceStatusHandler = func(nodeService node.IService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		status, err := nodeService.GetRebalanceStatus()
+		if err != nil {
+			c.Data(migrationErrorStatus(err), "", []byte(err.Error()))
+			return
+		}
+
+		c.JSON(200, status)
+	}
+}
+
+func migrationErrorStatus(err error) int {
+	if errors.Is(err, node.ErrNoMigration) {
+		return 404
+	}
+	if errors.Is(err, node.ErrMigrationNotRunning) {
+		return 409
+	}
+	return 500
+}
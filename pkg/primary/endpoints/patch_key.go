@@ -0,0 +1,48 @@
+package endpoints
+
+import (
+	"io"
+
+	"keepair/pkg/primary/node"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PatchKeyHandler applies a JSON Merge Patch (RFC 7386) to the
+// value of a key. The patch is applied on the owning worker so
+// only the patch itself is sent over the network.
+var PatchKeyHandler = func(nodeService node.IService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		key := c.Param("key")
+		if key == "" {
+			c.Data(400, "", []byte("empty key"))
+			return
+		}
+
+		workerClient, err := getWriteClient(nodeService, key)
+		if err != nil {
+			c.Data(500, "", []byte(err.Error()))
+			return
+		}
+
+		patch, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.Data(500, "", []byte(err.Error()))
+			return
+		}
+		defer c.Request.Body.Close()
+
+		if len(patch) == 0 {
+			c.Data(400, "", []byte("empty patch"))
+			return
+		}
+
+		if err := workerClient.PatchKey(key, patch); err != nil {
+			c.Data(errorStatus(err), "", []byte(err.Error()))
+			return
+		}
+
+		c.Data(200, "", []byte("ok"))
+	}
+}
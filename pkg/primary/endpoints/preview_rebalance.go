@@ -0,0 +1,39 @@
+package endpoints
+
+import (
+	"errors"
+
+	"keepair/pkg/primary/node"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PreviewRebalanceHandler returns how many keys and bytes a proposed
+// membership change would move between each pair of nodes, without
+// moving anything
+var PreviewRebalanceHandler = func(nodeService node.IService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var change node.MembershipChange
+		if err := c.ShouldBindJSON(&change); err != nil {
+			c.Data(400, "", []byte(err.Error()))
+			return
+		}
+		if len(change.Add) == 0 && len(change.Remove) == 0 {
+			c.Data(400, "", []byte("empty membership change"))
+			return
+		}
+
+		preview, err := nodeService.PreviewRebalance(change)
+		if err != nil {
+			status := 500
+			if errors.Is(err, node.ErrInvalidChange) || errors.Is(err, node.ErrNodeNotFound) {
+				status = 400
+			}
+			c.Data(status, "", []byte(err.Error()))
+			return
+		}
+
+		c.JSON(200, preview)
+	}
+}
@@ -0,0 +1,80 @@
+package endpoints
+
+import (
+	"net/http/httputil"
+	"net/url"
+
+	"keepair/pkg/primary/node"
+	"keepair/pkg/raft"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ForwardToLeader proxies membership changes received by a
+// follower primary to the raft leader
+var ForwardToLeader = func(nodeService node.IService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if nodeService.IsLeader() {
+			c.Next()
+			return
+		}
+
+		leaderURL := nodeService.GetRaft().LeaderURL()
+		if leaderURL == "" {
+			c.Data(503, "", []byte("no leader elected"))
+			c.Abort()
+			return
+		}
+		target, err := url.Parse(leaderURL)
+		if err != nil {
+			c.Data(500, "", []byte(err.Error()))
+			c.Abort()
+			return
+		}
+
+		// the proxy adds X-Forwarded-For, so the leader
+		// still sees the address of a registering worker
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		proxy.ServeHTTP(c.Writer, c.Request)
+		c.Abort()
+	}
+}
+
+var RaftStatusHandler = func(raftNode *raft.Node) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(200, raftNode.Status())
+	}
+}
+
+var RequestVoteHandler = func(raftNode *raft.Node) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var args raft.RequestVoteArgs
+		if err := c.ShouldBindJSON(&args); err != nil {
+			c.Data(400, "", []byte(err.Error()))
+			return
+		}
+		c.JSON(200, raftNode.HandleRequestVote(args))
+	}
+}
+
+var AppendEntriesHandler = func(raftNode *raft.Node) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var args raft.AppendEntriesArgs
+		if err := c.ShouldBindJSON(&args); err != nil {
+			c.Data(400, "", []byte(err.Error()))
+			return
+		}
+		c.JSON(200, raftNode.HandleAppendEntries(args))
+	}
+}
+
+var InstallSnapshotHandler = func(raftNode *raft.Node) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var args raft.InstallSnapshotArgs
+		if err := c.ShouldBindJSON(&args); err != nil {
+			c.Data(400, "", []byte(err.Error()))
+			return
+		}
+		c.JSON(200, raftNode.HandleInstallSnapshot(args))
+	}
+}
@@ -11,6 +11,8 @@ import (
 type RegisterNodeBody struct {
 	ID   string `json:"id" binding:"required"`
 	Port string `json:"port" binding:"required"`
+	// Epoch is the latest assignment epoch the worker has seen
+	Epoch uint64 `json:"epoch"`
 }
 
 var RegisterNodeHandler = func(nodeService node2.IService) gin.HandlerFunc {
@@ -21,9 +23,11 @@ var RegisterNodeHandler = func(nodeService node2.IService) gin.HandlerFunc {
 			return
 		}
 
-		err := nodeService.RegisterNode(node2.NewNode(body.ID, c.ClientIP(), body.Port))
+		nd := node2.NewNode(body.ID, c.ClientIP(), body.Port)
+		nd.Epoch = body.Epoch
+		err := nodeService.RegisterNode(nd)
 		if err != nil {
-			c.Data(500, "", []byte(err.Error()))
+			c.Data(nodeErrorStatus(err), "", []byte(err.Error()))
 			return
 		}
 
@@ -0,0 +1,39 @@
+package endpoints
+
+import (
+	"keepair/pkg/primary/clients"
+	"keepair/pkg/primary/node"
+)
+
+// getWriteClient returns a client for the leader replica of
+// a key, which forwards writes to the follower replicas. Followers
+// that are not healthy are skipped, so writes keep working while a
+// failed node is being detected.
+func getWriteClient(nodeService node.IService, key string) (clients.IWorkerClient, error) {
+	replicas, err := nodeService.GetReplicasForKey(key)
+	if err != nil {
+		return nil, err
+	}
+	followerURLs := make([]string, 0, len(replicas)-1)
+	for _, n := range replicas[1:] {
+		if n.Status == node.HealthyStatus {
+			followerURLs = append(followerURLs, n.URL())
+		}
+	}
+	return clients.NewReplicatedWorkerClient(replicas[0].URL(), followerURLs), nil
+}
+
+// readFromReplicas calls read with a client for each replica of a
+// key in turn, starting with the leader, until one succeeds
+func readFromReplicas(nodeService node.IService, key string, read func(client clients.IWorkerClient) error) error {
+	replicas, err := nodeService.GetReplicasForKey(key)
+	if err != nil {
+		return err
+	}
+	for _, n := range replicas {
+		if err = read(clients.NewWorkerClient(n.URL())); err == nil {
+			return nil
+		}
+	}
+	return err
+}
@@ -1,11 +1,10 @@
 package endpoints
 
 import (
-	"fmt"
 	"io"
 
-	"keepair/pkg/partition"
-	"keepair/pkg/primary/clients"
+	"keepair/pkg/common"
+
 	"keepair/pkg/primary/node"
 
 	"github.com/gin-gonic/gin"
@@ -20,19 +19,6 @@ var SetKeyHandler = func(nodeService node.IService) gin.HandlerFunc {
 			return
 		}
 
-		numNodes := nodeService.GetNumNodes()
-		if numNodes == 0 {
-			c.Data(500, "", []byte("no nodes available"))
-			return
-		}
-
-		partitionKey := partition.GenerateDeterministicPartitionKey(key, numNodes)
-		n, err := nodeService.GetNodeByIndex(partitionKey)
-		if err != nil {
-			c.Data(500, "", []byte(err.Error()))
-			return
-		}
-
 		postBody, err := io.ReadAll(c.Request.Body)
 		if err != nil {
 			c.Data(500, "", []byte(err.Error()))
@@ -45,10 +31,23 @@ var SetKeyHandler = func(nodeService node.IService) gin.HandlerFunc {
 			return
 		}
 
-		workerNodeURL := fmt.Sprintf("http://%s", n.Address)
-		workerClient := clients.NewWorkerClient(workerNodeURL)
-		if err := workerClient.SetKey(key, postBody); err != nil {
-			c.Data(500, "", []byte(err.Error()))
+		if nodeService.GetConfig().Mode == node.LeaderlessMode {
+			err := writeQuorum(nodeService, key, c.Query("w"), common.SetEntry, postBody)
+			if err != nil {
+				c.Data(errorStatus(err), "", []byte(err.Error()))
+				return
+			}
+			c.Data(200, "", []byte("ok"))
+			return
+		}
+
+		hinted, err := writeOrHint(nodeService, key, common.SetEntry, postBody)
+		if err != nil {
+			c.Data(errorStatus(err), "", []byte(err.Error()))
+			return
+		}
+		if hinted {
+			c.Data(202, "", []byte("hinted"))
 			return
 		}
 
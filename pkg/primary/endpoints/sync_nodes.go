@@ -0,0 +1,79 @@
+package endpoints
+
+import (
+	"errors"
+	"fmt"
+
+	"keepair/pkg/primary/antientropy"
+	"keepair/pkg/primary/clients"
+	"keepair/pkg/primary/node"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SyncNodesHandler compares the data of two nodes by their Merkle
+// trees and, unless dryRun is true, makes the keys the target shares
+// with the source match it. Nodes that share no keys are refused.
+var SyncNodesHandler = func(nodeService node.IService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		sourceID := c.Query("source")
+		targetID := c.Query("target")
+		if sourceID == "" || targetID == "" {
+			c.Data(400, "", []byte("source and target are required"))
+			return
+		}
+		if sourceID == targetID {
+			c.Data(400, "", []byte("source and target must be different nodes"))
+			return
+		}
+
+		// only the keys both nodes are supposed to hold are synced
+		shared, err := nodeService.SharedKeys(sourceID, targetID)
+		if errors.Is(err, node.ErrNodeNotFound) {
+			c.Data(404, "", []byte(err.Error()))
+			return
+		}
+		if err != nil {
+			c.Data(400, "", []byte(err.Error()))
+			return
+		}
+
+		// nodes joining with a migration are not members yet
+		nodesByID := make(map[string]node.Node)
+		if plan := nodeService.GetMigration(); plan != nil {
+			for _, mb := range plan.To {
+				nodesByID[mb.ID] = node.Node{ID: mb.ID, Address: mb.Address}
+			}
+		}
+		for _, n := range nodeService.GetNodes() {
+			nodesByID[n.ID] = n
+		}
+		source, ok := nodesByID[sourceID]
+		if !ok {
+			c.Data(404, "", []byte(fmt.Sprintf("failed to find node: %s", sourceID)))
+			return
+		}
+		target, ok := nodesByID[targetID]
+		if !ok {
+			c.Data(404, "", []byte(fmt.Sprintf("failed to find node: %s", targetID)))
+			return
+		}
+
+		sourceClient := clients.NewWorkerClient(source.URL())
+		targetClient := clients.NewWorkerClient(target.URL())
+
+		var report antientropy.Report
+		if c.Query("dryRun") == "true" {
+			report, err = antientropy.Compare(sourceClient, targetClient, shared)
+		} else {
+			report, err = antientropy.Sync(sourceClient, targetClient, shared)
+		}
+		if err != nil {
+			c.Data(500, "", []byte(err.Error()))
+			return
+		}
+
+		c.JSON(200, report)
+	}
+}
@@ -23,7 +23,7 @@ var UnregisterNodeHandler = func(nodeService node.IService) gin.HandlerFunc {
 
 		err := nodeService.UnregisterNode(nodeID)
 		if err != nil {
-			c.Data(500, "", []byte(err.Error()))
+			c.Data(nodeErrorStatus(err), "", []byte(err.Error()))
 			return
 		}
 
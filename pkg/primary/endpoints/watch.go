@@ -0,0 +1,85 @@
+package endpoints
+
+import (
+	"strings"
+	"time"
+
+	"keepair/pkg/common"
+	"keepair/pkg/primary/node"
+	"keepair/pkg/primary/watch"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+const watchKeepAliveInterval = time.Second * 15
+
+// WatchHandler streams set and delete events for keys matching a
+// prefix as Server-Sent Events. Each event ID is a cursor that can
+// be passed back as "since" (or Last-Event-ID) to resume the watch.
+// Changes made by rebalances are skipped unless includeRebalance=true.
+var WatchHandler = func(nodeService node.IService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		since := c.Query("since")
+		if since == "" {
+			since = c.GetHeader("Last-Event-ID")
+		}
+		cursor, err := watch.ParseCursor(since)
+		if err != nil {
+			c.Data(400, "", []byte(err.Error()))
+			return
+		}
+		prefix := c.Query("prefix")
+		includeRebalance := c.Query("includeRebalance") == "true"
+
+		c.Writer.Header().Set("Content-Type", "text/event-stream")
+		c.Writer.Header().Set("Cache-Control", "no-cache")
+		c.Writer.Header().Set("Connection", "keep-alive")
+		c.Writer.WriteHeaderNow()
+		c.Writer.Flush()
+
+		ctx := c.Request.Context()
+		eventChan := watch.Watch(ctx, nodeService, cursor)
+
+		keepAlive := time.NewTicker(watchKeepAliveInterval)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-keepAlive.C:
+				if _, err := c.Writer.WriteString(": keep-alive\n\n"); err != nil {
+					return
+				}
+				c.Writer.Flush()
+			case event, ok := <-eventChan:
+				if !ok {
+					return
+				}
+				cursor[event.WorkerID] = event.Seq
+
+				if event.Action != common.CompactedChange {
+					if !strings.HasPrefix(event.Key, prefix) {
+						continue
+					}
+					if event.Origin == common.RebalanceOrigin && !includeRebalance {
+						continue
+					}
+					// the leader replica already reported the change
+					if event.Origin == common.ReplicationOrigin {
+						continue
+					}
+				}
+
+				c.Render(-1, sse.Event{
+					Id:    cursor.String(),
+					Event: string(event.Action),
+					Data:  event,
+				})
+				c.Writer.Flush()
+			}
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package hints
+
+import (
+	"errors"
+	"time"
+
+	"keepair/pkg/common"
+)
+
+var ErrFull = errors.New("hint store is full")
+
+// Hint is a write accepted for a node that was unavailable,
+// to be replayed once the node is healthy again
+type Hint struct {
+	NodeID string                      `json:"nodeId"`
+	Action common.EntryOperationAction `json:"action"`
+	Key    string                      `json:"key"`
+	Value  []byte                      `json:"value,omitempty"`
+	// Timestamp is the version of the write, so a replayed hint
+	// does not overwrite a newer write made in the meantime
+	Timestamp int64     `json:"timestamp"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type Config struct {
+	// Dir is the directory hints are persisted to. Hints are
+	// kept in memory only if Dir is empty.
+	Dir string
+	// MaxHints is the number of hints stored across all
+	// nodes, or 0 to not limit by count
+	MaxHints int
+	// MaxAge is how long a hint is kept before it is
+	// dropped, or 0 to keep hints until replayed
+	MaxAge time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Dir:      "",
+		MaxHints: 10_000,
+		MaxAge:   time.Hour,
+	}
+}
+
+type IStore interface {
+	// Add stores a hint, returning ErrFull if the store is at capacity
+	Add(hint Hint) error
+	// Pending returns the unexpired hints of a node, oldest first
+	Pending(nodeID string) []Hint
+	// Done removes hints of a node that were replayed. Hints added
+	// or expired since they were returned by Pending are left alone.
+	Done(nodeID string, replayed []Hint) error
+	// Depths returns the number of pending hints per node
+	Depths() map[string]int
+	Close() error
+}
@@ -0,0 +1,253 @@
+package hints
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const hintsExtension = ".hints"
+
+// Store keeps the hints of each node in order. With a directory, each
+// node's hints are appended as JSON lines to a file named after the
+// node, which is rewritten when hints are replayed or expire.
+type Store struct {
+	Config Config
+
+	mu    sync.Mutex
+	hints map[string][]Hint
+	count int
+}
+
+func Open(config Config) (IStore, error) {
+	s := &Store{
+		Config: config,
+		hints:  make(map[string][]Hint),
+	}
+	if config.Dir == "" {
+		return s, nil
+	}
+
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create hints dir: %w", err)
+	}
+	paths, err := filepath.Glob(filepath.Join(config.Dir, "*"+hintsExtension))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		nodeHints, err := readHints(path)
+		if err != nil {
+			return nil, err
+		}
+		nodeID := strings.TrimSuffix(filepath.Base(path), hintsExtension)
+		s.hints[nodeID] = nodeHints
+		s.count += len(nodeHints)
+	}
+	return s, nil
+}
+
+// readHints reads a hints file, ignoring a torn last line
+func readHints(path string) ([]Hint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	nodeHints := make([]Hint, 0)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var hint Hint
+		if err := json.Unmarshal(scanner.Bytes(), &hint); err != nil {
+			break
+		}
+		nodeHints = append(nodeHints, hint)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read hints %s: %w", path, err)
+	}
+	return nodeHints, nil
+}
+
+func (s *Store) Add(hint Hint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Config.MaxHints > 0 && s.count >= s.Config.MaxHints {
+		s.expire(time.Now())
+		if s.count >= s.Config.MaxHints {
+			return ErrFull
+		}
+	}
+
+	if s.Config.Dir != "" {
+		line, err := json.Marshal(hint)
+		if err != nil {
+			return err
+		}
+		f, err := os.OpenFile(s.path(hint.NodeID), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			return err
+		}
+		if err := f.Sync(); err != nil {
+			return err
+		}
+	}
+
+	s.hints[hint.NodeID] = append(s.hints[hint.NodeID], hint)
+	s.count++
+	return nil
+}
+
+func (s *Store) Pending(nodeID string) []Hint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire(time.Now())
+	pending := make([]Hint, len(s.hints[nodeID]))
+	copy(pending, s.hints[nodeID])
+	return pending
+}
+
+func (s *Store) Done(nodeID string, replayed []Hint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	done := make(map[hintID]int, len(replayed))
+	for _, hint := range replayed {
+		done[idOf(hint)]++
+	}
+	kept := make([]Hint, 0, len(s.hints[nodeID]))
+	for _, hint := range s.hints[nodeID] {
+		if ID := idOf(hint); done[ID] > 0 {
+			done[ID]--
+			s.count--
+			continue
+		}
+		kept = append(kept, hint)
+	}
+	return s.setHints(nodeID, kept)
+}
+
+// hintID identifies a hint of a node
+type hintID struct {
+	action    string
+	key       string
+	timestamp int64
+	createdAt int64
+}
+
+func idOf(hint Hint) hintID {
+	return hintID{
+		action:    string(hint.Action),
+		key:       hint.Key,
+		timestamp: hint.Timestamp,
+		createdAt: hint.CreatedAt.UnixNano(),
+	}
+}
+
+func (s *Store) Depths() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	depths := make(map[string]int, len(s.hints))
+	for nodeID, nodeHints := range s.hints {
+		depths[nodeID] = len(nodeHints)
+	}
+	return depths
+}
+
+func (s *Store) Close() error {
+	return nil
+}
+
+// expire drops hints older than MaxAge. Caller must handle locks.
+func (s *Store) expire(now time.Time) {
+	if s.Config.MaxAge <= 0 {
+		return
+	}
+	for nodeID, nodeHints := range s.hints {
+		// hints are added in order, so expired ones come first
+		n := 0
+		for n < len(nodeHints) && now.Sub(nodeHints[n].CreatedAt) > s.Config.MaxAge {
+			n++
+		}
+		if n == 0 {
+			continue
+		}
+		s.count -= n
+		if err := s.setHints(nodeID, nodeHints[n:]); err != nil {
+			// the expired hints are dropped again on the next call
+			s.count += n
+		}
+	}
+}
+
+// setHints replaces the hints of a node, rewriting its file.
+// Caller must handle locks.
+func (s *Store) setHints(nodeID string, nodeHints []Hint) error {
+	if s.Config.Dir != "" {
+		if err := s.writeHints(nodeID, nodeHints); err != nil {
+			return fmt.Errorf("failed to write hints of %s: %w", nodeID, err)
+		}
+	}
+	if len(nodeHints) == 0 {
+		delete(s.hints, nodeID)
+		return nil
+	}
+	s.hints[nodeID] = nodeHints
+	return nil
+}
+
+// writeHints atomically replaces the hints file of a node
+func (s *Store) writeHints(nodeID string, nodeHints []Hint) error {
+	path := s.path(nodeID)
+	if len(nodeHints) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, hint := range nodeHints {
+		line, err := json.Marshal(hint)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		w.Write(append(line, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func (s *Store) path(nodeID string) string {
+	return filepath.Join(s.Config.Dir, nodeID+hintsExtension)
+}
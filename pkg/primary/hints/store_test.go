@@ -0,0 +1,105 @@
+package hints
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"keepair/pkg/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newHint(nodeID string, key string, createdAt time.Time) Hint {
+	return Hint{
+		NodeID:    nodeID,
+		Action:    common.SetEntry,
+		Key:       key,
+		Value:     []byte("value-" + key),
+		Timestamp: createdAt.UnixNano(),
+		CreatedAt: createdAt,
+	}
+}
+
+// TestStoreReopen checks that hints survive reopening the
+// store and that replayed hints are not restored
+func TestStoreReopen(t *testing.T) {
+
+	config := DefaultConfig()
+	config.Dir = t.TempDir()
+
+	s, err := Open(config)
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, s.Add(newHint("a", fmt.Sprint(i), time.Now())))
+	}
+	assert.NoError(t, s.Add(newHint("b", "x", time.Now())))
+	assert.NoError(t, s.Done("a", s.Pending("a")[:2]))
+	assert.NoError(t, s.Close())
+
+	s, err = Open(config)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"a": 1, "b": 1}, s.Depths())
+	pending := s.Pending("a")
+	assert.Len(t, pending, 1)
+	assert.Equal(t, "2", pending[0].Key)
+	assert.Equal(t, []byte("value-2"), pending[0].Value)
+
+	assert.NoError(t, s.Done("a", pending))
+	assert.NoError(t, s.Close())
+
+	s, err = Open(config)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"b": 1}, s.Depths())
+}
+
+// TestStoreLimits checks that the store is bounded
+// by count and that old hints expire
+func TestStoreLimits(t *testing.T) {
+
+	config := DefaultConfig()
+	config.MaxHints = 2
+	config.MaxAge = time.Minute
+
+	s, err := Open(config)
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.Add(newHint("a", "old", time.Now().Add(-time.Hour))))
+	assert.NoError(t, s.Add(newHint("a", "new", time.Now())))
+
+	// the expired hint makes room for another
+	assert.NoError(t, s.Add(newHint("b", "new", time.Now())))
+	assert.ErrorIs(t, s.Add(newHint("b", "full", time.Now())), ErrFull)
+
+	pending := s.Pending("a")
+	assert.Len(t, pending, 1)
+	assert.Equal(t, "new", pending[0].Key)
+	assert.Equal(t, map[string]int{"a": 1, "b": 1}, s.Depths())
+}
+
+// TestStoreDoneAfterExpire checks that hints expiring between
+// Pending and Done do not make Done drop hints never replayed
+func TestStoreDoneAfterExpire(t *testing.T) {
+
+	config := DefaultConfig()
+	config.MaxAge = time.Second
+
+	s, err := Open(config)
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.Add(newHint("a", "old", time.Now().Add(-900*time.Millisecond))))
+	assert.NoError(t, s.Add(newHint("a", "new", time.Now())))
+	pending := s.Pending("a")
+	assert.Len(t, pending, 2)
+
+	// the old hint expires and another is added before the replay is done
+	time.Sleep(200 * time.Millisecond)
+	assert.NoError(t, s.Add(newHint("a", "newer", time.Now())))
+	assert.Len(t, s.Pending("a"), 2)
+
+	assert.NoError(t, s.Done("a", pending))
+	pending = s.Pending("a")
+	assert.Len(t, pending, 1)
+	assert.Equal(t, "newer", pending[0].Key)
+	assert.Equal(t, map[string]int{"a": 1}, s.Depths())
+}
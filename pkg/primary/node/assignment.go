@@ -0,0 +1,44 @@
+package node
+
+import (
+	"fmt"
+
+	"keepair/pkg/partition"
+	"keepair/pkg/primary/clients"
+)
+
+// newAssignment builds the partition assignment of nodes
+func newAssignment(epoch uint64, nodes Map, replicationFactor int) partition.Assignment {
+	assignment := partition.Assignment{
+		Epoch:             epoch,
+		ReplicationFactor: replicationFactor,
+		Nodes:             make([]partition.Node, len(nodes)),
+	}
+	for _, n := range nodes {
+		assignment.Nodes[n.Index] = partition.Node{ID: n.ID, Address: n.Address}
+	}
+	return assignment
+}
+
+// pushAssignment sends an assignment to every node. It stops at the
+// first failure, which wraps clients.ErrFenced if a node has seen a
+// newer epoch than the one of this primary.
+func pushAssignment(nodes []Node, assignment partition.Assignment) error {
+	for _, n := range nodes {
+		if err := clients.NewWorkerClient(n.URL()).SetAssignment(assignment); err != nil {
+			return fmt.Errorf("failed to push assignment to %s: %w", n.ID, err)
+		}
+	}
+	return nil
+}
+
+// mergeNodes returns the nodes of both lists, once each
+func mergeNodes(a []Node, b Map) []Node {
+	merged := append([]Node{}, a...)
+	for _, n := range b {
+		if !containsNode(merged, n.ID) {
+			merged = append(merged, n)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,69 @@
+package node
+
+import (
+	"time"
+
+	"keepair/pkg/primary/hints"
+)
+
+// ReplicationMode is how writes reach the replicas of a key
+type ReplicationMode string
+
+// PrimaryBackupMode sends writes to the leader replica,
+// which forwards them to the followers
+var PrimaryBackupMode = ReplicationMode("primary-backup")
+
+// LeaderlessMode sends writes to every replica and waits for a
+// quorum of them, with reads returning the newest version
+var LeaderlessMode = ReplicationMode("leaderless")
+
+type Config struct {
+	// ReplicationFactor is the number of distinct
+	// nodes that each key is stored on
+	ReplicationFactor int
+	Mode              ReplicationMode
+	// LeaseDuration is how long a node stays healthy after a
+	// heartbeat. Workers send one every third of it.
+	LeaseDuration time.Duration
+	// HealthCheckInterval is the time between
+	// checks of the leases of nodes
+	HealthCheckInterval time.Duration
+	// SuspectAfter and DeadAfter are the numbers of consecutive
+	// checks finding a node's lease expired after which it is
+	// suspect, and after which it is dead and removed from the
+	// cluster. With a ReplicationFactor below 2 a dead node holds
+	// the only copy of its keys, so it stays until it comes back
+	// or is removed by hand with DELETE /nodes/:nodeID.
+	SuspectAfter int
+	DeadAfter    int
+	// Hints stores writes for unavailable nodes
+	Hints hints.Config
+	// StateFile is where membership is saved after every change and
+	// reloaded from on startup. It is kept in memory only if empty.
+	StateFile string
+	// TransferBatchSize is the number of entries a worker sends
+	// to another at once when a rebalance moves data
+	TransferBatchSize int
+	// MigrationKeysPerSecond and MigrationBytesPerSecond limit how
+	// fast a worker sends keys to another when a rebalance moves
+	// data, so it leaves room for other traffic. Zero is no limit.
+	MigrationKeysPerSecond  int
+	MigrationBytesPerSecond int64
+	// RegistrationWindow is how long a registration waits for other
+	// nodes to register, so that nodes starting together join with
+	// a single migration. Zero adds every node on its own.
+	RegistrationWindow time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		ReplicationFactor:   1,
+		Mode:                PrimaryBackupMode,
+		LeaseDuration:       time.Second * 10,
+		HealthCheckInterval: time.Second,
+		SuspectAfter:        1,
+		DeadAfter:           3,
+		Hints:               hints.DefaultConfig(),
+		TransferBatchSize:   500,
+	}
+}
@@ -0,0 +1,75 @@
+package node
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"keepair/pkg/log"
+)
+
+// CordonNode stops a node from being given new data, while it keeps
+// serving the keys it holds. Keys are placed by the number of nodes,
+// so any node joining or leaving moves keys onto every member, and
+// such changes are refused until the node is drained or uncordoned.
+// A running migration is waited for, so it has moved no keys onto
+// the node once it is cordoned.
+func (m *Service) CordonNode(ID string) error {
+	m.rebalanceMu.Lock()
+	defer m.rebalanceMu.Unlock()
+	return m.setCordoned(ID, true)
+}
+
+// UncordonNode lets a cordoned node be given new data again
+func (m *Service) UncordonNode(ID string) error {
+	m.rebalanceMu.Lock()
+	defer m.rebalanceMu.Unlock()
+	return m.setCordoned(ID, false)
+}
+
+// DrainNode cordons a node, moves all its keys to the other nodes and
+// unregisters it. A drain that fails leaves the node cordoned, and
+// is resumed with the migration it started.
+func (m *Service) DrainNode(ID string) error {
+	m.rebalanceMu.Lock()
+	defer m.rebalanceMu.Unlock()
+	return m.unregisterNode(ID, true)
+}
+
+func (m *Service) setCordoned(ID string, cordoned bool) error {
+	if !m.IsLeader() {
+		return ErrNotLeader
+	}
+	return m.commitMembership(func(state *membershipState) (bool, error) {
+		nd, ok := state.Nodes[ID]
+		if !ok {
+			return false, fmt.Errorf("%w: %s", ErrNodeNotFound, ID)
+		}
+		if nd.Cordoned == cordoned {
+			return false, nil
+		}
+		log.Get().Printf("node %s cordoned: %t", ID, cordoned)
+		nd.Cordoned = cordoned
+		state.Nodes[ID] = nd
+		return true, nil
+	})
+}
+
+// checkCordoned returns an error if a node other
+// than the excepted ones is cordoned
+func (m *Service) checkCordoned(except ...string) error {
+	m.RLock()
+	defer m.RUnlock()
+
+	cordoned := make([]string, 0)
+	for ID, n := range m.Nodes {
+		if n.Cordoned && !containsID(except, ID) {
+			cordoned = append(cordoned, ID)
+		}
+	}
+	if len(cordoned) == 0 {
+		return nil
+	}
+	sort.Strings(cordoned)
+	return fmt.Errorf("%w: %s, drain or uncordon it first", ErrNodeCordoned, strings.Join(cordoned, ", "))
+}
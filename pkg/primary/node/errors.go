@@ -0,0 +1,15 @@
+package node
+
+import "errors"
+
+var ErrNoNodes = errors.New("no nodes available")
+
+var ErrNodeNotFound = errors.New("failed to find node")
+
+// ErrNodeRemoved is returned for a node that was unregistered,
+// which should not register again
+var ErrNodeRemoved = errors.New("node was removed")
+
+// ErrNodeCordoned is returned for a membership change that
+// would move keys onto a cordoned node
+var ErrNodeCordoned = errors.New("node is cordoned")
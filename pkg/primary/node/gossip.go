@@ -0,0 +1,74 @@
+package node
+
+import (
+	"time"
+
+	"keepair/pkg/gossip"
+)
+
+// gossipVotes counts what the other workers report about a node
+type gossipVotes struct {
+	alive   int
+	suspect int
+	dead    int
+	total   int
+}
+
+// collectVotes counts the gossip views about a node sent in the
+// heartbeats of the other workers that still hold a lease
+func collectVotes(ID string, leases map[string]lease, now time.Time) gossipVotes {
+	votes := gossipVotes{}
+	for reporterID, l := range leases {
+		if reporterID == ID || now.After(l.expiry) {
+			continue
+		}
+		state, ok := l.gossip[ID]
+		if !ok {
+			continue
+		}
+		votes.total++
+		switch state {
+		case gossip.Alive:
+			votes.alive++
+		case gossip.Suspect:
+			votes.suspect++
+		case gossip.Dead:
+			votes.dead++
+		}
+	}
+	return votes
+}
+
+// majority returns the state reported by more than
+// half of the workers, or an empty state if none is
+func (v gossipVotes) majority() gossip.State {
+	switch {
+	case v.alive*2 > v.total:
+		return gossip.Alive
+	case v.suspect*2 > v.total:
+		return gossip.Suspect
+	case v.dead*2 > v.total:
+		return gossip.Dead
+	default:
+		return ""
+	}
+}
+
+// applyGossip adjusts the status of a node whose lease expired with
+// what the other workers see. A node they find dead is dead at once,
+// and a node they can still reach is only cut off from the primary,
+// so it is kept suspect rather than failed over.
+func applyGossip(status Status, leaseExpired bool, votes gossipVotes) Status {
+	if !leaseExpired {
+		return status
+	}
+	switch votes.majority() {
+	case gossip.Dead:
+		return DeadStatus
+	case gossip.Alive:
+		if status == DeadStatus {
+			return SuspectStatus
+		}
+	}
+	return status
+}
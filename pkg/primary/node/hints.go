@@ -0,0 +1,129 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+
+	"keepair/pkg/common"
+	"keepair/pkg/log"
+	"keepair/pkg/primary/clients"
+	"keepair/pkg/primary/hints"
+)
+
+// AddHint stores a write for a node that is unavailable
+func (m *Service) AddHint(hint hints.Hint) error {
+	if err := m.Hints.Add(hint); err != nil {
+		return err
+	}
+	log.Get().Printf("stored hint for %s (%s) on node %s", hint.Key, hint.Action, hint.NodeID)
+	return nil
+}
+
+func (m *Service) Close() error {
+	return m.Hints.Close()
+}
+
+// replayHints sends the pending hints of a node to it in order,
+// stopping at the first failure so the rest are retried later
+func (m *Service) replayHints(nd Node) {
+	pending := m.Hints.Pending(nd.ID)
+	if len(pending) == 0 {
+		return
+	}
+
+	replayed := 0
+	for _, hint := range pending {
+		if err := m.replayHint(nd, hint); err != nil {
+			log.Get().Printf("failed to replay hint for %s to node %s: %s", hint.Key, nd.ID, err)
+			break
+		}
+		replayed++
+	}
+
+	if err := m.Hints.Done(nd.ID, pending[:replayed]); err != nil {
+		log.Get().Printf("failed to remove replayed hints of node %s: %s", nd.ID, err)
+		return
+	}
+	log.Get().Printf("replayed %d of %d hints to node %s", replayed, len(pending), nd.ID)
+}
+
+// replayHint applies a hint with its original timestamp, so it is
+// ignored if the key has been written since. Followers that miss a
+// hint replayed to their leader are given a hint of their own.
+func (m *Service) replayHint(nd Node, hint hints.Hint) error {
+	workerClient := clients.NewWorkerClient(nd.URL())
+
+	// a leader forwards the write to its followers
+	followers := make([]Node, 0)
+	if m.Config.Mode != LeaderlessMode {
+		replicas, err := m.GetReplicasForKey(hint.Key)
+		if err == nil && replicas[0].ID == nd.ID {
+			followers = replicas[1:]
+			followerURLs := make([]string, 0, len(followers))
+			for _, n := range followers {
+				followerURLs = append(followerURLs, n.URL())
+			}
+			workerClient = clients.NewReplicatedWorkerClient(nd.URL(), followerURLs)
+		}
+	}
+
+	var err error
+	switch hint.Action {
+	case common.SetEntry:
+		err = workerClient.SetKeyVersioned(hint.Key, hint.Value, hint.Timestamp)
+	case common.DeleteEntry:
+		err = workerClient.DeleteKeyVersioned(hint.Key, hint.Timestamp)
+	default:
+		return fmt.Errorf("invalid hint action: %s", hint.Action)
+	}
+
+	var replicationErr *clients.ReplicationError
+	if !errors.As(err, &replicationErr) {
+		return err
+	}
+	for _, n := range followers {
+		if !containsID(replicationErr.FollowerURLs, n.URL()) {
+			continue
+		}
+		followerHint := hint
+		followerHint.NodeID = n.ID
+		if err := m.AddHint(followerHint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// redirectHints replays the hints of a dead node to the nodes that
+// took over its keys. Hints that fail are dropped, since the dead
+// node will not come back for them.
+func (m *Service) redirectHints(dead Node) {
+	pending := m.Hints.Pending(dead.ID)
+	if len(pending) == 0 {
+		return
+	}
+
+	for _, hint := range pending {
+		replicas, err := m.GetReplicasForKey(hint.Key)
+		if err != nil {
+			log.Get().Printf("failed to redirect hint for %s: %s", hint.Key, err)
+			continue
+		}
+		// a leader forwards the write to its followers
+		targets := replicas[:1]
+		if m.Config.Mode == LeaderlessMode {
+			targets = replicas
+		}
+		for _, target := range targets {
+			if err := m.replayHint(target, hint); err != nil {
+				log.Get().Printf("failed to redirect hint for %s to node %s: %s", hint.Key, target.ID, err)
+			}
+		}
+	}
+
+	if err := m.Hints.Done(dead.ID, pending); err != nil {
+		log.Get().Printf("failed to remove redirected hints of node %s: %s", dead.ID, err)
+		return
+	}
+	log.Get().Printf("redirected %d hints of dead node %s", len(pending), dead.ID)
+}
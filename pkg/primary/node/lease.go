@@ -0,0 +1,171 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"keepair/pkg/common"
+	"keepair/pkg/gossip"
+	"keepair/pkg/log"
+)
+
+var errLeaseExpired = errors.New("membership lease expired")
+
+// lease is the latest heartbeat of a node. Leases are kept apart
+// from the nodes, so heartbeats are not held up by rebalances.
+type lease struct {
+	expiry        time.Time
+	lastHeartbeat time.Time
+	stats         common.NodeStats
+	// gossip is the node's view of the other nodes
+	gossip map[string]gossip.State
+}
+
+// Heartbeat renews the lease of a node and records
+// its stats and gossip view
+func (m *Service) Heartbeat(ID string, heartbeat common.Heartbeat) (common.Lease, error) {
+	m.leasesMu.Lock()
+	defer m.leasesMu.Unlock()
+
+	l, ok := m.leases[ID]
+	if !ok {
+		if m.removed[ID] {
+			return common.Lease{}, fmt.Errorf("%w: %s", ErrNodeRemoved, ID)
+		}
+		return common.Lease{}, fmt.Errorf("%w: %s", ErrNodeNotFound, ID)
+	}
+	now := time.Now()
+	l.expiry = now.Add(m.Config.LeaseDuration)
+	l.lastHeartbeat = now
+	l.stats = heartbeat.Stats
+	l.gossip = make(map[string]gossip.State, len(heartbeat.Gossip))
+	for _, mb := range heartbeat.Gossip {
+		l.gossip[mb.ID] = mb.State
+	}
+	m.leases[ID] = l
+	return common.Lease{
+		Duration:        m.Config.LeaseDuration,
+		Expiry:          l.expiry,
+		TopologyVersion: m.publishedTopologyVersion.Load(),
+	}, nil
+}
+
+// markRemoved stops a node that was unregistered from
+// being told to register again by its heartbeats
+func (m *Service) markRemoved(ID string) {
+	m.leasesMu.Lock()
+	defer m.leasesMu.Unlock()
+	m.removed[ID] = true
+}
+
+// renewLease extends the lease of a node without new stats
+func (m *Service) renewLease(ID string) {
+	m.leasesMu.Lock()
+	defer m.leasesMu.Unlock()
+	l := m.leases[ID]
+	l.expiry = time.Now().Add(m.Config.LeaseDuration)
+	m.leases[ID] = l
+}
+
+// syncLeases grants leases to new members and drops the leases
+// of removed ones. Caller must hold the lock.
+func (m *Service) syncLeases() {
+	members := make(map[string]bool, len(m.Nodes))
+	for ID := range m.Nodes {
+		members[ID] = true
+	}
+	// a node joining in a migration is not a member yet
+	if m.migration != nil {
+		for _, mb := range m.migration.To {
+			members[mb.ID] = true
+		}
+	}
+
+	m.leasesMu.Lock()
+	defer m.leasesMu.Unlock()
+	for ID := range members {
+		if _, ok := m.leases[ID]; !ok {
+			m.leases[ID] = lease{expiry: time.Now().Add(m.Config.LeaseDuration)}
+		}
+	}
+	for ID := range m.leases {
+		if !members[ID] {
+			delete(m.leases, ID)
+		}
+	}
+}
+
+func (m *Service) getLeases() map[string]lease {
+	m.leasesMu.Lock()
+	defer m.leasesMu.Unlock()
+	leases := make(map[string]lease, len(m.leases))
+	for ID, l := range m.leases {
+		leases[ID] = l
+	}
+	return leases
+}
+
+// checkLeases moves nodes through their statuses, counting every
+// check with an expired lease as a failure, and fails over dead
+// nodes. It returns the nodes that were failed over.
+func (m *Service) checkLeases() []Node {
+	failed := make([]Node, 0)
+	for _, ID := range m.updateStatuses() {
+		if nd, ok := m.failoverNode(ID); ok {
+			failed = append(failed, nd)
+		}
+	}
+	return failed
+}
+
+// updateStatuses updates the statuses of nodes from their
+// leases and returns the IDs of the dead ones
+func (m *Service) updateStatuses() []string {
+	leases := m.getLeases()
+	now := time.Now()
+
+	m.Lock()
+	statuses := make(map[string]Status)
+	for ID, current := range m.Nodes {
+		l := leases[ID]
+		current.LastHealthCheckTime = l.lastHeartbeat
+		current.LastHealthCheckError = nil
+		if now.After(l.expiry) {
+			current.LastHealthCheckError = errLeaseExpired
+		}
+		// the status is set once it is committed
+		committed := current.Status
+		if m.updateStatus(&current, collectVotes(ID, leases, now)) {
+			statuses[ID] = current.Status
+		}
+		current.Status = committed
+		m.Nodes[ID] = current
+	}
+	m.Unlock()
+
+	if len(statuses) > 0 {
+		err := m.commitMembership(func(state *membershipState) (bool, error) {
+			for ID, status := range statuses {
+				if n, ok := state.Nodes[ID]; ok {
+					n.Status = status
+					state.Nodes[ID] = n
+				}
+			}
+			return true, nil
+		})
+		if err != nil {
+			log.Get().Printf("failed to commit node statuses: %s", err)
+		}
+	}
+
+	m.RLock()
+	defer m.RUnlock()
+	dead := make([]string, 0)
+	for ID, n := range m.Nodes {
+		if n.Status == DeadStatus {
+			dead = append(dead, ID)
+		}
+	}
+	return dead
+}
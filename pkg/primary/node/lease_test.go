@@ -0,0 +1,44 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"keepair/pkg/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLeases checks that a node without heartbeats becomes suspect
+// once its lease expires, and healthy again after a heartbeat
+func TestLeases(t *testing.T) {
+	config := DefaultConfig()
+	config.LeaseDuration = time.Millisecond * 50
+	service, err := NewServiceWithConfig(config)
+	assert.NoError(t, err)
+	m := service.(*Service)
+
+	assert.NoError(t, commitNodes(m, Map{}.Add(NewNode("a", "127.0.0.1", "8001"))))
+
+	lease, err := m.Heartbeat("a", common.Heartbeat{Stats: common.NodeStats{ObjectCount: 3}})
+	assert.NoError(t, err)
+	assert.Equal(t, config.LeaseDuration, lease.Duration)
+	assert.Empty(t, m.checkLeases())
+	assert.Equal(t, HealthyStatus, m.GetNodes()[0].Status)
+	assert.Equal(t, 3, m.GetNodes()[0].Stats.ObjectCount)
+
+	time.Sleep(config.LeaseDuration * 2)
+	assert.Empty(t, m.checkLeases())
+	assert.Equal(t, SuspectStatus, m.GetNodes()[0].Status)
+
+	_, err = m.Heartbeat("a", common.Heartbeat{})
+	assert.NoError(t, err)
+	m.checkLeases()
+	assert.Equal(t, HealthyStatus, m.GetNodes()[0].Status)
+
+	_, err = m.Heartbeat("b", common.Heartbeat{})
+	assert.ErrorIs(t, err, ErrNodeNotFound)
+	m.markRemoved("b")
+	_, err = m.Heartbeat("b", common.Heartbeat{})
+	assert.ErrorIs(t, err, ErrNodeRemoved)
+}
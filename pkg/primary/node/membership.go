@@ -0,0 +1,147 @@
+package node
+
+import (
+	"fmt"
+	"time"
+
+	"keepair/pkg/log"
+)
+
+// ChangeNodes adds and removes several nodes at once
+var ChangeNodes = RebalanceOperation("change")
+
+// registrationBatch is the nodes registering within a
+// registration window, which join with a single migration
+type registrationBatch struct {
+	nodes []Node
+	done  chan struct{}
+	err   error
+}
+
+// ChangeMembership adds and removes nodes with a single migration,
+// moving data once from the current membership to the final one
+// instead of once for every node
+func (m *Service) ChangeMembership(change MembershipChange) error {
+	m.rebalanceMu.Lock()
+	defer m.rebalanceMu.Unlock()
+
+	if err := m.resumeMigration(); err != nil {
+		return fmt.Errorf("failed to resume migration: %w", err)
+	}
+
+	m.RLock()
+	isLeader := m.IsLeader()
+	_, err := applyChange(m.Nodes, change)
+	m.RUnlock()
+
+	if !isLeader {
+		return ErrNotLeader
+	}
+	if err != nil {
+		return err
+	}
+	if len(change.Add)+len(change.Remove) == 0 {
+		return nil
+	}
+	if err := m.checkCordoned(change.Remove...); err != nil {
+		return err
+	}
+
+	m.leasesMu.Lock()
+	for _, n := range change.Add {
+		delete(m.removed, n.ID)
+	}
+	m.leasesMu.Unlock()
+	for _, ID := range change.Remove {
+		m.markRemoved(ID)
+	}
+	if err := m.rebalanceNodes(changeOperation(change), change); err != nil {
+		return fmt.Errorf("failed to rebalance nodes: %w", err)
+	}
+	return nil
+}
+
+// changeOperation names the migration of a change
+// after the node joining or leaving, if only one does
+func changeOperation(change MembershipChange) RebalanceOperation {
+	switch {
+	case len(change.Add) == 1 && len(change.Remove) == 0:
+		return AddNode
+	case len(change.Add) == 0 && len(change.Remove) == 1:
+		return DeleteNode
+	}
+	return ChangeNodes
+}
+
+// registerInBatch waits for the registration window so the nodes
+// registering within it join together. The first registration of a
+// batch waits for the window and for the migration in progress, and
+// registers every node of the batch by then.
+func (m *Service) registerInBatch(nd Node) error {
+	m.registrationsMu.Lock()
+	batch := m.registrations
+	first := batch == nil
+	if first {
+		batch = &registrationBatch{done: make(chan struct{})}
+		m.registrations = batch
+	}
+	batch.nodes = append(batch.nodes, nd)
+	m.registrationsMu.Unlock()
+
+	if first {
+		time.Sleep(m.Config.RegistrationWindow)
+
+		m.rebalanceMu.Lock()
+		m.registrationsMu.Lock()
+		m.registrations = nil
+		m.registrationsMu.Unlock()
+		batch.err = m.registerNodes(batch.nodes)
+		m.rebalanceMu.Unlock()
+		close(batch.done)
+	}
+
+	<-batch.done
+	return batch.err
+}
+
+// registerNodes takes the registrations of nodes, adding the
+// ones that are not members with a single migration.
+// Caller must hold rebalanceMu.
+func (m *Service) registerNodes(nodes []Node) error {
+	if err := m.resumeMigration(); err != nil {
+		return fmt.Errorf("failed to resume migration: %w", err)
+	}
+
+	change := MembershipChange{}
+	for _, nd := range nodes {
+		known, err := m.registerKnownNode(nd)
+		if err != nil {
+			return err
+		}
+		if known {
+			continue
+		}
+		m.RLock()
+		_, member := m.Nodes[nd.ID]
+		m.RUnlock()
+		if member || containsNode(change.Add, nd.ID) {
+			log.Get().Printf("node %s registered again from %s, keeping it as it is", nd.ID, nd.Address)
+			continue
+		}
+		change.Add = append(change.Add, nd)
+	}
+	if len(change.Add) == 0 {
+		return nil
+	}
+	if err := m.checkCordoned(); err != nil {
+		return err
+	}
+
+	if len(change.Add) > 1 {
+		log.Get().Printf("registering %d nodes with a single migration", len(change.Add))
+	}
+	if err := m.rebalanceNodes(changeOperation(change), change); err != nil {
+		return fmt.Errorf("failed to rebalance nodes: %w", err)
+	}
+	return nil
+}
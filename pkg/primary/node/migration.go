@@ -0,0 +1,671 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"keepair/pkg/common"
+	"keepair/pkg/log"
+	"keepair/pkg/partition"
+	"keepair/pkg/primary/clients"
+
+	"github.com/google/uuid"
+)
+
+// ErrNoMigration is returned when there is no migration to resume
+// or roll back
+var ErrNoMigration = errors.New("no migration in progress")
+
+// ErrMigrationCanceled is returned when a migration was canceled,
+// until it is resumed or rolled back
+var ErrMigrationCanceled = errors.New("migration canceled")
+
+// ErrMigrationNotRunning is returned when canceling
+// a migration that is not running
+var ErrMigrationNotRunning = errors.New("migration not running")
+
+// RollbackOperation moves data back to the membership
+// a migration started from
+var RollbackOperation = RebalanceOperation("rollback")
+
+// StepKind is what a step of a migration does
+type StepKind string
+
+// AssignStep tells the nodes about the migration, so they redirect
+// requests for the keys that move
+var AssignStep = StepKind("assign")
+
+// CopyStep copies the keys of a node to their owners in the new
+// membership that miss them
+var CopyStep = StepKind("copy")
+
+// DropStep deletes the keys a node no longer owns
+var DropStep = StepKind("drop")
+
+// CommitStep makes the new membership current
+var CommitStep = StepKind("commit")
+
+// MigrationStep is a step of a migration. Copies and drops act on
+// the keys of a single node.
+type MigrationStep struct {
+	Kind   StepKind `json:"kind"`
+	NodeID string   `json:"nodeId,omitempty"`
+	Done   bool     `json:"done"`
+	// Transfers are what a copy or drop step moved once done
+	Transfers []partition.Transfer `json:"transfers,omitempty"`
+}
+
+// MigrationPlan is a rebalance moving data from one membership to
+// another. It is saved with the membership after every step, and
+// every step can be run again, so a migration that failed or was
+// interrupted by a restart can be resumed or rolled back.
+type MigrationPlan struct {
+	ID        string             `json:"id"`
+	Operation RebalanceOperation `json:"operation"`
+	// NodeID is the node joining or leaving,
+	// when a single one does
+	NodeID string `json:"nodeId"`
+	// Added and Removed are the IDs of the nodes joining and leaving
+	Added     []string `json:"added,omitempty"`
+	Removed   []string `json:"removed,omitempty"`
+	From      []member `json:"from"`
+	FromEpoch uint64   `json:"fromEpoch"`
+	To        []member `json:"to"`
+	ToEpoch   uint64   `json:"toEpoch"`
+	// Sources are the nodes holding data before the migration
+	Sources []member        `json:"sources"`
+	Steps   []MigrationStep `json:"steps"`
+	// Moves are the keys and bytes the copy and drop steps are
+	// expected to move, counted before the first of them runs
+	Moves []partition.Move `json:"moves,omitempty"`
+	// Error is why the last run of the migration stopped
+	Error string `json:"error,omitempty"`
+	// Canceled migrations are only resumed when asked to
+	Canceled bool `json:"canceled,omitempty"`
+}
+
+// migrationRun is a migration being run, which can be canceled
+// between its steps, and between the batches of a copy step
+type migrationRun struct {
+	plan *MigrationPlan
+	// step is the index of the step running
+	step      int
+	canceling bool
+	// canceled is closed when the run is canceled
+	canceled chan struct{}
+	done     chan struct{}
+}
+
+// newMigrationPlan computes the membership after nodes join and leave,
+// and the steps to move data to it. Caller must hold the lock.
+func (m *Service) newMigrationPlan(operation RebalanceOperation, change MembershipChange) (*MigrationPlan, error) {
+
+	nodes, err := applyChange(m.Nodes, change)
+	if err != nil {
+		return nil, err
+	}
+
+	// all nodes that hold data before the rebalance, including
+	// nodes that are being deleted, but not failed nodes
+	sources := make(Map)
+	for _, n := range m.Nodes {
+		if operation == FailNode && containsID(change.Remove, n.ID) {
+			continue
+		}
+		sources[n.ID] = n
+	}
+	// nodes added after the primary forgot them may still hold data.
+	// They are ordered after the others, with indexes none of them
+	// use, as failed nodes leave gaps.
+	nextIndex := 0
+	for _, n := range sources {
+		if n.Index >= nextIndex {
+			nextIndex = n.Index + 1
+		}
+	}
+	added := make([]string, 0, len(change.Add))
+	for _, n := range change.Add {
+		n.Index = nextIndex
+		nextIndex++
+		sources[n.ID] = n
+		added = append(added, n.ID)
+	}
+
+	plan := &MigrationPlan{
+		ID:        uuid.NewString(),
+		Operation: operation,
+		Added:     added,
+		Removed:   append([]string{}, change.Remove...),
+		From:      toMembers(m.Nodes),
+		FromEpoch: m.epoch,
+		To:        toMembers(nodes),
+		ToEpoch:   m.epoch + 1,
+		Sources:   toMembers(sources),
+	}
+	switch {
+	case len(plan.Added) == 1 && len(plan.Removed) == 0:
+		plan.NodeID = plan.Added[0]
+	case len(plan.Added) == 0 && len(plan.Removed) == 1:
+		plan.NodeID = plan.Removed[0]
+	}
+	plan.Steps = planSteps(plan.Sources)
+	return plan, nil
+}
+
+// planSteps assigns, copies the keys of every source before
+// dropping any, so keys can always be read from their old or
+// new owners, and commits
+func planSteps(sources []member) []MigrationStep {
+	steps := []MigrationStep{{Kind: AssignStep}}
+	for _, n := range sources {
+		steps = append(steps, MigrationStep{Kind: CopyStep, NodeID: n.ID})
+	}
+	for _, n := range sources {
+		steps = append(steps, MigrationStep{Kind: DropStep, NodeID: n.ID})
+	}
+	return append(steps, MigrationStep{Kind: CommitStep})
+}
+
+// reversed returns the plan moving data back to the membership the
+// plan started from, at a newer epoch. If no data was moved yet, it
+// commits the old membership right away, then drops what writes
+// copied to the nodes that stay members while they were told about
+// the migration. Those drops are not resumed if they fail, which
+// leaves keys for the placement check to repair.
+func (p *MigrationPlan) reversed() *MigrationPlan {
+	moved := false
+	for _, step := range p.Steps {
+		if step.Done && (step.Kind == CopyStep || step.Kind == DropStep) {
+			moved = true
+		}
+	}
+
+	rollback := &MigrationPlan{
+		ID:        uuid.NewString(),
+		Operation: RollbackOperation,
+		NodeID:    p.NodeID,
+		Added:     p.Removed,
+		Removed:   p.Added,
+		From:      p.To,
+		FromEpoch: p.ToEpoch,
+		To:        p.From,
+		ToEpoch:   p.ToEpoch + 1,
+		Sources:   mergeMembers(p.Sources, p.To),
+	}
+	if moved {
+		rollback.Steps = planSteps(rollback.Sources)
+		return rollback
+	}
+	rollback.Steps = []MigrationStep{{Kind: CommitStep}}
+	for _, n := range p.To {
+		if containsMember(p.From, n.ID) {
+			rollback.Steps = append(rollback.Steps, MigrationStep{Kind: DropStep, NodeID: n.ID})
+		}
+	}
+	return rollback
+}
+
+// startMigration commits a plan before running it, so it can be
+// resumed after a restart or by another primary elected leader.
+// Caller must not hold the lock.
+func (m *Service) startMigration(plan *MigrationPlan) error {
+	return m.commitMembership(func(state *membershipState) (bool, error) {
+		state.Migration = plan
+		return true, nil
+	})
+}
+
+// saveMigration commits the progress of a plan, unless it is no
+// longer the migration in progress. Caller must not hold the lock.
+func (m *Service) saveMigration(plan *MigrationPlan) {
+	err := m.commitMembership(func(state *membershipState) (bool, error) {
+		return state.Migration == plan, nil
+	})
+	if err != nil {
+		log.Get().Printf("failed to save migration %s: %s", plan.ID, err)
+	}
+}
+
+// runMigration runs the steps of a plan that are not done, saving
+// its progress after each one. If a step fails, the plan is kept
+// with its error and the membership is left as it was.
+// Caller must hold rebalanceMu.
+func (m *Service) runMigration(plan *MigrationPlan) error {
+
+	log.BigPrintf("[%s] MIGRATION %s (%s) STARTED...", "primary", plan.ID, plan.Operation)
+
+	run := &migrationRun{plan: plan, canceled: make(chan struct{}), done: make(chan struct{})}
+	m.Lock()
+	m.running = run
+	m.Unlock()
+	defer func() {
+		m.Lock()
+		m.running = nil
+		m.Unlock()
+		close(run.done)
+	}()
+
+	for i, step := range plan.Steps {
+		if step.Done {
+			continue
+		}
+		m.Lock()
+		run.step = i
+		// steps are done or not run at all, so the migration stops at
+		// a point it can be resumed or rolled back from. Once committed,
+		// it is no longer the migration in progress and is not canceled.
+		if run.canceling && m.migration == plan {
+			plan.Canceled = true
+			plan.Error = ErrMigrationCanceled.Error()
+			m.Unlock()
+			m.saveMigration(plan)
+			log.BigPrintf("[%s] MIGRATION %s CANCELED BEFORE %s %s", "primary", plan.ID, step.Kind, step.NodeID)
+			return fmt.Errorf("%w before %s step", ErrMigrationCanceled, step.Kind)
+		}
+		m.Unlock()
+
+		var err error
+		if (step.Kind == CopyStep || step.Kind == DropStep) && plan.Moves == nil {
+			err = m.countMoves(plan)
+		}
+		var transfers []partition.Transfer
+		if err == nil {
+			stepDone := make(chan struct{})
+			if step.Kind == CopyStep {
+				go stopCopyOnCancel(run, plan.source(step.NodeID), plan.ID, stepDone)
+			}
+			transfers, err = m.runStep(plan, step)
+			close(stepDone)
+		}
+
+		m.Lock()
+		canceled := err != nil && run.canceling && m.migration == plan
+		if canceled {
+			// the copy stopped at a batch, and is run again on resume
+			plan.Canceled = true
+			plan.Error = ErrMigrationCanceled.Error()
+		} else if err != nil {
+			plan.Error = err.Error()
+		} else {
+			plan.Steps[i].Done = true
+			plan.Steps[i].Transfers = transfers
+			plan.Error = ""
+		}
+		m.Unlock()
+		// the commit step has already saved the new membership
+		m.saveMigration(plan)
+
+		if canceled {
+			log.BigPrintf("[%s] MIGRATION %s CANCELED DURING %s %s", "primary", plan.ID, step.Kind, step.NodeID)
+			return fmt.Errorf("%w during %s step", ErrMigrationCanceled, step.Kind)
+		}
+		if err != nil {
+			log.BigPrintf("[%s] MIGRATION %s STOPPED AT %s %s: %s", "primary", plan.ID, step.Kind, step.NodeID, err)
+			return fmt.Errorf("migration failed at %s step: %w", step.Kind, err)
+		}
+	}
+
+	log.BigPrintf("[%s] MIGRATION %s DONE", "primary", plan.ID)
+	return nil
+}
+
+// stopCopyOnCancel tells the source of a copy step to stop the copy
+// if the migration is canceled while it runs, retrying until the
+// source has started the copy or the step is done
+func stopCopyOnCancel(run *migrationRun, source Node, ID string, stepDone <-chan struct{}) {
+	select {
+	case <-run.canceled:
+	case <-stepDone:
+		return
+	}
+	client := clients.NewWorkerClient(source.URL())
+	for {
+		ok, err := client.CancelTransfer(ID)
+		if err != nil {
+			log.Get().Printf("failed to cancel transfer on %s: %s", source.ID, err)
+		}
+		if ok {
+			return
+		}
+		select {
+		case <-stepDone:
+			return
+		case <-time.After(time.Millisecond * 100):
+		}
+	}
+}
+
+func (m *Service) runStep(plan *MigrationPlan, step MigrationStep) ([]partition.Transfer, error) {
+	switch step.Kind {
+	case AssignStep:
+		return nil, m.assign(plan)
+	case CopyStep:
+		return m.copyKeys(plan, step.NodeID)
+	case DropStep:
+		tr, err := m.dropKeys(plan, step.NodeID)
+		if err != nil {
+			return nil, err
+		}
+		return []partition.Transfer{tr}, nil
+	case CommitStep:
+		return nil, m.commitMigration(plan)
+	default:
+		return nil, fmt.Errorf("invalid step kind: %s", step.Kind)
+	}
+}
+
+// assign pushes the current assignment with the next one to every
+// node of the migration. A node that has seen a newer epoch refuses
+// it, which fences off this primary.
+func (m *Service) assign(plan *MigrationPlan) error {
+	return pushAssignment(plan.assigned(), m.transferRequest(plan).Assignment)
+}
+
+// transferRequest is what the source nodes are asked to move. Nodes
+// that hold keys but are not sources, such as a failed node, are
+// skipped, so the next holder of their keys copies them instead.
+func (m *Service) transferRequest(plan *MigrationPlan) partition.TransferRequest {
+	current := newAssignment(plan.FromEpoch, fromMembers(plan.From), m.Config.ReplicationFactor)
+	next := newAssignment(plan.ToEpoch, fromMembers(plan.To), m.Config.ReplicationFactor)
+	current.Next = &next
+
+	skip := make([]string, 0)
+	for _, mb := range plan.From {
+		if !containsMember(plan.Sources, mb.ID) {
+			skip = append(skip, mb.ID)
+		}
+	}
+	return partition.TransferRequest{
+		ID:                plan.ID,
+		Assignment:        current,
+		Skip:              skip,
+		BatchSize:         m.Config.TransferBatchSize,
+		MaxKeysPerSecond:  m.Config.MigrationKeysPerSecond,
+		MaxBytesPerSecond: m.Config.MigrationBytesPerSecond,
+	}
+}
+
+// countMoves asks the nodes that copy or drop keys what they
+// will move, to follow the progress of a migration
+func (m *Service) countMoves(plan *MigrationPlan) error {
+	req := m.transferRequest(plan)
+	moves := make([]partition.Move, 0)
+	counted := make(map[string]bool)
+	for _, step := range plan.Steps {
+		if (step.Kind != CopyStep && step.Kind != DropStep) || counted[step.NodeID] {
+			continue
+		}
+		counted[step.NodeID] = true
+		n := plan.source(step.NodeID)
+		nodeMoves, err := clients.NewWorkerClient(n.URL()).CountMoves(req)
+		if err != nil {
+			return fmt.Errorf("failed to count moves on %s: %w", n.ID, err)
+		}
+		moves = append(moves, nodeMoves...)
+	}
+	partition.SortMoves(moves)
+
+	m.Lock()
+	plan.Moves = moves
+	m.Unlock()
+	return nil
+}
+
+// copyKeys has a source node send its keys straight to the nodes that
+// own them in the new membership and miss them, then applies them
+func (m *Service) copyKeys(plan *MigrationPlan, sourceID string) ([]partition.Transfer, error) {
+	sourceNode := plan.source(sourceID)
+	transfers, err := clients.NewWorkerClient(sourceNode.URL()).TransferKeys(m.transferRequest(plan))
+	if err != nil {
+		return nil, err
+	}
+	for _, tr := range transfers {
+		log.Get().Printf("[%s] migration %s copied %d keys (%d bytes) from %s to %s in %s (%.0f bytes/s)",
+			"primary", plan.ID, tr.Keys, tr.Bytes, tr.Source, tr.Target, tr.Duration, tr.BytesPerSecond)
+	}
+
+	// apply the copies of the migration on all nodes
+	for _, n := range fromMembers(plan.To) {
+		if err := clients.NewWorkerClient(n.URL()).ApplyOperations(plan.ID, false); err != nil {
+			return nil, err
+		}
+	}
+	return transfers, nil
+}
+
+// dropKeys has a source node delete the keys it does not own in the
+// new membership, which is all of them for a node that is deleted
+func (m *Service) dropKeys(plan *MigrationPlan, sourceID string) (partition.Transfer, error) {
+	sourceNode := plan.source(sourceID)
+	tr, err := clients.NewWorkerClient(sourceNode.URL()).DropKeys(m.transferRequest(plan))
+	if err != nil {
+		return partition.Transfer{}, err
+	}
+	log.Get().Printf("[%s] migration %s dropped %d keys (%d bytes) from %s in %s",
+		"primary", plan.ID, tr.Keys, tr.Bytes, tr.Source, tr.Duration)
+	return tr, nil
+}
+
+// commitMigration makes the new membership current, keeping what
+// health checks found out about the nodes during the migration, and
+// discards the queues of the migration, whose batches are not sent
+// again once it is committed
+func (m *Service) commitMigration(plan *MigrationPlan) error {
+	err := m.commitMembership(func(state *membershipState) (bool, error) {
+		nodes := make(Map, len(plan.To))
+		for ID, n := range fromMembers(plan.To) {
+			if current, ok := state.Nodes[ID]; ok {
+				current.Index = n.Index
+				n = current
+			}
+			nodes[ID] = n
+		}
+		state.Nodes = nodes
+		state.Epoch = plan.ToEpoch
+		state.Migration = nil
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to commit membership: %w", err)
+	}
+
+	next := newAssignment(plan.ToEpoch, fromMembers(plan.To), m.Config.ReplicationFactor)
+	if err := pushAssignment(plan.assigned(), next); err != nil {
+		log.Get().Printf("failed to push assignment: %s", err)
+	}
+	discardQueues(plan)
+	return nil
+}
+
+// resumeMigration runs the rest of a migration that failed or was
+// interrupted, before the membership can change again. A canceled
+// migration is left for an operator to resume.
+// Caller must hold rebalanceMu.
+func (m *Service) resumeMigration() error {
+	m.RLock()
+	isLeader, plan := m.IsLeader(), m.migration
+	canceled := plan != nil && plan.Canceled
+	m.RUnlock()
+	if plan == nil {
+		return nil
+	}
+	if !isLeader {
+		return ErrNotLeader
+	}
+	if canceled {
+		return fmt.Errorf("%w: resume or roll back migration %s", ErrMigrationCanceled, plan.ID)
+	}
+	log.Get().Printf("resuming migration %s (%s %s)", plan.ID, plan.Operation, plan.NodeID)
+	return m.runMigration(plan)
+}
+
+// ResumeMigration runs the rest of a migration that failed
+func (m *Service) ResumeMigration() error {
+	m.rebalanceMu.Lock()
+	defer m.rebalanceMu.Unlock()
+
+	m.Lock()
+	plan := m.migration
+	if plan != nil {
+		plan.Canceled = false
+	}
+	m.Unlock()
+	if plan == nil {
+		return ErrNoMigration
+	}
+	return m.resumeMigration()
+}
+
+// CancelMigration stops the migration running before its next step,
+// or the copy step running before its next batch, and waits for it.
+// It is kept to be resumed or rolled back.
+func (m *Service) CancelMigration() error {
+	m.Lock()
+	if !m.IsLeader() {
+		m.Unlock()
+		return ErrNotLeader
+	}
+	if m.migration == nil {
+		m.Unlock()
+		return ErrNoMigration
+	}
+	run := m.running
+	if run == nil || run.plan != m.migration {
+		m.Unlock()
+		return ErrMigrationNotRunning
+	}
+	if !run.canceling {
+		run.canceling = true
+		close(run.canceled)
+	}
+	m.Unlock()
+
+	<-run.done
+	return nil
+}
+
+// RollbackMigration replaces a migration that failed with one moving
+// data back to the membership it started from, and runs it
+func (m *Service) RollbackMigration() error {
+	m.rebalanceMu.Lock()
+	defer m.rebalanceMu.Unlock()
+
+	m.Lock()
+	if !m.IsLeader() {
+		m.Unlock()
+		return ErrNotLeader
+	}
+	if m.migration == nil {
+		m.Unlock()
+		return ErrNoMigration
+	}
+	failed := m.migration
+	plan := failed.reversed()
+	m.Unlock()
+
+	log.Get().Printf("rolling back migration %s with %s", failed.ID, plan.ID)
+	if err := m.startMigration(plan); err != nil {
+		return fmt.Errorf("failed to save migration: %w", err)
+	}
+
+	discardQueues(failed)
+	return m.runMigration(plan)
+}
+
+// discardQueues drops the queues of a migration on its nodes, so
+// copies that were not applied are not applied later
+func discardQueues(plan *MigrationPlan) {
+	for _, n := range fromMembers(plan.To) {
+		if _, err := clients.NewWorkerClient(n.URL()).DiscardOperationQueue(plan.ID); err != nil {
+			log.Get().Printf("failed to discard queue of migration %s on %s: %s", plan.ID, n.ID, err)
+		}
+	}
+}
+
+// GetMigration returns a copy of the migration in progress, or nil
+func (m *Service) GetMigration() *MigrationPlan {
+	m.RLock()
+	defer m.RUnlock()
+	if m.migration == nil {
+		return nil
+	}
+	plan := *m.migration
+	plan.Steps = append([]MigrationStep{}, plan.Steps...)
+	plan.Moves = append([]partition.Move(nil), plan.Moves...)
+	return &plan
+}
+
+// source returns the source node with an ID
+func (p *MigrationPlan) source(ID string) Node {
+	return fromMembers(p.Sources)[ID]
+}
+
+// assigned returns the nodes the assignments of
+// the migration are pushed to
+func (p *MigrationPlan) assigned() []Node {
+	return mergeNodes(fromMembers(p.Sources).sorted(), fromMembers(p.To))
+}
+
+// streamEntries calls fn with every entry of a node
+func streamEntries(n Node, fn func(entry common.Entry) error) error {
+	entryChan, errChan := clients.NewWorkerClient(n.URL()).StreamEntries()
+	for {
+		select {
+		case err := <-errChan:
+			return err
+		case entry := <-entryChan:
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// toMembers returns the members of nodes sorted by index
+func toMembers(nodes Map) []member {
+	members := make([]member, 0, len(nodes))
+	for _, n := range nodes.sorted() {
+		members = append(members, newMember(n))
+	}
+	return members
+}
+
+func fromMembers(members []member) Map {
+	nodes := make(Map, len(members))
+	for _, mb := range members {
+		nodes[mb.ID] = Node{ID: mb.ID, Address: mb.Address, Index: mb.Index, Status: mb.Status, Cordoned: mb.Cordoned}
+	}
+	return nodes
+}
+
+// mergeMembers returns the members of both lists, once each
+func mergeMembers(a, b []member) []member {
+	merged := append([]member{}, a...)
+	for _, mb := range b {
+		if !containsMember(merged, mb.ID) {
+			merged = append(merged, mb)
+		}
+	}
+	return merged
+}
+
+func containsMember(members []member, ID string) bool {
+	for _, mb := range members {
+		if mb.ID == ID {
+			return true
+		}
+	}
+	return false
+}
+
+// sorted returns the nodes ordered by index
+func (m Map) sorted() []Node {
+	nodes := make([]Node, 0, len(m))
+	for _, n := range m {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Index < nodes[j].Index })
+	return nodes
+}
@@ -0,0 +1,150 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// commitNodes sets the membership of a service
+func commitNodes(m *Service, nodes Map) error {
+	return m.commitMembership(func(state *membershipState) (bool, error) {
+		state.Nodes = nodes
+		return true, nil
+	})
+}
+
+// TestMigrationPlan checks the steps of a plan deleting a node, and
+// of the plans rolling it back before and after data was moved
+func TestMigrationPlan(t *testing.T) {
+	service, err := NewServiceWithConfig(DefaultConfig())
+	assert.NoError(t, err)
+	m := service.(*Service)
+
+	nodes := Map{}.Add(NewNode("a", "127.0.0.1", "8001")).Add(NewNode("b", "127.0.0.1", "8002"))
+	assert.NoError(t, commitNodes(m, nodes))
+	m.Lock()
+	m.epoch = 4
+	plan, err := m.newMigrationPlan(DeleteNode, MembershipChange{Remove: []string{"b"}})
+	m.Unlock()
+	assert.NoError(t, err)
+
+	IDs := func(members []member) []string {
+		IDs := make([]string, 0)
+		for _, mb := range members {
+			IDs = append(IDs, mb.ID)
+		}
+		return IDs
+	}
+	assert.Equal(t, []string{"a", "b"}, IDs(plan.From))
+	assert.Equal(t, []string{"a"}, IDs(plan.To))
+	assert.Equal(t, []string{"a", "b"}, IDs(plan.Sources))
+	assert.Equal(t, uint64(4), plan.FromEpoch)
+	assert.Equal(t, uint64(5), plan.ToEpoch)
+	// every source is copied before any is dropped
+	assert.Equal(t, []MigrationStep{
+		{Kind: AssignStep},
+		{Kind: CopyStep, NodeID: "a"},
+		{Kind: CopyStep, NodeID: "b"},
+		{Kind: DropStep, NodeID: "a"},
+		{Kind: DropStep, NodeID: "b"},
+		{Kind: CommitStep},
+	}, plan.Steps)
+
+	// nothing was moved, so the old membership is committed
+	// and what writes copied to a is dropped
+	plan.Steps[0].Done = true
+	rollback := plan.reversed()
+	assert.Equal(t, RollbackOperation, rollback.Operation)
+	assert.Equal(t, []string{"a"}, IDs(rollback.From))
+	assert.Equal(t, []string{"a", "b"}, IDs(rollback.To))
+	assert.Equal(t, uint64(5), rollback.FromEpoch)
+	assert.Equal(t, uint64(6), rollback.ToEpoch)
+	assert.Equal(t, []MigrationStep{
+		{Kind: CommitStep},
+		{Kind: DropStep, NodeID: "a"},
+	}, rollback.Steps)
+
+	// once data was moved, it is moved back
+	plan.Steps[1].Done = true
+	rollback = plan.reversed()
+	assert.Equal(t, []MigrationStep{
+		{Kind: AssignStep},
+		{Kind: CopyStep, NodeID: "a"},
+		{Kind: CopyStep, NodeID: "b"},
+		{Kind: DropStep, NodeID: "a"},
+		{Kind: DropStep, NodeID: "b"},
+		{Kind: CommitStep},
+	}, rollback.Steps)
+	assert.NotEqual(t, plan.ID, rollback.ID)
+}
+
+// TestMigrationPlanSourceIndexes checks that nodes added while
+// another fails over do not take the index of a source
+func TestMigrationPlanSourceIndexes(t *testing.T) {
+	service, err := NewServiceWithConfig(DefaultConfig())
+	assert.NoError(t, err)
+	m := service.(*Service)
+
+	nodes := Map{}.
+		Add(NewNode("a", "127.0.0.1", "8001")).
+		Add(NewNode("b", "127.0.0.1", "8002")).
+		Add(NewNode("c", "127.0.0.1", "8003"))
+	assert.NoError(t, commitNodes(m, nodes))
+	m.Lock()
+	plan, err := m.newMigrationPlan(FailNode, MembershipChange{
+		Add:    []Node{NewNode("d", "127.0.0.1", "8004")},
+		Remove: []string{"b"},
+	})
+	m.Unlock()
+	assert.NoError(t, err)
+
+	indexes := map[string]int{}
+	for _, mb := range plan.Sources {
+		indexes[mb.ID] = mb.Index
+	}
+	assert.Equal(t, map[string]int{"a": 0, "c": 2, "d": 3}, indexes)
+}
+
+// TestReplicatedMigration checks that the migration in progress is
+// replicated with the membership, so another primary can resume it
+func TestReplicatedMigration(t *testing.T) {
+	service, err := NewServiceWithConfig(DefaultConfig())
+	assert.NoError(t, err)
+	leader := service.(*Service)
+	service, err = NewServiceWithConfig(DefaultConfig())
+	assert.NoError(t, err)
+	follower := service.(*Service)
+
+	nodes := Map{}.Add(NewNode("a", "127.0.0.1", "8001")).Add(NewNode("b", "127.0.0.1", "8002"))
+	assert.NoError(t, commitNodes(leader, nodes))
+	leader.Lock()
+	plan, err := leader.newMigrationPlan(DeleteNode, MembershipChange{Remove: []string{"b"}})
+	leader.Unlock()
+	assert.NoError(t, err)
+	assert.NoError(t, leader.startMigration(plan))
+	assert.Same(t, plan, leader.migration)
+
+	plan.Steps[0].Done = true
+	leader.saveMigration(plan)
+	data, err := leader.Snapshot()
+	assert.NoError(t, err)
+	assert.NoError(t, follower.Restore(2, data))
+	replicated := follower.GetMigration()
+	if assert.NotNil(t, replicated) {
+		assert.Equal(t, plan.ID, replicated.ID)
+		assert.True(t, replicated.Steps[0].Done)
+	}
+	assert.Len(t, follower.GetNodes(), 2)
+
+	// the commit clears it, and older entries are not applied again
+	assert.NoError(t, leader.commitMigration(plan))
+	assert.Nil(t, leader.GetMigration())
+	data, err = leader.Snapshot()
+	assert.NoError(t, err)
+	follower.Apply(3, data)
+	assert.Nil(t, follower.GetMigration())
+	assert.Len(t, follower.GetNodes(), 1)
+	follower.Apply(2, data)
+	assert.Equal(t, uint64(3), follower.membershipIndex)
+}
@@ -2,11 +2,10 @@ package node
 
 import (
 	"fmt"
-	"net/http"
 	"time"
 
 	"keepair/pkg/common"
-	"keepair/pkg/log"
+	"keepair/pkg/gossip"
 	"keepair/pkg/primary/clients"
 )
 
@@ -17,6 +16,31 @@ type Node struct {
 	LastHealthCheckTime  time.Time        `json:"lastHealthCheckTime"`
 	LastHealthCheckError error            `json:"lastHealthCheckError"`
 	Stats                common.NodeStats `json:"stats"`
+	Status               Status           `json:"status"`
+	// Cordoned nodes are given no new data until they are
+	// drained or uncordoned
+	Cordoned bool `json:"cordoned"`
+	// LeaseExpiry is when the node becomes unavailable
+	// unless it sends another heartbeat
+	LeaseExpiry time.Time `json:"leaseExpiry"`
+	// GossipState is what most other workers see of the node
+	GossipState gossip.State `json:"gossipState,omitempty"`
+	// ConsecutiveFailures is the number of health
+	// checks failed in a row
+	ConsecutiveFailures int `json:"consecutiveFailures"`
+	// LeaderOf and FollowerOf are the partitions the node holds
+	// leader and follower replicas of
+	LeaderOf   []int `json:"leaderOf"`
+	FollowerOf []int `json:"followerOf"`
+	// ReadRepairs is the number of stale values
+	// on the node fixed by read repair
+	ReadRepairs int `json:"readRepairs"`
+	// PendingHints is the number of writes waiting
+	// to be replayed to the node
+	PendingHints int `json:"pendingHints"`
+	// Epoch is the latest assignment epoch the node
+	// had seen when it registered
+	Epoch uint64 `json:"-"`
 }
 
 func NewNode(ID, address, port string) Node {
@@ -25,49 +49,21 @@ func NewNode(ID, address, port string) Node {
 		Address:              fmt.Sprintf("%s:%s", address, port),
 		LastHealthCheckTime:  time.Time{},
 		LastHealthCheckError: nil,
+		Status:               HealthyStatus,
 	}
 }
 
-func (node *Node) PerformHealthCheck() {
-	node.LastHealthCheckTime = time.Now()
-	address := node.Address
-	ID := node.ID
-
-	url := fmt.Sprintf("http://%s/health", address)
-
-	res, err := http.Get(url)
-	success := err == nil && res.StatusCode == 200
-	defer func() {
-		if success {
-			log.Get().Printf("health check succeeded for node %s (%s)", ID, url)
-		} else {
-			log.Get().Printf("health check failed for node %s (%s)", ID, url)
-		}
-	}()
-	if err != nil {
-		node.LastHealthCheckError = err
-		return
-	}
-
-	if res.StatusCode != 200 {
-		node.LastHealthCheckError = fmt.Errorf("health check failed with status code: %d", res.StatusCode)
-		return
-	}
-
-	node.LastHealthCheckError = nil
+func (node *Node) URL() string {
+	return fmt.Sprintf("http://%s", node.Address)
 }
 
+// LoadStats replaces the stats of the latest heartbeat
+// with the current stats of the worker
 func (node *Node) LoadStats() error {
-	workerNodeURL := fmt.Sprintf("http://%s", node.Address)
-	client := clients.NewWorkerClient(workerNodeURL)
-	stats, err := client.GetStats()
+	stats, err := clients.NewWorkerClient(node.URL()).GetStats()
 	if err != nil {
 		return err
 	}
 	node.Stats = stats
 	return nil
 }
-
-func (node *Node) URL() string {
-	return fmt.Sprintf("http://%s", node.Address)
-}
@@ -0,0 +1,252 @@
+package node
+
+import (
+	"sort"
+
+	"keepair/pkg/common"
+	"keepair/pkg/log"
+	"keepair/pkg/primary/clients"
+	"keepair/pkg/worker/transfer"
+
+	"github.com/google/uuid"
+)
+
+type PlacementReport struct {
+	Nodes []NodePlacement `json:"nodes"`
+	// Misplaced are keys held by a node that is not one of their owners
+	Misplaced []KeyPlacement `json:"misplaced"`
+	// Duplicates are keys held by more nodes than they have owners
+	Duplicates []KeyPlacement `json:"duplicates"`
+	// UnderReplicated are keys missing from some of their owners
+	UnderReplicated []KeyPlacement `json:"underReplicated"`
+	Repair          *RepairSummary `json:"repair,omitempty"`
+}
+
+type NodePlacement struct {
+	Index       int    `json:"index"`
+	ID          string `json:"id"`
+	Address     string `json:"address"`
+	ObjectCount int    `json:"objectCount"`
+	Misplaced   int    `json:"misplaced"`
+}
+
+type KeyPlacement struct {
+	Key     string   `json:"key"`
+	Holders []string `json:"holders"`
+	Owners  []string `json:"owners"`
+}
+
+type RepairSummary struct {
+	// Copied is the number of copies made to owners missing a key
+	Copied int `json:"copied"`
+	// Deleted is the number of copies removed from non-owners
+	Deleted int `json:"deleted"`
+}
+
+// placementRepair is how one key is repaired: the source node copies
+// it to the targets, and the drop nodes delete their copies
+type placementRepair struct {
+	source  string
+	targets []string
+	drops   []string
+}
+
+// CheckPlacement streams the entries of every node and reports keys
+// that are not where the partitioner places them. With repair, keys
+// are copied to owners missing them and removed from other nodes.
+func (m *Service) CheckPlacement(repair bool) (PlacementReport, error) {
+	// keys are misplaced while a rebalance moves them, and the
+	// membership only changes through a rebalance, so a snapshot
+	// of it is used without blocking requests during the scan
+	m.rebalanceMu.Lock()
+	defer m.rebalanceMu.Unlock()
+	m.RLock()
+	nodes := make(Map, len(m.Nodes))
+	for ID, n := range m.Nodes {
+		nodes[ID] = n
+	}
+	indexes := make(Indexes, len(m.Indexes))
+	for index, ID := range m.Indexes {
+		indexes[index] = ID
+	}
+	m.RUnlock()
+
+	sources := make([]Node, 0, len(nodes))
+	for _, n := range nodes {
+		sources = append(sources, n)
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].Index < sources[j].Index
+	})
+
+	holders, err := collectHolders(sources)
+	if err != nil {
+		return PlacementReport{}, err
+	}
+
+	ownersOf := func(key string) []string {
+		owners, err := getReplicas(key, nodes, indexes, m.Config.ReplicationFactor)
+		if err != nil {
+			return nil
+		}
+		IDs := make([]string, 0, len(owners))
+		for _, n := range owners {
+			IDs = append(IDs, n.ID)
+		}
+		return IDs
+	}
+
+	report, repairs := analyzePlacement(holders, ownersOf)
+	for _, n := range sources {
+		nodePlacement := NodePlacement{Index: n.Index, ID: n.ID, Address: n.Address}
+		for _, keyHolders := range holders {
+			if containsID(keyHolders, n.ID) {
+				nodePlacement.ObjectCount++
+			}
+		}
+		for _, misplaced := range report.Misplaced {
+			if containsID(misplaced.Holders, n.ID) && !containsID(misplaced.Owners, n.ID) {
+				nodePlacement.Misplaced++
+			}
+		}
+		report.Nodes = append(report.Nodes, nodePlacement)
+	}
+
+	if !repair {
+		return report, nil
+	}
+
+	summary, err := m.repairPlacement(nodes, sources, repairs)
+	if err != nil {
+		return report, err
+	}
+	report.Repair = &summary
+	return report, nil
+}
+
+// analyzePlacement compares the holders of each key with its owners,
+// returning a report and the repairs needed for misplaced keys
+func analyzePlacement(holders map[string][]string, ownersOf func(key string) []string) (PlacementReport, map[string]placementRepair) {
+	report := PlacementReport{
+		Nodes:           make([]NodePlacement, 0),
+		Misplaced:       make([]KeyPlacement, 0),
+		Duplicates:      make([]KeyPlacement, 0),
+		UnderReplicated: make([]KeyPlacement, 0),
+	}
+	repairs := make(map[string]placementRepair)
+
+	keys := make([]string, 0, len(holders))
+	for key := range holders {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		keyHolders := holders[key]
+		owners := ownersOf(key)
+		placement := KeyPlacement{Key: key, Holders: keyHolders, Owners: owners}
+
+		r := placementRepair{}
+		for _, holder := range keyHolders {
+			if containsID(owners, holder) {
+				// prefer copying from an owner
+				if r.source == "" || !containsID(owners, r.source) {
+					r.source = holder
+				}
+			} else {
+				r.drops = append(r.drops, holder)
+				if r.source == "" {
+					r.source = holder
+				}
+			}
+		}
+		for _, owner := range owners {
+			if !containsID(keyHolders, owner) {
+				r.targets = append(r.targets, owner)
+			}
+		}
+
+		if len(r.drops) > 0 {
+			report.Misplaced = append(report.Misplaced, placement)
+		}
+		if len(keyHolders) > len(owners) {
+			report.Duplicates = append(report.Duplicates, placement)
+		}
+		if len(r.targets) > 0 && len(r.targets) < len(owners) {
+			report.UnderReplicated = append(report.UnderReplicated, placement)
+		}
+		if len(r.drops) > 0 || len(r.targets) > 0 {
+			repairs[key] = r
+		}
+	}
+
+	return report, repairs
+}
+
+// repairPlacement streams the nodes again and queues the copies and
+// deletes of each repair. Copies are applied unless their key was
+// written since it was streamed. Caller must hold rebalanceMu.
+func (m *Service) repairPlacement(nodes Map, sources []Node, repairs map[string]placementRepair) (RepairSummary, error) {
+	summary := RepairSummary{}
+
+	// the repair is queued apart from any migration, in
+	// batches of operations for each node
+	batches := transfer.NewBatches("repair-"+uuid.NewString(), m.Config.TransferBatchSize)
+
+	for _, sourceNode := range sources {
+		workerClient := clients.NewWorkerClient(sourceNode.URL())
+		entryChan, errChan := workerClient.StreamEntries()
+
+		loop := true
+		for loop {
+			select {
+			case err := <-errChan:
+				if err != nil {
+					return summary, err
+				}
+				loop = false
+			case entry := <-entryChan:
+				r, ok := repairs[entry.Key]
+				if !ok {
+					continue
+				}
+				if r.source == sourceNode.ID {
+					for _, target := range r.targets {
+						targetNode := nodes[target]
+						op := common.EntryOperation{Action: common.SetEntry, Entry: entry}
+						if err := batches.Add(targetNode.URL(), op); err != nil {
+							return summary, err
+						}
+						summary.Copied++
+					}
+				}
+				if containsID(r.drops, sourceNode.ID) {
+					op := common.EntryOperation{Action: common.DeleteEntry, Entry: common.Entry{Key: entry.Key}}
+					if err := batches.Add(sourceNode.URL(), op); err != nil {
+						return summary, err
+					}
+					summary.Deleted++
+				}
+			}
+		}
+	}
+
+	if err := batches.Flush(); err != nil {
+		return summary, err
+	}
+
+	for _, n := range sources {
+		workerClient := clients.NewWorkerClient(n.URL())
+		if err := workerClient.ApplyOperations(batches.QueueID, true); err != nil {
+			return summary, err
+		}
+	}
+	for _, n := range sources {
+		if _, err := clients.NewWorkerClient(n.URL()).DiscardOperationQueue(batches.QueueID); err != nil {
+			log.Get().Printf("failed to discard queue of placement repair on %s: %s", n.ID, err)
+		}
+	}
+
+	log.Get().Printf("placement repair copied %d and deleted %d keys", summary.Copied, summary.Deleted)
+	return summary, nil
+}
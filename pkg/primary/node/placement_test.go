@@ -0,0 +1,45 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyzePlacement(t *testing.T) {
+	owners := map[string][]string{
+		"placed":     {"a", "b"},
+		"misplaced":  {"a", "b"},
+		"duplicated": {"a", "b"},
+		"partial":    {"b", "c"},
+	}
+	holders := map[string][]string{
+		"placed":     {"a", "b"},
+		"misplaced":  {"c"},
+		"duplicated": {"a", "b", "c"},
+		"partial":    {"b"},
+	}
+
+	report, repairs := analyzePlacement(holders, func(key string) []string {
+		return owners[key]
+	})
+
+	keysOf := func(placements []KeyPlacement) []string {
+		keys := make([]string, 0)
+		for _, p := range placements {
+			keys = append(keys, p.Key)
+		}
+		return keys
+	}
+	assert.Equal(t, []string{"duplicated", "misplaced"}, keysOf(report.Misplaced))
+	assert.Equal(t, []string{"duplicated"}, keysOf(report.Duplicates))
+	assert.Equal(t, []string{"partial"}, keysOf(report.UnderReplicated))
+
+	assert.NotContains(t, repairs, "placed")
+	// a key only held by a non-owner is moved to its owners
+	assert.Equal(t, placementRepair{source: "c", targets: []string{"a", "b"}, drops: []string{"c"}}, repairs["misplaced"])
+	// a stale duplicate is deleted
+	assert.Equal(t, placementRepair{source: "a", drops: []string{"c"}}, repairs["duplicated"])
+	// a missing replica is copied from an owner
+	assert.Equal(t, placementRepair{source: "b", targets: []string{"c"}}, repairs["partial"])
+}
@@ -0,0 +1,104 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+
+	"keepair/pkg/partition"
+	"keepair/pkg/primary/clients"
+)
+
+// ErrInvalidChange is returned for a membership change
+// that cannot be applied to the current membership
+var ErrInvalidChange = errors.New("invalid membership change")
+
+// MembershipChange is nodes joining and leaving the cluster
+type MembershipChange struct {
+	Add    []Node   `json:"add"`
+	Remove []string `json:"remove"`
+}
+
+// RebalancePreview is what a membership change would move, counted
+// by the workers against the current placement of their keys
+type RebalancePreview struct {
+	From      []member `json:"from"`
+	FromEpoch uint64   `json:"fromEpoch"`
+	To        []member `json:"to"`
+	ToEpoch   uint64   `json:"toEpoch"`
+	// Moves are the keys and bytes copied between each pair of
+	// nodes, and dropped from each node, by source
+	Moves []partition.Move `json:"moves"`
+	// Keys and Bytes are the totals copied
+	Keys  int   `json:"keys"`
+	Bytes int64 `json:"bytes"`
+}
+
+// PreviewRebalance computes the membership after a change and asks
+// the current members what they would move to get there, without
+// changing anything
+func (m *Service) PreviewRebalance(change MembershipChange) (RebalancePreview, error) {
+	m.RLock()
+	from := make(Map, len(m.Nodes))
+	for ID, n := range m.Nodes {
+		from[ID] = n
+	}
+	epoch := m.epoch
+	m.RUnlock()
+
+	nodes, err := applyChange(from, change)
+	if err != nil {
+		return RebalancePreview{}, err
+	}
+
+	current := newAssignment(epoch, from, m.Config.ReplicationFactor)
+	next := newAssignment(epoch+1, nodes, m.Config.ReplicationFactor)
+	current.Next = &next
+
+	preview := RebalancePreview{
+		From:      toMembers(from),
+		FromEpoch: epoch,
+		To:        toMembers(nodes),
+		ToEpoch:   epoch + 1,
+		Moves:     make([]partition.Move, 0),
+	}
+	for _, n := range from.sorted() {
+		moves, err := clients.NewWorkerClient(n.URL()).CountMoves(partition.TransferRequest{Assignment: current})
+		if err != nil {
+			return RebalancePreview{}, fmt.Errorf("failed to count moves on %s: %w", n.ID, err)
+		}
+		for _, mv := range moves {
+			if mv.Target != "" {
+				preview.Keys += mv.Keys
+				preview.Bytes += mv.Bytes
+			}
+		}
+		preview.Moves = append(preview.Moves, moves...)
+	}
+	partition.SortMoves(preview.Moves)
+	return preview, nil
+}
+
+// applyChange returns the membership after nodes leave and join
+func applyChange(nodes Map, change MembershipChange) (Map, error) {
+	for _, ID := range change.Remove {
+		n, ok := nodes[ID]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrNodeNotFound, ID)
+		}
+		nodes = nodes.Delete(n)
+	}
+	for _, n := range change.Add {
+		if n.ID == "" || n.Address == "" {
+			return nil, fmt.Errorf("%w: a node to add needs an id and an address", ErrInvalidChange)
+		}
+		if _, ok := nodes[n.ID]; ok {
+			return nil, fmt.Errorf("%w: node %s is already a member", ErrInvalidChange, n.ID)
+		}
+		if containsID(change.Remove, n.ID) {
+			return nil, fmt.Errorf("%w: node %s is both added and removed", ErrInvalidChange, n.ID)
+		}
+		n.Status = HealthyStatus
+		nodes = nodes.Add(n)
+	}
+	return nodes, nil
+}
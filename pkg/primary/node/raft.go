@@ -0,0 +1,181 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"keepair/pkg/log"
+	"keepair/pkg/raft"
+)
+
+var ErrNotLeader = errors.New("primary is not the leader")
+
+// proposeTimeout is how long a membership change
+// waits to be committed by the other primaries
+const proposeTimeout = time.Second * 10
+
+// member is the part of a node that is replicated to other
+// primaries. Health check results and stats stay local.
+type member struct {
+	ID       string `json:"id"`
+	Address  string `json:"address"`
+	Index    int    `json:"index"`
+	Status   Status `json:"status"`
+	Cordoned bool   `json:"cordoned,omitempty"`
+}
+
+func newMember(n Node) member {
+	return member{ID: n.ID, Address: n.Address, Index: n.Index, Status: n.Status, Cordoned: n.Cordoned}
+}
+
+// membershipCommand replaces the whole membership and the migration
+// in progress, so applying it twice or out of a snapshot gives the
+// same result
+type membershipCommand struct {
+	Epoch   uint64   `json:"epoch"`
+	Members []member `json:"members"`
+	// Migration is replicated so that another primary
+	// elected leader can resume it
+	Migration *MigrationPlan `json:"migration,omitempty"`
+}
+
+// membershipState is what a membership command sets
+type membershipState struct {
+	Nodes     Map
+	Epoch     uint64
+	Migration *MigrationPlan
+}
+
+// UseRaft replicates membership changes through a raft node. Only
+// the leader changes membership and runs health checks, and other
+// primaries apply the changes it commits.
+func (m *Service) UseRaft(raftNode *raft.Node) {
+	m.Lock()
+	defer m.Unlock()
+	m.raft = raftNode
+}
+
+func (m *Service) GetRaft() *raft.Node {
+	return m.raft
+}
+
+// IsLeader reports whether this primary can change membership
+func (m *Service) IsLeader() bool {
+	return m.raft == nil || m.raft.IsLeader()
+}
+
+// commitMembership replicates a change of the membership state to the
+// other primaries, and sets it once it is committed. The change is
+// made to a copy of the current state under commitMu, so changes are
+// committed in the order they are made, and nothing is committed if
+// it returns false. Caller must not hold the lock.
+func (m *Service) commitMembership(change func(state *membershipState) (bool, error)) error {
+	m.commitMu.Lock()
+	defer m.commitMu.Unlock()
+
+	m.RLock()
+	state := membershipState{Nodes: make(Map, len(m.Nodes)), Epoch: m.epoch, Migration: m.migration}
+	for ID, n := range m.Nodes {
+		state.Nodes[ID] = n
+	}
+	ok, err := change(&state)
+	var data []byte
+	if ok && err == nil && m.raft != nil {
+		data, err = json.Marshal(newMembershipCommand(state))
+	}
+	m.RUnlock()
+	if !ok || err != nil {
+		return err
+	}
+
+	var index uint64
+	if m.raft != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), proposeTimeout)
+		defer cancel()
+		if index, err = m.raft.Propose(ctx, data); err != nil {
+			return err
+		}
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	// the entry may have been applied already, with a
+	// copy of the migration instead of the one running
+	if index < m.membershipIndex {
+		return nil
+	}
+	if err := m.setMembership(index, state); err != nil {
+		log.Get().Printf("failed to save state: %s", err)
+	}
+	return nil
+}
+
+func newMembershipCommand(state membershipState) membershipCommand {
+	cmd := membershipCommand{Epoch: state.Epoch, Members: make([]member, 0, len(state.Nodes)), Migration: state.Migration}
+	for _, n := range state.Nodes {
+		cmd.Members = append(cmd.Members, newMember(n))
+	}
+	return cmd
+}
+
+// Apply sets the membership committed at index
+func (m *Service) Apply(index uint64, data []byte) {
+	if err := m.applyMembership(index, data); err != nil {
+		log.Get().Printf("failed to apply membership at %d: %s", index, err)
+	}
+}
+
+func (m *Service) Snapshot() ([]byte, error) {
+	m.RLock()
+	defer m.RUnlock()
+	return json.Marshal(newMembershipCommand(membershipState{Nodes: m.Nodes, Epoch: m.epoch, Migration: m.migration}))
+}
+
+func (m *Service) Restore(index uint64, data []byte) error {
+	return m.applyMembership(index, data)
+}
+
+func (m *Service) applyMembership(index uint64, data []byte) error {
+	var cmd membershipCommand
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		return err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	// the leader already set membership it committed itself
+	if index <= m.membershipIndex {
+		return nil
+	}
+	state := membershipState{Nodes: make(Map, len(cmd.Members)), Epoch: cmd.Epoch, Migration: cmd.Migration}
+	for _, mb := range cmd.Members {
+		state.Nodes[mb.ID] = Node{ID: mb.ID, Address: mb.Address, Index: mb.Index, Status: mb.Status, Cordoned: mb.Cordoned}
+	}
+	return m.setMembership(index, state)
+}
+
+// setMembership sets the membership state committed at index, keeping
+// what was checked locally about known nodes. Caller must hold the lock.
+func (m *Service) setMembership(index uint64, state membershipState) error {
+	nodes := make(Map, len(state.Nodes))
+	for ID, n := range state.Nodes {
+		if current, ok := m.Nodes[ID]; ok {
+			current.Address = n.Address
+			current.Index = n.Index
+			current.Status = n.Status
+			current.Cordoned = n.Cordoned
+			n = current
+		}
+		nodes[ID] = n
+	}
+	m.Nodes = nodes
+	m.Indexes = nodes.CreateIndexes()
+	m.epoch = state.Epoch
+	m.migration = state.Migration
+	m.membershipIndex = index
+	m.syncLeases()
+	m.topologyUpdated()
+	return m.saveState()
+}
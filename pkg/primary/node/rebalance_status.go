@@ -0,0 +1,166 @@
+package node
+
+import (
+	"time"
+
+	"keepair/pkg/log"
+	"keepair/pkg/partition"
+	"keepair/pkg/primary/clients"
+)
+
+// RebalanceStatus is the progress of the migration in progress
+type RebalanceStatus struct {
+	ID        string             `json:"id"`
+	Operation RebalanceOperation `json:"operation"`
+	NodeID    string             `json:"nodeId"`
+	Added     []string           `json:"added,omitempty"`
+	Removed   []string           `json:"removed,omitempty"`
+	// Phase is the kind of the step running, or to run next
+	// when the migration is stopped
+	Phase     StepKind `json:"phase"`
+	Running   bool     `json:"running"`
+	Canceling bool     `json:"canceling,omitempty"`
+	Canceled  bool     `json:"canceled,omitempty"`
+	Error     string   `json:"error,omitempty"`
+	// Transfers are the keys each source copies to each target,
+	// and drops with no target
+	Transfers []TransferStatus `json:"transfers"`
+	// the totals of the copies
+	MovedKeys      int           `json:"movedKeys"`
+	MovedBytes     int64         `json:"movedBytes"`
+	RemainingKeys  int           `json:"remainingKeys"`
+	RemainingBytes int64         `json:"remainingBytes"`
+	ETA            time.Duration `json:"eta"`
+}
+
+// TransferStatus is the progress of the keys moved from a source,
+// to a target or dropped
+type TransferStatus struct {
+	partition.Move
+	MovedKeys      int     `json:"movedKeys"`
+	MovedBytes     int64   `json:"movedBytes"`
+	RemainingKeys  int     `json:"remainingKeys"`
+	RemainingBytes int64   `json:"remainingBytes"`
+	BytesPerSecond float64 `json:"bytesPerSecond"`
+	// ETA is estimated from the throughput of the transfer, or of
+	// the copies done so far if it has not started. It is zero if
+	// it cannot be estimated yet.
+	ETA time.Duration `json:"eta"`
+}
+
+// GetRebalanceStatus returns what the migration in progress has moved
+// so far, asking the source it is copying from for the progress of
+// the copy, and estimates how long the rest will take
+func (m *Service) GetRebalanceStatus() (RebalanceStatus, error) {
+	m.RLock()
+	if m.migration == nil {
+		m.RUnlock()
+		return RebalanceStatus{}, ErrNoMigration
+	}
+	plan := *m.migration
+	plan.Steps = append([]MigrationStep{}, plan.Steps...)
+	status := RebalanceStatus{
+		ID:        plan.ID,
+		Operation: plan.Operation,
+		NodeID:    plan.NodeID,
+		Added:     plan.Added,
+		Removed:   plan.Removed,
+		Canceled:  plan.Canceled,
+		Error:     plan.Error,
+	}
+	current := -1
+	if run := m.running; run != nil && run.plan == m.migration {
+		status.Running, status.Canceling, current = true, run.canceling, run.step
+	}
+	m.RUnlock()
+
+	moved := make(map[partition.Move]partition.Transfer)
+	for i, step := range plan.Steps {
+		if current == -1 && !step.Done {
+			current = i
+		}
+		for _, tr := range step.Transfers {
+			moved[pairOf(tr.Move)] = tr
+		}
+	}
+	if current >= 0 && current < len(plan.Steps) {
+		step := plan.Steps[current]
+		status.Phase = step.Kind
+		// a copy running on a worker reports what it sent so far
+		if status.Running && step.Kind == CopyStep {
+			source := plan.source(step.NodeID)
+			transfers, _, err := clients.NewWorkerClient(source.URL()).GetTransferProgress(plan.ID)
+			if err != nil {
+				log.Get().Printf("failed to get transfer progress of %s: %s", step.NodeID, err)
+			}
+			for _, tr := range transfers {
+				moved[pairOf(tr.Move)] = tr
+			}
+		}
+	}
+
+	// the throughput of the copies so far estimates the others. The
+	// copies of a source are sent together, so they take as long as
+	// the longest of them, and sources copy one after the other.
+	var copiedBytes int64
+	copyTimes := make(map[string]time.Duration)
+	for pair, tr := range moved {
+		if pair.Target != "" {
+			copiedBytes += tr.Bytes
+			if tr.Duration > copyTimes[pair.Source] {
+				copyTimes[pair.Source] = tr.Duration
+			}
+		}
+	}
+	var copyTime time.Duration
+	for _, d := range copyTimes {
+		copyTime += d
+	}
+	var averageRate float64
+	if copyTime > 0 {
+		averageRate = float64(copiedBytes) / copyTime.Seconds()
+	}
+
+	sourceETA := make(map[string]time.Duration)
+	status.Transfers = make([]TransferStatus, 0, len(plan.Moves))
+	for _, mv := range plan.Moves {
+		ts := TransferStatus{Move: mv}
+		if tr, ok := moved[pairOf(mv)]; ok {
+			ts.MovedKeys, ts.MovedBytes, ts.BytesPerSecond = tr.Keys, tr.Bytes, tr.BytesPerSecond
+		}
+		ts.RemainingKeys = mv.Keys - ts.MovedKeys
+		if ts.RemainingKeys < 0 {
+			ts.RemainingKeys = 0
+		}
+		ts.RemainingBytes = mv.Bytes - ts.MovedBytes
+		if ts.RemainingBytes < 0 {
+			ts.RemainingBytes = 0
+		}
+		if mv.Target != "" {
+			rate := ts.BytesPerSecond
+			if rate == 0 {
+				rate = averageRate
+			}
+			if rate > 0 {
+				ts.ETA = time.Duration(float64(ts.RemainingBytes) / rate * float64(time.Second))
+			}
+			if ts.ETA > sourceETA[mv.Source] {
+				sourceETA[mv.Source] = ts.ETA
+			}
+			status.MovedKeys += ts.MovedKeys
+			status.MovedBytes += ts.MovedBytes
+			status.RemainingKeys += ts.RemainingKeys
+			status.RemainingBytes += ts.RemainingBytes
+		}
+		status.Transfers = append(status.Transfers, ts)
+	}
+	for _, eta := range sourceETA {
+		status.ETA += eta
+	}
+	return status, nil
+}
+
+// pairOf returns the source and target of a move
+func pairOf(mv partition.Move) partition.Move {
+	return partition.Move{Source: mv.Source, Target: mv.Target}
+}
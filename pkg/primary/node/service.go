@@ -1,7 +1,9 @@
 package node
 
 import (
+	"context"
 	"fmt"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -9,7 +11,8 @@ import (
 	"keepair/pkg/common"
 	"keepair/pkg/log"
 	"keepair/pkg/partition"
-	"keepair/pkg/primary/clients"
+	"keepair/pkg/primary/hints"
+	"keepair/pkg/raft"
 )
 
 type CancelFunc func()
@@ -17,70 +20,267 @@ type CancelFunc func()
 type IService interface {
 	RegisterNode(nd Node) error
 	UnregisterNode(ID string) error
+	Heartbeat(ID string, heartbeat common.Heartbeat) (common.Lease, error)
 	RunHealthChecksInBackground() CancelFunc
 	GetNodes() []Node
 	GetNodeByIndex(idx int) (Node, error)
 	GetNumNodes() int
+	GetReplicasForKey(key string) ([]Node, error)
+	GetConfig() Config
+	GetGeneration() string
+	RecordReadRepair(ID string)
+	AddHint(hint hints.Hint) error
+	CheckPlacement(repair bool) (PlacementReport, error)
+	SharedKeys(sourceID, targetID string) (func(key string) bool, error)
+	PreviewRebalance(change MembershipChange) (RebalancePreview, error)
+	ChangeMembership(change MembershipChange) error
+	GetMigration() *MigrationPlan
+	ResumeMigration() error
+	RollbackMigration() error
+	CordonNode(ID string) error
+	UncordonNode(ID string) error
+	DrainNode(ID string) error
+	CancelMigration() error
+	GetRebalanceStatus() (RebalanceStatus, error)
+	GetTopology() Topology
+	WaitForTopologyChange(ctx context.Context, version uint64) Topology
+	UseRaft(raftNode *raft.Node)
+	GetRaft() *raft.Node
+	IsLeader() bool
+	raft.StateMachine
+	Close() error
 }
 
 type Service struct {
 	sync.RWMutex
-	Indexes map[int]string
-	Nodes   map[string]Node
+	Config Config
+	// Generation is different every time the service starts
+	Generation string
+	Indexes    map[int]string
+	Nodes      map[string]Node
+	Hints      hints.IStore
+
+	topologyVersion uint64
+	topologyChanged chan struct{}
+	// publishedTopologyVersion can be read without the lock
+	publishedTopologyVersion atomic.Uint64
+
+	// epoch increases every time the partition
+	// assignment of the nodes changes
+	epoch uint64
+
+	// rebalanceMu serializes the membership changes that move data,
+	// which only hold the lock while they start and finish
+	rebalanceMu sync.Mutex
+	// migration is the rebalance in progress, if any
+	migration *MigrationPlan
+	// running is the run of a migration, if one is running
+	running *migrationRun
+	// registrations are the nodes waiting for
+	// the registration window to join
+	registrationsMu sync.Mutex
+	registrations   *registrationBatch
+
+	raft *raft.Node
+	// commitMu serializes membership changes from
+	// the moment they are made until they are set
+	commitMu sync.Mutex
+	// membershipIndex is the raft index of the current membership
+	membershipIndex uint64
+
+	readRepairsMu sync.Mutex
+	readRepairs   map[string]int
+
+	leasesMu sync.Mutex
+	leases   map[string]lease
+	// removed holds the IDs of unregistered nodes
+	removed map[string]bool
 }
 
 func NewService() IService {
-	return &Service{
-		Indexes: make(map[int]string),
-		Nodes:   make(map[string]Node),
+	service, err := NewServiceWithConfig(DefaultConfig())
+	if err != nil {
+		panic(err)
 	}
+	return service
 }
 
+func NewServiceWithConfig(config Config) (IService, error) {
+	nodes, epoch, migration, err := loadState(config.StateFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state: %w", err)
+	}
+	hintStore, err := hints.Open(config.Hints)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open hints: %w", err)
+	}
+	service := &Service{
+		Config:          config,
+		Generation:      strconv.FormatInt(time.Now().UnixNano(), 10),
+		Indexes:         nodes.CreateIndexes(),
+		Nodes:           nodes,
+		Hints:           hintStore,
+		epoch:           epoch,
+		migration:       migration,
+		topologyChanged: make(chan struct{}),
+		readRepairs:     make(map[string]int),
+		leases:          make(map[string]lease),
+		removed:         make(map[string]bool),
+	}
+	// reloaded nodes have a lease to send a heartbeat in
+	service.syncLeases()
+	return service, nil
+}
+
+// RegisterNode adds a node to the cluster, unless it is already a
+// member. With a registration window, the nodes registering within
+// it are added together.
 func (m *Service) RegisterNode(nd Node) error {
+	if m.Config.RegistrationWindow > 0 {
+		return m.registerInBatch(nd)
+	}
+
+	m.rebalanceMu.Lock()
+	defer m.rebalanceMu.Unlock()
+	return m.registerNodes([]Node{nd})
+}
+
+// registerKnownNode takes the registration of a node that is
+// already a member, and reports whether it was one
+func (m *Service) registerKnownNode(nd Node) (bool, error) {
+	known, ok, err := m.renewKnownNode(nd)
+	if err != nil || !ok || known.Status == HealthyStatus {
+		return ok, err
+	}
+	return true, m.commitMembership(func(state *membershipState) (bool, error) {
+		n, ok := state.Nodes[nd.ID]
+		if !ok {
+			return false, nil
+		}
+		n.Status = HealthyStatus
+		state.Nodes[nd.ID] = n
+		return true, nil
+	})
+}
+
+// renewKnownNode considers the registration of a known node to be a
+// health check, and returns the node and whether it was known
+func (m *Service) renewKnownNode(nd Node) (Node, bool, error) {
 	m.Lock()
 	defer m.Unlock()
 
+	if !m.IsLeader() {
+		return Node{}, false, ErrNotLeader
+	}
+
 	// consider registration to be a health check
 	nd.LastHealthCheckTime = time.Now()
-
-	if err := m.rebalanceNodes(AddNode, nd); err != nil {
-		return fmt.Errorf("failed to rebalance nodes: %w", err)
+	// continue from the epoch of the workers if the
+	// primary lost its state, so they accept its assignments
+	if nd.Epoch > m.epoch {
+		m.epoch = nd.Epoch
 	}
-
-	return nil
+	m.leasesMu.Lock()
+	delete(m.removed, nd.ID)
+	m.leasesMu.Unlock()
+
+	// a known node re-registers after the primary restarts,
+	// and already holds the right data
+	known, ok := m.Nodes[nd.ID]
+	if !ok || known.Address != nd.Address {
+		return Node{}, false, nil
+	}
+	known.LastHealthCheckTime = nd.LastHealthCheckTime
+	known.LastHealthCheckError = nil
+	known.ConsecutiveFailures = 0
+	m.renewLease(known.ID)
+	m.Nodes[nd.ID] = known
+	return known, true, nil
 }
 
 func (m *Service) UnregisterNode(ID string) error {
-	m.Lock()
-	defer m.Unlock()
+	m.rebalanceMu.Lock()
+	defer m.rebalanceMu.Unlock()
 
+	return m.unregisterNode(ID, false)
+}
+
+// unregisterNode moves the keys of a node to the other nodes and
+// removes it, cordoning it first for a drain. A dead node is failed
+// over instead, as its keys cannot be streamed from it.
+// Caller must hold rebalanceMu.
+func (m *Service) unregisterNode(ID string, drain bool) error {
+	if err := m.resumeMigration(); err != nil {
+		return fmt.Errorf("failed to resume migration: %w", err)
+	}
+
+	m.RLock()
+	isLeader := m.IsLeader()
 	nd, ok := m.Nodes[ID]
+	m.RUnlock()
+
+	if !isLeader {
+		return ErrNotLeader
+	}
 	if !ok {
-		return fmt.Errorf("failed to find node: %s", ID)
+		return fmt.Errorf("%w: %s", ErrNodeNotFound, ID)
+	}
+	if err := m.checkCordoned(ID); err != nil {
+		return err
+	}
+	if drain {
+		if err := m.setCordoned(ID, true); err != nil {
+			return err
+		}
+	}
+
+	operation := DeleteNode
+	if nd.Status == DeadStatus {
+		operation = FailNode
 	}
 
-	if err := m.rebalanceNodes(DeleteNode, nd); err != nil {
+	m.markRemoved(ID)
+	if err := m.rebalanceNodes(operation, MembershipChange{Remove: []string{nd.ID}}); err != nil {
 		return fmt.Errorf("failed to rebalance nodes: %w", err)
 	}
 
 	return nil
 }
 
+// RunHealthChecksInBackground checks the leases of nodes, which
+// workers renew with heartbeats
 func (m *Service) RunHealthChecksInBackground() CancelFunc {
 
 	quit := atomic.Bool{}
 
 	go func() {
+		resumed := false
 		for !quit.Load() {
-			// TODO: check if lock affects read performance
-			nodes := m.GetNodes()
-			for _, n := range nodes {
-				n.PerformHealthCheck()
-				m.Lock()
-				m.Nodes[n.ID] = n
-				m.Unlock()
+			// other primaries take over checking leases
+			// only once they are elected
+			if !m.IsLeader() {
+				time.Sleep(m.Config.HealthCheckInterval)
+				continue
+			}
+			// a migration interrupted by a restart is resumed once,
+			// and otherwise before the next membership change
+			if !resumed {
+				resumed = true
+				m.rebalanceMu.Lock()
+				if err := m.resumeMigration(); err != nil {
+					log.Get().Printf("failed to resume migration: %s", err)
+				}
+				m.rebalanceMu.Unlock()
 			}
-			time.Sleep(time.Second * 5)
+			for _, nd := range m.checkLeases() {
+				m.redirectHints(nd)
+			}
+			for _, nd := range m.GetNodes() {
+				if nd.Status == HealthyStatus {
+					m.replayHints(nd)
+				}
+			}
+			time.Sleep(m.Config.HealthCheckInterval)
 		}
 	}()
 
@@ -92,13 +292,57 @@ func (m *Service) RunHealthChecksInBackground() CancelFunc {
 func (m *Service) GetNodes() []Node {
 	m.RLock()
 	defer m.RUnlock()
+	numNodes := len(m.Nodes)
 	nodes := make([]Node, 0)
+	m.readRepairsMu.Lock()
+	defer m.readRepairsMu.Unlock()
+	hintDepths := m.Hints.Depths()
+	leases := m.getLeases()
 	for _, v := range m.Nodes {
+		l := leases[v.ID]
+		v.Stats = l.stats
+		v.LeaseExpiry = l.expiry
+		if !l.lastHeartbeat.IsZero() {
+			v.LastHealthCheckTime = l.lastHeartbeat
+		}
+		v.LeaderOf, v.FollowerOf = getReplicaPartitions(v.Index, numNodes, m.Config.ReplicationFactor)
+		v.ReadRepairs = m.readRepairs[v.ID]
+		v.PendingHints = hintDepths[v.ID]
 		nodes = append(nodes, v)
 	}
 	return nodes
 }
 
+func (m *Service) GetConfig() Config {
+	return m.Config
+}
+
+func (m *Service) GetGeneration() string {
+	return m.Generation
+}
+
+// RecordReadRepair counts a stale value on a node
+// that was overwritten by a read repair
+func (m *Service) RecordReadRepair(ID string) {
+	m.readRepairsMu.Lock()
+	defer m.readRepairsMu.Unlock()
+	m.readRepairs[ID]++
+}
+
+// getReplicaPartitions returns the partitions a node leads and the
+// partitions it holds follower replicas of. Partition p is led by
+// the node at index p and followed by the next nodes in index order.
+func getReplicaPartitions(index int, numNodes int, replicationFactor int) ([]int, []int) {
+	if replicationFactor > numNodes {
+		replicationFactor = numNodes
+	}
+	followerOf := make([]int, 0)
+	for i := 1; i < replicationFactor; i++ {
+		followerOf = append(followerOf, (index-i+numNodes)%numNodes)
+	}
+	return []int{index}, followerOf
+}
+
 func (m *Service) GetNodeByIndex(idx int) (Node, error) {
 	m.RLock()
 	defer m.RUnlock()
@@ -119,157 +363,91 @@ func (m *Service) GetNumNodes() int {
 	return len(m.Indexes)
 }
 
-type RebalanceOperation string
-
-var AddNode = RebalanceOperation("add")
-var DeleteNode = RebalanceOperation("delete")
-
-// rebalanceNodes redistributes data to be stored evenly across all nodes.
-// Caller must handle locks.
-func (m *Service) rebalanceNodes(operation RebalanceOperation, opNode Node) error {
-
-	log.BigPrintf("OLD NODES: %+v", m.Nodes)
-
-	// make copy of nodes map
-	nodes := Map(m.Nodes)
-	if operation == AddNode {
-		nodes = nodes.Add(opNode)
-	}
-	if operation == DeleteNode {
-		nodes = nodes.Delete(opNode)
-		opNode.Index = -1 // for logging
-	}
-	indexes := nodes.CreateIndexes()
-	numNodes := len(nodes)
-
-	log.BigPrintf("NEW NODES: %+v", nodes)
-
-	defer func() {
-		m.Nodes = nodes
-		m.Indexes = indexes
-	}()
+// GetReplicasForKey returns the nodes that hold a key,
+// starting with the leader replica
+func (m *Service) GetReplicasForKey(key string) ([]Node, error) {
+	m.RLock()
+	defer m.RUnlock()
+	return getReplicas(key, m.Nodes, m.Indexes, m.Config.ReplicationFactor)
+}
 
+func getReplicas(key string, nodes Map, indexes Indexes, replicationFactor int) ([]Node, error) {
+	numNodes := len(indexes)
 	if numNodes == 0 {
-		return nil
+		return nil, ErrNoNodes
 	}
-
-	log.BigPrintf("[%s] REBALANCE STARTED...", "primary")
-	defer log.BigPrintf("[%s] REBALANCE DONE", "primary")
-
-	// handle buffering of operations and set flush callback
-	q := NewTransferOperationsQueueWithCallback(50, func(items []TransferOperation) error {
-		for _, item := range items {
-			if err := handleBulkTransferOps(item.Entry, item.SourceNode, item.TargetNode); err != nil {
-				return err
-			}
-		}
-		return nil
-	})
-
-	// for each node, regenerate partition keys and move data to correct node
-	for _, currentNode := range nodes {
-
-		var entryChan <-chan common.Entry
-		var errChan <-chan error
-
-		workerClient := clients.NewWorkerClient(currentNode.URL())
-		if operation == DeleteNode {
-			// if deleting, then stream entries from the node
-			// that will soon be deleted
-			workerClient = clients.NewWorkerClient(opNode.URL())
+	replicas := make([]Node, 0, replicationFactor)
+	for _, idx := range partition.GetReplicaIndexes(key, numNodes, replicationFactor) {
+		n, ok := nodes[indexes[idx]]
+		if !ok {
+			return nil, fmt.Errorf("failed to find node index: %d", idx)
 		}
-		entryChan, errChan = workerClient.StreamEntries()
+		replicas = append(replicas, n)
+	}
+	return replicas, nil
+}
 
-		loop := true
+type RebalanceOperation string
 
-		for loop {
-			select {
-			case err := <-errChan:
-				if err != nil {
-					return err
-				}
-				loop = false
-			case entry := <-entryChan:
-				switch operation {
-				case AddNode:
-					sourceNode := nodes[indexes[currentNode.Index]]
-					targetNodeIndex := partition.GenerateDeterministicPartitionKey(entry.Key, numNodes)
-					targetNode := nodes[indexes[targetNodeIndex]]
-					if sourceNode.ID != targetNode.ID {
-
-						// if err := handleBulkTransferOps(entry, sourceNode, targetNode); err != nil {
-						// 	return err
-						// }
-
-						if err := q.Push(NewTransferOperation(entry, sourceNode, targetNode)); err != nil {
-							return err
-						}
-					}
-				case DeleteNode:
-					sourceNode := opNode
-					targetNodeIndex := partition.GenerateDeterministicPartitionKey(entry.Key, numNodes)
-					targetNode := nodes[indexes[targetNodeIndex]]
-
-					// if err := handleBulkTransferOps(entry, sourceNode, targetNode); err != nil {
-					// 	return err
-					// }
-
-					if err := q.Push(NewTransferOperation(entry, sourceNode, targetNode)); err != nil {
-						return err
-					}
-				}
-			}
-		}
-	}
+var AddNode = RebalanceOperation("add")
+var DeleteNode = RebalanceOperation("delete")
 
-	if err := q.Flush(); err != nil {
+// FailNode removes a node that cannot be reached, so its data is
+// restored from the other replicas instead of streamed from it
+var FailNode = RebalanceOperation("fail")
+
+// rebalanceNodes redistributes data to be stored evenly across all nodes,
+// with each key stored on as many nodes as the replication factor.
+// The lock is only held to start and finish the migration, so requests
+// are served while data moves. The plan of the migration is saved
+// first, so it can be resumed or rolled back if it fails.
+// Caller must hold rebalanceMu.
+func (m *Service) rebalanceNodes(operation RebalanceOperation, change MembershipChange) error {
+	m.Lock()
+	log.BigPrintf("OLD NODES: %+v", m.Nodes)
+	plan, err := m.newMigrationPlan(operation, change)
+	m.Unlock()
+	if err != nil {
 		return err
 	}
+	log.BigPrintf("NEW NODES: %+v", plan.To)
+	if err := m.startMigration(plan); err != nil {
+		return fmt.Errorf("failed to save migration: %w", err)
+	}
 
-	// apply operations for all nodes
-	for _, n := range nodes {
-		workerClient := clients.NewWorkerClient(n.URL())
-		if err := workerClient.ApplyOperations(); err != nil {
-			return err
+	return m.runMigration(plan)
+}
+
+// collectHolders streams the keys of every node and returns the IDs
+// of the nodes holding each key, in the order the nodes were given
+func collectHolders(sources []Node) (map[string][]string, error) {
+	holders := make(map[string][]string)
+	for _, sourceNode := range sources {
+		err := streamEntries(sourceNode, func(entry common.Entry) error {
+			holders[entry.Key] = append(holders[entry.Key], sourceNode.ID)
+			return nil
+		})
+		if err != nil {
+			return nil, err
 		}
 	}
+	return holders, nil
+}
 
-	// if deleting, apply operations on node that will
-	// soon be deleted
-	if operation == DeleteNode {
-		workerClient := clients.NewWorkerClient(opNode.URL())
-		if err := workerClient.ApplyOperations(); err != nil {
-			return err
+func containsID(IDs []string, ID string) bool {
+	for _, v := range IDs {
+		if v == ID {
+			return true
 		}
 	}
-
-	return nil
+	return false
 }
 
-func handleBulkTransferOps(entry common.Entry, source Node, target Node) error {
-	sourceNodeClient := clients.NewWorkerClient(source.URL())
-	targetNodeClient := clients.NewWorkerClient(target.URL())
-	// set key on new node
-	if err := targetNodeClient.QueueOperations([]common.EntryOperation{
-		{
-			Action: common.SetEntry,
-			Entry:  entry,
-		},
-	}); err != nil {
-		return fmt.Errorf("failed to queue operation: %w", err)
-	}
-	// delete key on old node
-	if err := sourceNodeClient.QueueOperations([]common.EntryOperation{
-		{
-			Action: common.DeleteEntry,
-			Entry: common.Entry{
-				Key:   entry.Key,
-				Value: nil,
-			},
-		},
-	}); err != nil {
-		return fmt.Errorf("failed to queue operations: %w", err)
+func containsNode(nodes []Node, ID string) bool {
+	for _, n := range nodes {
+		if n.ID == ID {
+			return true
+		}
 	}
-	log.Get().Printf("transferred key (%s) from node %s => %s", entry.Key, source.ID, target.ID)
-	return nil
+	return false
 }
@@ -0,0 +1,93 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+
+	"keepair/pkg/partition"
+)
+
+// ErrNoSharedKeys is returned for two nodes that are
+// not supposed to hold any key in common
+var ErrNoSharedKeys = errors.New("nodes do not share any keys")
+
+// SharedKeys returns whether a key is supposed to be held by both of
+// two nodes: as replicas of it in the current membership, or, while a
+// migration runs, as its owners before and after the migration. Nodes
+// that cannot hold a key in common are refused with ErrNoSharedKeys.
+func (m *Service) SharedKeys(sourceID, targetID string) (func(key string) bool, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	assignments := []partition.Assignment{newAssignment(m.epoch, m.Nodes, m.Config.ReplicationFactor)}
+	if m.migration != nil {
+		assignments = append(assignments, newAssignment(m.migration.ToEpoch, fromMembers(m.migration.To), m.Config.ReplicationFactor))
+	}
+
+	for _, ID := range []string{sourceID, targetID} {
+		if !assigned(assignments, ID) {
+			return nil, fmt.Errorf("%w: %s", ErrNodeNotFound, ID)
+		}
+	}
+	if !mayShareKeys(assignments, sourceID, targetID) {
+		return nil, fmt.Errorf("%w: %s and %s", ErrNoSharedKeys, sourceID, targetID)
+	}
+
+	return func(key string) bool {
+		holds := func(ID string) bool {
+			for _, a := range assignments {
+				if a.Owns(ID, key) {
+					return true
+				}
+			}
+			return false
+		}
+		return holds(sourceID) && holds(targetID)
+	}, nil
+}
+
+// assigned reports whether a node is in one of the assignments
+func assigned(assignments []partition.Assignment, ID string) bool {
+	for _, a := range assignments {
+		if indexOf(a, ID) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// mayShareKeys reports whether two nodes are replicas of the same
+// partition in one of the assignments, or are in different ones
+func mayShareKeys(assignments []partition.Assignment, a, b string) bool {
+	for i, first := range assignments {
+		for j, second := range assignments {
+			if i != j && indexOf(first, a) >= 0 && indexOf(second, b) >= 0 {
+				return true
+			}
+		}
+		ia, ib := indexOf(first, a), indexOf(first, b)
+		if ia < 0 || ib < 0 {
+			continue
+		}
+		// partition p is held by the nodes of index p to p+rf-1
+		numNodes := len(first.Nodes)
+		distance := (ib - ia + numNodes) % numNodes
+		if distance > numNodes-distance {
+			distance = numNodes - distance
+		}
+		if distance < first.ReplicationFactor {
+			return true
+		}
+	}
+	return false
+}
+
+// indexOf returns the index of a node in an assignment, or -1
+func indexOf(a partition.Assignment, ID string) int {
+	for i, n := range a.Nodes {
+		if n.ID == ID {
+			return i
+		}
+	}
+	return -1
+}
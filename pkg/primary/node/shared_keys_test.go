@@ -0,0 +1,61 @@
+package node
+
+import (
+	"testing"
+
+	"keepair/pkg/partition"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSharedKeys checks that only nodes holding replicas of the same
+// keys, or moving keys between them, are synced, and only those keys
+func TestSharedKeys(t *testing.T) {
+	newService := func(replicationFactor int, IDs ...string) *Service {
+		config := DefaultConfig()
+		config.ReplicationFactor = replicationFactor
+		service, err := NewServiceWithConfig(config)
+		assert.NoError(t, err)
+		m := service.(*Service)
+		nodes := Map{}
+		for i, ID := range IDs {
+			nodes = nodes.Add(NewNode(ID, "127.0.0.1", string(rune('1'+i))))
+		}
+		assert.NoError(t, commitNodes(m, nodes))
+		return m
+	}
+	keys := []string{"a", "b", "c", "d", "e", "f"}
+
+	// without replicas, no two nodes hold the same key
+	m := newService(1, "a", "b")
+	_, err := m.SharedKeys("a", "b")
+	assert.ErrorIs(t, err, ErrNoSharedKeys)
+	_, err = m.SharedKeys("a", "unknown")
+	assert.ErrorIs(t, err, ErrNodeNotFound)
+
+	// replicas share the keys of the partitions they both hold
+	m = newService(2, "a", "b", "c")
+	shared, err := m.SharedKeys("a", "b")
+	assert.NoError(t, err)
+	for _, key := range keys {
+		indexes := partition.GetReplicaIndexes(key, 3, 2)
+		holders := map[string]bool{}
+		for _, idx := range indexes {
+			holders[m.Indexes[idx]] = true
+		}
+		assert.Equal(t, holders["a"] && holders["b"], shared(key), key)
+	}
+
+	// a node joining shares the keys it takes over
+	m = newService(1, "a")
+	m.Lock()
+	plan, err := m.newMigrationPlan(AddNode, MembershipChange{Add: []Node{NewNode("b", "127.0.0.1", "2")}})
+	m.migration = plan
+	m.Unlock()
+	assert.NoError(t, err)
+	shared, err = m.SharedKeys("a", "b")
+	assert.NoError(t, err)
+	for _, key := range keys {
+		assert.Equal(t, partition.GenerateDeterministicPartitionKey(key, 2) == 1, shared(key), key)
+	}
+}
@@ -0,0 +1,111 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// savedNode is a member along with the partitions it was assigned
+type savedNode struct {
+	member
+	LeaderOf   []int `json:"leaderOf"`
+	FollowerOf []int `json:"followerOf"`
+}
+
+// savedState is the membership written to the state file
+type savedState struct {
+	Epoch             uint64      `json:"epoch"`
+	ReplicationFactor int         `json:"replicationFactor"`
+	Nodes             []savedNode `json:"nodes"`
+	Indexes           Indexes     `json:"indexes"`
+	// Migration is the rebalance in progress, if any
+	Migration *MigrationPlan `json:"migration,omitempty"`
+}
+
+// saveState writes the membership and the migration in progress to
+// the state file, replacing it atomically. Caller must hold the lock.
+func (m *Service) saveState() error {
+	if m.Config.StateFile == "" {
+		return nil
+	}
+
+	state := savedState{
+		Epoch:             m.epoch,
+		ReplicationFactor: m.Config.ReplicationFactor,
+		Nodes:             make([]savedNode, 0, len(m.Nodes)),
+		Indexes:           m.Indexes,
+		Migration:         m.migration,
+	}
+	for _, n := range m.Nodes {
+		leaderOf, followerOf := getReplicaPartitions(n.Index, len(m.Nodes), m.Config.ReplicationFactor)
+		state.Nodes = append(state.Nodes, savedNode{
+			member:     newMember(n),
+			LeaderOf:   leaderOf,
+			FollowerOf: followerOf,
+		})
+	}
+	sort.Slice(state.Nodes, func(i, j int) bool {
+		return state.Nodes[i].Index < state.Nodes[j].Index
+	})
+
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.Config.StateFile), 0755); err != nil {
+		return err
+	}
+	tmpPath := m.Config.StateFile + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, m.Config.StateFile)
+}
+
+// loadState reads the membership, assignment epoch and migration in
+// progress from the state file, returning no nodes if there is none
+func loadState(path string) (Map, uint64, *MigrationPlan, error) {
+	nodes := make(Map)
+	if path == "" {
+		return nodes, 0, nil, nil
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nodes, 0, nil, nil
+	}
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	var state savedState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, 0, nil, err
+	}
+	for _, saved := range state.Nodes {
+		nodes[saved.ID] = Node{
+			ID:       saved.ID,
+			Address:  saved.Address,
+			Index:    saved.Index,
+			Status:   saved.Status,
+			Cordoned: saved.Cordoned,
+			// health checks resume from the restart
+			LastHealthCheckTime: time.Now(),
+		}
+	}
+	return nodes, state.Epoch, state.Migration, nil
+}
@@ -0,0 +1,84 @@
+package node
+
+import "keepair/pkg/log"
+
+// Status is where a node is in its failure detection: a healthy node
+// becomes suspect after failing health checks, and dead after
+// failing enough of them in a row, at which point it is failed over
+type Status string
+
+var HealthyStatus = Status("healthy")
+var SuspectStatus = Status("suspect")
+var DeadStatus = Status("dead")
+
+// nextStatus returns the status of a node after a number of
+// consecutive failed health checks
+func nextStatus(consecutiveFailures int, config Config) Status {
+	switch {
+	case consecutiveFailures >= config.DeadAfter:
+		return DeadStatus
+	case consecutiveFailures >= config.SuspectAfter:
+		return SuspectStatus
+	default:
+		return HealthyStatus
+	}
+}
+
+// updateStatus moves a node through its statuses after a health
+// check, taking into account what the other workers gossip about it,
+// and reports whether it changed. Caller must hold the write lock.
+func (m *Service) updateStatus(nd *Node, votes gossipVotes) bool {
+	if nd.LastHealthCheckError == nil {
+		nd.ConsecutiveFailures = 0
+	} else {
+		nd.ConsecutiveFailures++
+	}
+	nd.GossipState = votes.majority()
+	status := applyGossip(nextStatus(nd.ConsecutiveFailures, m.Config), nd.LastHealthCheckError != nil, votes)
+	if status == nd.Status {
+		return false
+	}
+	log.Get().Printf("node %s is now %s (was %s)", nd.ID, status, nd.Status)
+	if status == DeadStatus && m.Config.ReplicationFactor < 2 {
+		log.Get().Printf("node %s holds the only replica of its keys and is not failed over, remove it to give up its keys", nd.ID)
+	}
+	nd.Status = status
+	return true
+}
+
+// failoverNode removes a dead node from the cluster. Its partitions
+// are reassigned, and keys it held are copied from their other
+// replicas to restore the replication factor. Without replicas its
+// keys would be lost, so the node stays dead and keeps its partitions
+// until it comes back or an operator removes it. It is skipped while
+// another rebalance runs or a failed one cannot be resumed, and
+// retried at the next health check. It returns the node and whether
+// it was failed over.
+func (m *Service) failoverNode(ID string) (Node, bool) {
+	if m.Config.ReplicationFactor < 2 {
+		return Node{}, false
+	}
+	if !m.rebalanceMu.TryLock() {
+		return Node{}, false
+	}
+	defer m.rebalanceMu.Unlock()
+
+	if err := m.resumeMigration(); err != nil {
+		log.Get().Printf("failed to resume migration before failing over node %s: %s", ID, err)
+		return Node{}, false
+	}
+
+	// indexes shift as each dead node is removed
+	m.RLock()
+	nd, ok := m.Nodes[ID]
+	m.RUnlock()
+	if !ok || nd.Status != DeadStatus {
+		return Node{}, false
+	}
+
+	log.Get().Printf("failing over dead node %s", nd.ID)
+	if err := m.rebalanceNodes(FailNode, MembershipChange{Remove: []string{nd.ID}}); err != nil {
+		log.Get().Printf("failed to rebalance after failing over node %s: %s", nd.ID, err)
+	}
+	return nd, true
+}
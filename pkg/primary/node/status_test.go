@@ -0,0 +1,33 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextStatus(t *testing.T) {
+	config := DefaultConfig()
+	config.SuspectAfter = 1
+	config.DeadAfter = 3
+
+	assert.Equal(t, HealthyStatus, nextStatus(0, config))
+	assert.Equal(t, SuspectStatus, nextStatus(1, config))
+	assert.Equal(t, SuspectStatus, nextStatus(2, config))
+	assert.Equal(t, DeadStatus, nextStatus(3, config))
+	assert.Equal(t, DeadStatus, nextStatus(4, config))
+}
+
+func TestApplyGossip(t *testing.T) {
+	alive := gossipVotes{alive: 2, dead: 1, total: 3}
+	dead := gossipVotes{dead: 2, suspect: 1, total: 3}
+	split := gossipVotes{alive: 1, dead: 1, total: 2}
+
+	// a node holding its lease keeps its status
+	assert.Equal(t, HealthyStatus, applyGossip(HealthyStatus, false, dead))
+
+	assert.Equal(t, DeadStatus, applyGossip(SuspectStatus, true, dead))
+	assert.Equal(t, SuspectStatus, applyGossip(DeadStatus, true, alive))
+	assert.Equal(t, DeadStatus, applyGossip(DeadStatus, true, split))
+	assert.Equal(t, SuspectStatus, applyGossip(SuspectStatus, true, gossipVotes{}))
+}
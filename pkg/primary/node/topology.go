@@ -0,0 +1,94 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Topology is the cluster membership as seen by clients. Version
+// increases whenever nodes join, leave or change status.
+type Topology struct {
+	Version uint64 `json:"version"`
+	// Epoch is the epoch of the partition assignment
+	Epoch             uint64          `json:"epoch"`
+	ReplicationFactor int             `json:"replicationFactor"`
+	Mode              ReplicationMode `json:"mode"`
+	Nodes             []TopologyNode  `json:"nodes"`
+}
+
+type TopologyNode struct {
+	ID         string `json:"id"`
+	Address    string `json:"address"`
+	Index      int    `json:"index"`
+	Status     Status `json:"status"`
+	Cordoned   bool   `json:"cordoned,omitempty"`
+	LeaderOf   []int  `json:"leaderOf"`
+	FollowerOf []int  `json:"followerOf"`
+}
+
+func (m *Service) GetTopology() Topology {
+	m.RLock()
+	defer m.RUnlock()
+	return m.getTopology()
+}
+
+// getTopology builds the topology. Caller must handle locks.
+func (m *Service) getTopology() Topology {
+	topology := Topology{
+		Version:           m.topologyVersion,
+		Epoch:             m.epoch,
+		ReplicationFactor: m.Config.ReplicationFactor,
+		Mode:              m.Config.Mode,
+		Nodes:             make([]TopologyNode, 0, len(m.Nodes)),
+	}
+	for _, n := range m.Nodes {
+		leaderOf, followerOf := getReplicaPartitions(n.Index, len(m.Nodes), m.Config.ReplicationFactor)
+		topology.Nodes = append(topology.Nodes, TopologyNode{
+			ID:         n.ID,
+			Address:    n.Address,
+			Index:      n.Index,
+			Status:     n.Status,
+			Cordoned:   n.Cordoned,
+			LeaderOf:   leaderOf,
+			FollowerOf: followerOf,
+		})
+	}
+	sort.Slice(topology.Nodes, func(i, j int) bool {
+		return topology.Nodes[i].Index < topology.Nodes[j].Index
+	})
+	return topology
+}
+
+// WaitForTopologyChange returns the topology once its version is
+// different from version, or the current one when ctx is done
+func (m *Service) WaitForTopologyChange(ctx context.Context, version uint64) Topology {
+	for {
+		m.RLock()
+		topology := m.getTopology()
+		changed := m.topologyChanged
+		m.RUnlock()
+
+		if topology.Version != version {
+			return topology
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return topology
+		}
+	}
+}
+
+// topologyUpdated bumps the topology version and wakes up
+// waiting clients. Caller must hold the write lock.
+func (m *Service) topologyUpdated() {
+	m.topologyVersion++
+	m.publishedTopologyVersion.Store(m.topologyVersion)
+	close(m.topologyChanged)
+	m.topologyChanged = make(chan struct{})
+}
+
+func (node *TopologyNode) URL() string {
+	return fmt.Sprintf("http://%s", node.Address)
+}
@@ -6,14 +6,23 @@ import (
 	"keepair/pkg/common"
 )
 
+// TransferKind is what a transfer does with an entry: a copy sets it
+// on the target node, a drop deletes it from the source node
+type TransferKind string
+
+var CopyTransfer = TransferKind("copy")
+var DropTransfer = TransferKind("drop")
+
 type TransferOperation struct {
+	Kind       TransferKind
 	SourceNode Node
 	TargetNode Node
 	Entry      common.Entry
 }
 
-func NewTransferOperation(entry common.Entry, source, target Node) TransferOperation {
+func NewTransferOperation(kind TransferKind, entry common.Entry, source, target Node) TransferOperation {
 	return TransferOperation{
+		Kind:       kind,
 		SourceNode: source,
 		TargetNode: target,
 		Entry:      entry,
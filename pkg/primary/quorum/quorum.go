@@ -0,0 +1,57 @@
+package quorum
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"keepair/pkg/common"
+)
+
+const (
+	One    = "one"
+	Quorum = "quorum"
+	All    = "all"
+)
+
+var ErrInvalidLevel = errors.New("invalid consistency level")
+
+// ParseLevel returns the number of replicas out of n that must respond
+// for a consistency level, which is one, quorum, all or a number.
+// An empty level defaults to a quorum.
+func ParseLevel(level string, n int) (int, error) {
+	switch level {
+	case One:
+		return 1, nil
+	case Quorum, "":
+		return n/2 + 1, nil
+	case All:
+		return n, nil
+	}
+	count, err := strconv.Atoi(level)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidLevel, level)
+	}
+	if count < 1 || count > n {
+		return 0, fmt.Errorf("%w: %d is not between 1 and %d", ErrInvalidLevel, count, n)
+	}
+	return count, nil
+}
+
+// Newest returns the version with the latest timestamp. A delete
+// wins over a write made at the same time.
+func Newest(versions []common.VersionedValue) common.VersionedValue {
+	newest := common.VersionedValue{}
+	for _, version := range versions {
+		if version.Timestamp > newest.Timestamp ||
+			(version.Timestamp == newest.Timestamp && version.Deleted) {
+			newest = version
+		}
+	}
+	return newest
+}
+
+// IsStale returns whether a replica's version is older than the newest
+func IsStale(version common.VersionedValue, newest common.VersionedValue) bool {
+	return version.Timestamp < newest.Timestamp
+}
@@ -0,0 +1,47 @@
+package quorum
+
+import (
+	"testing"
+
+	"keepair/pkg/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLevel(t *testing.T) {
+	for level, expected := range map[string]int{
+		"":       2,
+		"one":    1,
+		"quorum": 2,
+		"all":    3,
+		"3":      3,
+	} {
+		count, err := ParseLevel(level, 3)
+		assert.NoError(t, err)
+		assert.Equalf(t, expected, count, "level %q", level)
+	}
+
+	for _, level := range []string{"0", "4", "most"} {
+		_, err := ParseLevel(level, 3)
+		assert.Errorf(t, err, "level %q", level)
+	}
+
+	count, err := ParseLevel("quorum", 4)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+}
+
+func TestNewest(t *testing.T) {
+	missing := common.VersionedValue{}
+	old := common.VersionedValue{Value: []byte("old"), Timestamp: 1, Found: true}
+	current := common.VersionedValue{Value: []byte("new"), Timestamp: 2, Found: true}
+	deleted := common.VersionedValue{Timestamp: 2, Deleted: true}
+
+	assert.Equal(t, current, Newest([]common.VersionedValue{old, current, missing}))
+	assert.Equal(t, deleted, Newest([]common.VersionedValue{current, deleted, old}))
+	assert.Equal(t, missing, Newest([]common.VersionedValue{missing}))
+
+	assert.True(t, IsStale(old, current))
+	assert.True(t, IsStale(missing, current))
+	assert.False(t, IsStale(current, current))
+}
@@ -23,12 +23,54 @@ func NewServer(nodeService node.IService) base_server.IServer {
 func (s *Server) Run(ctx context.Context, port string) error {
 
 	r := gin.Default()
+	r.Use(endpoints.GenerationHeader(s.NodeService))
 	r.GET("/nodes", endpoints.GetNodesHandler(s.NodeService))
-	r.POST("/nodes", endpoints.RegisterNodeHandler(s.NodeService))
-	r.DELETE("/nodes/:nodeID", endpoints.UnregisterNodeHandler(s.NodeService))
+	forwardToLeader := endpoints.ForwardToLeader(s.NodeService)
+	r.POST("/nodes", forwardToLeader, endpoints.RegisterNodeHandler(s.NodeService))
+	r.DELETE("/nodes/:nodeID", forwardToLeader, endpoints.UnregisterNodeHandler(s.NodeService))
+	r.POST("/nodes/:nodeID/heartbeat", forwardToLeader, endpoints.HeartbeatHandler(s.NodeService))
+	r.POST("/nodes/:nodeID/cordon", forwardToLeader, endpoints.CordonNodeHandler(s.NodeService))
+	r.POST("/nodes/:nodeID/uncordon", forwardToLeader, endpoints.UncordonNodeHandler(s.NodeService))
+	r.POST("/nodes/:nodeID/drain", forwardToLeader, endpoints.DrainNodeHandler(s.NodeService))
+	r.GET("/topology", endpoints.GetTopologyHandler(s.NodeService))
 	r.POST("/keys/:key", endpoints.SetKeyHandler(s.NodeService))
 	r.GET("/keys/:key", endpoints.GetKeyHandler(s.NodeService))
+	r.PATCH("/keys/:key", endpoints.PatchKeyHandler(s.NodeService))
 	r.DELETE("/keys/:key", endpoints.DeleteKeyHandler(s.NodeService))
+	r.GET("/watch", endpoints.WatchHandler(s.NodeService))
+	r.GET("/placement", endpoints.CheckPlacementHandler(s.NodeService, false))
+	r.POST("/placement/repair", forwardToLeader, endpoints.CheckPlacementHandler(s.NodeService, true))
+	r.POST("/sync", forwardToLeader, endpoints.SyncNodesHandler(s.NodeService))
+	r.POST("/rebalance/plan", endpoints.PreviewRebalanceHandler(s.NodeService))
+	r.POST("/rebalance/apply", forwardToLeader, endpoints.ApplyRebalanceHandler(s.NodeService))
+	r.GET("/rebalance/migration", forwardToLeader, endpoints.GetMigrationHandler(s.NodeService))
+	r.POST("/rebalance/resume", forwardToLeader, endpoints.ResumeMigrationHandler(s.NodeService))
+	r.POST("/rebalance/rollback", forwardToLeader, endpoints.RollbackMigrationHandler(s.NodeService))
+	r.POST("/rebalance/cancel", forwardToLeader, endpoints.CancelMigrationHandler(s.NodeService))
+	r.GET("/rebalance/status", forwardToLeader, endpoints.GetRebalanceStatusHandler(s.NodeService))
+
+	// primaries replicate membership with raft
+	if raftNode := s.NodeService.GetRaft(); raftNode != nil {
+		r.GET("/raft/status", endpoints.RaftStatusHandler(raftNode))
+		r.POST("/raft/vote", endpoints.RequestVoteHandler(raftNode))
+		r.POST("/raft/append", endpoints.AppendEntriesHandler(raftNode))
+		r.POST("/raft/snapshot", endpoints.InstallSnapshotHandler(raftNode))
+	}
+
+	// data structure operations are forwarded as-is to the
+	// worker that owns the key
+	forwardByKey := endpoints.ForwardByKeyHandler(s.NodeService)
+	r.POST("/lists/:key/push", forwardByKey)
+	r.POST("/lists/:key/pop", forwardByKey)
+	r.GET("/lists/:key", forwardByKey)
+	r.POST("/sets/:key/add", forwardByKey)
+	r.POST("/sets/:key/remove", forwardByKey)
+	r.GET("/sets/:key", forwardByKey)
+	r.POST("/hashes/:key", forwardByKey)
+	r.GET("/hashes/:key/:field", forwardByKey)
+	r.GET("/hashes/:key", forwardByKey)
+	r.POST("/zsets/:key", forwardByKey)
+	r.GET("/zsets/:key", forwardByKey)
 
 	svr := base_server.NewBaseServer(r)
 	return svr.Run(ctx, port)
@@ -4,20 +4,46 @@ import (
 	"context"
 
 	"keepair/pkg/primary/node"
+	"keepair/pkg/raft"
 )
 
 type IService interface {
 	Run(ctx context.Context, port string) error
 }
 
-type Service struct{}
+type Service struct {
+	Config Config
+}
 
 func NewService() IService {
-	return &Service{}
+	return NewServiceWithConfig(DefaultConfig())
+}
+
+func NewServiceWithConfig(config Config) IService {
+	return &Service{
+		Config: config,
+	}
 }
 
 func (m *Service) Run(ctx context.Context, port string) error {
-	nodeService := node.NewService()
+	nodeService, err := node.NewServiceWithConfig(m.Config.Node)
+	if err != nil {
+		return err
+	}
+	defer nodeService.Close()
+
+	if m.Config.Raft.ID != "" {
+		raftNode, err := raft.NewNode(m.Config.Raft, nodeService)
+		if err != nil {
+			return err
+		}
+		nodeService.UseRaft(raftNode)
+
+		raftCtx, cancelRaft := context.WithCancel(ctx)
+		defer cancelRaft()
+		go raftNode.Run(raftCtx)
+	}
+
 	cancelHealthCheck := nodeService.RunHealthChecksInBackground()
 	defer cancelHealthCheck()
 
@@ -0,0 +1,56 @@
+package watch
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Cursor is the position of a watch in the change stream of every
+// worker, as a map of worker ID to the last sequence number seen.
+// Its string form is used as the SSE event ID, so a client can
+// resume from any event it received.
+type Cursor map[string]uint64
+
+// ParseCursor parses the format produced by Cursor.String,
+// e.g. "workerA:12,workerB:3"
+func ParseCursor(s string) (Cursor, error) {
+	cursor := make(Cursor)
+	if s == "" {
+		return cursor, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		workerID, seqStr, ok := strings.Cut(part, ":")
+		if !ok || workerID == "" {
+			return nil, fmt.Errorf("invalid cursor segment: %s", part)
+		}
+		seq, err := strconv.ParseUint(seqStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor sequence: %s", part)
+		}
+		cursor[workerID] = seq
+	}
+	return cursor, nil
+}
+
+func (c Cursor) String() string {
+	workerIDs := make([]string, 0, len(c))
+	for workerID := range c {
+		workerIDs = append(workerIDs, workerID)
+	}
+	sort.Strings(workerIDs)
+	parts := make([]string, 0, len(c))
+	for _, workerID := range workerIDs {
+		parts = append(parts, fmt.Sprintf("%s:%d", workerID, c[workerID]))
+	}
+	return strings.Join(parts, ",")
+}
+
+func (c Cursor) Copy() Cursor {
+	cursor := make(Cursor)
+	for k, v := range c {
+		cursor[k] = v
+	}
+	return cursor
+}
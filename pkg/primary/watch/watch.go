@@ -0,0 +1,94 @@
+package watch
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"keepair/pkg/common"
+	"keepair/pkg/log"
+	"keepair/pkg/primary/clients"
+	"keepair/pkg/primary/node"
+)
+
+// membershipPollInterval is how often a watch checks for
+// nodes that joined the cluster, e.g. during a rebalance
+const membershipPollInterval = time.Second
+
+// Watch merges the change streams of all registered nodes, starting
+// from the position in cursor. Nodes that register later are
+// subscribed to as they appear, and streams that end are resumed
+// from the last event received while the node is still registered.
+// The returned channel is closed when the context is cancelled.
+func Watch(ctx context.Context, nodeService node.IService, cursor Cursor) <-chan common.ChangeEvent {
+	out := make(chan common.ChangeEvent)
+
+	go func() {
+		defer close(out)
+
+		mu := sync.Mutex{}
+		seqs := cursor.Copy()
+		active := make(map[string]bool)
+		wg := sync.WaitGroup{}
+
+		subscribe := func(n node.Node) {
+			defer wg.Done()
+			defer func() {
+				mu.Lock()
+				delete(active, n.ID)
+				mu.Unlock()
+			}()
+
+			mu.Lock()
+			since := seqs[n.ID]
+			mu.Unlock()
+
+			workerClient := clients.NewWorkerClient(n.URL())
+			eventChan, errChan := workerClient.StreamEvents(ctx, since)
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case err := <-errChan:
+					if err != nil && ctx.Err() == nil {
+						log.Get().Printf("watch stream of node %s ended: %s", n.ID, err)
+					}
+					return
+				case event := <-eventChan:
+					mu.Lock()
+					seqs[n.ID] = event.Seq
+					mu.Unlock()
+					select {
+					case out <- event:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+
+		ticker := time.NewTicker(membershipPollInterval)
+		defer ticker.Stop()
+
+		for {
+			for _, n := range nodeService.GetNodes() {
+				mu.Lock()
+				isActive := active[n.ID]
+				active[n.ID] = true
+				mu.Unlock()
+				if !isActive {
+					wg.Add(1)
+					go subscribe(n)
+				}
+			}
+			select {
+			case <-ctx.Done():
+				wg.Wait()
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return out
+}
@@ -0,0 +1,517 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"keepair/pkg/log"
+)
+
+var ErrNotLeader = errors.New("not the raft leader")
+var ErrLostLeadership = errors.New("lost raft leadership before the entry was committed")
+
+type Role string
+
+var Follower = Role("follower")
+var Candidate = Role("candidate")
+var Leader = Role("leader")
+
+// Entry is a command in the replicated log. An entry without data
+// is a no-op appended by a new leader to commit earlier entries.
+type Entry struct {
+	Index uint64 `json:"index"`
+	Term  uint64 `json:"term"`
+	Data  []byte `json:"data,omitempty"`
+}
+
+// StateMachine is the state replicated by the log. Apply is called
+// with committed entries in order, and a snapshot replaces the state
+// up to its index. Calls never overlap.
+type StateMachine interface {
+	Apply(index uint64, data []byte)
+	Snapshot() ([]byte, error)
+	Restore(index uint64, data []byte) error
+}
+
+type Config struct {
+	// ID identifies this node among Peers
+	ID string
+	// Peers maps the ID of every node in the cluster,
+	// including this one, to its URL
+	Peers map[string]string
+	// ElectionTimeout is the minimum time without hearing from a
+	// leader before starting an election. Each node waits a random
+	// time between it and twice it, so elections rarely tie.
+	ElectionTimeout   time.Duration
+	HeartbeatInterval time.Duration
+	// SnapshotThreshold is the number of applied entries after which
+	// the log is compacted into a snapshot
+	SnapshotThreshold int
+	// Dir is where the term, vote, log and snapshot are persisted.
+	// They are kept in memory only if Dir is empty.
+	Dir string
+}
+
+func DefaultConfig() Config {
+	return Config{
+		ElectionTimeout:   time.Millisecond * 300,
+		HeartbeatInterval: time.Millisecond * 50,
+		SnapshotThreshold: 1_000,
+	}
+}
+
+// Status is a summary of a node's view of the cluster
+type Status struct {
+	ID          string `json:"id"`
+	Role        Role   `json:"role"`
+	Term        uint64 `json:"term"`
+	LeaderID    string `json:"leaderId"`
+	LeaderURL   string `json:"leaderUrl"`
+	CommitIndex uint64 `json:"commitIndex"`
+	LastApplied uint64 `json:"lastApplied"`
+	LastIndex   uint64 `json:"lastIndex"`
+	// SnapshotIndex is the last entry compacted into the snapshot
+	SnapshotIndex uint64 `json:"snapshotIndex"`
+}
+
+type Node struct {
+	config  Config
+	fsm     StateMachine
+	storage *storage
+	client  *http.Client
+
+	mu       sync.Mutex
+	role     Role
+	leaderID string
+	// persisted state
+	currentTerm   uint64
+	votedFor      string
+	log           []Entry
+	snapshotIndex uint64
+	snapshotTerm  uint64
+	snapshot      []byte
+	// volatile state
+	commitIndex      uint64
+	lastApplied      uint64
+	restorePending   bool
+	electionDeadline time.Time
+	nextIndex        map[string]uint64
+	matchIndex       map[string]uint64
+	replicating      map[string]bool
+	// changed is closed and replaced whenever the commit
+	// index, term or role changes, to wake up proposers
+	changed chan struct{}
+	// applyNotify wakes up the apply loop
+	applyNotify chan struct{}
+	// replicateNotify wakes up the leader to send entries
+	replicateNotify chan struct{}
+}
+
+// NewNode returns a node that replicates commands to fsm. Persisted
+// state is reloaded from config.Dir, including the snapshot, which
+// is restored into fsm.
+func NewNode(config Config, fsm StateMachine) (*Node, error) {
+	if _, ok := config.Peers[config.ID]; !ok {
+		return nil, fmt.Errorf("raft peers do not include %s", config.ID)
+	}
+
+	s, err := openStorage(config.Dir)
+	if err != nil {
+		return nil, err
+	}
+	state, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	n := &Node{
+		config:          config,
+		fsm:             fsm,
+		storage:         s,
+		client:          &http.Client{Timeout: config.ElectionTimeout},
+		role:            Follower,
+		currentTerm:     state.CurrentTerm,
+		votedFor:        state.VotedFor,
+		log:             state.Log,
+		snapshotIndex:   state.SnapshotIndex,
+		snapshotTerm:    state.SnapshotTerm,
+		snapshot:        state.Snapshot,
+		commitIndex:     state.SnapshotIndex,
+		lastApplied:     state.SnapshotIndex,
+		nextIndex:       make(map[string]uint64),
+		matchIndex:      make(map[string]uint64),
+		replicating:     make(map[string]bool),
+		changed:         make(chan struct{}),
+		applyNotify:     make(chan struct{}, 1),
+		replicateNotify: make(chan struct{}, 1),
+	}
+	if n.snapshot != nil {
+		if err := fsm.Restore(n.snapshotIndex, n.snapshot); err != nil {
+			return nil, fmt.Errorf("failed to restore raft snapshot: %w", err)
+		}
+	}
+	n.resetElectionDeadline()
+	return n, nil
+}
+
+// Run runs elections, heartbeats and the apply loop until ctx is done
+func (n *Node) Run(ctx context.Context) {
+	go n.applyLoop(ctx)
+
+	ticker := time.NewTicker(n.config.HeartbeatInterval / 5)
+	defer ticker.Stop()
+	lastHeartbeat := time.Time{}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-n.replicateNotify:
+			n.replicateToAll()
+			lastHeartbeat = time.Now()
+		case <-ticker.C:
+			n.mu.Lock()
+			role := n.role
+			electionDue := time.Now().After(n.electionDeadline)
+			n.mu.Unlock()
+
+			if role == Leader {
+				if time.Since(lastHeartbeat) >= n.config.HeartbeatInterval {
+					n.replicateToAll()
+					lastHeartbeat = time.Now()
+				}
+			} else if electionDue {
+				n.startElection()
+			}
+		}
+	}
+}
+
+func (n *Node) Status() Status {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return Status{
+		ID:            n.config.ID,
+		Role:          n.role,
+		Term:          n.currentTerm,
+		LeaderID:      n.leaderID,
+		LeaderURL:     n.config.Peers[n.leaderID],
+		CommitIndex:   n.commitIndex,
+		LastApplied:   n.lastApplied,
+		LastIndex:     n.lastIndex(),
+		SnapshotIndex: n.snapshotIndex,
+	}
+}
+
+func (n *Node) IsLeader() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.role == Leader
+}
+
+// LeaderURL returns the URL of the current leader,
+// or an empty string if it is not known
+func (n *Node) LeaderURL() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.config.Peers[n.leaderID]
+}
+
+// Propose appends a command to the log and waits until it is
+// committed, returning its index. It fails on nodes that are
+// not the leader.
+func (n *Node) Propose(ctx context.Context, data []byte) (uint64, error) {
+	n.mu.Lock()
+	if n.role != Leader {
+		n.mu.Unlock()
+		return 0, ErrNotLeader
+	}
+	entry := Entry{Index: n.lastIndex() + 1, Term: n.currentTerm, Data: data}
+	n.log = append(n.log, entry)
+	if err := n.persist(); err != nil {
+		n.log = n.log[:len(n.log)-1]
+		n.mu.Unlock()
+		return 0, err
+	}
+	// a single node commits on its own
+	n.advanceCommitIndex()
+	n.mu.Unlock()
+
+	n.notifyReplicate()
+
+	for {
+		n.mu.Lock()
+		committed := n.commitIndex >= entry.Index
+		lost := n.currentTerm != entry.Term || n.role != Leader
+		if committed {
+			// the entry may have been replaced by a new leader
+			lost = entry.Index > n.snapshotIndex && n.termAt(entry.Index) != entry.Term
+		}
+		changed := n.changed
+		n.mu.Unlock()
+
+		if committed && !lost {
+			return entry.Index, nil
+		}
+		if lost {
+			return 0, ErrLostLeadership
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+// startElection becomes a candidate and requests votes from every peer
+func (n *Node) startElection() {
+	n.mu.Lock()
+	n.role = Candidate
+	n.currentTerm++
+	n.votedFor = n.config.ID
+	n.leaderID = ""
+	if err := n.persist(); err != nil {
+		log.Get().Printf("raft %s failed to persist election: %s", n.config.ID, err)
+	}
+	n.resetElectionDeadline()
+	n.notifyChanged()
+	term := n.currentTerm
+	args := RequestVoteArgs{
+		Term:         term,
+		CandidateID:  n.config.ID,
+		LastLogIndex: n.lastIndex(),
+		LastLogTerm:  n.lastTerm(),
+	}
+	n.mu.Unlock()
+
+	log.Get().Printf("raft %s started election for term %d", n.config.ID, term)
+
+	votes := 1
+	if votes > len(n.config.Peers)/2 {
+		n.becomeLeader(term)
+		return
+	}
+	for peerID := range n.config.Peers {
+		if peerID == n.config.ID {
+			continue
+		}
+		go func(peerID string) {
+			var reply RequestVoteReply
+			if err := n.call(peerID, "vote", args, &reply); err != nil {
+				return
+			}
+			n.mu.Lock()
+			if reply.Term > n.currentTerm {
+				n.stepDown(reply.Term)
+				n.mu.Unlock()
+				return
+			}
+			if !reply.VoteGranted || n.role != Candidate || n.currentTerm != term {
+				n.mu.Unlock()
+				return
+			}
+			votes++
+			won := votes == len(n.config.Peers)/2+1
+			n.mu.Unlock()
+			if won {
+				n.becomeLeader(term)
+			}
+		}(peerID)
+	}
+}
+
+func (n *Node) becomeLeader(term uint64) {
+	n.mu.Lock()
+	if n.role != Candidate || n.currentTerm != term {
+		n.mu.Unlock()
+		return
+	}
+	n.role = Leader
+	n.leaderID = n.config.ID
+	for peerID := range n.config.Peers {
+		n.nextIndex[peerID] = n.lastIndex() + 1
+		n.matchIndex[peerID] = 0
+	}
+	// commit entries from earlier terms through an entry of this term
+	n.log = append(n.log, Entry{Index: n.lastIndex() + 1, Term: term})
+	if err := n.persist(); err != nil {
+		log.Get().Printf("raft %s failed to persist no-op entry: %s", n.config.ID, err)
+	}
+	n.advanceCommitIndex()
+	n.notifyChanged()
+	n.mu.Unlock()
+
+	log.Get().Printf("raft %s became leader for term %d", n.config.ID, term)
+	n.notifyReplicate()
+}
+
+// stepDown becomes a follower of a newer term.
+// Caller must hold mu.
+func (n *Node) stepDown(term uint64) {
+	if term > n.currentTerm {
+		n.currentTerm = term
+		n.votedFor = ""
+		n.leaderID = ""
+		if err := n.persist(); err != nil {
+			log.Get().Printf("raft %s failed to persist term: %s", n.config.ID, err)
+		}
+	}
+	if n.role != Follower {
+		log.Get().Printf("raft %s stepped down in term %d", n.config.ID, n.currentTerm)
+	}
+	n.role = Follower
+	n.resetElectionDeadline()
+	n.notifyChanged()
+}
+
+// applyLoop applies committed entries to the state machine, restores
+// snapshots received from the leader and compacts the log
+func (n *Node) applyLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-n.applyNotify:
+		}
+
+		n.mu.Lock()
+		if n.restorePending {
+			n.restorePending = false
+			index, data := n.snapshotIndex, n.snapshot
+			n.mu.Unlock()
+			if err := n.fsm.Restore(index, data); err != nil {
+				log.Get().Printf("raft %s failed to restore snapshot: %s", n.config.ID, err)
+			}
+			n.mu.Lock()
+			if n.lastApplied < index {
+				n.lastApplied = index
+			}
+		}
+		entries := make([]Entry, 0)
+		for i := n.lastApplied + 1; i <= n.commitIndex; i++ {
+			entries = append(entries, n.entryAt(i))
+		}
+		n.mu.Unlock()
+
+		for _, entry := range entries {
+			if entry.Data != nil {
+				n.fsm.Apply(entry.Index, entry.Data)
+			}
+			n.mu.Lock()
+			// a snapshot may have been installed meanwhile
+			if entry.Index > n.lastApplied {
+				n.lastApplied = entry.Index
+			}
+			n.mu.Unlock()
+		}
+
+		n.maybeSnapshot()
+	}
+}
+
+// maybeSnapshot compacts the applied log into a snapshot once
+// it has grown past the threshold
+func (n *Node) maybeSnapshot() {
+	n.mu.Lock()
+	lastApplied := n.lastApplied
+	due := n.config.SnapshotThreshold > 0 && lastApplied-n.snapshotIndex >= uint64(n.config.SnapshotThreshold)
+	n.mu.Unlock()
+	if !due {
+		return
+	}
+
+	data, err := n.fsm.Snapshot()
+	if err != nil {
+		log.Get().Printf("raft %s failed to snapshot: %s", n.config.ID, err)
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if lastApplied <= n.snapshotIndex {
+		return
+	}
+	term := n.termAt(lastApplied)
+	n.log = append([]Entry(nil), n.log[lastApplied-n.snapshotIndex:]...)
+	n.snapshotIndex = lastApplied
+	n.snapshotTerm = term
+	n.snapshot = data
+	if err := n.persist(); err != nil {
+		log.Get().Printf("raft %s failed to persist snapshot: %s", n.config.ID, err)
+	}
+	log.Get().Printf("raft %s compacted log up to %d", n.config.ID, lastApplied)
+}
+
+// lastIndex returns the index of the last entry. Caller must hold mu.
+func (n *Node) lastIndex() uint64 {
+	return n.snapshotIndex + uint64(len(n.log))
+}
+
+// lastTerm returns the term of the last entry. Caller must hold mu.
+func (n *Node) lastTerm() uint64 {
+	if len(n.log) == 0 {
+		return n.snapshotTerm
+	}
+	return n.log[len(n.log)-1].Term
+}
+
+// termAt returns the term of the entry at index, which must not be
+// before the snapshot. Caller must hold mu.
+func (n *Node) termAt(index uint64) uint64 {
+	if index == n.snapshotIndex {
+		return n.snapshotTerm
+	}
+	return n.entryAt(index).Term
+}
+
+// entryAt returns the entry at index, which must be after the
+// snapshot. Caller must hold mu.
+func (n *Node) entryAt(index uint64) Entry {
+	return n.log[index-n.snapshotIndex-1]
+}
+
+// persist saves the state that must survive a restart.
+// Caller must hold mu.
+func (n *Node) persist() error {
+	return n.storage.save(persistentState{
+		CurrentTerm:   n.currentTerm,
+		VotedFor:      n.votedFor,
+		Log:           n.log,
+		SnapshotIndex: n.snapshotIndex,
+		SnapshotTerm:  n.snapshotTerm,
+		Snapshot:      n.snapshot,
+	})
+}
+
+// resetElectionDeadline picks a new random election timeout.
+// Caller must hold mu.
+func (n *Node) resetElectionDeadline() {
+	timeout := n.config.ElectionTimeout + time.Duration(rand.Int63n(int64(n.config.ElectionTimeout)))
+	n.electionDeadline = time.Now().Add(timeout)
+}
+
+// notifyChanged wakes up proposers. Caller must hold mu.
+func (n *Node) notifyChanged() {
+	close(n.changed)
+	n.changed = make(chan struct{})
+}
+
+func (n *Node) notifyApply() {
+	select {
+	case n.applyNotify <- struct{}{}:
+	default:
+	}
+}
+
+func (n *Node) notifyReplicate() {
+	select {
+	case n.replicateNotify <- struct{}{}:
+	default:
+	}
+}
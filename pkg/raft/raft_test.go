@@ -0,0 +1,260 @@
+package raft
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// listFSM records applied commands in order
+type listFSM struct {
+	mu       sync.Mutex
+	commands []string
+}
+
+func (f *listFSM) Apply(index uint64, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commands = append(f.commands, string(data))
+}
+
+func (f *listFSM) Snapshot() ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return json.Marshal(f.commands)
+}
+
+func (f *listFSM) Restore(index uint64, data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return json.Unmarshal(data, &f.commands)
+}
+
+func (f *listFSM) get() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.commands...)
+}
+
+type testCluster struct {
+	config  Config
+	servers map[string]*httptest.Server
+	nodes   map[string]*Node
+	fsms    map[string]*listFSM
+	cancels map[string]context.CancelFunc
+	mu      sync.Mutex
+}
+
+// newTestCluster serves the RPCs of each node on a local port
+func newTestCluster(t *testing.T, size int, config Config) *testCluster {
+	c := &testCluster{
+		servers: make(map[string]*httptest.Server),
+		nodes:   make(map[string]*Node),
+		fsms:    make(map[string]*listFSM),
+		cancels: make(map[string]context.CancelFunc),
+	}
+	config.Peers = make(map[string]string)
+	for i := 0; i < size; i++ {
+		ID := fmt.Sprintf("n%d", i)
+		c.servers[ID] = httptest.NewServer(c.handler(ID))
+		config.Peers[ID] = c.servers[ID].URL
+	}
+	c.config = config
+	t.Cleanup(func() {
+		for ID := range c.servers {
+			c.stop(ID)
+		}
+	})
+	return c
+}
+
+func (c *testCluster) handler(ID string) http.Handler {
+	mux := http.NewServeMux()
+	handle := func(rpc string, serve func(n *Node, decoder *json.Decoder) (interface{}, error)) {
+		mux.HandleFunc("/raft/"+rpc, func(w http.ResponseWriter, r *http.Request) {
+			c.mu.Lock()
+			n := c.nodes[ID]
+			c.mu.Unlock()
+			if n == nil {
+				w.WriteHeader(503)
+				return
+			}
+			reply, err := serve(n, json.NewDecoder(r.Body))
+			if err != nil {
+				w.WriteHeader(400)
+				return
+			}
+			json.NewEncoder(w).Encode(reply)
+		})
+	}
+	handle("vote", func(n *Node, decoder *json.Decoder) (interface{}, error) {
+		var args RequestVoteArgs
+		err := decoder.Decode(&args)
+		return n.HandleRequestVote(args), err
+	})
+	handle("append", func(n *Node, decoder *json.Decoder) (interface{}, error) {
+		var args AppendEntriesArgs
+		err := decoder.Decode(&args)
+		return n.HandleAppendEntries(args), err
+	})
+	handle("snapshot", func(n *Node, decoder *json.Decoder) (interface{}, error) {
+		var args InstallSnapshotArgs
+		err := decoder.Decode(&args)
+		return n.HandleInstallSnapshot(args), err
+	})
+	return mux
+}
+
+func (c *testCluster) start(t *testing.T, ID string) {
+	config := c.config
+	config.ID = ID
+	fsm := &listFSM{}
+	n, err := NewNode(config, fsm)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c.mu.Lock()
+	c.nodes[ID] = n
+	c.fsms[ID] = fsm
+	c.cancels[ID] = cancel
+	c.mu.Unlock()
+	go n.Run(ctx)
+}
+
+// stop stops a node while leaving its port unreachable
+func (c *testCluster) stop(ID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cancel, ok := c.cancels[ID]; ok {
+		cancel()
+		delete(c.cancels, ID)
+	}
+	delete(c.nodes, ID)
+}
+
+// waitForLeader returns the ID of the only leader among running nodes
+func (c *testCluster) waitForLeader(t *testing.T) string {
+	deadline := time.Now().Add(time.Second * 10)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		leaders := make([]string, 0)
+		for ID, n := range c.nodes {
+			if n.IsLeader() {
+				leaders = append(leaders, ID)
+			}
+		}
+		c.mu.Unlock()
+		if len(leaders) == 1 {
+			return leaders[0]
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+	t.Fatal("no leader elected")
+	return ""
+}
+
+func (c *testCluster) propose(t *testing.T, commands ...string) {
+	for _, command := range commands {
+		leaderID := c.waitForLeader(t)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		_, err := c.nodes[leaderID].Propose(ctx, []byte(command))
+		cancel()
+		assert.NoError(t, err)
+	}
+}
+
+// waitForCommands waits until a node has applied the commands
+func (c *testCluster) waitForCommands(t *testing.T, ID string, commands []string) {
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual(commands, c.fsms[ID].get())
+	}, time.Second*5, time.Millisecond*20, "node %s applied %v", ID, c.fsms[ID].get())
+}
+
+func testConfig() Config {
+	config := DefaultConfig()
+	config.ElectionTimeout = time.Millisecond * 150
+	config.HeartbeatInterval = time.Millisecond * 30
+	return config
+}
+
+// TestReplicateAndFailover checks that committed commands reach every
+// node, and survive the leader stopping
+func TestReplicateAndFailover(t *testing.T) {
+	c := newTestCluster(t, 3, testConfig())
+	for ID := range c.servers {
+		c.start(t, ID)
+	}
+
+	c.propose(t, "a", "b", "c")
+	for ID := range c.servers {
+		c.waitForCommands(t, ID, []string{"a", "b", "c"})
+	}
+
+	oldLeaderID := c.waitForLeader(t)
+	c.stop(oldLeaderID)
+
+	c.propose(t, "d")
+	assert.NotEqual(t, oldLeaderID, c.waitForLeader(t))
+	for ID := range c.servers {
+		if ID != oldLeaderID {
+			c.waitForCommands(t, ID, []string{"a", "b", "c", "d"})
+		}
+	}
+
+	// a follower cannot propose
+	for ID, n := range c.nodes {
+		if ID != c.waitForLeader(t) {
+			_, err := n.Propose(context.Background(), []byte("e"))
+			assert.ErrorIs(t, err, ErrNotLeader)
+		}
+	}
+}
+
+// TestSnapshot checks that a node that joins after the log was
+// compacted catches up from the snapshot
+func TestSnapshot(t *testing.T) {
+	config := testConfig()
+	config.SnapshotThreshold = 3
+	c := newTestCluster(t, 3, config)
+	c.start(t, "n0")
+	c.start(t, "n1")
+
+	commands := []string{"a", "b", "c", "d", "e", "f", "g"}
+	c.propose(t, commands...)
+	c.waitForCommands(t, "n0", commands)
+	assert.Eventually(t, func() bool {
+		return c.nodes[c.waitForLeader(t)].Status().SnapshotIndex > 0
+	}, time.Second*5, time.Millisecond*20)
+
+	c.start(t, "n2")
+	c.waitForCommands(t, "n2", commands)
+	assert.Greater(t, c.nodes["n2"].Status().SnapshotIndex, uint64(0))
+}
+
+// TestRestart checks that a node recovers its log and
+// snapshot from disk
+func TestRestart(t *testing.T) {
+	config := testConfig()
+	config.SnapshotThreshold = 3
+	config.Dir = t.TempDir()
+	c := newTestCluster(t, 1, config)
+	c.start(t, "n0")
+
+	commands := []string{"a", "b", "c", "d", "e"}
+	c.propose(t, commands...)
+	c.waitForCommands(t, "n0", commands)
+	term := c.nodes["n0"].Status().Term
+
+	c.stop("n0")
+	c.start(t, "n0")
+	c.waitForCommands(t, "n0", commands)
+	c.waitForLeader(t)
+	assert.Greater(t, c.nodes["n0"].Status().Term, term)
+}
@@ -0,0 +1,136 @@
+package raft
+
+import "sort"
+
+// replicateToAll sends new entries, or a heartbeat, to every peer
+func (n *Node) replicateToAll() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.role != Leader {
+		return
+	}
+	for peerID := range n.config.Peers {
+		// one request in flight per peer, so entries are sent in order
+		if peerID == n.config.ID || n.replicating[peerID] {
+			continue
+		}
+		n.replicating[peerID] = true
+		go n.replicateTo(peerID, n.currentTerm)
+	}
+}
+
+// replicateTo sends a peer the entries from its next index,
+// or the snapshot if they have been compacted
+func (n *Node) replicateTo(peerID string, term uint64) {
+	defer func() {
+		n.mu.Lock()
+		n.replicating[peerID] = false
+		n.mu.Unlock()
+	}()
+
+	n.mu.Lock()
+	if n.role != Leader || n.currentTerm != term {
+		n.mu.Unlock()
+		return
+	}
+	next := n.nextIndex[peerID]
+	if next <= n.snapshotIndex {
+		args := InstallSnapshotArgs{
+			Term:              term,
+			LeaderID:          n.config.ID,
+			LastIncludedIndex: n.snapshotIndex,
+			LastIncludedTerm:  n.snapshotTerm,
+			Data:              n.snapshot,
+		}
+		n.mu.Unlock()
+
+		var reply InstallSnapshotReply
+		if err := n.call(peerID, "snapshot", args, &reply); err != nil {
+			return
+		}
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		if reply.Term > n.currentTerm {
+			n.stepDown(reply.Term)
+			return
+		}
+		if n.role != Leader || n.currentTerm != term {
+			return
+		}
+		n.matchIndex[peerID] = maxIndex(n.matchIndex[peerID], args.LastIncludedIndex)
+		n.nextIndex[peerID] = n.matchIndex[peerID] + 1
+		n.advanceCommitIndex()
+		return
+	}
+
+	prevIndex := next - 1
+	args := AppendEntriesArgs{
+		Term:         term,
+		LeaderID:     n.config.ID,
+		PrevLogIndex: prevIndex,
+		PrevLogTerm:  n.termAt(prevIndex),
+		Entries:      append([]Entry(nil), n.log[prevIndex-n.snapshotIndex:]...),
+		LeaderCommit: n.commitIndex,
+	}
+	n.mu.Unlock()
+
+	var reply AppendEntriesReply
+	if err := n.call(peerID, "append", args, &reply); err != nil {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if reply.Term > n.currentTerm {
+		n.stepDown(reply.Term)
+		return
+	}
+	if n.role != Leader || n.currentTerm != term {
+		return
+	}
+	if reply.Success {
+		n.matchIndex[peerID] = maxIndex(n.matchIndex[peerID], prevIndex+uint64(len(args.Entries)))
+		n.nextIndex[peerID] = n.matchIndex[peerID] + 1
+		n.advanceCommitIndex()
+		if n.nextIndex[peerID] <= n.lastIndex() {
+			n.notifyReplicate()
+		}
+		return
+	}
+	n.nextIndex[peerID] = maxIndex(1, minIndex(reply.ConflictIndex, next-1))
+	n.notifyReplicate()
+}
+
+// advanceCommitIndex commits the highest entry of the current term
+// stored on a majority. Caller must hold mu.
+func (n *Node) advanceCommitIndex() {
+	matched := []uint64{n.lastIndex()}
+	for peerID := range n.config.Peers {
+		if peerID != n.config.ID {
+			matched = append(matched, n.matchIndex[peerID])
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i] > matched[j] })
+	majority := matched[len(n.config.Peers)/2]
+
+	// entries of earlier terms are only committed indirectly
+	if majority > n.commitIndex && majority > n.snapshotIndex && n.termAt(majority) == n.currentTerm {
+		n.commitIndex = majority
+		n.notifyChanged()
+		n.notifyApply()
+	}
+}
+
+func maxIndex(a, b uint64) uint64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minIndex(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,201 @@
+package raft
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type RequestVoteArgs struct {
+	Term         uint64 `json:"term"`
+	CandidateID  string `json:"candidateId"`
+	LastLogIndex uint64 `json:"lastLogIndex"`
+	LastLogTerm  uint64 `json:"lastLogTerm"`
+}
+
+type RequestVoteReply struct {
+	Term        uint64 `json:"term"`
+	VoteGranted bool   `json:"voteGranted"`
+}
+
+type AppendEntriesArgs struct {
+	Term         uint64  `json:"term"`
+	LeaderID     string  `json:"leaderId"`
+	PrevLogIndex uint64  `json:"prevLogIndex"`
+	PrevLogTerm  uint64  `json:"prevLogTerm"`
+	Entries      []Entry `json:"entries"`
+	LeaderCommit uint64  `json:"leaderCommit"`
+}
+
+type AppendEntriesReply struct {
+	Term    uint64 `json:"term"`
+	Success bool   `json:"success"`
+	// ConflictIndex is where the leader should retry from on failure
+	ConflictIndex uint64 `json:"conflictIndex"`
+}
+
+type InstallSnapshotArgs struct {
+	Term              uint64 `json:"term"`
+	LeaderID          string `json:"leaderId"`
+	LastIncludedIndex uint64 `json:"lastIncludedIndex"`
+	LastIncludedTerm  uint64 `json:"lastIncludedTerm"`
+	Data              []byte `json:"data"`
+}
+
+type InstallSnapshotReply struct {
+	Term uint64 `json:"term"`
+}
+
+func (n *Node) HandleRequestVote(args RequestVoteArgs) RequestVoteReply {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if args.Term > n.currentTerm {
+		n.stepDown(args.Term)
+	}
+	reply := RequestVoteReply{Term: n.currentTerm}
+	if args.Term < n.currentTerm {
+		return reply
+	}
+
+	upToDate := args.LastLogTerm > n.lastTerm() ||
+		(args.LastLogTerm == n.lastTerm() && args.LastLogIndex >= n.lastIndex())
+	if (n.votedFor == "" || n.votedFor == args.CandidateID) && upToDate {
+		n.votedFor = args.CandidateID
+		if err := n.persist(); err != nil {
+			return reply
+		}
+		n.resetElectionDeadline()
+		reply.VoteGranted = true
+	}
+	return reply
+}
+
+func (n *Node) HandleAppendEntries(args AppendEntriesArgs) AppendEntriesReply {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if args.Term < n.currentTerm {
+		return AppendEntriesReply{Term: n.currentTerm}
+	}
+	if args.Term > n.currentTerm || n.role != Follower {
+		n.stepDown(args.Term)
+	}
+	n.leaderID = args.LeaderID
+	n.resetElectionDeadline()
+	reply := AppendEntriesReply{Term: n.currentTerm}
+
+	// entries already compacted into the snapshot are committed
+	entries := args.Entries
+	prevIndex, prevTerm := args.PrevLogIndex, args.PrevLogTerm
+	for len(entries) > 0 && prevIndex < n.snapshotIndex {
+		prevIndex, prevTerm = entries[0].Index, entries[0].Term
+		entries = entries[1:]
+	}
+	if prevIndex < n.snapshotIndex {
+		reply.ConflictIndex = n.snapshotIndex + 1
+		return reply
+	}
+
+	if prevIndex > n.lastIndex() {
+		reply.ConflictIndex = n.lastIndex() + 1
+		return reply
+	}
+	if n.termAt(prevIndex) != prevTerm {
+		// skip back over the whole conflicting term
+		conflictTerm := n.termAt(prevIndex)
+		index := prevIndex
+		for index > n.snapshotIndex+1 && n.termAt(index-1) == conflictTerm {
+			index--
+		}
+		reply.ConflictIndex = index
+		return reply
+	}
+
+	changed := false
+	for i, entry := range entries {
+		if entry.Index <= n.lastIndex() {
+			if n.termAt(entry.Index) == entry.Term {
+				continue
+			}
+			n.log = n.log[:entry.Index-n.snapshotIndex-1]
+		}
+		n.log = append(n.log, entries[i:]...)
+		changed = true
+		break
+	}
+	if changed {
+		if err := n.persist(); err != nil {
+			return reply
+		}
+	}
+
+	lastNew := prevIndex + uint64(len(entries))
+	if args.LeaderCommit > n.commitIndex {
+		n.commitIndex = minIndex(args.LeaderCommit, lastNew)
+		n.notifyChanged()
+		n.notifyApply()
+	}
+	reply.Success = true
+	return reply
+}
+
+func (n *Node) HandleInstallSnapshot(args InstallSnapshotArgs) InstallSnapshotReply {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if args.Term < n.currentTerm {
+		return InstallSnapshotReply{Term: n.currentTerm}
+	}
+	if args.Term > n.currentTerm || n.role != Follower {
+		n.stepDown(args.Term)
+	}
+	n.leaderID = args.LeaderID
+	n.resetElectionDeadline()
+	reply := InstallSnapshotReply{Term: n.currentTerm}
+
+	if args.LastIncludedIndex <= n.snapshotIndex {
+		return reply
+	}
+
+	// keep entries following the snapshot if they agree with it
+	if args.LastIncludedIndex < n.lastIndex() && n.termAt(args.LastIncludedIndex) == args.LastIncludedTerm {
+		n.log = append([]Entry(nil), n.log[args.LastIncludedIndex-n.snapshotIndex:]...)
+	} else {
+		n.log = nil
+	}
+	n.snapshotIndex = args.LastIncludedIndex
+	n.snapshotTerm = args.LastIncludedTerm
+	n.snapshot = args.Data
+	if err := n.persist(); err != nil {
+		return reply
+	}
+	if n.commitIndex < n.snapshotIndex {
+		n.commitIndex = n.snapshotIndex
+	}
+	if n.lastApplied < n.snapshotIndex {
+		n.restorePending = true
+		n.notifyApply()
+	}
+	n.notifyChanged()
+	return reply
+}
+
+// call sends an RPC to a peer
+func (n *Node) call(peerID, rpc string, args, reply interface{}) error {
+	body, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/raft/%s", n.config.Peers[peerID], rpc)
+	resp, err := n.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("raft %s to %s: unexpected status: %d", rpc, peerID, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(reply)
+}
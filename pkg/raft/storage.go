@@ -0,0 +1,79 @@
+package raft
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+const stateFile = "raft-state.json"
+
+type persistentState struct {
+	CurrentTerm   uint64  `json:"currentTerm"`
+	VotedFor      string  `json:"votedFor"`
+	Log           []Entry `json:"log"`
+	SnapshotIndex uint64  `json:"snapshotIndex"`
+	SnapshotTerm  uint64  `json:"snapshotTerm"`
+	Snapshot      []byte  `json:"snapshot,omitempty"`
+}
+
+// storage keeps the persistent state in a single file, rewritten
+// atomically on every change. The state is small because the log
+// is compacted into snapshots.
+type storage struct {
+	dir string
+}
+
+func openStorage(dir string) (*storage, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &storage{dir: dir}, nil
+}
+
+func (s *storage) load() (persistentState, error) {
+	state := persistentState{}
+	if s.dir == "" {
+		return state, nil
+	}
+	b, err := os.ReadFile(filepath.Join(s.dir, stateFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(b, &state)
+	return state, err
+}
+
+func (s *storage) save(state persistentState) error {
+	if s.dir == "" {
+		return nil
+	}
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, stateFile)
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
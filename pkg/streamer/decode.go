@@ -4,23 +4,31 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"keepair/pkg/common"
 )
 
 func DecodeMessage(line string) (common.Entry, error) {
-	parts := strings.SplitN(line, Seperator, 2)
-	if len(parts) != 2 {
+	parts := strings.SplitN(line, Seperator, 4)
+	if len(parts) != 4 {
 		return common.Entry{}, errors.New("line has invalid number of segments")
 	}
 	k := parts[0]
-	v, err := base64.StdEncoding.DecodeString(parts[1])
+	t := common.ValueType(parts[1])
+	ts, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return common.Entry{}, fmt.Errorf("failed to decode timestamp: %w", err)
+	}
+	v, err := base64.StdEncoding.DecodeString(parts[3])
 	if err != nil {
 		return common.Entry{}, fmt.Errorf("failed to decode message: %w", err)
 	}
 	return common.Entry{
-		Key:   k,
-		Value: v,
+		Key:       k,
+		Value:     v,
+		Type:      t,
+		Timestamp: ts,
 	}, nil
 }
@@ -10,11 +10,13 @@ import (
 
 const Seperator = ","
 
+// EncodeMessage encodes an entry as a single line
+// in the format: key,type,timestamp,base64(value)
 func EncodeMessage(entry common.Entry) (string, error) {
 	k := entry.Key
 	if strings.Contains(k, Seperator) {
 		return "", fmt.Errorf("key cannot contain '%s' character", Seperator)
 	}
 	v := base64.StdEncoding.EncodeToString(entry.Value)
-	return fmt.Sprintf("%s%s%s\n", k, Seperator, v), nil
+	return fmt.Sprintf("%s%s%s%s%d%s%s\n", k, Seperator, entry.Type, Seperator, entry.Timestamp, Seperator, v), nil
 }
@@ -1,3 +1,41 @@
 package values
 
 const StreamBufferSize = 1024 * 1024 * 4
+
+// ChangeFeedSubscriberBufferSize is the number of events buffered
+// per subscriber before it is considered too slow and dropped
+const ChangeFeedSubscriberBufferSize = 1024
+
+// ReplicasHeader lists the URLs of the follower replicas that a
+// worker must forward a write to before acknowledging it
+const ReplicasHeader = "X-Keepair-Replicas"
+
+// FailedReplicasHeader lists the URLs of the follower replicas that
+// missed a write the leader replica applied, along with the
+// TimestampHeader of the write, so they can be sent it later
+const FailedReplicasHeader = "X-Keepair-Failed-Replicas"
+
+// TimestampHeader carries the time a leaderless write was made at, so
+// every replica stores it with the same version
+const TimestampHeader = "X-Keepair-Timestamp"
+
+// DigestBuckets is the number of buckets of keys in
+// a worker's Merkle tree
+const DigestBuckets = 1024
+
+// GenerationHeader identifies a run of a primary process. Workers
+// re-register when it changes, as the primary may have forgotten them.
+const GenerationHeader = "X-Keepair-Generation"
+
+// EpochHeader carries the epoch of the partition assignment a
+// redirect or an assignment push was made with
+const EpochHeader = "X-Keepair-Epoch"
+
+// RedirectHeader is set to MOVED or ASK on the response of a
+// worker that does not serve the key it was asked for. The
+// node to ask instead is in the Location header.
+const RedirectHeader = "X-Keepair-Redirect"
+
+// AskingHeader marks a request that follows an ASK redirect,
+// which the new owner of a migrating key accepts
+const AskingHeader = "X-Keepair-Asking"
@@ -0,0 +1,178 @@
+package changefeed
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"keepair/pkg/common"
+	"keepair/pkg/log"
+	"keepair/pkg/values"
+	"keepair/pkg/worker/changelog"
+)
+
+type CancelFunc func()
+
+// Feed assigns sequence numbers to change events, records them
+// in a change log and fans them out to subscribers
+type Feed struct {
+	WorkerID string
+	Log      changelog.Log
+
+	mu          sync.Mutex
+	seq         uint64
+	subscribers map[int]chan common.ChangeEvent
+	nextSubID   int
+}
+
+// NewFeed creates a feed whose sequence numbers continue
+// from the last event in changeLog
+func NewFeed(workerID string, changeLog changelog.Log) *Feed {
+	return &Feed{
+		WorkerID:    workerID,
+		Log:         changeLog,
+		seq:         changeLog.LastSeq(),
+		subscribers: make(map[int]chan common.ChangeEvent),
+	}
+}
+
+// Publish records a change to an entry and sends it to all
+// subscribers. It never blocks: a subscriber whose buffer is full
+// is dropped, and can resume from the last sequence it received.
+// A change that cannot be recorded in the change log is not sent,
+// and the error is returned to fail the write that made it.
+func (f *Feed) Publish(action common.EntryOperationAction, entry common.Entry, origin common.ChangeOrigin) (common.ChangeEvent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	event := common.ChangeEvent{
+		Seq:      f.seq + 1,
+		WorkerID: f.WorkerID,
+		Action:   action,
+		Key:      entry.Key,
+		Value:    entry.Value,
+		Type:     entry.Type,
+		Origin:   origin,
+		Time:     time.Now(),
+	}
+
+	if err := f.Log.Append(event); err != nil {
+		return common.ChangeEvent{}, fmt.Errorf("failed to append to change log: %w", err)
+	}
+	f.seq = event.Seq
+
+	for id, ch := range f.subscribers {
+		select {
+		case ch <- event:
+		default:
+			close(ch)
+			delete(f.subscribers, id)
+		}
+	}
+
+	return event, nil
+}
+
+// Seq returns the sequence number of the latest event
+func (f *Feed) Seq() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.seq
+}
+
+// backlogPageSize is the number of events a
+// subscription reads from the change log at a time
+const backlogPageSize = 256
+
+// Subscribe returns the events after since, followed by new events
+// as they are published. If events after since are no longer in the
+// change log, a CompactedChange event comes first. The backlog is
+// read from the change log a page at a time without holding up
+// Publish, while new events are buffered. The channel is closed when
+// the subscription is cancelled or falls too far behind.
+func (f *Feed) Subscribe(since uint64) (<-chan common.ChangeEvent, CancelFunc) {
+	f.mu.Lock()
+	live := make(chan common.ChangeEvent, values.ChangeFeedSubscriberBufferSize)
+	id := f.nextSubID
+	f.nextSubID++
+	f.subscribers[id] = live
+	// events after upTo are sent to live
+	upTo := f.seq
+	f.mu.Unlock()
+
+	ch := make(chan common.ChangeEvent, values.ChangeFeedSubscriberBufferSize)
+	done := make(chan struct{})
+	go func() {
+		defer close(ch)
+		if !f.sendBacklog(ch, done, since, upTo) {
+			return
+		}
+		for event := range live {
+			select {
+			case ch <- event:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	once := sync.Once{}
+	return ch, func() {
+		once.Do(func() { close(done) })
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if _, ok := f.subscribers[id]; ok {
+			close(live)
+			delete(f.subscribers, id)
+		}
+	}
+}
+
+// sendBacklog sends the events of the change log after since up to
+// upTo. It returns false if the subscription was cancelled, or the
+// change log could not be read.
+func (f *Feed) sendBacklog(ch chan<- common.ChangeEvent, done <-chan struct{}, since uint64, upTo uint64) bool {
+	send := func(event common.ChangeEvent) bool {
+		select {
+		case ch <- event:
+			return true
+		case <-done:
+			return false
+		}
+	}
+
+	for since < upTo {
+		// events may expire between pages
+		if firstSeq := f.Log.FirstSeq(); since+1 < firstSeq {
+			compacted := common.ChangeEvent{
+				Seq:      firstSeq - 1,
+				WorkerID: f.WorkerID,
+				Action:   common.CompactedChange,
+				Time:     time.Now(),
+			}
+			if !send(compacted) {
+				return false
+			}
+			since = compacted.Seq
+			continue
+		}
+		events, err := f.Log.Since(since, backlogPageSize)
+		if err != nil {
+			log.Get().Printf("[%s] failed to read change log: %s", f.WorkerID, err)
+			return false
+		}
+		if len(events) == 0 {
+			return true
+		}
+		for _, event := range events {
+			if event.Seq > upTo {
+				return true
+			}
+			if !send(event) {
+				return false
+			}
+			since = event.Seq
+		}
+	}
+	return true
+}
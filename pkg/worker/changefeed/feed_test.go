@@ -0,0 +1,71 @@
+package changefeed
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"keepair/pkg/common"
+	"keepair/pkg/worker/changelog"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingLog is a change log that cannot be written to
+type failingLog struct {
+	changelog.Log
+}
+
+func (l failingLog) Append(event common.ChangeEvent) error {
+	return errors.New("disk full")
+}
+
+func TestSubscribeBacklog(t *testing.T) {
+	config := changelog.DefaultConfig()
+	feed := NewFeed("worker", changelog.NewMemoryLog(config))
+
+	// a backlog of several pages
+	numEvents := backlogPageSize*2 + 10
+	for i := 0; i < numEvents; i++ {
+		_, err := feed.Publish(common.SetEntry, common.Entry{Key: fmt.Sprintf("key-%d", i)}, common.ClientOrigin)
+		assert.NoError(t, err)
+	}
+
+	ch, cancel := feed.Subscribe(5)
+	defer cancel()
+
+	// events published while the backlog is read follow it
+	_, err := feed.Publish(common.SetEntry, common.Entry{Key: "live"}, common.ClientOrigin)
+	assert.NoError(t, err)
+
+	next := uint64(6)
+	for next <= uint64(numEvents+1) {
+		select {
+		case event, ok := <-ch:
+			if !assert.True(t, ok) {
+				return
+			}
+			assert.Equal(t, next, event.Seq)
+			next++
+		case <-time.After(time.Second):
+			t.Fatalf("missing event %d", next)
+		}
+	}
+}
+
+func TestPublishAppendError(t *testing.T) {
+	feed := NewFeed("worker", failingLog{changelog.NewMemoryLog(changelog.DefaultConfig())})
+	ch, cancel := feed.Subscribe(0)
+	defer cancel()
+
+	_, err := feed.Publish(common.SetEntry, common.Entry{Key: "key"}, common.ClientOrigin)
+	assert.ErrorContains(t, err, "disk full")
+	assert.Equal(t, uint64(0), feed.Seq())
+
+	select {
+	case event := <-ch:
+		t.Fatalf("unexpected event %d", event.Seq)
+	case <-time.After(time.Millisecond * 50):
+	}
+}
@@ -0,0 +1,64 @@
+package changelog
+
+import (
+	"time"
+
+	"keepair/pkg/common"
+)
+
+// Log is an ordered log of change events. Events must be appended
+// in sequence order. Old events may be dropped according to the
+// retention settings, so FirstSeq can move forward over time.
+type Log interface {
+	Append(event common.ChangeEvent) error
+	// Since returns up to limit events with a sequence number
+	// greater than seq. A limit of 0 returns all of them.
+	Since(seq uint64, limit int) ([]common.ChangeEvent, error)
+	// FirstSeq returns the sequence number of the oldest
+	// retained event, or LastSeq()+1 if the log is empty
+	FirstSeq() uint64
+	LastSeq() uint64
+	Close() error
+}
+
+type Config struct {
+	// Dir is the directory of the log's files. The log is
+	// kept in memory only if Dir is empty.
+	Dir string
+	// MaxEvents is the number of most recent events to
+	// retain, or 0 to not limit by count
+	MaxEvents int
+	// MaxAge is how long to retain events,
+	// or 0 to not limit by age
+	MaxAge time.Duration
+	// SyncWrites calls fsync after every append
+	SyncWrites bool
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Dir:       "",
+		MaxEvents: 10_000,
+		MaxAge:    0,
+	}
+}
+
+// Open opens the log described by config
+func Open(config Config) (Log, error) {
+	if config.Dir == "" {
+		return NewMemoryLog(config), nil
+	}
+	return OpenFileLog(config)
+}
+
+// isExpired reports whether an event falls outside the retention
+// window, given the newest sequence number in the log
+func isExpired(config Config, event common.ChangeEvent, lastSeq uint64, now time.Time) bool {
+	if config.MaxEvents > 0 && lastSeq-event.Seq >= uint64(config.MaxEvents) {
+		return true
+	}
+	if config.MaxAge > 0 && now.Sub(event.Time) > config.MaxAge {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,256 @@
+package changelog
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"keepair/pkg/common"
+	"keepair/pkg/values"
+)
+
+const segmentExtension = ".log"
+
+// segmentSize is the number of events written to a segment file
+// before starting a new one. Retention drops whole segments.
+const segmentSize = 1_000
+
+type segment struct {
+	path     string
+	firstSeq uint64
+	lastSeq  uint64
+	lastTime time.Time
+	count    int
+}
+
+// FileLog appends events as JSON lines to segment files in a
+// directory, named after the first sequence number they hold.
+// The log is reloaded from the directory when reopened, so
+// sequence numbers continue after a restart.
+type FileLog struct {
+	Config Config
+
+	mu       sync.RWMutex
+	segments []*segment
+	current  *os.File
+	lastSeq  uint64
+}
+
+func OpenFileLog(config Config) (*FileLog, error) {
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create change log dir: %w", err)
+	}
+
+	l := &FileLog{
+		Config:   config,
+		segments: make([]*segment, 0),
+	}
+
+	paths, err := filepath.Glob(filepath.Join(config.Dir, "*"+segmentExtension))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), segmentExtension)
+		firstSeq, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		l.segments = append(l.segments, &segment{path: path, firstSeq: firstSeq})
+	}
+	sort.Slice(l.segments, func(i, j int) bool {
+		return l.segments[i].firstSeq < l.segments[j].firstSeq
+	})
+
+	for i, s := range l.segments {
+		events, validSize, err := readSegment(s.path)
+		if err != nil {
+			return nil, err
+		}
+		// drop a torn write at the end of the last segment,
+		// which was never acknowledged
+		if i == len(l.segments)-1 {
+			if err := os.Truncate(s.path, validSize); err != nil {
+				return nil, fmt.Errorf("failed to truncate change log segment: %w", err)
+			}
+		}
+		s.count = len(events)
+		s.lastSeq = s.firstSeq - 1
+		if len(events) > 0 {
+			last := events[len(events)-1]
+			s.lastSeq = last.Seq
+			s.lastTime = last.Time
+			l.lastSeq = last.Seq
+		}
+	}
+
+	if len(l.segments) > 0 {
+		last := l.segments[len(l.segments)-1]
+		f, err := os.OpenFile(last.path, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open change log segment: %w", err)
+		}
+		l.current = f
+	}
+
+	return l, nil
+}
+
+// readSegment returns the events of a segment file and the size
+// in bytes of the complete lines they were read from
+func readSegment(path string) ([]common.ChangeEvent, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open change log segment: %w", err)
+	}
+	defer f.Close()
+
+	events := make([]common.ChangeEvent, 0)
+	validSize := int64(0)
+	reader := bufio.NewReaderSize(f, values.StreamBufferSize)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// an incomplete last line is ignored
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read change log segment: %w", err)
+		}
+		var event common.ChangeEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			break
+		}
+		events = append(events, event)
+		validSize += int64(len(line))
+	}
+	return events, validSize, nil
+}
+
+func (l *FileLog) Append(event common.ChangeEvent) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.current == nil || l.segments[len(l.segments)-1].count >= segmentSize {
+		if err := l.startSegment(event.Seq); err != nil {
+			return err
+		}
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err := l.current.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write change log: %w", err)
+	}
+	if l.Config.SyncWrites {
+		if err := l.current.Sync(); err != nil {
+			return fmt.Errorf("failed to sync change log: %w", err)
+		}
+	}
+
+	s := l.segments[len(l.segments)-1]
+	s.count++
+	s.lastSeq = event.Seq
+	s.lastTime = event.Time
+	l.lastSeq = event.Seq
+
+	return nil
+}
+
+// startSegment closes the current segment, starts a new one
+// and applies retention to the closed segments.
+// Caller must handle locks.
+func (l *FileLog) startSegment(firstSeq uint64) error {
+	if l.current != nil {
+		if err := l.current.Close(); err != nil {
+			return err
+		}
+	}
+	path := filepath.Join(l.Config.Dir, fmt.Sprintf("%020d%s", firstSeq, segmentExtension))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create change log segment: %w", err)
+	}
+	l.current = f
+	l.segments = append(l.segments, &segment{path: path, firstSeq: firstSeq, lastSeq: firstSeq - 1})
+
+	// a segment is dropped once its newest event has expired
+	now := time.Now()
+	for len(l.segments) > 1 {
+		oldest := l.segments[0]
+		newest := common.ChangeEvent{Seq: oldest.lastSeq, Time: oldest.lastTime}
+		if !isExpired(l.Config, newest, firstSeq, now) {
+			break
+		}
+		if err := os.Remove(oldest.path); err != nil {
+			return fmt.Errorf("failed to remove change log segment: %w", err)
+		}
+		l.segments = l.segments[1:]
+	}
+	return nil
+}
+
+func (l *FileLog) Since(seq uint64, limit int) ([]common.ChangeEvent, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	events := make([]common.ChangeEvent, 0)
+	for _, s := range l.segments {
+		if s.lastSeq <= seq {
+			continue
+		}
+		segmentEvents, _, err := readSegment(s.path)
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range segmentEvents {
+			if event.Seq <= seq {
+				continue
+			}
+			if limit > 0 && len(events) >= limit {
+				return events, nil
+			}
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (l *FileLog) FirstSeq() uint64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, s := range l.segments {
+		if s.count > 0 {
+			return s.firstSeq
+		}
+	}
+	return l.lastSeq + 1
+}
+
+func (l *FileLog) LastSeq() uint64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.lastSeq
+}
+
+func (l *FileLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.current == nil {
+		return nil
+	}
+	err := l.current.Close()
+	l.current = nil
+	return err
+}
@@ -0,0 +1,87 @@
+package changelog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"keepair/pkg/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func appendEvents(t *testing.T, l Log, from, to uint64) {
+	for seq := from; seq <= to; seq++ {
+		err := l.Append(common.ChangeEvent{
+			Seq:    seq,
+			Action: common.SetEntry,
+			Key:    "key",
+			Value:  []byte("value"),
+			Time:   time.Now(),
+		})
+		assert.NoError(t, err)
+	}
+}
+
+// TestFileLogReopen checks that events survive reopening the
+// log, including after a torn write
+func TestFileLogReopen(t *testing.T) {
+
+	config := DefaultConfig()
+	config.Dir = t.TempDir()
+
+	l, err := OpenFileLog(config)
+	assert.NoError(t, err)
+	appendEvents(t, l, 1, 10)
+	assert.NoError(t, l.Close())
+
+	// simulate a crash in the middle of a write
+	segmentPath := filepath.Join(config.Dir, "00000000000000000001.log")
+	f, err := os.OpenFile(segmentPath, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = f.WriteString(`{"seq":11,"act`)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	l, err = OpenFileLog(config)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), l.FirstSeq())
+	assert.Equal(t, uint64(10), l.LastSeq())
+
+	appendEvents(t, l, 11, 12)
+	events, err := l.Since(8, 0)
+	assert.NoError(t, err)
+	assert.Len(t, events, 4)
+	for i, event := range events {
+		assert.Equal(t, uint64(9+i), event.Seq)
+	}
+
+	events, err = l.Since(0, 3)
+	assert.NoError(t, err)
+	assert.Len(t, events, 3)
+	assert.NoError(t, l.Close())
+}
+
+// TestFileLogRetention checks that whole segments are dropped
+// once all of their events are outside the retention window
+func TestFileLogRetention(t *testing.T) {
+
+	config := DefaultConfig()
+	config.Dir = t.TempDir()
+	config.MaxEvents = segmentSize
+
+	l, err := OpenFileLog(config)
+	assert.NoError(t, err)
+	appendEvents(t, l, 1, segmentSize*2+segmentSize/2)
+
+	assert.Equal(t, uint64(segmentSize+1), l.FirstSeq())
+	paths, err := filepath.Glob(filepath.Join(config.Dir, "*"+segmentExtension))
+	assert.NoError(t, err)
+	assert.Len(t, paths, 2)
+
+	events, err := l.Since(0, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(segmentSize+1), events[0].Seq)
+	assert.NoError(t, l.Close())
+}
@@ -0,0 +1,78 @@
+package changelog
+
+import (
+	"sync"
+	"time"
+
+	"keepair/pkg/common"
+)
+
+// MemoryLog keeps the retained events in memory
+type MemoryLog struct {
+	Config Config
+
+	mu      sync.RWMutex
+	events  []common.ChangeEvent
+	lastSeq uint64
+}
+
+func NewMemoryLog(config Config) *MemoryLog {
+	return &MemoryLog{
+		Config: config,
+		events: make([]common.ChangeEvent, 0),
+	}
+}
+
+func (l *MemoryLog) Append(event common.ChangeEvent) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.events = append(l.events, event)
+	l.lastSeq = event.Seq
+
+	// drop expired events from the front
+	now := time.Now()
+	expired := 0
+	for expired < len(l.events) && isExpired(l.Config, l.events[expired], l.lastSeq, now) {
+		expired++
+	}
+	// the dropped head is reclaimed the next time append grows the slice
+	l.events = l.events[expired:]
+	return nil
+}
+
+func (l *MemoryLog) Since(seq uint64, limit int) ([]common.ChangeEvent, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	events := make([]common.ChangeEvent, 0)
+	for _, event := range l.events {
+		if event.Seq <= seq {
+			continue
+		}
+		if limit > 0 && len(events) >= limit {
+			break
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func (l *MemoryLog) FirstSeq() uint64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if len(l.events) == 0 {
+		return l.lastSeq + 1
+	}
+	return l.events[0].Seq
+}
+
+func (l *MemoryLog) LastSeq() uint64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.lastSeq
+}
+
+func (l *MemoryLog) Close() error {
+	return nil
+}
@@ -0,0 +1,28 @@
+package worker
+
+import (
+	"time"
+
+	"keepair/pkg/gossip"
+	"keepair/pkg/worker/changelog"
+)
+
+type Config struct {
+	ChangeLog changelog.Config
+	// Gossip detects failures of the other workers
+	Gossip gossip.Config
+	// TombstoneTTL is how long a versioned delete is kept, so that
+	// older writes of its key brought back by hints, read repair or
+	// an anti-entropy sync are rejected. It should be longer than the
+	// primary keeps hints. Zero keeps tombstones forever.
+	TombstoneTTL time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		ChangeLog: changelog.DefaultConfig(),
+		Gossip:    gossip.DefaultConfig(),
+		// twice the default MaxAge of hints
+		TombstoneTTL: time.Hour * 2,
+	}
+}
@@ -1,15 +1,22 @@
 package endpoints
 
 import (
+	"keepair/pkg/worker/ownership"
 	"keepair/pkg/worker/store"
 
 	"github.com/gin-gonic/gin"
 )
 
-var ApplyOperationsHandler = func(store store.IStore) gin.HandlerFunc {
+// ApplyOperationsHandler applies the operations of the requested queue.
+// With keepNewer, keys written after their queued copies were made
+// are kept.
+var ApplyOperationsHandler = func(store store.IStore, ownership *ownership.Ownership) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		if err := store.ApplyOperations(); err != nil {
+		// writes replicated while a rebalance runs are newer than
+		// the copies streamed before them
+		keepNewer := c.Query("keepNewer") == "true" || ownership.Migrating()
+		if err := store.ApplyOperations(c.Query("queue"), keepNewer); err != nil {
 			c.Data(500, "", []byte(err.Error()))
 			return
 		}
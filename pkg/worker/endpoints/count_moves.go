@@ -0,0 +1,28 @@
+package endpoints
+
+import (
+	"keepair/pkg/partition"
+	"keepair/pkg/worker/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CountMovesHandler counts the keys and bytes the worker would copy
+// and drop if keys moved from the placement of the requested
+// assignment to its next one, without moving anything
+var CountMovesHandler = func(workerID string, store store.IStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		req, ok := bindTransferRequest(c)
+		if !ok {
+			return
+		}
+
+		counter := partition.NewMoveCounter(workerID, req.Assignment, req.Skip)
+		for entry := range store.StreamEntries() {
+			counter.Add(entry.Key, len(entry.Value))
+		}
+
+		c.JSON(200, gin.H{"moves": counter.Moves()})
+	}
+}
@@ -1,7 +1,10 @@
 package endpoints
 
 import (
+	"strconv"
+
 	"keepair/pkg/log"
+	"keepair/pkg/values"
 	"keepair/pkg/worker/store"
 
 	"github.com/gin-gonic/gin"
@@ -16,6 +19,21 @@ var DeleteKeyHandler = func(workerID string, store store.IStore) gin.HandlerFunc
 			return
 		}
 
+		// leaderless deletes are only applied if they are newer
+		if header := c.GetHeader(values.TimestampHeader); header != "" {
+			timestamp, err := strconv.ParseInt(header, 10, 64)
+			if err != nil {
+				c.Data(400, "", []byte("invalid timestamp"))
+				return
+			}
+			if _, err := store.DeleteVersioned(key, timestamp); err != nil {
+				c.Data(500, "", []byte(err.Error()))
+				return
+			}
+			c.Data(200, "", []byte("ok"))
+			return
+		}
+
 		log.Get().Printf("DELETE: %s on %s", key, workerID)
 		if err := store.Delete(key); err != nil {
 			c.Data(500, "", []byte(err.Error()))
@@ -0,0 +1,61 @@
+package endpoints
+
+import (
+	"strconv"
+
+	"keepair/pkg/common"
+	"keepair/pkg/worker/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetDigestHandler returns the root and bucket hashes
+// of the worker's Merkle tree
+var GetDigestHandler = func(store store.IStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(200, store.GetDigest())
+	}
+}
+
+// GetBucketDigestHandler returns the hash of each key in a bucket
+var GetBucketDigestHandler = func(store store.IStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		bucket, err := strconv.Atoi(c.Param("bucket"))
+		if err != nil {
+			c.Data(400, "", []byte("invalid bucket"))
+			return
+		}
+
+		keys, err := store.GetBucketDigest(bucket)
+		if err != nil {
+			c.Data(common.ErrorStatus(err), "", []byte(err.Error()))
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"keys": keys,
+		})
+	}
+}
+
+// GetEntryHandler returns the entry of a key, whether it
+// holds a plain value or a collection
+var GetEntryHandler = func(store store.IStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		key := c.Param("key")
+		if key == "" {
+			c.Data(400, "", []byte("empty key"))
+			return
+		}
+
+		entry, ok := store.GetEntry(key)
+		if !ok {
+			c.Data(404, "", []byte("no value found for key: "+key))
+			return
+		}
+
+		c.JSON(200, entry)
+	}
+}
@@ -0,0 +1,48 @@
+package endpoints
+
+import (
+	"strconv"
+
+	"keepair/pkg/worker/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultChangesLimit = 1_000
+const maxChangesLimit = 10_000
+
+// GetChangesHandler returns the changes made after the "since"
+// sequence number in order. If older changes were requested than
+// the log retains, "compacted" is true and the consumer must
+// resync, e.g. from /stream-entries.
+var GetChangesHandler = func(store store.IStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		since, err := strconv.ParseUint(c.DefaultQuery("since", "0"), 10, 64)
+		if err != nil {
+			c.Data(400, "", []byte("invalid since"))
+			return
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultChangesLimit)))
+		if err != nil || limit <= 0 || limit > maxChangesLimit {
+			c.Data(400, "", []byte("invalid limit"))
+			return
+		}
+
+		changeLog := store.ChangeLog()
+		firstSeq := changeLog.FirstSeq()
+		lastSeq := changeLog.LastSeq()
+		changes, err := changeLog.Since(since, limit)
+		if err != nil {
+			c.Data(500, "", []byte(err.Error()))
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"changes":   changes,
+			"firstSeq":  firstSeq,
+			"lastSeq":   lastSeq,
+			"compacted": since < lastSeq && since+1 < firstSeq,
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package endpoints
 
 import (
+	"keepair/pkg/common"
 	"keepair/pkg/worker/store"
 
 	"github.com/gin-gonic/gin"
@@ -15,9 +16,20 @@ var GetKeyHandler = func(store store.IStore) gin.HandlerFunc {
 			return
 		}
 
+		// return a sub-document of a JSON value
+		if path := c.Query("path"); path != "" {
+			value, err := store.GetPath(key, path)
+			if err != nil {
+				c.Data(common.ErrorStatus(err), "", []byte(err.Error()))
+				return
+			}
+			c.Data(200, "application/json", value)
+			return
+		}
+
 		value, err := store.Get(key)
 		if err != nil {
-			c.Data(500, "", []byte(err.Error()))
+			c.Data(common.ErrorStatus(err), "", []byte(err.Error()))
 			return
 		}
 
@@ -0,0 +1,29 @@
+package endpoints
+
+import (
+	"keepair/pkg/common"
+	"keepair/pkg/worker/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetVersionHandler returns the value of a key with its timestamp,
+// or the timestamp it was deleted at
+var GetVersionHandler = func(store store.IStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		key := c.Param("key")
+		if key == "" {
+			c.Data(400, "", []byte("empty key"))
+			return
+		}
+
+		version, err := store.GetVersioned(key)
+		if err != nil {
+			c.Data(common.ErrorStatus(err), "", []byte(err.Error()))
+			return
+		}
+
+		c.JSON(200, version)
+	}
+}
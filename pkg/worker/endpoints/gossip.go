@@ -0,0 +1,44 @@
+package endpoints
+
+import (
+	"keepair/pkg/gossip"
+
+	"github.com/gin-gonic/gin"
+)
+
+var GossipPingHandler = func(g *gossip.Gossip) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var msg gossip.Message
+		if err := c.ShouldBindJSON(&msg); err != nil {
+			c.Data(400, "", []byte(err.Error()))
+			return
+		}
+		c.JSON(200, g.HandlePing(msg))
+	}
+}
+
+// GossipPingReqHandler probes another worker on behalf of
+// one that could not reach it directly
+var GossipPingReqHandler = func(g *gossip.Gossip) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body gossip.PingReqBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.Data(400, "", []byte(err.Error()))
+			return
+		}
+		ack, err := g.HandlePingReq(c.Request.Context(), body.Target, body.Message)
+		if err != nil {
+			c.Data(502, "", []byte(err.Error()))
+			return
+		}
+		c.JSON(200, ack)
+	}
+}
+
+var GossipMembersHandler = func(g *gossip.Gossip) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"members": g.Members(),
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package endpoints
+
+import (
+	"keepair/pkg/common"
+	"keepair/pkg/worker/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HashSetBody struct {
+	Fields map[string]string `json:"fields" binding:"required"`
+}
+
+var HashSetHandler = func(store store.IStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		key := c.Param("key")
+		if key == "" {
+			c.Data(400, "", []byte("empty key"))
+			return
+		}
+
+		var body HashSetBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.Data(400, "", []byte(err.Error()))
+			return
+		}
+
+		added, err := store.HashSet(key, body.Fields)
+		if err != nil {
+			c.Data(common.ErrorStatus(err), "", []byte(err.Error()))
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"added": added,
+		})
+	}
+}
+
+var HashGetHandler = func(store store.IStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		key := c.Param("key")
+		if key == "" {
+			c.Data(400, "", []byte("empty key"))
+			return
+		}
+
+		value, err := store.HashGet(key, c.Param("field"))
+		if err != nil {
+			c.Data(common.ErrorStatus(err), "", []byte(err.Error()))
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"value": value,
+		})
+	}
+}
+
+var HashGetAllHandler = func(store store.IStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		key := c.Param("key")
+		if key == "" {
+			c.Data(400, "", []byte("empty key"))
+			return
+		}
+
+		fields, err := store.HashGetAll(key)
+		if err != nil {
+			c.Data(common.ErrorStatus(err), "", []byte(err.Error()))
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"fields": fields,
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package endpoints
+
+import (
+	"strconv"
+
+	"keepair/pkg/common"
+	"keepair/pkg/worker/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ListPushBody struct {
+	Values []string `json:"values" binding:"required"`
+	Left   bool     `json:"left"`
+}
+
+var ListPushHandler = func(store store.IStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		key := c.Param("key")
+		if key == "" {
+			c.Data(400, "", []byte("empty key"))
+			return
+		}
+
+		var body ListPushBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.Data(400, "", []byte(err.Error()))
+			return
+		}
+
+		length, err := store.ListPush(key, body.Values, body.Left)
+		if err != nil {
+			c.Data(common.ErrorStatus(err), "", []byte(err.Error()))
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"length": length,
+		})
+	}
+}
+
+var ListPopHandler = func(store store.IStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		key := c.Param("key")
+		if key == "" {
+			c.Data(400, "", []byte("empty key"))
+			return
+		}
+
+		left := c.Query("left") == "true"
+		value, err := store.ListPop(key, left)
+		if err != nil {
+			c.Data(common.ErrorStatus(err), "", []byte(err.Error()))
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"value": value,
+		})
+	}
+}
+
+var ListRangeHandler = func(store store.IStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		key := c.Param("key")
+		if key == "" {
+			c.Data(400, "", []byte("empty key"))
+			return
+		}
+
+		start, err := strconv.Atoi(c.DefaultQuery("start", "0"))
+		if err != nil {
+			c.Data(400, "", []byte("invalid start"))
+			return
+		}
+		stop, err := strconv.Atoi(c.DefaultQuery("stop", "-1"))
+		if err != nil {
+			c.Data(400, "", []byte("invalid stop"))
+			return
+		}
+
+		values, err := store.ListRange(key, start, stop)
+		if err != nil {
+			c.Data(common.ErrorStatus(err), "", []byte(err.Error()))
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"values": values,
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package endpoints
+
+import (
+	"fmt"
+
+	"keepair/pkg/worker/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetOperationQueuesHandler lists the queues of operations
+// waiting to be applied, and the ones applied recently
+var GetOperationQueuesHandler = func(store store.IStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(200, store.GetOperationQueues())
+	}
+}
+
+// GetOperationQueueHandler returns a queue with its pending operations
+var GetOperationQueueHandler = func(store store.IStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		queue, ok := store.GetOperationQueue(c.Param("queueID"))
+		if !ok {
+			c.Data(404, "", []byte(fmt.Sprintf("no queue %s", c.Param("queueID"))))
+			return
+		}
+
+		c.JSON(200, queue)
+	}
+}
+
+// DiscardOperationQueueHandler drops a queue without applying it
+var DiscardOperationQueueHandler = func(store store.IStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if !store.DiscardOperationQueue(c.Param("queueID")) {
+			c.Data(404, "", []byte(fmt.Sprintf("no queue %s", c.Param("queueID"))))
+			return
+		}
+
+		c.Data(200, "", []byte("ok"))
+	}
+}
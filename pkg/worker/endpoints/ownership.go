@@ -0,0 +1,101 @@
+package endpoints
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"keepair/pkg/partition"
+	"keepair/pkg/values"
+	"keepair/pkg/worker/ownership"
+	"keepair/pkg/worker/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CheckOwnership is a middleware for key endpoints, which redirects
+// requests for keys the worker does not serve to the node that does.
+// Writes made while a rebalance moves a key are also replicated to
+// the new owners of the key.
+var CheckOwnership = func(store store.IStore, ownership *ownership.Ownership) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		key := c.Param("key")
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		_, present := store.GetEntry(key)
+		redirect := ownership.Check(key, present, c.GetHeader(values.AskingHeader) != "")
+		if redirect != nil {
+			nodeURL := redirect.Node.URL()
+			c.Header(values.RedirectHeader, string(redirect.Kind))
+			c.Header(values.EpochHeader, strconv.FormatUint(redirect.Epoch, 10))
+			c.Header("Location", nodeURL)
+			c.Data(http.StatusMisdirectedRequest, "", []byte(fmt.Sprintf("%s %d %s", redirect.Kind, redirect.Epoch, nodeURL)))
+			c.Abort()
+			return
+		}
+
+		if c.Request.Method != http.MethodGet {
+			if targets := ownership.MigrationTargets(key); len(targets) > 0 {
+				c.Request.Header.Set(values.ReplicasHeader, addURLs(c.GetHeader(values.ReplicasHeader), targets))
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// addURLs adds URLs missing from a comma-separated list
+func addURLs(list string, URLs []string) string {
+	all := make([]string, 0)
+	if list != "" {
+		all = strings.Split(list, ",")
+	}
+	for _, u := range URLs {
+		found := false
+		for _, v := range all {
+			found = found || v == u
+		}
+		if !found {
+			all = append(all, u)
+		}
+	}
+	return strings.Join(all, ",")
+}
+
+var GetAssignmentHandler = func(ownership *ownership.Ownership) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(200, ownership.Get())
+	}
+}
+
+// SetAssignmentHandler takes the assignment pushed by the primary.
+// An assignment older than the current one is refused, which fences
+// off a primary that was replaced.
+var SetAssignmentHandler = func(o *ownership.Ownership) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var assignment partition.Assignment
+		if err := c.ShouldBindJSON(&assignment); err != nil {
+			c.Data(400, "", []byte(err.Error()))
+			return
+		}
+
+		if err := o.Update(assignment); err != nil {
+			if errors.Is(err, ownership.ErrStaleEpoch) {
+				c.Header(values.EpochHeader, strconv.FormatUint(o.Get().Epoch, 10))
+				c.Data(409, "", []byte(err.Error()))
+				return
+			}
+			c.Data(500, "", []byte(err.Error()))
+			return
+		}
+
+		c.Data(200, "", []byte("ok"))
+	}
+}
@@ -0,0 +1,40 @@
+package endpoints
+
+import (
+	"io"
+
+	"keepair/pkg/common"
+	"keepair/pkg/worker/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+var PatchKeyHandler = func(store store.IStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		key := c.Param("key")
+		if key == "" {
+			c.Data(400, "", []byte("empty key"))
+			return
+		}
+
+		patch, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.Data(500, "", []byte(err.Error()))
+			return
+		}
+		defer c.Request.Body.Close()
+
+		if len(patch) == 0 {
+			c.Data(400, "", []byte("empty patch"))
+			return
+		}
+
+		if _, err := store.Patch(key, patch); err != nil {
+			c.Data(common.ErrorStatus(err), "", []byte(err.Error()))
+			return
+		}
+
+		c.Data(200, "", []byte("ok"))
+	}
+}
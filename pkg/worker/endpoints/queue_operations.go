@@ -10,6 +10,8 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// QueueOperationsHandler queues operations under the queue and batch
+// IDs of the request, ignoring a batch the queue already received
 var QueueOperationsHandler = func(store store.IStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
@@ -26,10 +28,15 @@ var QueueOperationsHandler = func(store store.IStore) gin.HandlerFunc {
 			return
 		}
 
-		if err := store.QueueOperations(operations); err != nil {
+		queued, err := store.QueueOperations(c.Query("queue"), c.Query("batch"), operations)
+		if err != nil {
 			c.Data(500, "", []byte(err.Error()))
 			return
 		}
+		if !queued {
+			c.Data(200, "", []byte("already queued"))
+			return
+		}
 
 		c.Data(200, "", []byte("ok"))
 	}
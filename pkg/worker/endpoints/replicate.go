@@ -0,0 +1,116 @@
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"keepair/pkg/common"
+	"keepair/pkg/log"
+	"keepair/pkg/values"
+	"keepair/pkg/worker/replication"
+	"keepair/pkg/worker/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bufferedWriter holds back a handler's response, so it can
+// be replaced by an error if replication fails
+type bufferedWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(code int)              { w.status = code }
+func (w *bufferedWriter) WriteHeaderNow()                   {}
+func (w *bufferedWriter) Write(data []byte) (int, error)    { return w.body.Write(data) }
+func (w *bufferedWriter) WriteString(s string) (int, error) { return w.body.WriteString(s) }
+func (w *bufferedWriter) Status() int                       { return w.status }
+func (w *bufferedWriter) Size() int                         { return w.body.Len() }
+func (w *bufferedWriter) Written() bool                     { return w.body.Len() > 0 }
+func (w *bufferedWriter) Flush()                            {}
+
+// ReplicateWrites is a middleware for write endpoints. If the request
+// names follower replicas, the resulting entry is forwarded to them
+// once the write succeeds locally, and the response is only sent
+// after every follower has applied it. A write that some followers
+// failed to apply is kept, and answered with 202 and the followers
+// that missed it, so the caller can hint the write to them.
+var ReplicateWrites = func(store store.IStore, locks *replication.KeyLocks) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		replicas := c.GetHeader(values.ReplicasHeader)
+		key := c.Param("key")
+		if replicas == "" || key == "" {
+			c.Next()
+			return
+		}
+
+		unlock := locks.Lock(key)
+		defer unlock()
+
+		writer := &bufferedWriter{ResponseWriter: c.Writer, status: 200}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if writer.status == 200 {
+			// the delete is timestamped, so a copy of the key
+			// made by a rebalance does not bring it back
+			operation := common.EntryOperation{
+				Action: common.DeleteEntry,
+				Entry:  common.Entry{Key: key, Timestamp: time.Now().UnixNano()},
+			}
+			if entry, ok := store.GetEntry(key); ok {
+				operation = common.EntryOperation{
+					Action: common.SetEntry,
+					Entry:  entry,
+				}
+			}
+			followerURLs := strings.Split(replicas, ",")
+			if failed, err := replication.Forward(followerURLs, []common.EntryOperation{operation}); err != nil {
+				log.Get().Printf("write of %s applied, but not replicated to %s: %s", key, strings.Join(failed, ","), err)
+				c.Header(values.FailedReplicasHeader, strings.Join(failed, ","))
+				c.Header(values.TimestampHeader, strconv.FormatInt(operation.Entry.Timestamp, 10))
+				c.Data(202, "", []byte(fmt.Sprintf("applied, failed to replicate: %s", err)))
+				return
+			}
+		}
+
+		c.Writer.WriteHeader(writer.status)
+		if _, err := c.Writer.Write(writer.body.Bytes()); err != nil {
+			panic(fmt.Errorf("error writing response: %w", err))
+		}
+	}
+}
+
+// ReplicateHandler applies operations forwarded by a leader replica
+var ReplicateHandler = func(store store.IStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.Data(500, "", []byte(err.Error()))
+			return
+		}
+		defer c.Request.Body.Close()
+
+		var operations []common.EntryOperation
+		if err := json.Unmarshal(body, &operations); err != nil {
+			c.Data(400, "", []byte(err.Error()))
+			return
+		}
+
+		if err := store.Replicate(operations); err != nil {
+			c.Data(500, "", []byte(err.Error()))
+			return
+		}
+
+		c.Data(200, "", []byte("ok"))
+	}
+}
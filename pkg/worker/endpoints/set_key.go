@@ -2,6 +2,9 @@ package endpoints
 
 import (
 	"io"
+	"strconv"
+
+	"keepair/pkg/values"
 
 	"keepair/pkg/worker/store"
 
@@ -29,6 +32,21 @@ var SetKeyHandler = func(store store.IStore) gin.HandlerFunc {
 			return
 		}
 
+		// leaderless writes are only applied if they are newer
+		if header := c.GetHeader(values.TimestampHeader); header != "" {
+			timestamp, err := strconv.ParseInt(header, 10, 64)
+			if err != nil {
+				c.Data(400, "", []byte("invalid timestamp"))
+				return
+			}
+			if _, err := store.SetVersioned(key, value, timestamp); err != nil {
+				c.Data(500, "", []byte(err.Error()))
+				return
+			}
+			c.Data(200, "", []byte("ok"))
+			return
+		}
+
 		if err := store.Set(key, value); err != nil {
 			c.Data(500, "", []byte(err.Error()))
 			return
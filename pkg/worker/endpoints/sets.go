@@ -0,0 +1,87 @@
+package endpoints
+
+import (
+	"keepair/pkg/common"
+	"keepair/pkg/worker/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SetMembersBody struct {
+	Members []string `json:"members" binding:"required"`
+}
+
+var SetAddHandler = func(store store.IStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		key := c.Param("key")
+		if key == "" {
+			c.Data(400, "", []byte("empty key"))
+			return
+		}
+
+		var body SetMembersBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.Data(400, "", []byte(err.Error()))
+			return
+		}
+
+		added, err := store.SetAdd(key, body.Members)
+		if err != nil {
+			c.Data(common.ErrorStatus(err), "", []byte(err.Error()))
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"added": added,
+		})
+	}
+}
+
+var SetRemoveHandler = func(store store.IStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		key := c.Param("key")
+		if key == "" {
+			c.Data(400, "", []byte("empty key"))
+			return
+		}
+
+		var body SetMembersBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.Data(400, "", []byte(err.Error()))
+			return
+		}
+
+		removed, err := store.SetRemove(key, body.Members)
+		if err != nil {
+			c.Data(common.ErrorStatus(err), "", []byte(err.Error()))
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"removed": removed,
+		})
+	}
+}
+
+var SetMembersHandler = func(store store.IStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		key := c.Param("key")
+		if key == "" {
+			c.Data(400, "", []byte("empty key"))
+			return
+		}
+
+		members, err := store.SetMembers(key)
+		if err != nil {
+			c.Data(common.ErrorStatus(err), "", []byte(err.Error()))
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"members": members,
+		})
+	}
+}
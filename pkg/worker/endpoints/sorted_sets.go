@@ -0,0 +1,75 @@
+package endpoints
+
+import (
+	"math"
+	"strconv"
+
+	"keepair/pkg/common"
+	"keepair/pkg/worker/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SortedSetAddBody struct {
+	Members []common.ScoredMember `json:"members" binding:"required"`
+}
+
+var SortedSetAddHandler = func(store store.IStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		key := c.Param("key")
+		if key == "" {
+			c.Data(400, "", []byte("empty key"))
+			return
+		}
+
+		var body SortedSetAddBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.Data(400, "", []byte(err.Error()))
+			return
+		}
+
+		added, err := store.SortedSetAdd(key, body.Members)
+		if err != nil {
+			c.Data(common.ErrorStatus(err), "", []byte(err.Error()))
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"added": added,
+		})
+	}
+}
+
+var SortedSetRangeHandler = func(store store.IStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		key := c.Param("key")
+		if key == "" {
+			c.Data(400, "", []byte("empty key"))
+			return
+		}
+
+		// ParseFloat accepts "-inf" and "+inf"
+		min, err := strconv.ParseFloat(c.DefaultQuery("min", "-inf"), 64)
+		if err != nil || math.IsNaN(min) {
+			c.Data(400, "", []byte("invalid min"))
+			return
+		}
+		max, err := strconv.ParseFloat(c.DefaultQuery("max", "+inf"), 64)
+		if err != nil || math.IsNaN(max) {
+			c.Data(400, "", []byte("invalid max"))
+			return
+		}
+
+		members, err := store.SortedSetRangeByScore(key, min, max)
+		if err != nil {
+			c.Data(common.ErrorStatus(err), "", []byte(err.Error()))
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"members": members,
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"keepair/pkg/worker/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StreamEventsHandler streams the changes made after the "since"
+// sequence number, one JSON event per line, until the client
+// disconnects. Values are only included if values=true.
+var StreamEventsHandler = func(store store.IStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		since, err := strconv.ParseUint(c.DefaultQuery("since", "0"), 10, 64)
+		if err != nil {
+			c.Data(400, "", []byte("invalid since"))
+			return
+		}
+
+		includeValues := c.Query("values") == "true"
+
+		eventChan, cancel := store.Subscribe(since)
+		defer cancel()
+
+		c.Writer.Header().Set("Content-Type", "application/octet-stream")
+		c.Writer.Header().Set("Cache-Control", "no-cache")
+		c.Writer.WriteHeaderNow()
+		c.Writer.Flush()
+
+		for {
+			select {
+			case <-c.Request.Context().Done():
+				return
+			case event, ok := <-eventChan:
+				if !ok {
+					// subscriber fell behind, client should resume
+					return
+				}
+				if !includeValues {
+					event.Value = nil
+				}
+				line, err := json.Marshal(event)
+				if err != nil {
+					panic(fmt.Errorf("error encoding event: %w", err))
+				}
+				if _, err := c.Writer.Write(append(line, '\n')); err != nil {
+					return
+				}
+				c.Writer.Flush()
+			}
+		}
+	}
+}
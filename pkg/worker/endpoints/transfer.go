@@ -0,0 +1,96 @@
+package endpoints
+
+import (
+	"errors"
+
+	"keepair/pkg/partition"
+	"keepair/pkg/worker/ownership"
+	"keepair/pkg/worker/store"
+	"keepair/pkg/worker/transfer"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TransferHandler sends the keys of the worker to the workers that
+// own them in the next placement of the requested assignment
+var TransferHandler = func(workerID string, store store.IStore, tracker *transfer.Tracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		req, ok := bindTransferRequest(c)
+		if !ok {
+			return
+		}
+
+		transfers, err := transfer.Copy(workerID, store, req, tracker)
+		if errors.Is(err, transfer.ErrCanceled) {
+			c.Data(409, "", []byte(err.Error()))
+			return
+		}
+		if err != nil {
+			c.Data(500, "", []byte(err.Error()))
+			return
+		}
+
+		c.JSON(200, gin.H{"transfers": transfers})
+	}
+}
+
+// TransferProgressHandler returns what a copy in progress has sent
+var TransferProgressHandler = func(tracker *transfer.Tracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		transfers, ok := tracker.Get(c.Param("id"))
+		if !ok {
+			c.Data(404, "", []byte("no transfer in progress"))
+			return
+		}
+
+		c.JSON(200, gin.H{"transfers": transfers})
+	}
+}
+
+// CancelTransferHandler stops a copy in progress before its next batch
+var CancelTransferHandler = func(tracker *transfer.Tracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if !tracker.Cancel(c.Param("id")) {
+			c.Data(404, "", []byte("no transfer in progress"))
+			return
+		}
+
+		c.Data(200, "", []byte("ok"))
+	}
+}
+
+// DropHandler deletes the keys the worker does not own in the
+// next placement of the requested assignment
+var DropHandler = func(workerID string, store store.IStore, ownership *ownership.Ownership) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		req, ok := bindTransferRequest(c)
+		if !ok {
+			return
+		}
+
+		tr, err := transfer.Drop(workerID, store, req, ownership.Migrating())
+		if err != nil {
+			c.Data(500, "", []byte(err.Error()))
+			return
+		}
+
+		c.JSON(200, gin.H{"transfer": tr})
+	}
+}
+
+func bindTransferRequest(c *gin.Context) (partition.TransferRequest, bool) {
+	var req partition.TransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Data(400, "", []byte(err.Error()))
+		return req, false
+	}
+	if req.Assignment.Next == nil {
+		c.Data(400, "", []byte("no next assignment"))
+		return req, false
+	}
+	return req, true
+}
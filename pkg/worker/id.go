@@ -0,0 +1,43 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// idFile is the name of the file the worker keeps its ID in,
+// next to the files of its change log
+const idFile = "worker.id"
+
+// loadID returns the ID kept in dir, creating and saving a new one
+// the first time, so that a restarted worker keeps the ID its change
+// log and its keys were recorded under. Without a dir, the worker
+// gets a new ID every time it starts.
+func loadID(dir string) (string, error) {
+	if dir == "" {
+		return uuid.NewString(), nil
+	}
+	path := filepath.Join(dir, idFile)
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if ID := strings.TrimSpace(string(data)); ID != "" {
+			return ID, nil
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to read worker ID: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create worker ID dir: %w", err)
+	}
+	ID := uuid.NewString()
+	if err := os.WriteFile(path, []byte(ID+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("failed to save worker ID: %w", err)
+	}
+	return ID, nil
+}
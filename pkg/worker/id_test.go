@@ -0,0 +1,27 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadID(t *testing.T) {
+	dir := t.TempDir()
+
+	ID, err := loadID(dir)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ID)
+
+	// a restarted worker keeps its ID
+	again, err := loadID(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, ID, again)
+
+	// without a dir, every start gets a new one
+	first, err := loadID("")
+	assert.NoError(t, err)
+	second, err := loadID("")
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second)
+}
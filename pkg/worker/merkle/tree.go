@@ -0,0 +1,149 @@
+package merkle
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/fnv"
+	"sync"
+
+	"keepair/pkg/common"
+)
+
+type Hash [sha256.Size]byte
+
+func (h Hash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+// Tree is a Merkle tree over a fixed number of buckets of keys. A
+// bucket's hash is the XOR of the hashes of its keys, so it can be
+// updated in place as keys change, and each parent is the hash of
+// its two children. Updates rehash the path from a bucket to the root.
+type Tree struct {
+	mu         sync.RWMutex
+	numBuckets int
+	keys       []map[string]Hash
+	// nodes is the tree in heap order: the root is at 1, the
+	// children of i at 2i and 2i+1, and the buckets at the end
+	nodes []Hash
+}
+
+// New returns an empty tree. numBuckets is rounded up to a power of two.
+func New(numBuckets int) *Tree {
+	n := 1
+	for n < numBuckets {
+		n *= 2
+	}
+	t := &Tree{
+		numBuckets: n,
+		keys:       make([]map[string]Hash, n),
+		nodes:      make([]Hash, 2*n),
+	}
+	for i := range t.keys {
+		t.keys[i] = make(map[string]Hash)
+	}
+	for i := n - 1; i >= 1; i-- {
+		t.nodes[i] = hashChildren(t.nodes[2*i], t.nodes[2*i+1])
+	}
+	return t
+}
+
+// HashEntry hashes the key, type and value of an entry
+func HashEntry(entry common.Entry) Hash {
+	h := sha256.New()
+	for _, part := range [][]byte{[]byte(entry.Key), []byte(entry.Type), entry.Value} {
+		var size [8]byte
+		binary.BigEndian.PutUint64(size[:], uint64(len(part)))
+		h.Write(size[:])
+		h.Write(part)
+	}
+	var sum Hash
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+func hashChildren(left, right Hash) Hash {
+	return sha256.Sum256(append(left[:], right[:]...))
+}
+
+func (t *Tree) NumBuckets() int {
+	return t.numBuckets
+}
+
+// Bucket returns the bucket a key belongs to
+func (t *Tree) Bucket(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(t.numBuckets))
+}
+
+// Set sets the hash of a key
+func (t *Tree) Set(key string, hash Hash) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	bucket := t.Bucket(key)
+	if old, ok := t.keys[bucket][key]; ok {
+		t.xorBucket(bucket, old)
+	}
+	t.keys[bucket][key] = hash
+	t.xorBucket(bucket, hash)
+	t.rehash(bucket)
+}
+
+// Delete removes a key from the tree
+func (t *Tree) Delete(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	bucket := t.Bucket(key)
+	old, ok := t.keys[bucket][key]
+	if !ok {
+		return
+	}
+	delete(t.keys[bucket], key)
+	t.xorBucket(bucket, old)
+	t.rehash(bucket)
+}
+
+// xorBucket adds or removes a key hash. Caller must handle locks.
+func (t *Tree) xorBucket(bucket int, hash Hash) {
+	leaf := &t.nodes[t.numBuckets+bucket]
+	for i := range leaf {
+		leaf[i] ^= hash[i]
+	}
+}
+
+// rehash updates the parents of a bucket. Caller must handle locks.
+func (t *Tree) rehash(bucket int) {
+	for i := (t.numBuckets + bucket) / 2; i >= 1; i /= 2 {
+		t.nodes[i] = hashChildren(t.nodes[2*i], t.nodes[2*i+1])
+	}
+}
+
+func (t *Tree) Root() Hash {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.nodes[1]
+}
+
+// Buckets returns the hash of every bucket
+func (t *Tree) Buckets() []Hash {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	buckets := make([]Hash, t.numBuckets)
+	copy(buckets, t.nodes[t.numBuckets:])
+	return buckets
+}
+
+// Keys returns the hashes of the keys in a bucket
+func (t *Tree) Keys(bucket int) map[string]Hash {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	keys := make(map[string]Hash, len(t.keys[bucket]))
+	for k, v := range t.keys[bucket] {
+		keys[k] = v
+	}
+	return keys
+}
@@ -0,0 +1,63 @@
+package merkle
+
+import (
+	"fmt"
+	"testing"
+
+	"keepair/pkg/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setEntry(t *Tree, key string, value string) {
+	t.Set(key, HashEntry(common.Entry{Key: key, Value: []byte(value)}))
+}
+
+// TestTreeIncremental checks that the root only depends on the
+// current keys, not on the order of updates that led to them
+func TestTreeIncremental(t *testing.T) {
+	a := New(16)
+	b := New(16)
+	empty := a.Root()
+
+	for i := 0; i < 50; i++ {
+		setEntry(a, fmt.Sprint(i), "old")
+	}
+	for i := 49; i >= 0; i-- {
+		setEntry(b, fmt.Sprint(i), "new")
+	}
+	assert.NotEqual(t, a.Root(), b.Root())
+
+	for i := 0; i < 50; i++ {
+		setEntry(a, fmt.Sprint(i), "new")
+	}
+	assert.Equal(t, a.Root(), b.Root())
+	assert.Equal(t, a.Buckets(), b.Buckets())
+
+	// a differing key only changes its own bucket
+	setEntry(a, "extra", "value")
+	bucket := a.Bucket("extra")
+	for i, hash := range a.Buckets() {
+		if i == bucket {
+			assert.NotEqual(t, b.Buckets()[i], hash)
+		} else {
+			assert.Equal(t, b.Buckets()[i], hash)
+		}
+	}
+	assert.Contains(t, a.Keys(bucket), "extra")
+
+	a.Delete("extra")
+	assert.Equal(t, a.Root(), b.Root())
+
+	for i := 0; i < 50; i++ {
+		a.Delete(fmt.Sprint(i))
+	}
+	assert.Equal(t, empty, a.Root())
+}
+
+func TestHashEntry(t *testing.T) {
+	plain := HashEntry(common.Entry{Key: "k", Value: []byte("v")})
+	assert.Equal(t, plain, HashEntry(common.Entry{Key: "k", Value: []byte("v"), Timestamp: 1}))
+	assert.NotEqual(t, plain, HashEntry(common.Entry{Key: "k", Value: []byte("v"), Type: common.ListType}))
+	assert.NotEqual(t, HashEntry(common.Entry{Key: "ab", Value: []byte("c")}), HashEntry(common.Entry{Key: "a", Value: []byte("bc")}))
+}
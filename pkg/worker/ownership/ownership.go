@@ -0,0 +1,99 @@
+package ownership
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"keepair/pkg/partition"
+)
+
+// ErrStaleEpoch is returned for an assignment older than the
+// current one, which comes from a primary that was replaced
+var ErrStaleEpoch = errors.New("stale epoch")
+
+// Ownership holds the partition assignment of a worker
+type Ownership struct {
+	sync.RWMutex
+	WorkerID   string
+	Assignment partition.Assignment
+}
+
+func New(workerID string) *Ownership {
+	return &Ownership{
+		WorkerID: workerID,
+	}
+}
+
+func (o *Ownership) Get() partition.Assignment {
+	o.RLock()
+	defer o.RUnlock()
+	return o.Assignment
+}
+
+// Update replaces the assignment unless its epoch is older
+func (o *Ownership) Update(assignment partition.Assignment) error {
+	o.Lock()
+	defer o.Unlock()
+	if assignment.Epoch < o.Assignment.Epoch {
+		return fmt.Errorf("%w: %d is older than %d", ErrStaleEpoch, assignment.Epoch, o.Assignment.Epoch)
+	}
+	o.Assignment = assignment
+	return nil
+}
+
+// Check returns a redirect if the worker should not serve a key.
+// While a rebalance moves a key away, the worker keeps serving it
+// until it is dropped, then asks for the key on its new owner,
+// which only accepts it from requests that follow an ASK.
+// Every key is served until the first assignment arrives.
+func (o *Ownership) Check(key string, present bool, asking bool) *partition.Redirect {
+	o.RLock()
+	defer o.RUnlock()
+
+	a := o.Assignment
+	if len(a.Nodes) == 0 {
+		return nil
+	}
+	ownsKey := a.Owns(o.WorkerID, key)
+	if next := a.Next; next != nil && len(next.Nodes) > 0 {
+		ownsNext := next.Owns(o.WorkerID, key)
+		if ownsKey && !ownsNext && !present {
+			return &partition.Redirect{Kind: partition.AskRedirect, Epoch: next.Epoch, Node: next.Owners(key)[0]}
+		}
+		if !ownsKey && ownsNext && asking {
+			return nil
+		}
+	}
+	if ownsKey {
+		return nil
+	}
+	return &partition.Redirect{Kind: partition.MovedRedirect, Epoch: a.Epoch, Node: a.Owners(key)[0]}
+}
+
+// Migrating reports whether a rebalance is moving keys
+func (o *Ownership) Migrating() bool {
+	o.RLock()
+	defer o.RUnlock()
+	return o.Assignment.Next != nil
+}
+
+// MigrationTargets returns the URLs of the nodes that will own a key
+// once a rebalance is done. Writes during the rebalance are copied to
+// them, as the data being moved was read before the write.
+func (o *Ownership) MigrationTargets(key string) []string {
+	o.RLock()
+	defer o.RUnlock()
+
+	next := o.Assignment.Next
+	if next == nil {
+		return nil
+	}
+	targets := make([]string, 0)
+	for _, n := range next.Owners(key) {
+		if n.ID != o.WorkerID {
+			targets = append(targets, n.URL())
+		}
+	}
+	return targets
+}
@@ -0,0 +1,55 @@
+package ownership
+
+import (
+	"testing"
+
+	"keepair/pkg/partition"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func nodes(IDs ...string) []partition.Node {
+	nodes := make([]partition.Node, 0, len(IDs))
+	for _, ID := range IDs {
+		nodes = append(nodes, partition.Node{ID: ID, Address: ID + ":8000"})
+	}
+	return nodes
+}
+
+// with two nodes, "b" belongs to node 0 and "a" to node 1. With
+// three nodes, "b" belongs to node 2.
+func TestCheck(t *testing.T) {
+	a := New("A")
+	assert.Nil(t, a.Check("a", false, false), "keys are served until the first assignment")
+
+	assert.NoError(t, a.Update(partition.Assignment{Epoch: 1, ReplicationFactor: 1, Nodes: nodes("A", "B")}))
+	assert.Nil(t, a.Check("b", false, false))
+	assert.Equal(t, &partition.Redirect{Kind: partition.MovedRedirect, Epoch: 1, Node: nodes("B")[0]}, a.Check("a", true, false))
+
+	// a third node is added and "b" moves from A to C
+	migration := partition.Assignment{Epoch: 1, ReplicationFactor: 1, Nodes: nodes("A", "B")}
+	migration.Next = &partition.Assignment{Epoch: 2, ReplicationFactor: 1, Nodes: nodes("A", "B", "C")}
+	assert.NoError(t, a.Update(migration))
+	assert.True(t, a.Migrating())
+	assert.Nil(t, a.Check("b", true, false), "a key is served until it is dropped")
+	assert.Equal(t, &partition.Redirect{Kind: partition.AskRedirect, Epoch: 2, Node: nodes("C")[0]}, a.Check("b", false, false))
+	assert.Equal(t, []string{"http://C:8000"}, a.MigrationTargets("b"))
+
+	c := New("C")
+	assert.NoError(t, c.Update(migration))
+	assert.Nil(t, c.Check("b", false, true), "the new owner accepts requests that follow an ASK")
+	assert.Equal(t, &partition.Redirect{Kind: partition.MovedRedirect, Epoch: 1, Node: nodes("A")[0]}, c.Check("b", false, false))
+
+	// the migration is done
+	assert.NoError(t, c.Update(*migration.Next))
+	assert.False(t, c.Migrating())
+	assert.Nil(t, c.Check("b", false, false))
+}
+
+func TestUpdateStaleEpoch(t *testing.T) {
+	o := New("A")
+	assert.NoError(t, o.Update(partition.Assignment{Epoch: 3, ReplicationFactor: 1, Nodes: nodes("A")}))
+	assert.NoError(t, o.Update(partition.Assignment{Epoch: 3, ReplicationFactor: 1, Nodes: nodes("A")}))
+	assert.ErrorIs(t, o.Update(partition.Assignment{Epoch: 2, ReplicationFactor: 1, Nodes: nodes("A", "B")}), ErrStaleEpoch)
+	assert.Equal(t, uint64(3), o.Get().Epoch)
+}
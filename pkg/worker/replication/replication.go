@@ -0,0 +1,81 @@
+package replication
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"sync"
+
+	"keepair/pkg/common"
+)
+
+const numLockStripes = 256
+
+// KeyLocks serializes writes to the same key, so that followers
+// receive the writes to a key in the order the leader applied them
+type KeyLocks struct {
+	stripes [numLockStripes]sync.Mutex
+}
+
+func NewKeyLocks() *KeyLocks {
+	return &KeyLocks{}
+}
+
+// Lock locks the stripe of a key and returns its unlock function
+func (l *KeyLocks) Lock(key string) func() {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	mu := &l.stripes[h.Sum32()%numLockStripes]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// Forward sends operations to every follower in parallel. It returns
+// the URLs of the followers that failed to apply them, with the first
+// of their errors.
+func Forward(followerURLs []string, operations []common.EntryOperation) ([]string, error) {
+	body, err := json.Marshal(operations)
+	if err != nil {
+		return followerURLs, err
+	}
+
+	type result struct {
+		followerURL string
+		err         error
+	}
+	results := make(chan result, len(followerURLs))
+	for _, followerURL := range followerURLs {
+		go func(followerURL string) {
+			url := fmt.Sprintf("%s/replicate", followerURL)
+			res, err := http.Post(url, "application/json", bytes.NewReader(body))
+			if err != nil {
+				results <- result{followerURL, fmt.Errorf("replicate to %s: %w", followerURL, err)}
+				return
+			}
+			defer res.Body.Close()
+			if res.StatusCode != 200 {
+				resBody, _ := io.ReadAll(res.Body)
+				results <- result{followerURL, fmt.Errorf("replicate to %s failed: %s", followerURL, resBody)}
+				return
+			}
+			results <- result{followerURL, nil}
+		}(followerURL)
+	}
+
+	failed := make([]string, 0)
+	var firstErr error
+	for range followerURLs {
+		r := <-results
+		if r.err == nil {
+			continue
+		}
+		failed = append(failed, r.followerURL)
+		if firstErr == nil {
+			firstErr = r.err
+		}
+	}
+	return failed, firstErr
+}
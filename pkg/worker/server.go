@@ -4,8 +4,12 @@ import (
 	"context"
 
 	"keepair/pkg/base_server"
+	"keepair/pkg/gossip"
 	"keepair/pkg/worker/endpoints"
+	"keepair/pkg/worker/ownership"
+	"keepair/pkg/worker/replication"
 	"keepair/pkg/worker/store"
+	"keepair/pkg/worker/transfer"
 
 	"github.com/gin-gonic/gin"
 )
@@ -13,25 +17,83 @@ import (
 type Server struct {
 	WorkerID string
 	Store    store.IStore
+	Gossip   *gossip.Gossip
+	// Ownership is the partition assignment pushed by the primary
+	Ownership *ownership.Ownership
 }
 
 func NewServer(workerID string, store store.IStore) base_server.IServer {
 	return &Server{
-		WorkerID: workerID,
-		Store:    store,
+		WorkerID:  workerID,
+		Store:     store,
+		Ownership: ownership.New(workerID),
+	}
+}
+
+// NewServerWithGossip also answers the gossip probes of other workers
+func NewServerWithGossip(workerID string, store store.IStore, g *gossip.Gossip, o *ownership.Ownership) base_server.IServer {
+	return &Server{
+		WorkerID:  workerID,
+		Store:     store,
+		Gossip:    g,
+		Ownership: o,
 	}
 }
 
 func (s *Server) Run(ctx context.Context, port string) error {
 	r := gin.Default()
 
-	r.POST("/keys/:key", endpoints.SetKeyHandler(s.Store))
-	r.DELETE("/keys/:key", endpoints.DeleteKeyHandler(s.WorkerID, s.Store))
-	r.GET("/keys/:key", endpoints.GetKeyHandler(s.Store))
+	// writes are forwarded to the follower replicas named by the primary
+	replicate := endpoints.ReplicateWrites(s.Store, replication.NewKeyLocks())
+
+	// keys the worker does not own are redirected to their owner
+	owned := endpoints.CheckOwnership(s.Store, s.Ownership)
+
+	// copies sent to other workers while a rebalance moves data
+	transfers := transfer.NewTracker()
+
+	r.POST("/keys/:key", owned, replicate, endpoints.SetKeyHandler(s.Store))
+	r.DELETE("/keys/:key", owned, replicate, endpoints.DeleteKeyHandler(s.WorkerID, s.Store))
+	r.GET("/keys/:key", owned, endpoints.GetKeyHandler(s.Store))
+	r.GET("/versions/:key", endpoints.GetVersionHandler(s.Store))
+	r.PATCH("/keys/:key", owned, replicate, endpoints.PatchKeyHandler(s.Store))
+	r.POST("/lists/:key/push", owned, replicate, endpoints.ListPushHandler(s.Store))
+	r.POST("/lists/:key/pop", owned, replicate, endpoints.ListPopHandler(s.Store))
+	r.GET("/lists/:key", owned, endpoints.ListRangeHandler(s.Store))
+	r.POST("/sets/:key/add", owned, replicate, endpoints.SetAddHandler(s.Store))
+	r.POST("/sets/:key/remove", owned, replicate, endpoints.SetRemoveHandler(s.Store))
+	r.GET("/sets/:key", owned, endpoints.SetMembersHandler(s.Store))
+	r.POST("/hashes/:key", owned, replicate, endpoints.HashSetHandler(s.Store))
+	r.GET("/hashes/:key/:field", owned, endpoints.HashGetHandler(s.Store))
+	r.GET("/hashes/:key", owned, endpoints.HashGetAllHandler(s.Store))
+	r.POST("/zsets/:key", owned, replicate, endpoints.SortedSetAddHandler(s.Store))
+	r.GET("/zsets/:key", owned, endpoints.SortedSetRangeHandler(s.Store))
 	r.GET("/stats", endpoints.GetStatsHandler(s.Store))
+	r.GET("/digest", endpoints.GetDigestHandler(s.Store))
+	r.GET("/digest/:bucket", endpoints.GetBucketDigestHandler(s.Store))
+	r.GET("/entries/:key", endpoints.GetEntryHandler(s.Store))
 	r.GET("/stream-entries", endpoints.StreamEntriesHandler(s.Store))
+	r.GET("/events", endpoints.StreamEventsHandler(s.Store))
+	r.GET("/changes", endpoints.GetChangesHandler(s.Store))
 	r.POST("/queue-operations", endpoints.QueueOperationsHandler(s.Store))
-	r.POST("/apply-operations", endpoints.ApplyOperationsHandler(s.Store))
+	r.POST("/apply-operations", endpoints.ApplyOperationsHandler(s.Store, s.Ownership))
+	r.GET("/operation-queues", endpoints.GetOperationQueuesHandler(s.Store))
+	r.GET("/operation-queues/:queueID", endpoints.GetOperationQueueHandler(s.Store))
+	r.DELETE("/operation-queues/:queueID", endpoints.DiscardOperationQueueHandler(s.Store))
+	r.POST("/moves", endpoints.CountMovesHandler(s.WorkerID, s.Store))
+	r.POST("/transfer", endpoints.TransferHandler(s.WorkerID, s.Store, transfers))
+	r.GET("/transfer/:id", endpoints.TransferProgressHandler(transfers))
+	r.POST("/transfer/:id/cancel", endpoints.CancelTransferHandler(transfers))
+	r.POST("/drop", endpoints.DropHandler(s.WorkerID, s.Store, s.Ownership))
+	r.POST("/replicate", endpoints.ReplicateHandler(s.Store))
+	r.GET("/assignment", endpoints.GetAssignmentHandler(s.Ownership))
+	r.POST("/assignment", endpoints.SetAssignmentHandler(s.Ownership))
+
+	if s.Gossip != nil {
+		r.POST("/gossip/ping", endpoints.GossipPingHandler(s.Gossip))
+		r.POST("/gossip/ping-req", endpoints.GossipPingReqHandler(s.Gossip))
+		r.GET("/gossip/members", endpoints.GossipMembersHandler(s.Gossip))
+	}
 
 	svr := base_server.NewBaseServer(r)
 	return svr.Run(ctx, port)
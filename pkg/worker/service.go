@@ -4,35 +4,66 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 
+	"keepair/pkg/common"
+	"keepair/pkg/gossip"
 	"keepair/pkg/log"
+	"keepair/pkg/partition"
+	"keepair/pkg/values"
+	"keepair/pkg/worker/changelog"
+	"keepair/pkg/worker/ownership"
 	"keepair/pkg/worker/store"
-
-	"github.com/google/uuid"
 )
 
 type IService interface {
 	GetID() string
 	Run(ctx context.Context, port string) error
+	Drain(ctx context.Context) error
 }
 
 type Service struct {
-	ID             string
+	ID string
+	// PrimaryNodeURL is the URL of the primary, or a
+	// comma-separated list of URLs of several primaries
 	PrimaryNodeURL string
 	Store          store.IStore
+	Gossip         *gossip.Gossip
+	Ownership      *ownership.Ownership
+	// TombstoneTTL is how long versioned deletes are kept
+	TombstoneTTL time.Duration
 }
 
 func NewService(primaryNodeURL string) IService {
-	ID := uuid.NewString()
+	service, err := NewServiceWithConfig(primaryNodeURL, DefaultConfig())
+	if err != nil {
+		panic(err)
+	}
+	return service
+}
+
+func NewServiceWithConfig(primaryNodeURL string, config Config) (IService, error) {
+	ID, err := loadID(config.ChangeLog.Dir)
+	if err != nil {
+		return nil, err
+	}
+	changeLog, err := changelog.Open(config.ChangeLog)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open change log: %w", err)
+	}
 	return &Service{
 		ID:             ID,
 		PrimaryNodeURL: primaryNodeURL,
-		Store:          store.NewMemStore(ID),
-	}
+		Store:          store.NewMemStore(ID, changeLog),
+		Gossip:         gossip.New(ID, config.Gossip, gossip.NewHTTPTransport()),
+		Ownership:      ownership.New(ID),
+		TombstoneTTL:   config.TombstoneTTL,
+	}, nil
 }
 
 func (m *Service) GetID() string {
@@ -48,60 +79,274 @@ func (m *Service) Run(ctx context.Context, port string) error {
 	// 	}
 	// }()
 
+	defer m.Store.Close()
+
 	errChan := make(chan error)
 
 	go func() {
 		log.Get().Printf("running WORKER (%s) on port %s\n", m.ID, port)
-		server := NewServer(m.ID, m.Store)
+		server := NewServerWithGossip(m.ID, m.Store, m.Gossip, m.Ownership)
 		errChan <- server.Run(ctx, port)
 	}()
+	go m.Gossip.Run(ctx)
+	if m.TombstoneTTL > 0 {
+		go m.compactTombstones(ctx)
+	}
+
+	primaryIdx, generation, err := m.register(ctx, port, 0)
+	if err != nil {
+		return err
+	}
+	go m.sendHeartbeats(ctx, port, primaryIdx, generation)
+
+	return <-errChan
+}
+
+// Drain asks the primary to move the keys of the worker to the other
+// workers and unregister it, and returns once it is done, so the
+// worker can stop without losing data. A worker that is not a
+// member has nothing to drain.
+func (m *Service) Drain(ctx context.Context) error {
+	var err error
+	for _, primaryURL := range strings.Split(m.PrimaryNodeURL, ",") {
+		if err = m.drain(ctx, primaryURL); err == nil {
+			return nil
+		}
+		log.Get().Printf("drain ERR: %s", err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return err
+}
 
-	// attempt to register self to primary node until
-	// context is cancelled or success
+func (m *Service) drain(ctx context.Context, primaryNodeURL string) error {
+	url := fmt.Sprintf("%s/nodes/%s/drain", primaryNodeURL, m.ID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == 404 {
+		return nil
+	}
+	if res.StatusCode != 200 {
+		resBody, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("failed to drain: %s", string(resBody))
+	}
+	return nil
+}
+
+// compactTombstones removes the tombstones older than their
+// TTL, checking every tenth of it
+func (m *Service) compactTombstones(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(m.TombstoneTTL / 10):
+		}
+		before := time.Now().Add(-m.TombstoneTTL).UnixNano()
+		if removed := m.Store.CompactTombstones(before); removed > 0 {
+			log.Get().Printf("[%s] compacted %d tombstones", m.ID, removed)
+		}
+	}
+}
+
+// errNotMember is returned by a heartbeat to a primary
+// that does not know the worker
+var errNotMember = errors.New("worker is not a member")
+
+// errRemoved is returned by a heartbeat after
+// the worker was unregistered
+var errRemoved = errors.New("worker was removed")
+
+// register attempts to register self to a primary node until
+// context is cancelled or success, returning the index of the
+// primary and its generation
+func (m *Service) register(ctx context.Context, port string, primaryIdx int) (int, string, error) {
 	// TODO: don't repeat if rebalance failed
-	success := false
-	for !success {
-		err := m.registerSelf(ctx, port)
+	// with several primaries, try each in turn
+	primaryURLs := strings.Split(m.PrimaryNodeURL, ",")
+	for attempt := primaryIdx; ; attempt++ {
+		generation, err := m.registerSelf(ctx, primaryURLs[attempt%len(primaryURLs)], port)
 		if err == nil {
-			success = true
-			break
+			log.Get().Printf("worker register self success: %s", m.ID)
+			return attempt % len(primaryURLs), generation, nil
 		}
 		log.Get().Printf("register self ERR: %s", err)
 		if contextErr := ctx.Err(); contextErr != nil {
-			return fmt.Errorf("context err (%w) while registering self: %s\n", contextErr, err.Error())
-			break
+			return 0, "", fmt.Errorf("context err (%w) while registering self: %s\n", contextErr, err.Error())
 		}
 		log.Get().Printf("worker register self failed- trying again (%s)", m.ID)
 		time.Sleep(time.Millisecond * 200)
 	}
-	log.Get().Printf("worker register self success: %s", m.ID)
+}
 
-	return <-errChan
+// sendHeartbeats renews the worker's membership lease every third
+// of the lease. It registers again if the primary has forgotten the
+// worker, and moves on to the next primary if one fails to answer.
+func (m *Service) sendHeartbeats(ctx context.Context, port string, primaryIdx int, generation string) {
+	primaryURLs := strings.Split(m.PrimaryNodeURL, ",")
+	interval := time.Duration(0)
+	topologyVersion := uint64(0)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		primaryURL := primaryURLs[primaryIdx%len(primaryURLs)]
+		lease, current, err := m.heartbeat(ctx, primaryURL)
+		if errors.Is(err, errRemoved) {
+			log.Get().Printf("worker %s was removed from the cluster, stopping heartbeats", m.ID)
+			return
+		}
+		if errors.Is(err, errNotMember) {
+			log.Get().Printf("primary %s forgot worker %s (generation %s => %s), registering again", primaryURL, m.ID, generation, current)
+			primaryIdx, generation, err = m.register(ctx, port, primaryIdx)
+			if err != nil {
+				return
+			}
+			interval = 0
+			continue
+		}
+		if err != nil {
+			log.Get().Printf("heartbeat ERR: %s", err)
+			primaryIdx++
+			interval = time.Millisecond * 200
+			continue
+		}
+		if current != generation {
+			log.Get().Printf("primary %s restarted and kept worker %s", primaryURL, m.ID)
+			generation = current
+			topologyVersion = 0
+		}
+		if lease.TopologyVersion != topologyVersion {
+			if err := m.syncTopology(ctx, primaryURL); err != nil {
+				log.Get().Printf("failed to sync topology: %s", err)
+			} else {
+				topologyVersion = lease.TopologyVersion
+			}
+		}
+		interval = lease.Duration / 3
+	}
+}
+
+// heartbeat sends the worker's stats and gossip view to a primary,
+// returning the renewed lease and the generation of the primary
+func (m *Service) heartbeat(ctx context.Context, primaryNodeURL string) (common.Lease, string, error) {
+	body, err := json.Marshal(common.Heartbeat{
+		Stats: common.NodeStats{
+			ObjectCount: m.Store.GetObjectCount(),
+		},
+		Gossip: m.Gossip.Members(),
+	})
+	if err != nil {
+		return common.Lease{}, "", err
+	}
+	url := fmt.Sprintf("%s/nodes/%s/heartbeat", primaryNodeURL, m.ID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return common.Lease{}, "", err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return common.Lease{}, "", err
+	}
+	defer res.Body.Close()
+	generation := res.Header.Get(values.GenerationHeader)
+	if res.StatusCode == 404 {
+		return common.Lease{}, generation, errNotMember
+	}
+	if res.StatusCode == 410 {
+		return common.Lease{}, generation, errRemoved
+	}
+	if res.StatusCode != 200 {
+		resBody, _ := io.ReadAll(res.Body)
+		return common.Lease{}, generation, fmt.Errorf("heartbeat failed: %s", string(resBody))
+	}
+	var lease common.Lease
+	if err := json.NewDecoder(res.Body).Decode(&lease); err != nil {
+		return common.Lease{}, generation, err
+	}
+	return lease, generation, nil
 }
 
-func (m *Service) registerSelf(ctx context.Context, port string) error {
-	registerURL := fmt.Sprintf("%s/nodes", m.PrimaryNodeURL)
+// syncTopology sets the workers to gossip with from the topology of
+// the primary, and catches up with its partition assignment in case
+// the worker missed it being pushed
+func (m *Service) syncTopology(ctx context.Context, primaryNodeURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, primaryNodeURL+"/topology", nil)
+	if err != nil {
+		return err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return fmt.Errorf("failed to get topology: status code %d", res.StatusCode)
+	}
+	var topology struct {
+		Epoch             uint64          `json:"epoch"`
+		ReplicationFactor int             `json:"replicationFactor"`
+		Nodes             []gossip.Member `json:"nodes"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&topology); err != nil {
+		return err
+	}
+	m.Gossip.Sync(topology.Nodes)
+
+	// nodes are ordered by index
+	if topology.Epoch > m.Ownership.Get().Epoch {
+		assignment := partition.Assignment{
+			Epoch:             topology.Epoch,
+			ReplicationFactor: topology.ReplicationFactor,
+			Nodes:             make([]partition.Node, 0, len(topology.Nodes)),
+		}
+		for _, n := range topology.Nodes {
+			assignment.Nodes = append(assignment.Nodes, partition.Node{ID: n.ID, Address: n.Address})
+		}
+		if err := m.Ownership.Update(assignment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Service) registerSelf(ctx context.Context, primaryNodeURL, port string) (string, error) {
+	registerURL := fmt.Sprintf("%s/nodes", primaryNodeURL)
 	body := map[string]any{
 		"id":   m.ID,
 		"port": port,
+		// a primary that lost its state continues from
+		// the epoch the worker has seen
+		"epoch": m.Ownership.Get().Epoch,
 	}
 	bodyStr, err := json.Marshal(body)
 	if err != nil {
-		return err
+		return "", err
 	}
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, registerURL, bytes.NewReader(bodyStr))
 	if err != nil {
-		return err
+		return "", err
 	}
 	req.Header.Set("Cache-Control", "no-cache")
 	res, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return err
+		return "", err
 	}
+	defer res.Body.Close()
 	if res.StatusCode != 200 {
-		defer res.Body.Close()
 		resBody, _ := io.ReadAll(res.Body)
-		return fmt.Errorf("failed to register: %s", string(resBody))
+		return "", fmt.Errorf("failed to register: %s", string(resBody))
 	}
-	return nil
+	return res.Header.Get(values.GenerationHeader), nil
 }
@@ -0,0 +1,221 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+
+	"keepair/pkg/common"
+)
+
+// Collection is a data structure value held by a key. Collections
+// are kept decoded in memory and only encoded when they leave the
+// store, e.g. when streamed or queued for a rebalance.
+type Collection interface {
+	Type() common.ValueType
+	Len() int
+	Encode() ([]byte, error)
+}
+
+type List struct {
+	Items []string `json:"items"`
+}
+
+type Set struct {
+	Members map[string]struct{} `json:"-"`
+}
+
+type Hash struct {
+	Fields map[string]string `json:"fields"`
+}
+
+type SortedSet struct {
+	Scores map[string]float64 `json:"scores"`
+}
+
+func NewCollection(valueType common.ValueType) (Collection, error) {
+	switch valueType {
+	case common.ListType:
+		return &List{Items: make([]string, 0)}, nil
+	case common.SetType:
+		return &Set{Members: make(map[string]struct{})}, nil
+	case common.HashType:
+		return &Hash{Fields: make(map[string]string)}, nil
+	case common.SortedSetType:
+		return &SortedSet{Scores: make(map[string]float64)}, nil
+	default:
+		return nil, fmt.Errorf("invalid collection type: %s", valueType)
+	}
+}
+
+// DecodeCollection restores a collection from the value
+// produced by its Encode method
+func DecodeCollection(valueType common.ValueType, value []byte) (Collection, error) {
+	collection, err := NewCollection(valueType)
+	if err != nil {
+		return nil, err
+	}
+	switch c := collection.(type) {
+	case *Set:
+		var members []string
+		if err := json.Unmarshal(value, &members); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", valueType, err)
+		}
+		for _, member := range members {
+			c.Members[member] = struct{}{}
+		}
+	default:
+		if err := json.Unmarshal(value, collection); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", valueType, err)
+		}
+	}
+	return collection, nil
+}
+
+func (l *List) Type() common.ValueType  { return common.ListType }
+func (l *List) Len() int                { return len(l.Items) }
+func (l *List) Encode() ([]byte, error) { return json.Marshal(l) }
+
+func (l *List) Push(values []string, left bool) {
+	if !left {
+		l.Items = append(l.Items, values...)
+		return
+	}
+	// like LPUSH, each value is pushed to the head in turn
+	items := make([]string, 0, len(values)+len(l.Items))
+	for i := len(values) - 1; i >= 0; i-- {
+		items = append(items, values[i])
+	}
+	l.Items = append(items, l.Items...)
+}
+
+func (l *List) Pop(left bool) (string, bool) {
+	if len(l.Items) == 0 {
+		return "", false
+	}
+	if left {
+		value := l.Items[0]
+		l.Items = l.Items[1:]
+		return value, true
+	}
+	value := l.Items[len(l.Items)-1]
+	l.Items = l.Items[:len(l.Items)-1]
+	return value, true
+}
+
+// Range returns the items between start and stop (inclusive).
+// Negative indexes count from the end of the list.
+func (l *List) Range(start, stop int) []string {
+	n := len(l.Items)
+	if start < 0 {
+		start = n + start
+	}
+	if stop < 0 {
+		stop = n + stop
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop || start >= n {
+		return []string{}
+	}
+	items := make([]string, stop-start+1)
+	copy(items, l.Items[start:stop+1])
+	return items
+}
+
+func (s *Set) Type() common.ValueType  { return common.SetType }
+func (s *Set) Len() int                { return len(s.Members) }
+func (s *Set) Encode() ([]byte, error) { return json.Marshal(s.List()) }
+
+func (s *Set) Add(members []string) int {
+	added := 0
+	for _, member := range members {
+		if _, ok := s.Members[member]; !ok {
+			s.Members[member] = struct{}{}
+			added++
+		}
+	}
+	return added
+}
+
+func (s *Set) Remove(members []string) int {
+	removed := 0
+	for _, member := range members {
+		if _, ok := s.Members[member]; ok {
+			delete(s.Members, member)
+			removed++
+		}
+	}
+	return removed
+}
+
+// List returns the members in sorted order
+func (s *Set) List() []string {
+	members := make([]string, 0, len(s.Members))
+	for member := range s.Members {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
+func (h *Hash) Type() common.ValueType  { return common.HashType }
+func (h *Hash) Len() int                { return len(h.Fields) }
+func (h *Hash) Encode() ([]byte, error) { return json.Marshal(h) }
+
+// Set sets the fields and returns the number of new fields
+func (h *Hash) Set(fields map[string]string) int {
+	added := 0
+	for field, value := range fields {
+		if _, ok := h.Fields[field]; !ok {
+			added++
+		}
+		h.Fields[field] = value
+	}
+	return added
+}
+
+func (z *SortedSet) Type() common.ValueType  { return common.SortedSetType }
+func (z *SortedSet) Len() int                { return len(z.Scores) }
+func (z *SortedSet) Encode() ([]byte, error) { return json.Marshal(z) }
+
+// Add sets the scores of the members and returns the number of
+// new members
+func (z *SortedSet) Add(members []common.ScoredMember) int {
+	added := 0
+	for _, m := range members {
+		if _, ok := z.Scores[m.Member]; !ok {
+			added++
+		}
+		z.Scores[m.Member] = m.Score
+	}
+	return added
+}
+
+// RangeByScore returns the members with a score between min and
+// max (inclusive), ordered by score and then by member
+func (z *SortedSet) RangeByScore(min, max float64) []common.ScoredMember {
+	members := make([]common.ScoredMember, 0)
+	for member, score := range z.Scores {
+		if score >= min && score <= max {
+			members = append(members, common.ScoredMember{Member: member, Score: score})
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Score != members[j].Score {
+			return members[i].Score < members[j].Score
+		}
+		return members[i].Member < members[j].Member
+	})
+	return members
+}
+
+// isValidScore rejects scores that cannot be encoded as JSON
+func isValidScore(score float64) bool {
+	return !math.IsNaN(score) && !math.IsInf(score, 0)
+}
@@ -0,0 +1,6 @@
+package store
+
+import "keepair/pkg/common"
+
+var ErrWrongType = common.ErrWrongType
+var ErrNotFound = common.ErrNotFound
@@ -0,0 +1,173 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"keepair/pkg/common"
+	"keepair/pkg/log"
+)
+
+type operationQueue struct {
+	info       common.OperationQueue
+	operations []common.EntryOperation
+	batches    map[string]bool
+}
+
+// QueueOperations adds operations to a queue, creating it if needed,
+// to be applied with ApplyOperations. A batch whose ID was already
+// received by the queue is ignored, so senders can retry it. It
+// returns whether the operations were queued.
+func (m *MemStore) QueueOperations(queueID string, batchID string, operations []common.EntryOperation) (bool, error) {
+	m.opQueueMu.Lock()
+	defer m.opQueueMu.Unlock()
+
+	if queueID == "" {
+		queueID = common.DefaultQueue
+	}
+	q, ok := m.operationQueues[queueID]
+	if !ok {
+		now := time.Now()
+		q = &operationQueue{
+			info:    common.OperationQueue{ID: queueID, CreatedAt: now, UpdatedAt: now},
+			batches: make(map[string]bool),
+		}
+		m.operationQueues[queueID] = q
+	}
+	if batchID != "" {
+		if q.batches[batchID] {
+			log.Get().Printf("[%s] IGNORED BATCH %s ALREADY IN QUEUE %s", m.WorkerID, batchID, queueID)
+			return false, nil
+		}
+		q.batches[batchID] = true
+	}
+
+	for _, op := range operations {
+		log.Get().Printf("[%s] ADDED TO QUEUE %s: %s => %s", m.WorkerID, queueID, op.Action, op.Entry.Key)
+		q.operations = append(q.operations, op)
+		q.info.Bytes += int64(len(op.Entry.Value))
+	}
+	q.info.Batches++
+	q.info.UpdatedAt = time.Now()
+
+	return true, nil
+}
+
+// ApplyOperations applies the operations of a queue, leaving the other
+// queues untouched. With keepNewer, keys written after the queued
+// copies of them were made are kept. A queue that does not exist
+// has nothing to apply. The applied queue is kept, without its
+// operations, so that its batches are recognized if they are retried,
+// until it is discarded.
+func (m *MemStore) ApplyOperations(queueID string, keepNewer bool) error {
+	m.opQueueMu.Lock()
+	m.dataMu.Lock()
+	defer func() {
+		m.dataMu.Unlock()
+		m.opQueueMu.Unlock()
+	}()
+
+	if queueID == "" {
+		queueID = common.DefaultQueue
+	}
+	q, ok := m.operationQueues[queueID]
+	if !ok || len(q.operations) == 0 {
+		return nil
+	}
+
+	log.Get().Printf("=============")
+	log.Get().Printf("[%s] BEFORE APPLY %s: %d", m.WorkerID, queueID, len(m.Data)+len(m.Collections))
+	log.Get().Printf("=============")
+
+	applied := 0
+	for i, op := range q.operations {
+		log.Get().Printf("[%s] entry: %s %s (%d)", m.WorkerID, op.Action, op.Entry.Key, len(op.Entry.Value))
+		switch op.Action {
+		case common.SetEntry:
+			if keepNewer && op.Entry.Timestamp != 0 && m.latestVersion(op.Entry.Key) > op.Entry.Timestamp {
+				continue
+			}
+			if err := m.setEntry(op.Entry); err != nil {
+				// keep what was not applied, to be inspected or discarded
+				q.info.Applied += applied
+				q.operations = q.operations[i:]
+				return err
+			}
+			applied++
+			if err := m.publish(common.SetEntry, op.Entry, common.RebalanceOrigin); err != nil {
+				q.info.Applied += applied
+				q.operations = q.operations[i+1:]
+				return err
+			}
+		case common.DeleteEntry:
+			m.removeKey(op.Entry.Key)
+			applied++
+			if err := m.publish(common.DeleteEntry, common.Entry{Key: op.Entry.Key}, common.RebalanceOrigin); err != nil {
+				q.info.Applied += applied
+				q.operations = q.operations[i+1:]
+				return err
+			}
+		default:
+			panic(fmt.Errorf("invalid entry action: %s", op.Action))
+		}
+	}
+
+	log.Get().Printf("=============")
+	log.Get().Printf("[%s] AFTER APPLY %s: %d", m.WorkerID, queueID, len(m.Data)+len(m.Collections))
+	log.Get().Printf("=============")
+
+	q.info.Applied += applied
+	q.info.Bytes = 0
+	q.info.UpdatedAt = time.Now()
+	q.operations = nil
+
+	return nil
+}
+
+// GetOperationQueues returns the queues with pending operations
+// and the applied ones not discarded yet, without their operations
+func (m *MemStore) GetOperationQueues() []common.OperationQueue {
+	m.opQueueMu.RLock()
+	defer m.opQueueMu.RUnlock()
+
+	queues := make([]common.OperationQueue, 0, len(m.operationQueues))
+	for _, q := range m.operationQueues {
+		info := q.info
+		info.Pending = len(q.operations)
+		queues = append(queues, info)
+	}
+	sort.Slice(queues, func(i, j int) bool {
+		return queues[i].CreatedAt.Before(queues[j].CreatedAt)
+	})
+	return queues
+}
+
+// GetOperationQueue returns a queue with its pending operations
+func (m *MemStore) GetOperationQueue(queueID string) (common.OperationQueue, bool) {
+	m.opQueueMu.RLock()
+	defer m.opQueueMu.RUnlock()
+
+	q, ok := m.operationQueues[queueID]
+	if !ok {
+		return common.OperationQueue{}, false
+	}
+	info := q.info
+	info.Pending = len(q.operations)
+	info.Operations = append([]common.EntryOperation{}, q.operations...)
+	return info, true
+}
+
+// DiscardOperationQueue drops a queue without applying its operations,
+// forgetting the batches it received. It returns whether it existed.
+func (m *MemStore) DiscardOperationQueue(queueID string) bool {
+	m.opQueueMu.Lock()
+	defer m.opQueueMu.Unlock()
+
+	if _, ok := m.operationQueues[queueID]; !ok {
+		return false
+	}
+	log.Get().Printf("[%s] DISCARDED QUEUE %s", m.WorkerID, queueID)
+	delete(m.operationQueues, queueID)
+	return true
+}
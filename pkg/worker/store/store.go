@@ -2,68 +2,562 @@ package store
 
 import (
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"keepair/pkg/common"
+	"keepair/pkg/document"
 	"keepair/pkg/log"
+	"keepair/pkg/values"
+	"keepair/pkg/worker/changefeed"
+	"keepair/pkg/worker/changelog"
+	"keepair/pkg/worker/merkle"
 )
 
 type IStore interface {
 	Set(key string, value []byte) error
 	Delete(key string) error
 	Get(key string) ([]byte, error)
+	SetVersioned(key string, value []byte, timestamp int64) (bool, error)
+	DeleteVersioned(key string, timestamp int64) (bool, error)
+	GetVersioned(key string) (common.VersionedValue, error)
+	GetEntry(key string) (common.Entry, bool)
+	GetPath(key string, path string) ([]byte, error)
+	Patch(key string, patch []byte) ([]byte, error)
+	ListPush(key string, values []string, left bool) (int, error)
+	ListPop(key string, left bool) (string, error)
+	ListRange(key string, start, stop int) ([]string, error)
+	SetAdd(key string, members []string) (int, error)
+	SetRemove(key string, members []string) (int, error)
+	SetMembers(key string) ([]string, error)
+	HashSet(key string, fields map[string]string) (int, error)
+	HashGet(key string, field string) (string, error)
+	HashGetAll(key string) (map[string]string, error)
+	SortedSetAdd(key string, members []common.ScoredMember) (int, error)
+	SortedSetRangeByScore(key string, min, max float64) ([]common.ScoredMember, error)
 	GetObjectCount() int
+	GetDigest() common.Digest
+	GetBucketDigest(bucket int) ([]common.KeyDigest, error)
+	Subscribe(since uint64) (<-chan common.ChangeEvent, changefeed.CancelFunc)
+	ChangeLog() changelog.Log
+	Close() error
 	StreamEntries() <-chan common.Entry
-	QueueOperations(operations []common.EntryOperation) error
-	ApplyOperations() error
+	QueueOperations(queueID string, batchID string, operations []common.EntryOperation) (bool, error)
+	ApplyOperations(queueID string, keepNewer bool) error
+	GetOperationQueues() []common.OperationQueue
+	GetOperationQueue(queueID string) (common.OperationQueue, bool)
+	DiscardOperationQueue(queueID string) bool
+	Replicate(operations []common.EntryOperation) error
+	CompactTombstones(before int64) int
 }
 
 type MemStore struct {
 	WorkerID string
 
-	dataMu sync.RWMutex
-	Data   map[string][]byte
+	// Data holds plain values and Collections holds data
+	// structures. A key is never present in both.
+	dataMu      sync.RWMutex
+	Data        map[string][]byte
+	Collections map[string]Collection
 
+	// Versions holds the timestamp of the last write to each key and
+	// Tombstones the timestamp of versioned deletes, so that older
+	// writes arriving late do not overwrite newer ones
+	Versions   map[string]int64
+	Tombstones map[string]int64
+
+	// Changes is published to while holding dataMu, so
+	// events are sequenced in the order they were applied
+	Changes *changefeed.Feed
+
+	// Digest is a Merkle tree of the keys, updated on every change
+	Digest *merkle.Tree
+
+	// operationQueues holds the operations queued by each migration
+	// until they are applied, and the applied queues until they are
+	// discarded. The store is kept in memory, and so are its queues.
 	opQueueMu       sync.RWMutex
-	OperationsQueue []common.EntryOperation
+	operationQueues map[string]*operationQueue
 }
 
-func NewMemStore(workerID string) IStore {
+func NewMemStore(workerID string, changeLog changelog.Log) IStore {
 	return &MemStore{
-		WorkerID: workerID,
-		Data:     make(map[string][]byte),
+		WorkerID:    workerID,
+		Data:        make(map[string][]byte),
+		Collections: make(map[string]Collection),
+		Versions:    make(map[string]int64),
+		Tombstones:  make(map[string]int64),
+		Changes:     changefeed.NewFeed(workerID, changeLog),
+		Digest:      merkle.New(values.DigestBuckets),
+
+		operationQueues: make(map[string]*operationQueue),
 	}
 }
 
 func (m *MemStore) Set(key string, value []byte) error {
 	m.dataMu.Lock()
 	m.Data[key] = value
+	delete(m.Collections, key)
+	timestamp := m.touch(key)
+	err := m.publish(common.SetEntry, common.Entry{Key: key, Value: value, Timestamp: timestamp}, common.ClientOrigin)
 	m.dataMu.Unlock()
-	return nil
+	return err
 }
 
 func (m *MemStore) Delete(key string) error {
 	m.dataMu.Lock()
-	delete(m.Data, key)
+	m.removeKey(key)
+	err := m.publish(common.DeleteEntry, common.Entry{Key: key}, common.ClientOrigin)
 	m.dataMu.Unlock()
-	return nil
+	return err
+}
+
+// SetVersioned sets a plain value written at timestamp, unless the
+// key was already written or deleted at the same time or later.
+// It returns whether the value was applied.
+func (m *MemStore) SetVersioned(key string, value []byte, timestamp int64) (bool, error) {
+	m.dataMu.Lock()
+	defer m.dataMu.Unlock()
+
+	if timestamp <= m.latestVersion(key) {
+		return false, nil
+	}
+	m.Data[key] = value
+	delete(m.Collections, key)
+	delete(m.Tombstones, key)
+	m.Versions[key] = timestamp
+	if err := m.publish(common.SetEntry, common.Entry{Key: key, Value: value, Timestamp: timestamp}, common.ClientOrigin); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DeleteVersioned deletes a key at timestamp, leaving a tombstone,
+// unless it was already written or deleted at the same time or later.
+// It returns whether the delete was applied.
+func (m *MemStore) DeleteVersioned(key string, timestamp int64) (bool, error) {
+	m.dataMu.Lock()
+	defer m.dataMu.Unlock()
+
+	if timestamp <= m.latestVersion(key) {
+		return false, nil
+	}
+	m.removeKey(key)
+	m.Tombstones[key] = timestamp
+	if err := m.publish(common.DeleteEntry, common.Entry{Key: key, Timestamp: timestamp}, common.ClientOrigin); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetVersioned returns the plain value of a key with the timestamp
+// it was written at. Deleted keys are returned with the timestamp
+// of their tombstone.
+func (m *MemStore) GetVersioned(key string) (common.VersionedValue, error) {
+	m.dataMu.RLock()
+	defer m.dataMu.RUnlock()
+
+	if timestamp, ok := m.Tombstones[key]; ok {
+		return common.VersionedValue{Timestamp: timestamp, Deleted: true}, nil
+	}
+	if _, ok := m.Data[key]; !ok {
+		if _, ok := m.Collections[key]; !ok {
+			return common.VersionedValue{}, nil
+		}
+	}
+	value, err := m.getValue(key)
+	if err != nil {
+		return common.VersionedValue{}, err
+	}
+	return common.VersionedValue{Value: value, Timestamp: m.Versions[key], Found: true}, nil
+}
+
+// CompactTombstones forgets the versioned deletes made before a
+// timestamp, once no older write of their keys is expected to
+// arrive. It returns the number of tombstones removed.
+func (m *MemStore) CompactTombstones(before int64) int {
+	m.dataMu.Lock()
+	defer m.dataMu.Unlock()
+
+	removed := 0
+	for key, timestamp := range m.Tombstones {
+		if timestamp < before {
+			delete(m.Tombstones, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// latestVersion returns the timestamp of the last write or
+// versioned delete of a key. Caller must handle locks.
+func (m *MemStore) latestVersion(key string) int64 {
+	if timestamp, ok := m.Tombstones[key]; ok {
+		return timestamp
+	}
+	return m.Versions[key]
+}
+
+// touch records that a key was written now and returns the
+// timestamp. Caller must handle locks.
+func (m *MemStore) touch(key string) int64 {
+	timestamp := time.Now().UnixNano()
+	m.Versions[key] = timestamp
+	delete(m.Tombstones, key)
+	return timestamp
+}
+
+// publish updates the digest with a change and publishes it to
+// the change feed. Caller must hold dataMu.
+func (m *MemStore) publish(action common.EntryOperationAction, entry common.Entry, origin common.ChangeOrigin) error {
+	if action == common.DeleteEntry {
+		m.Digest.Delete(entry.Key)
+	} else {
+		m.Digest.Set(entry.Key, merkle.HashEntry(entry))
+	}
+	_, err := m.Changes.Publish(action, entry, origin)
+	return err
+}
+
+func (m *MemStore) GetDigest() common.Digest {
+	buckets := m.Digest.Buckets()
+	digest := common.Digest{
+		Root:    m.Digest.Root().String(),
+		Buckets: make([]string, 0, len(buckets)),
+	}
+	for _, bucket := range buckets {
+		digest.Buckets = append(digest.Buckets, bucket.String())
+	}
+	return digest
+}
+
+func (m *MemStore) GetBucketDigest(bucket int) ([]common.KeyDigest, error) {
+	if bucket < 0 || bucket >= m.Digest.NumBuckets() {
+		return nil, fmt.Errorf("%w: bucket %d", ErrNotFound, bucket)
+	}
+	keys := m.Digest.Keys(bucket)
+	digests := make([]common.KeyDigest, 0, len(keys))
+	for key, hash := range keys {
+		digests = append(digests, common.KeyDigest{Key: key, Hash: hash.String()})
+	}
+	sort.Slice(digests, func(i, j int) bool {
+		return digests[i].Key < digests[j].Key
+	})
+	return digests, nil
+}
+
+// removeKey deletes a key and its version. Caller must handle locks.
+func (m *MemStore) removeKey(key string) {
+	delete(m.Data, key)
+	delete(m.Collections, key)
+	delete(m.Versions, key)
 }
 
 func (m *MemStore) Get(key string) ([]byte, error) {
 	m.dataMu.RLock()
 	defer m.dataMu.RUnlock()
 
+	return m.getValue(key)
+}
+
+// getValue returns the plain value of a key.
+// Caller must handle locks.
+func (m *MemStore) getValue(key string) ([]byte, error) {
 	if value, ok := m.Data[key]; ok {
 		return value, nil
 	}
-	return nil, fmt.Errorf("no value found for key: %s", key)
+	if collection, ok := m.Collections[key]; ok {
+		return nil, fmt.Errorf("%w: key %s holds a %s", ErrWrongType, key, collection.Type())
+	}
+	return nil, fmt.Errorf("%w: no value found for key: %s", ErrNotFound, key)
+}
+
+// GetEntry returns the entry of a key, whether it holds
+// a plain value or a collection
+func (m *MemStore) GetEntry(key string) (common.Entry, bool) {
+	m.dataMu.RLock()
+	defer m.dataMu.RUnlock()
+
+	if value, ok := m.Data[key]; ok {
+		return common.Entry{Key: key, Value: value, Timestamp: m.Versions[key]}, true
+	}
+	if collection, ok := m.Collections[key]; ok {
+		value, err := collection.Encode()
+		if err != nil {
+			panic(fmt.Errorf("failed to encode %s (%s): %w", key, collection.Type(), err))
+		}
+		return common.Entry{Key: key, Value: value, Type: collection.Type(), Timestamp: m.Versions[key]}, true
+	}
+	return common.Entry{}, false
+}
+
+// GetPath returns the sub-document at path of a JSON value
+func (m *MemStore) GetPath(key string, path string) ([]byte, error) {
+	m.dataMu.RLock()
+	defer m.dataMu.RUnlock()
+
+	value, err := m.getValue(key)
+	if err != nil {
+		return nil, err
+	}
+	return document.Extract(value, path)
+}
+
+// Patch applies a JSON Merge Patch to a JSON value. The read,
+// merge and write happen under a single lock so concurrent
+// patches to the same key cannot overwrite each other.
+func (m *MemStore) Patch(key string, patch []byte) ([]byte, error) {
+	m.dataMu.Lock()
+	defer m.dataMu.Unlock()
+
+	value, err := m.getValue(key)
+	if err != nil {
+		return nil, err
+	}
+	patched, err := document.MergePatch(value, patch)
+	if err != nil {
+		return nil, err
+	}
+	m.Data[key] = patched
+	timestamp := m.touch(key)
+	if err := m.publish(common.SetEntry, common.Entry{Key: key, Value: patched, Timestamp: timestamp}, common.ClientOrigin); err != nil {
+		return nil, err
+	}
+	return patched, nil
+}
+
+// getCollection returns the collection held by key. If the key does
+// not exist and create is true, a new collection is added, otherwise
+// nil is returned. Caller must handle locks.
+func (m *MemStore) getCollection(key string, valueType common.ValueType, create bool) (Collection, error) {
+	if _, ok := m.Data[key]; ok {
+		return nil, fmt.Errorf("%w: key %s holds a plain value", ErrWrongType, key)
+	}
+	if collection, ok := m.Collections[key]; ok {
+		if collection.Type() != valueType {
+			return nil, fmt.Errorf("%w: key %s holds a %s", ErrWrongType, key, collection.Type())
+		}
+		return collection, nil
+	}
+	if !create {
+		return nil, nil
+	}
+	collection, err := NewCollection(valueType)
+	if err != nil {
+		return nil, err
+	}
+	m.Collections[key] = collection
+	return collection, nil
+}
+
+// collectionChanged publishes a change to a collection, deleting the
+// collection once its last element has been removed.
+// Caller must handle locks.
+func (m *MemStore) collectionChanged(key string, collection Collection) error {
+	if collection.Len() == 0 {
+		m.removeKey(key)
+		return m.publish(common.DeleteEntry, common.Entry{Key: key, Type: collection.Type()}, common.ClientOrigin)
+	}
+	value, err := collection.Encode()
+	if err != nil {
+		log.Get().Printf("[%s] failed to encode %s for change log: %s", m.WorkerID, key, err)
+	}
+	timestamp := m.touch(key)
+	return m.publish(common.SetEntry, common.Entry{Key: key, Value: value, Type: collection.Type(), Timestamp: timestamp}, common.ClientOrigin)
+}
+
+func (m *MemStore) ListPush(key string, values []string, left bool) (int, error) {
+	m.dataMu.Lock()
+	defer m.dataMu.Unlock()
+
+	collection, err := m.getCollection(key, common.ListType, true)
+	if err != nil {
+		return 0, err
+	}
+	list := collection.(*List)
+	list.Push(values, left)
+	if err := m.collectionChanged(key, list); err != nil {
+		return 0, err
+	}
+	return list.Len(), nil
+}
+
+func (m *MemStore) ListPop(key string, left bool) (string, error) {
+	m.dataMu.Lock()
+	defer m.dataMu.Unlock()
+
+	collection, err := m.getCollection(key, common.ListType, false)
+	if err != nil {
+		return "", err
+	}
+	if collection == nil {
+		return "", fmt.Errorf("%w: list is empty: %s", ErrNotFound, key)
+	}
+	list := collection.(*List)
+	value, _ := list.Pop(left)
+	if err := m.collectionChanged(key, list); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+func (m *MemStore) ListRange(key string, start, stop int) ([]string, error) {
+	m.dataMu.RLock()
+	defer m.dataMu.RUnlock()
+
+	collection, err := m.getCollection(key, common.ListType, false)
+	if err != nil || collection == nil {
+		return []string{}, err
+	}
+	return collection.(*List).Range(start, stop), nil
+}
+
+func (m *MemStore) SetAdd(key string, members []string) (int, error) {
+	m.dataMu.Lock()
+	defer m.dataMu.Unlock()
+
+	collection, err := m.getCollection(key, common.SetType, true)
+	if err != nil {
+		return 0, err
+	}
+	set := collection.(*Set)
+	added := set.Add(members)
+	if err := m.collectionChanged(key, set); err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+func (m *MemStore) SetRemove(key string, members []string) (int, error) {
+	m.dataMu.Lock()
+	defer m.dataMu.Unlock()
+
+	collection, err := m.getCollection(key, common.SetType, false)
+	if err != nil || collection == nil {
+		return 0, err
+	}
+	set := collection.(*Set)
+	removed := set.Remove(members)
+	if removed > 0 {
+		if err := m.collectionChanged(key, set); err != nil {
+			return 0, err
+		}
+	}
+	return removed, nil
+}
+
+func (m *MemStore) SetMembers(key string) ([]string, error) {
+	m.dataMu.RLock()
+	defer m.dataMu.RUnlock()
+
+	collection, err := m.getCollection(key, common.SetType, false)
+	if err != nil || collection == nil {
+		return []string{}, err
+	}
+	return collection.(*Set).List(), nil
+}
+
+func (m *MemStore) HashSet(key string, fields map[string]string) (int, error) {
+	m.dataMu.Lock()
+	defer m.dataMu.Unlock()
+
+	collection, err := m.getCollection(key, common.HashType, true)
+	if err != nil {
+		return 0, err
+	}
+	hash := collection.(*Hash)
+	added := hash.Set(fields)
+	if err := m.collectionChanged(key, hash); err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+func (m *MemStore) HashGet(key string, field string) (string, error) {
+	m.dataMu.RLock()
+	defer m.dataMu.RUnlock()
+
+	collection, err := m.getCollection(key, common.HashType, false)
+	if err != nil {
+		return "", err
+	}
+	if collection != nil {
+		if value, ok := collection.(*Hash).Fields[field]; ok {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("%w: field %s of key %s", ErrNotFound, field, key)
+}
+
+func (m *MemStore) HashGetAll(key string) (map[string]string, error) {
+	m.dataMu.RLock()
+	defer m.dataMu.RUnlock()
+
+	fields := make(map[string]string)
+	collection, err := m.getCollection(key, common.HashType, false)
+	if err != nil || collection == nil {
+		return fields, err
+	}
+	for k, v := range collection.(*Hash).Fields {
+		fields[k] = v
+	}
+	return fields, nil
+}
+
+func (m *MemStore) SortedSetAdd(key string, members []common.ScoredMember) (int, error) {
+	for _, member := range members {
+		if !isValidScore(member.Score) {
+			return 0, fmt.Errorf("invalid score for member %s: %f", member.Member, member.Score)
+		}
+	}
+
+	m.dataMu.Lock()
+	defer m.dataMu.Unlock()
+
+	collection, err := m.getCollection(key, common.SortedSetType, true)
+	if err != nil {
+		return 0, err
+	}
+	zset := collection.(*SortedSet)
+	added := zset.Add(members)
+	if err := m.collectionChanged(key, zset); err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+func (m *MemStore) SortedSetRangeByScore(key string, min, max float64) ([]common.ScoredMember, error) {
+	m.dataMu.RLock()
+	defer m.dataMu.RUnlock()
+
+	collection, err := m.getCollection(key, common.SortedSetType, false)
+	if err != nil || collection == nil {
+		return []common.ScoredMember{}, err
+	}
+	return collection.(*SortedSet).RangeByScore(min, max), nil
 }
 
 func (m *MemStore) GetObjectCount() int {
 	m.dataMu.RLock()
 	defer m.dataMu.RUnlock()
 
-	return len(m.Data)
+	return len(m.Data) + len(m.Collections)
+}
+
+// Subscribe returns the changes made after since, followed by
+// new changes as they are made
+func (m *MemStore) Subscribe(since uint64) (<-chan common.ChangeEvent, changefeed.CancelFunc) {
+	return m.Changes.Subscribe(since)
+}
+
+// ChangeLog returns the log of changes made to the store
+func (m *MemStore) ChangeLog() changelog.Log {
+	return m.Changes.Log
+}
+
+func (m *MemStore) Close() error {
+	return m.Changes.Log.Close()
 }
 
 func (m *MemStore) StreamEntries() <-chan common.Entry {
@@ -74,8 +568,21 @@ func (m *MemStore) StreamEntries() <-chan common.Entry {
 
 		for k, v := range m.Data {
 			ch <- common.Entry{
-				Key:   k,
-				Value: v,
+				Key:       k,
+				Value:     v,
+				Timestamp: m.Versions[k],
+			}
+		}
+		for k, collection := range m.Collections {
+			value, err := collection.Encode()
+			if err != nil {
+				panic(fmt.Errorf("failed to encode %s (%s): %w", k, collection.Type(), err))
+			}
+			ch <- common.Entry{
+				Key:       k,
+				Value:     value,
+				Type:      collection.Type(),
+				Timestamp: m.Versions[k],
 			}
 		}
 		close(ch)
@@ -83,47 +590,57 @@ func (m *MemStore) StreamEntries() <-chan common.Entry {
 	return ch
 }
 
-func (m *MemStore) QueueOperations(operations []common.EntryOperation) error {
-	m.opQueueMu.Lock()
-	defer m.opQueueMu.Unlock()
-
-	for _, op := range operations {
-		log.Get().Printf("[%s] ADDED TO QUEUE: %s => %s", m.WorkerID, op.Action, op.Entry.Key)
-		m.OperationsQueue = append(m.OperationsQueue, op)
+// setEntry stores an entry, restoring its collection if it has
+// a type, and keeps the timestamp it was written at.
+// Caller must handle locks.
+func (m *MemStore) setEntry(entry common.Entry) error {
+	if entry.Type == common.StringType {
+		m.Data[entry.Key] = entry.Value
+		delete(m.Collections, entry.Key)
+	} else {
+		collection, err := DecodeCollection(entry.Type, entry.Value)
+		if err != nil {
+			return fmt.Errorf("failed to restore key %s: %w", entry.Key, err)
+		}
+		m.Collections[entry.Key] = collection
+		delete(m.Data, entry.Key)
+	}
+	if entry.Timestamp != 0 {
+		m.Versions[entry.Key] = entry.Timestamp
+		delete(m.Tombstones, entry.Key)
+	} else {
+		m.touch(entry.Key)
 	}
-
 	return nil
 }
 
-func (m *MemStore) ApplyOperations() error {
-	m.opQueueMu.Lock()
+// Replicate immediately applies operations forwarded by the
+// leader replica of their keys. Timestamped deletes leave a tombstone.
+func (m *MemStore) Replicate(operations []common.EntryOperation) error {
 	m.dataMu.Lock()
-	defer func() {
-		m.dataMu.Unlock()
-		m.opQueueMu.Unlock()
-	}()
+	defer m.dataMu.Unlock()
 
-	log.Get().Printf("=============")
-	log.Get().Printf("[%s] BEFORE APPLY: %d", m.WorkerID, len(m.Data))
-	log.Get().Printf("=============")
-
-	for _, op := range m.OperationsQueue {
-		log.Get().Printf("[%s] entry: %s %s (%d)", m.WorkerID, op.Action, op.Entry.Key, len(op.Entry.Value))
+	for _, op := range operations {
 		switch op.Action {
 		case common.SetEntry:
-			m.Data[op.Entry.Key] = op.Entry.Value
+			if err := m.setEntry(op.Entry); err != nil {
+				return err
+			}
+			if err := m.publish(common.SetEntry, op.Entry, common.ReplicationOrigin); err != nil {
+				return err
+			}
 		case common.DeleteEntry:
-			delete(m.Data, op.Entry.Key)
+			m.removeKey(op.Entry.Key)
+			if op.Entry.Timestamp != 0 {
+				m.Tombstones[op.Entry.Key] = op.Entry.Timestamp
+			}
+			if err := m.publish(common.DeleteEntry, common.Entry{Key: op.Entry.Key}, common.ReplicationOrigin); err != nil {
+				return err
+			}
 		default:
-			panic(fmt.Errorf("invalid entry action: %s", op.Action))
+			return fmt.Errorf("invalid entry action: %s", op.Action)
 		}
 	}
 
-	log.Get().Printf("=============")
-	log.Get().Printf("[%s] AFTER APPLY: %d", m.WorkerID, len(m.Data))
-	log.Get().Printf("=============")
-
-	m.OperationsQueue = make([]common.EntryOperation, 0)
-
 	return nil
 }
@@ -0,0 +1,35 @@
+package store
+
+import (
+	"testing"
+
+	"keepair/pkg/worker/changelog"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompactTombstones(t *testing.T) {
+	s := NewMemStore("worker", changelog.NewMemoryLog(changelog.DefaultConfig()))
+
+	for key, timestamp := range map[string]int64{"old": 10, "recent": 30} {
+		applied, err := s.DeleteVersioned(key, timestamp)
+		assert.NoError(t, err)
+		assert.True(t, applied)
+	}
+
+	assert.Equal(t, 1, s.CompactTombstones(20))
+	assert.Equal(t, 0, s.CompactTombstones(20))
+
+	// a recent tombstone still rejects older writes
+	applied, err := s.SetVersioned("recent", []byte("stale"), 25)
+	assert.NoError(t, err)
+	assert.False(t, applied)
+
+	// a compacted one no longer holds the key's version
+	version, err := s.GetVersioned("old")
+	assert.NoError(t, err)
+	assert.False(t, version.Deleted)
+	applied, err = s.SetVersioned("old", []byte("value"), 15)
+	assert.NoError(t, err)
+	assert.True(t, applied)
+}
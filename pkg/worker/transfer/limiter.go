@@ -0,0 +1,56 @@
+package transfer
+
+import "time"
+
+// limiter paces a copy to at most a number of keys
+// and bytes per second, with no limit if zero
+type limiter struct {
+	start          time.Time
+	keysPerSecond  int
+	bytesPerSecond int64
+	keys           int
+	bytes          int64
+}
+
+func newLimiter(keysPerSecond int, bytesPerSecond int64) *limiter {
+	return &limiter{
+		start:          time.Now(),
+		keysPerSecond:  keysPerSecond,
+		bytesPerSecond: bytesPerSecond,
+	}
+}
+
+// wait sleeps until keys and bytes can be sent without going over
+// the limits, and returns false if canceled before then
+func (l *limiter) wait(keys int, bytes int64, canceled <-chan struct{}) bool {
+	d := time.Until(l.start.Add(l.reserve(keys, bytes)))
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-canceled:
+		return false
+	}
+}
+
+// reserve counts keys and bytes as sent, and returns how long after
+// the start everything sent so far may have been sent
+func (l *limiter) reserve(keys int, bytes int64) time.Duration {
+	l.keys += keys
+	l.bytes += bytes
+
+	var d time.Duration
+	if l.keysPerSecond > 0 {
+		d = time.Duration(float64(l.keys) / float64(l.keysPerSecond) * float64(time.Second))
+	}
+	if l.bytesPerSecond > 0 {
+		if b := time.Duration(float64(l.bytes) / float64(l.bytesPerSecond) * float64(time.Second)); b > d {
+			d = b
+		}
+	}
+	return d
+}
@@ -0,0 +1,31 @@
+package transfer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLimiter checks that the slowest of the limits paces a copy
+func TestLimiter(t *testing.T) {
+	l := newLimiter(100, 1000)
+	assert.Equal(t, time.Millisecond*100, l.reserve(10, 10))
+	// the bytes limit is the slowest
+	assert.Equal(t, time.Second, l.reserve(10, 990))
+	assert.Equal(t, time.Second*2, l.reserve(180, 0))
+
+	unlimited := newLimiter(0, 0)
+	assert.Equal(t, time.Duration(0), unlimited.reserve(1000, 1000))
+}
+
+// TestLimiterCanceled checks that a canceled copy stops waiting
+func TestLimiterCanceled(t *testing.T) {
+	l := newLimiter(1, 0)
+	canceled := make(chan struct{})
+	close(canceled)
+	start := time.Now()
+	assert.False(t, l.wait(60, 0, canceled))
+	assert.Less(t, time.Since(start), time.Second)
+	assert.True(t, newLimiter(0, 0).wait(60, 0, canceled))
+}
@@ -0,0 +1,81 @@
+package transfer
+
+import (
+	"errors"
+	"sync"
+
+	"keepair/pkg/partition"
+)
+
+// ErrCanceled is returned by a copy canceled before it sent every batch
+var ErrCanceled = errors.New("transfer canceled")
+
+// Tracker keeps the progress of the copies a worker is
+// sending, by the ID of their request, and cancels them
+type Tracker struct {
+	mu       sync.Mutex
+	progress map[string][]partition.Transfer
+	cancel   map[string]chan struct{}
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		progress: make(map[string][]partition.Transfer),
+		cancel:   make(map[string]chan struct{}),
+	}
+}
+
+// Get returns what a copy in progress has sent so far
+func (t *Tracker) Get(ID string) ([]partition.Transfer, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	transfers, ok := t.progress[ID]
+	return transfers, ok
+}
+
+// Cancel stops a copy in progress before its next batch,
+// and returns whether there was one
+func (t *Tracker) Cancel(ID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ch, ok := t.cancel[ID]
+	if !ok {
+		return false
+	}
+	select {
+	case <-ch:
+	default:
+		close(ch)
+	}
+	return true
+}
+
+// start tracks a copy, and returns the channel
+// closed when it is canceled
+func (t *Tracker) start(ID string) <-chan struct{} {
+	ch := make(chan struct{})
+	if ID == "" {
+		return ch
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.progress[ID] = []partition.Transfer{}
+	t.cancel[ID] = ch
+	return ch
+}
+
+func (t *Tracker) update(ID string, transfers []partition.Transfer) {
+	if ID == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.progress[ID] = transfers
+}
+
+func (t *Tracker) done(ID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.progress, ID)
+	delete(t.cancel, ID)
+}
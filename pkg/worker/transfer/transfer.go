@@ -0,0 +1,270 @@
+package transfer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"keepair/pkg/common"
+	"keepair/pkg/log"
+	"keepair/pkg/partition"
+	"keepair/pkg/worker/store"
+
+	"github.com/google/uuid"
+)
+
+// DefaultBatchSize is the number of entries sent at once
+// when a request does not set it
+const DefaultBatchSize = 500
+
+// sendRetries is the number of times a batch that failed to be sent is
+// sent again. Targets queue a batch only once, so a batch that was
+// queued but whose response was lost is not copied twice.
+const sendRetries = 3
+
+// Copy sends the entries of the store to the nodes that own them in the
+// next placement of the requested assignment and miss them, in batches
+// queued on each target under the ID of the request. It returns the keys and bytes sent to each
+// target, with how long sending them took. The progress of the copy
+// is kept in the tracker until it ends, and a copy canceled through
+// the tracker stops before its next batch with ErrCanceled.
+func Copy(workerID string, store store.IStore, req partition.TransferRequest, tracker *Tracker) ([]partition.Transfer, error) {
+	batchSize := req.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	// with a low limit, send batches of at most a second of keys
+	if req.MaxKeysPerSecond > 0 && req.MaxKeysPerSecond < batchSize {
+		batchSize = req.MaxKeysPerSecond
+	}
+
+	canceled := tracker.start(req.ID)
+	defer tracker.done(req.ID)
+
+	// the store is locked while its entries are streamed, so only
+	// find the keys to copy, and read each one when it is sent
+	type pendingKey struct {
+		key     string
+		targets []partition.Node
+	}
+	pending := make([]pendingKey, 0)
+	for entry := range store.StreamEntries() {
+		if targets := req.Assignment.CopyTargets(workerID, entry.Key, req.Skip); len(targets) > 0 {
+			pending = append(pending, pendingKey{key: entry.Key, targets: targets})
+		}
+	}
+
+	type target struct {
+		node  partition.Node
+		batch []common.EntryOperation
+		size  int64
+		move  partition.Move
+	}
+	targets := make(map[string]*target)
+	start := time.Now()
+	limit := newLimiter(req.MaxKeysPerSecond, req.MaxBytesPerSecond)
+	transfers := func() []partition.Transfer {
+		moves := make([]partition.Move, 0, len(targets))
+		for _, t := range targets {
+			moves = append(moves, t.move)
+		}
+		partition.SortMoves(moves)
+		transfers := make([]partition.Transfer, 0, len(moves))
+		for _, m := range moves {
+			transfers = append(transfers, partition.NewTransfer(m, time.Since(start)))
+		}
+		return transfers
+	}
+	send := func(t *target) error {
+		if !limit.wait(len(t.batch), t.size, canceled) {
+			return ErrCanceled
+		}
+		select {
+		case <-canceled:
+			return ErrCanceled
+		default:
+		}
+		if err := Send(t.node.URL(), req.ID, uuid.NewString(), t.batch); err != nil {
+			return err
+		}
+		t.move.Keys += len(t.batch)
+		t.move.Bytes += t.size
+		t.batch, t.size = t.batch[:0], 0
+		tracker.update(req.ID, transfers())
+		return nil
+	}
+
+	for _, p := range pending {
+		// a key deleted since it was found has nothing to copy
+		entry, ok := store.GetEntry(p.key)
+		if !ok {
+			continue
+		}
+		for _, n := range p.targets {
+			t, ok := targets[n.ID]
+			if !ok {
+				t = &target{node: n, move: partition.Move{Source: workerID, Target: n.ID}}
+				targets[n.ID] = t
+			}
+			t.batch = append(t.batch, common.EntryOperation{Action: common.SetEntry, Entry: entry})
+			t.size += int64(len(entry.Value))
+			if len(t.batch) >= batchSize {
+				if err := send(t); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	for _, t := range targets {
+		if len(t.batch) > 0 {
+			if err := send(t); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	result := transfers()
+	for _, tr := range result {
+		log.Get().Printf("[%s] COPIED %d keys (%d bytes) to %s in %s", workerID, tr.Keys, tr.Bytes, tr.Target, tr.Duration)
+	}
+	return result, nil
+}
+
+// Drop deletes the keys of the store it does not own in the next
+// placement of the requested assignment, in batches applied one at a
+// time, through a queue of its own so that no copy queued by a
+// migration is applied
+func Drop(workerID string, store store.IStore, req partition.TransferRequest, keepNewer bool) (partition.Transfer, error) {
+	batchSize := req.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	move := partition.Move{Source: workerID}
+	operations := make([]common.EntryOperation, 0)
+	for entry := range store.StreamEntries() {
+		if req.Assignment.Drops(workerID, entry.Key) {
+			operations = append(operations, common.EntryOperation{Action: common.DeleteEntry, Entry: common.Entry{Key: entry.Key}})
+			move.Keys++
+			move.Bytes += int64(len(entry.Value))
+		}
+	}
+
+	start := time.Now()
+	if len(operations) > 0 {
+		queueID := "drop-" + uuid.NewString()
+		defer store.DiscardOperationQueue(queueID)
+		for len(operations) > 0 {
+			n := len(operations)
+			if n > batchSize {
+				n = batchSize
+			}
+			if _, err := store.QueueOperations(queueID, "", operations[:n]); err != nil {
+				return partition.Transfer{}, err
+			}
+			if err := store.ApplyOperations(queueID, keepNewer); err != nil {
+				return partition.Transfer{}, err
+			}
+			operations = operations[n:]
+		}
+	}
+	tr := partition.NewTransfer(move, time.Since(start))
+	log.Get().Printf("[%s] DROPPED %d keys (%d bytes) in %s", workerID, tr.Keys, tr.Bytes, tr.Duration)
+	return tr, nil
+}
+
+// Batches groups operations by the worker they are for, and queues
+// them on it under the same queue ID with Send once a batch is full
+type Batches struct {
+	QueueID string
+	Size    int
+
+	pending map[string][]common.EntryOperation
+}
+
+// NewBatches creates batches of size operations,
+// or of DefaultBatchSize if size is not set
+func NewBatches(queueID string, size int) *Batches {
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	return &Batches{
+		QueueID: queueID,
+		Size:    size,
+		pending: make(map[string][]common.EntryOperation),
+	}
+}
+
+// Add adds an operation to the batch of a worker,
+// sending the batch if it is full
+func (b *Batches) Add(targetURL string, op common.EntryOperation) error {
+	b.pending[targetURL] = append(b.pending[targetURL], op)
+	if len(b.pending[targetURL]) >= b.Size {
+		return b.send(targetURL)
+	}
+	return nil
+}
+
+// Flush sends the batches that are not full yet
+func (b *Batches) Flush() error {
+	for targetURL, operations := range b.pending {
+		if len(operations) == 0 {
+			continue
+		}
+		if err := b.send(targetURL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Batches) send(targetURL string) error {
+	if err := Send(targetURL, b.QueueID, uuid.NewString(), b.pending[targetURL]); err != nil {
+		return err
+	}
+	b.pending[targetURL] = nil
+	return nil
+}
+
+// Send queues a batch of operations on a worker, to be applied when the
+// primary tells it to. A batch that fails is sent again with the
+// same ID, which the worker ignores if it already queued it.
+func Send(targetURL string, queueID string, batchID string, operations []common.EntryOperation) error {
+	body, err := json.Marshal(operations)
+	if err != nil {
+		return err
+	}
+	u := fmt.Sprintf("%s/queue-operations?queue=%s&batch=%s", targetURL, url.QueryEscape(queueID), url.QueryEscape(batchID))
+
+	backoff := time.Millisecond * 100
+	for retry := 0; ; retry++ {
+		err = send(u, body)
+		if err == nil || retry >= sendRetries {
+			break
+		}
+		log.Get().Printf("retrying batch %s to %s: %s", batchID, targetURL, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	if err != nil {
+		return fmt.Errorf("send to %s: %w", targetURL, err)
+	}
+	return nil
+}
+
+func send(u string, body []byte) error {
+	res, err := http.Post(u, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		resBody, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("failed: %s", resBody)
+	}
+	return nil
+}